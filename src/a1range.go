@@ -0,0 +1,66 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matches A1 notation such as "B2", "Stats!B2:G2" or "'My Sheet'!A1:C3"
+var a1RangePattern = regexp.MustCompile(`^(?:(.+)!)?\$?([A-Za-z]+)\$?([0-9]+)(?::\$?([A-Za-z]+)\$?([0-9]+))?$`)
+
+// A1Range is a parsed A1 reference; rows and columns are 1-based and inclusive.
+type A1Range struct {
+	Sheet    string
+	StartRow int
+	StartCol int
+	EndRow   int
+	EndCol   int
+}
+
+func ParseA1Range(a1Range string) (A1Range, bool) {
+	match := a1RangePattern.FindStringSubmatch(a1Range)
+	if match == nil {
+		return A1Range{}, false
+	}
+
+	parsed := A1Range{Sheet: match[1]}
+	if strings.HasPrefix(parsed.Sheet, "'") && strings.HasSuffix(parsed.Sheet, "'") && len(parsed.Sheet) > 1 {
+		parsed.Sheet = strings.ReplaceAll(parsed.Sheet[1:len(parsed.Sheet)-1], "''", "'")
+	}
+
+	parsed.StartCol = a1ColumnNumber(match[2])
+	parsed.StartRow, _ = strconv.Atoi(match[3])
+	if match[4] == "" {
+		// single cell
+		parsed.EndCol, parsed.EndRow = parsed.StartCol, parsed.StartRow
+	} else {
+		parsed.EndCol = a1ColumnNumber(match[4])
+		parsed.EndRow, _ = strconv.Atoi(match[5])
+	}
+
+	if parsed.EndRow < parsed.StartRow {
+		parsed.StartRow, parsed.EndRow = parsed.EndRow, parsed.StartRow
+	}
+	if parsed.EndCol < parsed.StartCol {
+		parsed.StartCol, parsed.EndCol = parsed.EndCol, parsed.StartCol
+	}
+
+	return parsed, true
+}
+
+func A1RangeSize(a1Range string) (rows int, cols int, ok bool) {
+	parsed, ok := ParseA1Range(a1Range)
+	if !ok {
+		return 0, 0, false
+	}
+	return parsed.EndRow - parsed.StartRow + 1, parsed.EndCol - parsed.StartCol + 1, true
+}
+
+func a1ColumnNumber(column string) int {
+	number := 0
+	for _, letter := range strings.ToUpper(column) {
+		number = number*26 + int(letter-'A'+1)
+	}
+	return number
+}
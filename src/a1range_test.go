@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestA1RangeSize(t *testing.T) {
+	tests := []struct {
+		a1Range            string
+		wantRows, wantCols int
+		wantOk             bool
+	}{
+		{"B2", 1, 1, true},
+		{"Stats!B2:G2", 1, 6, true},
+		{"'My Sheet'!A1:C3", 3, 3, true},
+		{"$A$1:$A$4", 4, 1, true},
+		{"AA10:AB11", 2, 2, true},
+		{"C3:A1", 3, 3, true},
+		{"HitPoints", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		rows, cols, ok := A1RangeSize(test.a1Range)
+		if rows != test.wantRows || cols != test.wantCols || ok != test.wantOk {
+			t.Errorf("A1RangeSize(%q) = %d, %d, %v; want %d, %d, %v",
+				test.a1Range, rows, cols, ok, test.wantRows, test.wantCols, test.wantOk)
+		}
+	}
+}
+
+func TestParseA1Range(t *testing.T) {
+	tests := []struct {
+		a1Range string
+		want    A1Range
+	}{
+		{"B2", A1Range{StartRow: 2, StartCol: 2, EndRow: 2, EndCol: 2}},
+		{"Stats!B2:G3", A1Range{Sheet: "Stats", StartRow: 2, StartCol: 2, EndRow: 3, EndCol: 7}},
+		{"'Bob''s Sheet'!A1", A1Range{Sheet: "Bob's Sheet", StartRow: 1, StartCol: 1, EndRow: 1, EndCol: 1}},
+		{"C3:A1", A1Range{StartRow: 1, StartCol: 1, EndRow: 3, EndCol: 3}},
+	}
+
+	for _, test := range tests {
+		got, ok := ParseA1Range(test.a1Range)
+		if !ok || got != test.want {
+			t.Errorf("ParseA1Range(%q) = %+v, %v; want %+v", test.a1Range, got, ok, test.want)
+		}
+	}
+}
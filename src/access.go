@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// the role of requests that present no access token
+const PublicRole = "public"
+
+type AccessToken struct {
+	Token string `json:"token"`
+	Role  string `json:"role"`
+}
+
+// RequestToken is the access token presented with ?token= (for browser sources that can't
+// set headers), as a bearer token, or in an X-API-Key header.
+func RequestToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		return token
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// AccessDeniedMessage says why CharacterRole turned the request away.
+func AccessDeniedMessage(r *http.Request) string {
+	if RequestToken(r) == "" {
+		return "An access token is required."
+	}
+	return "Unknown access token."
+}
+
+// RequestRole finds the role of the request's access token, for requests that aren't about
+// one character. ok is false for an unknown token, or a missing one when requireAccessToken
+// is on.
+func (app *CharacterSheetServiceApp) RequestRole(r *http.Request) (role string, ok bool) {
+	return app.CharacterRole(r, "")
+}
+
+// CharacterRole is RequestRole for a request about one character, whose own access tokens
+// are also accepted, and whose requireAccessToken overrides the global one. Tokens of other
+// characters get the public role, unless this one requires a token.
+func (app *CharacterSheetServiceApp) CharacterRole(r *http.Request, charKey string) (role string, ok bool) {
+	charConfig, configured := app.Characters()[charKey]
+	required := app.Config.RequireAccessToken
+	if configured {
+		required = app.Config.TokenRequired(charConfig)
+	}
+
+	tokens := app.Config.AccessTokens
+	if configured {
+		tokens = append(append([]AccessToken{}, charConfig.AccessTokens...), tokens...)
+	}
+
+	token := RequestToken(r)
+	if token == "" || len(tokens) == 0 {
+		// tokens are ignored when none are configured
+		return PublicRole, !required
+	}
+
+	if role, found := MatchAccessToken(token, tokens); found {
+		return role, true
+	}
+
+	// another character's token, e.g. on a /party or /ws request covering several
+	// characters, only gets what a request without one would
+	if !required && app.KnownAccessToken(token) {
+		return PublicRole, true
+	}
+	return "", false
+}
+
+// MatchAccessToken finds the role of token among tokens.
+func MatchAccessToken(token string, tokens []AccessToken) (role string, found bool) {
+	for _, accessToken := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(accessToken.Token)) == 1 {
+			return accessToken.Role, true
+		}
+	}
+	return "", false
+}
+
+// KnownAccessToken tells whether token is configured anywhere: globally, or for any
+// character. Tokens that aren't are still turned away, so a mistyped one isn't mistaken
+// for no token at all.
+func (app *CharacterSheetServiceApp) KnownAccessToken(token string) bool {
+	if _, found := MatchAccessToken(token, app.Config.AccessTokens); found {
+		return true
+	}
+	for _, charConfig := range app.Characters() {
+		if _, found := MatchAccessToken(token, charConfig.AccessTokens); found {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenRequired tells whether requests for the character need an access token: its own
+// requireAccessToken, or else the global one.
+func (config ServiceConfig) TokenRequired(charConfig ConfigEntry) bool {
+	if charConfig.RequireAccessToken != nil {
+		return *charConfig.RequireAccessToken
+	}
+	return config.RequireAccessToken
+}
+
+// PathCharacterKey is the character a character path is about: /<charKey>,
+// /<charKey>/schema or /<charKey>/attr/<name>. It's "" for anything else.
+func (app *CharacterSheetServiceApp) PathCharacterKey(path string) string {
+	characters := app.Characters()
+	for _, charKey := range []string{
+		path,
+		strings.TrimSuffix(path, "/schema"),
+		strings.SplitN(path, attributePathSeparator, 2)[0],
+	} {
+		if _, configured := characters[charKey]; configured {
+			return charKey
+		}
+	}
+	return ""
+}
+
+// VisibleTo returns the attribute names role may see, or nil if it may see them all.
+func (configEntry ConfigEntry) VisibleTo(role string) map[string]bool {
+	names, restricted := configEntry.Visibility[role]
+	private := map[string]bool{}
+	if role == PublicRole {
+		private = configEntry.PrivateNames()
+	}
+	if !restricted && len(private) == 0 {
+		return nil
+	}
+	if !restricted {
+		names = configEntry.AttributeNames()
+	}
+
+	visible := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !private[name] {
+			visible[name] = true
+		}
+	}
+	return visible
+}
+
+// PrivateNames returns the names of the attributes only requests with an access token see.
+func (configEntry ConfigEntry) PrivateNames() map[string]bool {
+	private := map[string]bool{}
+	for _, attr := range configEntry.Attributes {
+		if attr.Private {
+			for _, name := range attr.AttributeNames() {
+				private[name] = true
+			}
+		}
+	}
+	for _, derived := range configEntry.Derived {
+		if derived.Private {
+			private[derived.Name] = true
+		}
+	}
+	return private
+}
+
+// SelectAttributes narrows visible down to a comma-separated list of attribute names, as
+// given in ?attrs=. Names may be written as configured or in the key style; unknown names
+// are ignored.
+func (configEntry ConfigEntry) SelectAttributes(attrs string, keyStyle string, visible map[string]bool) map[string]bool {
+	requested := map[string]bool{}
+	for _, name := range strings.Split(attrs, ",") {
+		requested[strings.TrimSpace(name)] = true
+	}
+
+	selected := map[string]bool{}
+	for _, name := range configEntry.AttributeNames() {
+		if (visible == nil || visible[name]) && (requested[name] || requested[ApplyKeyStyle(keyStyle, name)]) {
+			selected[name] = true
+		}
+	}
+	return selected
+}
+
+func FilterAttributes(attributes map[string]string, visible map[string]bool) map[string]string {
+	if visible == nil {
+		return attributes
+	}
+
+	filtered := make(map[string]string, len(visible))
+	for name, value := range attributes {
+		if visible[name] {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+func FilterAttributeNames(names []string, visible map[string]bool) []string {
+	if visible == nil {
+		return names
+	}
+
+	filtered := []string{}
+	for _, name := range names {
+		if visible[name] {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+func (configEntry ConfigEntry) ValidateVisibility() error {
+	defined := map[string]bool{}
+	for _, name := range configEntry.AttributeNames() {
+		defined[name] = true
+	}
+
+	// the public role sees a list of everything that isn't private, which can't include
+	// names only read from the sheet
+	if len(configEntry.PrivateNames()) > 0 && configEntry.HasHeaderRanges() {
+		return fmt.Errorf("character '%s': private attributes can't be mixed with headers ranges; use visibility instead",
+			configEntry.CharacterKey)
+	}
+
+	for role, names := range configEntry.Visibility {
+		for _, name := range names {
+			if !defined[name] && !configEntry.HasHeaderRanges() {
+				return fmt.Errorf("character '%s': visibility for role '%s' lists undefined attribute '%s'",
+					configEntry.CharacterKey, role, name)
+			}
+		}
+	}
+	return nil
+}
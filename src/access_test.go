@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoleVisibility(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		bearer     string
+		wantStatus int
+		want       map[string]string
+	}{
+		{
+			name:       "gm sees everything",
+			token:      "gm-secret",
+			wantStatus: http.StatusOK,
+			want:       map[string]string{"hp": "12", "name": "Thorin", "secret": "cursed"},
+		},
+		{
+			name:       "player sees its list",
+			token:      "player-secret",
+			wantStatus: http.StatusOK,
+			want:       map[string]string{"hp": "12", "name": "Thorin"},
+		},
+		{
+			name:       "bearer token",
+			bearer:     "player-secret",
+			wantStatus: http.StatusOK,
+			want:       map[string]string{"hp": "12", "name": "Thorin"},
+		},
+		{
+			name:       "no token is public",
+			wantStatus: http.StatusOK,
+			want:       map[string]string{"name": "Thorin"},
+		},
+		{
+			name:       "unknown token",
+			token:      "nope",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"Thorin"}}, "B4": {{"cursed"}}})
+		app := newTestApp(t, fake, ConfigEntry{
+			CharacterKey: "thorin",
+			SheetId:      "sheet",
+			Attributes: []AttributeRow{
+				{Name: "hp", Range: "B2"},
+				{Name: "name", Range: "B3"},
+				{Name: "secret", Range: "B4"},
+			},
+			Visibility: map[string][]string{
+				"player":   {"hp", "name"},
+				PublicRole: {"name"},
+			},
+		})
+		app.Config.AccessTokens = []AccessToken{
+			{Token: "gm-secret", Role: "gm"},
+			{Token: "player-secret", Role: "player"},
+		}
+		app.PrimeCharacter("thorin")
+
+		path := "/thorin"
+		if test.token != "" {
+			path += "?token=" + test.token
+		}
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if test.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+test.bearer)
+		}
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, r)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		if test.want == nil {
+			continue
+		}
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.name, err)
+		}
+		if got := attributeMap(response); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: attributes = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateVisibility(t *testing.T) {
+	tests := []struct {
+		name       string
+		visibility map[string][]string
+		wantErr    bool
+	}{
+		{"none", nil, false},
+		{"defined attributes", map[string][]string{"player": {"hp"}}, false},
+		{"nothing visible", map[string][]string{PublicRole: {}}, false},
+		{"undefined attribute", map[string][]string{"player": {"gold"}}, true},
+	}
+
+	for _, test := range tests {
+		configEntry := ConfigEntry{
+			CharacterKey: "thorin",
+			Attributes:   []AttributeRow{{Name: "hp", Range: "B2"}},
+			Visibility:   test.visibility,
+		}
+		if err := configEntry.ValidateVisibility(); (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestAccessDeniedResponse(t *testing.T) {
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+	}{
+		{"api client", "application/json", "application/json"},
+		{"browser", "text/html", "text/html"},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.RequireAccessToken = true
+		app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+
+		r := httptest.NewRequest(http.MethodGet, "/thorin", nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", test.name, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, test.wantContentType) {
+			t.Errorf("%s: content type = %q, want %s", test.name, contentType, test.wantContentType)
+		}
+	}
+}
+
+// private attributes are left out of every way a character is served, for requests without
+// an access token
+func TestPrivateAttributes(t *testing.T) {
+	renderTemplate := filepath.Join(t.TempDir(), "thorin.html")
+	if err := ioutil.WriteFile(renderTemplate, []byte(`{{range $name, $value := .Attributes}}{{$name}}={{$value}};{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  map[string]string
+	}{
+		{"no token", "", map[string]string{"name": "Thorin"}},
+		{"gm", "gm-secret", map[string]string{"hp": "12", "name": "Thorin"}},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"Thorin"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", RenderTemplate: renderTemplate,
+			Attributes: []AttributeRow{{Name: "hp", Range: "B2", Private: true}, {Name: "name", Range: "B3"}}})
+		app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+		app.PrimeCharacter("thorin")
+		query := ""
+		if test.token != "" {
+			query = "?token=" + test.token
+		}
+
+		if got := attributeMap(getResponse(t, app, "/thorin"+query)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: JSON attributes = %v, want %v", test.name, got, test.want)
+		}
+
+		w := httptest.NewRecorder()
+		app.HandleParty(w, httptest.NewRequest(http.MethodGet, "/party"+query, nil))
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: party response isn't JSON: %v", test.name, err)
+		}
+		if got := partyAttributes(response.Party["thorin"]); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: party attributes = %v, want %v", test.name, got, test.want)
+		}
+
+		w = httptest.NewRecorder()
+		app.HandleRender(w, httptest.NewRequest(http.MethodGet, "/render/thorin"+query, nil))
+		wantPage := ""
+		for _, name := range []string{"hp", "name"} {
+			if value, found := test.want[name]; found {
+				wantPage += name + "=" + value + ";"
+			}
+		}
+		if page := w.Body.String(); page != wantPage {
+			t.Errorf("%s: rendered page = %q, want %q", test.name, page, wantPage)
+		}
+
+		update := app.NewWebSocketUpdate(httptest.NewRequest(http.MethodGet, "/ws/thorin"+query, nil), "thorin")
+		if got := *update.Attributes.(*map[string]string); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: websocket attributes = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// partyAttributes is a party member's attributes, as decoded from JSON.
+func partyAttributes(member PartyMember) map[string]string {
+	attributes := map[string]string{}
+	decoded, _ := member.Attributes.(map[string]interface{})
+	for name, value := range decoded {
+		attributes[name], _ = value.(string)
+	}
+	return attributes
+}
+
+func TestPartyAccessTokens(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name  string
+		token string
+		want  map[string]map[string]string
+	}{
+		{"no token", "", map[string]map[string]string{
+			"thorin": {"name": "Thorin"},
+			"gimli":  {"name": "Gimli"},
+			"balin":  {"error": "An access token is required."},
+		}},
+		{"global token", "gm-secret", map[string]map[string]string{
+			"thorin": {"hp": "12", "name": "Thorin"},
+			"gimli":  {"hp": "30", "name": "Gimli"},
+			"balin":  {"hp": "9", "name": "Balin"},
+		}},
+		// a player's token shows their own character, and the others as if it weren't there
+		{"thorin's token", "thorin-secret", map[string]map[string]string{
+			"thorin": {"hp": "12", "name": "Thorin"},
+			"gimli":  {"name": "Gimli"},
+			"balin":  {"error": "Unknown access token."},
+		}},
+		{"balin's token", "balin-secret", map[string]map[string]string{
+			"thorin": {"name": "Thorin"},
+			"gimli":  {"name": "Gimli"},
+			"balin":  {"hp": "9", "name": "Balin"},
+		}},
+		{"unknown token", "nope", map[string]map[string]string{
+			"thorin": {"error": "Unknown access token."},
+			"gimli":  {"error": "Unknown access token."},
+			"balin":  {"error": "Unknown access token."},
+		}},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{
+			"B2": {{"12"}}, "B3": {{"Thorin"}}, "C2": {{"30"}}, "C3": {{"Gimli"}}, "D2": {{"9"}}, "D3": {{"Balin"}},
+		})
+		app := newTestApp(t, fake,
+			ConfigEntry{CharacterKey: "thorin", SheetId: "sheet",
+				Attributes:   []AttributeRow{{Name: "hp", Range: "B2", Private: true}, {Name: "name", Range: "B3"}},
+				AccessTokens: []AccessToken{{Token: "thorin-secret", Role: "player"}}},
+			ConfigEntry{CharacterKey: "gimli", SheetId: "sheet",
+				Attributes: []AttributeRow{{Name: "hp", Range: "C2", Private: true}, {Name: "name", Range: "C3"}}},
+			ConfigEntry{CharacterKey: "balin", SheetId: "sheet", RequireAccessToken: &yes,
+				Attributes:   []AttributeRow{{Name: "hp", Range: "D2", Private: true}, {Name: "name", Range: "D3"}},
+				AccessTokens: []AccessToken{{Token: "balin-secret", Role: "player"}}},
+		)
+		app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+		for _, charKey := range []string{"thorin", "gimli", "balin"} {
+			app.PrimeCharacter(charKey)
+		}
+
+		path := "/party?keys=thorin,gimli,balin"
+		if test.token != "" {
+			path += "&token=" + test.token
+		}
+		w := httptest.NewRecorder()
+		app.HandleParty(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.name, err)
+		}
+
+		for charKey, want := range test.want {
+			member := response.Party[charKey]
+			got := partyAttributes(member)
+			if member.Error != "" {
+				got = map[string]string{"error": member.Error}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %s = %v, want %v", test.name, charKey, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Actions are for Stream Deck "Website" buttons and the like, which can only open a URL:
+//
+//	/actions/<charKey>/damage?amount=5    subtract from the attribute, down to 0
+//	/actions/<charKey>/heal?amount=3      add to it, up to its max if one is configured
+//	/actions/<charKey>/set?amount=20      set it
+//
+// The attribute is the character's actions.attribute (hp when left out), or ?attr= for
+// another one. amount defaults to 1. Like other writes they need writeBack and the admin
+// secret, which can be given as ?secret= since buttons can't set headers.
+
+const (
+	ActionDamage = "damage"
+	ActionHeal   = "heal"
+	ActionSet    = "set"
+
+	defaultActionAttribute = "hp"
+)
+
+type ActionsConfig struct {
+	// the attribute actions change when the request doesn't name one; defaults to hp
+	Attribute string `json:"attribute,omitempty"`
+
+	// the attribute holding the most that heal can bring Attribute up to
+	Max string `json:"max,omitempty"`
+}
+
+func (configEntry ConfigEntry) ActionAttribute() string {
+	if configEntry.Actions != nil && configEntry.Actions.Attribute != "" {
+		return configEntry.Actions.Attribute
+	}
+	return defaultActionAttribute
+}
+
+func (configEntry ConfigEntry) ValidateActions() error {
+	if configEntry.Actions == nil {
+		return nil
+	}
+	if name := configEntry.Actions.Attribute; name != "" {
+		if _, writable := configEntry.WritableAttribute(name, ""); !writable {
+			return fmt.Errorf("character '%s': actions attribute '%s' isn't a single value read from the sheet",
+				configEntry.CharacterKey, name)
+		}
+	}
+	if name := configEntry.Actions.Max; name != "" {
+		for _, defined := range configEntry.AttributeNames() {
+			if defined == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("character '%s': actions max refers to undefined attribute '%s'", configEntry.CharacterKey, name)
+	}
+	return nil
+}
+
+// HandleAction serves /actions/<charKey>/<action>, by GET or POST.
+func (app *CharacterSheetServiceApp) HandleAction(w http.ResponseWriter, r *http.Request) {
+	if secret := r.URL.Query().Get("secret"); secret != "" && r.Header.Get("Authorization") == "" {
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+secret)
+	}
+	app.RequireAdmin(app.handleAction)(w, r)
+}
+
+func (app *CharacterSheetServiceApp) handleAction(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		// Actions are GET or POST - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusMethodNotAllowed, "Actions must be GET or POST requests."),
+		})
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(requestPath, "/actions/"), "/")
+	split := strings.LastIndex(path, "/")
+	if split < 0 {
+		// No action given - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				"Actions are served at /actions/<characterKey>/<damage|heal|set>."),
+		})
+		return
+	}
+	charKey, action := path[:split], path[split+1:]
+	if action != ActionDamage && action != ActionHeal && action != ActionSet {
+		// Unknown action - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				fmt.Sprintf("Unknown action '%s'; must be damage, heal or set.", action)),
+		})
+		return
+	}
+
+	charConfig, ok := app.WritableCharacter(w, r, charKey)
+	if !ok {
+		return
+	}
+
+	amount := 1.0
+	if amountParam := r.URL.Query().Get("amount"); amountParam != "" {
+		parsed, err := strconv.ParseFloat(amountParam, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) || (action != ActionSet && parsed < 0) {
+			// Bad amount - 400 Bad Request error
+			app.WriteApiResponse(w, r, ApiResponse{
+				Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+					fmt.Sprintf("Invalid amount '%s'; must be a number, and not negative.", amountParam)),
+			})
+			return
+		}
+		amount = parsed
+	}
+
+	name := r.URL.Query().Get("attr")
+	if name == "" {
+		name = charConfig.ActionAttribute()
+	}
+	attr, writable := charConfig.WritableAttribute(name, app.Config.KeyStyle)
+	if !writable {
+		// Unknown or read-only attribute - 400 Bad Request error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+				fmt.Sprintf("Attribute '%s' doesn't exist, or can't be written.", name)),
+		})
+		return
+	}
+
+	switch action {
+	case ActionDamage:
+		app.AdjustAndRespond(w, r, charKey, charConfig, attr, -amount, 0.0, nil)
+	case ActionHeal:
+		var max interface{}
+		if charConfig.Actions != nil && charConfig.Actions.Max != "" {
+			max = charConfig.Actions.Max
+		}
+		app.AdjustAndRespond(w, r, charKey, charConfig, attr, amount, nil, max)
+	case ActionSet:
+		unlock := app.LockCharacterWrites(charKey)
+		defer unlock()
+
+		written := strconv.FormatFloat(amount, 'f', -1, 64)
+		log.Printf("--- action: set '%s' %s to %s", charKey, attr.Name, written)
+		data := []*sheets.ValueRange{{Range: attr.Range, Values: [][]interface{}{{written}}}}
+		app.WriteAndRespond(w, r, charKey, charConfig, data)
+	}
+}
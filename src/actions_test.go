@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleAction(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		secret     string
+		wantStatus int
+		wantWrite  string
+	}{
+		// buttons can only open a URL, so GET with ?secret= is how they're used
+		{"secret in the query", http.MethodGet, "/actions/thorin/damage?amount=5&secret=s3cret", "", http.StatusOK, "7"},
+		{"secret as a bearer token", http.MethodPost, "/actions/thorin/damage?amount=5", "s3cret", http.StatusOK, "7"},
+		{"wrong secret in the query", http.MethodGet, "/actions/thorin/damage?amount=5&secret=guess", "", http.StatusUnauthorized, ""},
+		{"no secret", http.MethodGet, "/actions/thorin/damage?amount=5", "", http.StatusUnauthorized, ""},
+		{"header wins over the query", http.MethodPost, "/actions/thorin/damage?secret=s3cret", "guess", http.StatusUnauthorized, ""},
+		{"not GET or POST", http.MethodDelete, "/actions/thorin/damage", "s3cret", http.StatusMethodNotAllowed, ""},
+
+		{"damage defaults to 1", http.MethodPost, "/actions/thorin/damage", "s3cret", http.StatusOK, "11"},
+		{"damage stops at 0", http.MethodPost, "/actions/thorin/damage?amount=50", "s3cret", http.StatusOK, "0"},
+		{"heal", http.MethodPost, "/actions/thorin/heal?amount=3", "s3cret", http.StatusOK, "15"},
+		{"heal stops at max", http.MethodPost, "/actions/thorin/heal?amount=50", "s3cret", http.StatusOK, "30"},
+		{"set", http.MethodPost, "/actions/thorin/set?amount=20", "s3cret", http.StatusOK, "20"},
+		{"set may be negative", http.MethodPost, "/actions/thorin/set?amount=-2", "s3cret", http.StatusOK, "-2"},
+		{"another attribute", http.MethodPost, "/actions/thorin/set?amount=3&attr=gold", "s3cret", http.StatusOK, "3"},
+
+		{"negative damage", http.MethodPost, "/actions/thorin/damage?amount=-5", "s3cret", http.StatusBadRequest, ""},
+		{"negative heal", http.MethodPost, "/actions/thorin/heal?amount=-5", "s3cret", http.StatusBadRequest, ""},
+		{"not a number", http.MethodPost, "/actions/thorin/damage?amount=lots", "s3cret", http.StatusBadRequest, ""},
+		{"infinite", http.MethodPost, "/actions/thorin/set?amount=Inf", "s3cret", http.StatusBadRequest, ""},
+		{"read-only attribute", http.MethodPost, "/actions/thorin/set?amount=3&attr=race", "s3cret", http.StatusBadRequest, ""},
+
+		{"no action", http.MethodPost, "/actions/thorin", "s3cret", http.StatusNotFound, ""},
+		{"unknown action", http.MethodPost, "/actions/thorin/smite", "s3cret", http.StatusNotFound, ""},
+		{"unknown character", http.MethodPost, "/actions/smaug/damage", "s3cret", http.StatusNotFound, ""},
+
+		// the action is after the last slash, so campaign keys keep theirs
+		{"campaign character", http.MethodPost, "/actions/moria/balin/damage?amount=2", "s3cret", http.StatusOK, "7"},
+		{"campaign only", http.MethodPost, "/actions/moria/damage", "s3cret", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"30"}}, "B4": {{"0"}}, "C2": {{"9"}}})
+		app := newTestApp(t, fake,
+			ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Actions: &ActionsConfig{Max: "maxHp"}, Attributes: []AttributeRow{
+				{Name: "hp", Range: "B2"},
+				{Name: "maxHp", Range: "B3"},
+				{Name: "gold", Range: "B4"},
+				{Name: "race", Value: stringPointer("Dwarf")},
+			}},
+			ConfigEntry{CharacterKey: "moria/balin", Campaign: "moria", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "C2"}}},
+		)
+		app.Config.WriteBack = true
+		app.Config.AdminSecret = "s3cret"
+		app.PrimeCharacter("thorin")
+		app.PrimeCharacter("moria/balin")
+
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.secret != "" {
+			r.Header.Set("Authorization", "Bearer "+test.secret)
+		}
+		w := httptest.NewRecorder()
+		app.HandleAction(w, r)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		writes := fake.Writes()
+		if test.wantWrite == "" {
+			if len(writes) > 0 {
+				t.Errorf("%s: wrote %v, want no write", test.name, writes[0].Values)
+			}
+			continue
+		}
+		if len(writes) != 1 || writes[0].Values[0][0] != test.wantWrite {
+			t.Errorf("%s: writes = %d, want one of %q", test.name, len(writes), test.wantWrite)
+		}
+	}
+}
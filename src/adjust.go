@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+const adjustPathSuffix = "/adjust"
+
+// AdjustRequest is the body of POST /<charKey>/attr/<name>/adjust. Min and Max are each a
+// number, or the name of an attribute holding one, such as maxHp.
+type AdjustRequest struct {
+	Delta *float64    `json:"delta"`
+	Min   interface{} `json:"min,omitempty"`
+	Max   interface{} `json:"max,omitempty"`
+}
+
+// IsAdjustPath tells whether a path is /<charKey>/attr/<name>/adjust.
+func IsAdjustPath(path string) bool {
+	return strings.HasSuffix(path, adjustPathSuffix) && strings.Contains(path, attributePathSeparator)
+}
+
+// HandleAdjust adds a signed delta to a number on the sheet. Unlike writing the new value,
+// two people adjusting at once both count: the cell is read from the sheet rather than the
+// cache, and adjustments to a character are made one at a time.
+func (app *CharacterSheetServiceApp) HandleAdjust(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+
+	if r.Method != http.MethodPost {
+		// Adjustments are POSTed - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusMethodNotAllowed, "Adjustments must be POST requests."),
+		})
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimSuffix(strings.Trim(requestPath, "/"), adjustPathSuffix), attributePathSeparator, 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		// No character or attribute in the path - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			CharacterUrls: app.ValidUrls(),
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				"Adjustments are POSTed to /<characterKey>/attr/<name>/adjust."),
+		})
+		return
+	}
+	charKey, name := parts[0], parts[1]
+	charConfig, ok := app.WritableCharacter(w, r, charKey)
+	if !ok {
+		return
+	}
+
+	var adjust AdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&adjust); err != nil || adjust.Delta == nil {
+		// Unreadable body - 400 Bad Request error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+				`The body must be a JSON object like {"delta": -5, "min": 0, "max": "maxHp"}.`),
+		})
+		return
+	}
+
+	attr, writable := charConfig.WritableAttribute(name, app.Config.KeyStyle)
+	if !writable {
+		// Unknown or read-only attribute - 400 Bad Request error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+				fmt.Sprintf("Attribute '%s' doesn't exist, or can't be written.", name)),
+		})
+		return
+	}
+
+	app.AdjustAndRespond(w, r, charKey, charConfig, attr, *adjust.Delta, adjust.Min, adjust.Max)
+}
+
+// LockCharacterWrites holds off other writes to the character until the returned function
+// is called. The locks are only per process: instances sharing a redis cache each have
+// their own, so adjustments made through different instances at once can still collide.
+func (app *CharacterSheetServiceApp) LockCharacterWrites(charKey string) func() {
+	lock, _ := app.writeLocks.LoadOrStore(charKey, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// AdjustAndRespond reads attr from the sheet, adds delta, and writes the result back. The
+// bounds only keep the adjustment from crossing them; a value already beyond one is never
+// moved back to it.
+func (app *CharacterSheetServiceApp) AdjustAndRespond(w http.ResponseWriter, r *http.Request, charKey string, charConfig ConfigEntry,
+	attr AttributeRow, delta float64, min interface{}, max interface{}) {
+	requestPath := r.URL.Path
+
+	if math.IsNaN(delta) || math.IsInf(delta, 0) {
+		// Not a usable delta - 400 Bad Request error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadRequest, "The delta must be a finite number."),
+		})
+		return
+	}
+
+	bounds := [2]*float64{}
+	for i, bound := range []interface{}{min, max} {
+		value, err := app.AdjustBound(r.Context(), charKey, bound)
+		if err != nil {
+			// Unusable bound - 400 Bad Request error
+			app.WriteApiResponse(w, r, ApiResponse{
+				Metadata: NewMetadata(requestPath, http.StatusBadRequest, fmt.Sprintf("Invalid %s: %v", []string{"min", "max"}[i], err)),
+			})
+			return
+		}
+		bounds[i] = value
+	}
+
+	unlock := app.LockCharacterWrites(charKey)
+	defer unlock()
+
+	cell, cellRange, err := app.ReadCell(r.Context(), charConfig, attr)
+	if err != nil {
+		// Sheets read failed - 502 Bad Gateway error
+		log.Printf("Unable to read '%s' of '%s' to adjust it: %v", attr.Name, charKey, err)
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadGateway, fmt.Sprintf("Unable to read the sheet: %v", err)),
+		})
+		return
+	}
+
+	current, isNumber := 0.0, true
+	if strings.TrimSpace(cell) != "" {
+		current, isNumber = ParseTypedNumber(cell)
+	}
+	if !isNumber {
+		// Nothing to add to - 409 Conflict error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusConflict,
+				fmt.Sprintf("Attribute '%s' of '%s' is '%s', which isn't a number.", attr.Name, charKey, cell)),
+		})
+		return
+	}
+
+	value := current + delta
+	if min := bounds[0]; min != nil && value < *min && value < current {
+		value = math.Min(*min, current)
+	}
+	if max := bounds[1]; max != nil && value > *max && value > current {
+		value = math.Max(*max, current)
+	}
+
+	written := strconv.FormatFloat(math.Round(value*1e9)/1e9, 'f', -1, 64)
+	log.Printf("--- adjust: '%s' %s %+g: %s -> %s", charKey, attr.Name, delta, CellString(current), written)
+	data := []*sheets.ValueRange{{Range: cellRange, Values: [][]interface{}{{written}}}}
+	app.WriteAndRespond(w, r, charKey, charConfig, data)
+}
+
+// AdjustBound reads a bound of an adjustment: nil, a number, or the name of an attribute
+// whose cached value is used.
+func (app *CharacterSheetServiceApp) AdjustBound(ctx context.Context, charKey string, bound interface{}) (*float64, error) {
+	switch bound := bound.(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		return &bound, nil
+	case string:
+		if number, isNumber := ParseTypedNumber(bound); isNumber {
+			return &number, nil
+		}
+		entry, found := app.LookupCharacter(ctx, charKey)
+		if !found || entry.Attributes == nil {
+			return nil, fmt.Errorf("'%s' has no attributes yet", charKey)
+		}
+		value, found := entry.RawAttributes[bound]
+		if !found {
+			value, found = (*entry.Attributes)[bound]
+		}
+		if !found {
+			return nil, fmt.Errorf("no attribute '%s'", bound)
+		}
+		number, isNumber := ParseTypedNumber(value)
+		if !isNumber {
+			return nil, fmt.Errorf("attribute '%s' is '%s', which isn't a number", bound, value)
+		}
+		return &number, nil
+	default:
+		return nil, fmt.Errorf("must be a number or an attribute name")
+	}
+}
+
+// ReadCell reads the top-left cell of an attribute's range straight from the sheet,
+// unformatted, along with the range it's in now, named ranges being resolved.
+func (app *CharacterSheetServiceApp) ReadCell(ctx context.Context, charConfig ConfigEntry, attr AttributeRow) (string, string, error) {
+	attr.ValueRenderOption = "UNFORMATTED_VALUE"
+	single := charConfig
+	single.Attributes = []AttributeRow{attr}
+	if single.HasNamedRanges() {
+		if layout, err := app.FetchSheetLayout(ctx, single.SheetId); err == nil {
+			single, _ = layout.ResolveRanges(single)
+		}
+	}
+	cellRange := single.Attributes[0].Range
+	if cellRange == "" {
+		return "", "", fmt.Errorf("named range '%s' isn't in the sheet", attr.Range)
+	}
+
+	valueRanges, err := app.BatchGetValueRanges(ctx, single)
+	if err != nil {
+		return "", "", err
+	}
+	values := valueRanges[0].Values
+	if len(values) == 0 || len(values[0]) == 0 {
+		return "", cellRange, nil
+	}
+	return CellString(values[0][0]), cellRange, nil
+}
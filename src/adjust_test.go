@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleAdjustPaths(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"no attribute", "/thorin/attr/adjust", http.StatusNotFound},
+		{"no character", "/attr/hp/adjust", http.StatusNotFound},
+		{"no separator", "/thorin/adjust", http.StatusNotFound},
+		{"unknown character", "/smaug/attr/hp/adjust", http.StatusNotFound},
+		{"unknown attribute", "/thorin/attr/gold/adjust", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.WriteBack = true
+
+		w := httptest.NewRecorder()
+		app.HandleAdjust(w, httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(`{"delta": -5}`)))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+	}
+}
+
+func TestHandleWriteBackWaitsForAdjustments(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.Config.WriteBack = true
+
+	unlock := app.LockCharacterWrites("thorin")
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		app.HandleWriteBack(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/thorin", strings.NewReader(`{"hp": "7"}`)))
+	}()
+
+	select {
+	case <-written:
+		t.Fatalf("write went ahead while the character's writes were locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("write didn't go ahead once the lock was released")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type CacheSnapshotEntry struct {
+	Attributes *map[string]string `json:"attributes"`
+	Expires    time.Time          `json:"expires"`
+	Expired    bool               `json:"expired"`
+	Updating   bool               `json:"updating"`
+	Truncated  bool               `json:"truncated,omitempty"`
+
+	LastAccessed *time.Time `json:"lastAccessed,omitempty"`
+
+	// how the last fetch went
+	FetchFailed         bool                 `json:"fetchFailed,omitempty"`
+	Stale               bool                 `json:"stale,omitempty"`
+	FetchError          string               `json:"fetchError,omitempty"`
+	ConsecutiveFailures int                  `json:"consecutiveFailures,omitempty"`
+	AttributeErrors     map[string]string    `json:"attributeErrors,omitempty"`
+	RangeExpires        map[string]time.Time `json:"rangeExpires,omitempty"`
+}
+
+// RequireAdmin guards admin endpoints with the configured adminSecret, presented as a
+// bearer token. Admin endpoints are disabled entirely when no secret is configured.
+func (app *CharacterSheetServiceApp) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Config.AdminSecret == "" {
+			// Admin disabled - 404 Not Found error
+			WriteApiResponseJson(w, ApiResponse{
+				Metadata: NewMetadata(r.URL.Path, http.StatusNotFound,
+					"Admin endpoints are disabled; set adminSecret in config.json to enable them."),
+			})
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(app.Config.AdminSecret)) != 1 {
+			// Missing or wrong secret - 401 Unauthorized error
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			WriteApiResponseJson(w, ApiResponse{
+				Metadata: NewMetadata(r.URL.Path, http.StatusUnauthorized,
+					"Admin endpoints require 'Authorization: Bearer <adminSecret>'."),
+			})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (app *CharacterSheetServiceApp) HandleAdminCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		// Not GET - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	WriteApiResponseJson(w, ApiResponse{
+		Cache:    app.CacheSnapshot(),
+		Metadata: NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
+
+// HandleAdminReloadCredentials re-reads the credentials and swaps in a new Sheets client,
+// leaving the cache intact so a rotated key doesn't cost a cold start.
+func (app *CharacterSheetServiceApp) HandleAdminReloadCredentials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// Not POST - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use POST for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	if app.DemoAttributes != nil {
+		// Demo mode has no credentials - 409 Conflict error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusConflict,
+				"Running in demo mode; there are no credentials to reload."),
+		})
+		return
+	}
+
+	googleSheetService, err := LoadGoogleSheetService()
+	if err != nil {
+		// Keep serving with the old credentials - 500 Internal Server Error
+		log.Printf("Unable to reload credentials: %v", err)
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusInternalServerError,
+				fmt.Sprintf("Unable to reload credentials; still using the previous ones. %v", err)),
+		})
+		return
+	}
+
+	if app.Config.SkipUnchangedSheets {
+		driveService, err := LoadGoogleDriveService()
+		if err != nil {
+			log.Printf("Unable to reload Drive credentials: %v", err)
+			WriteApiResponseJson(w, ApiResponse{
+				Metadata: NewMetadata(r.URL.Path, http.StatusInternalServerError,
+					fmt.Sprintf("Unable to reload credentials; still using the previous ones. %v", err)),
+			})
+			return
+		}
+		app.SetDriveService(driveService)
+	}
+
+	app.SetSheetService(googleSheetService)
+	log.Println("  * reloaded credentials")
+
+	WriteApiResponseJson(w, ApiResponse{
+		Metadata: NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
+
+// CacheSnapshot describes the cache entry of each of charKeys, or of every character when
+// none are given.
+func (app *CharacterSheetServiceApp) CacheSnapshot(charKeys ...string) map[string]CacheSnapshotEntry {
+	now := time.Now()
+	if len(charKeys) == 0 {
+		charKeys = app.PrimingOrder()
+	}
+	snapshot := make(map[string]CacheSnapshotEntry, len(charKeys))
+
+	for _, charKey := range charKeys {
+		entry, found := app.Cache.Get(charKey)
+		if !found {
+			continue
+		}
+		snapshotEntry := CacheSnapshotEntry{
+			Attributes: entry.Attributes,
+			Expires:    entry.Expires,
+			Expired:    now.After(entry.Expires),
+			Updating:   entry.UpdatingFlag,
+			Truncated:  entry.Truncated,
+
+			FetchFailed:         entry.FetchFailed,
+			Stale:               entry.Stale,
+			FetchError:          entry.FetchError,
+			ConsecutiveFailures: entry.ConsecutiveFailures,
+			AttributeErrors:     entry.AttributeErrors,
+			RangeExpires:        entry.RangeExpires,
+		}
+		if lastAccessed, tracked := app.IdleTracker.LastAccessed(charKey); tracked {
+			snapshotEntry.LastAccessed = &lastAccessed
+		}
+		snapshot[charKey] = snapshotEntry
+	}
+
+	return snapshot
+}
+
+// HandleAdminCacheCharacter serves POST /admin/cache/<charKey>/invalidate, which fetches the
+// character again right away, whatever its TTLs, and responds once that's done. The old
+// values are served until then.
+func (app *CharacterSheetServiceApp) HandleAdminCacheCharacter(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/cache/"), "/")
+	if !strings.HasSuffix(path, "/invalidate") {
+		// Unknown admin path - 404 Not Found error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusNotFound,
+				"Unknown cache endpoint; use POST /admin/cache/<characterKey>/invalidate."),
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		// Not POST - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use POST for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	charKey := strings.TrimSuffix(path, "/invalidate")
+	if _, configured := app.Characters()[charKey]; !configured {
+		// Result not found - 404 Not Found error
+		WriteApiResponseJson(w, ApiResponse{
+			CharacterUrls: app.ValidUrls(),
+			Metadata: NewMetadata(r.URL.Path, http.StatusNotFound,
+				fmt.Sprintf("No character '%s' found; see list of valid character paths in the payload.", charKey)),
+		})
+		return
+	}
+
+	log.Printf("-- invalidating '%s'", charKey)
+	app.waitForInvalidations(w, r, []string{charKey})
+}
+
+// HandleAdminRefreshAll serves POST /admin/refresh-all, which invalidates every character
+// at once.
+func (app *CharacterSheetServiceApp) HandleAdminRefreshAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// Not POST - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use POST for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	log.Println("-- refreshing every character")
+	app.waitForInvalidations(w, r, app.PrimingOrder())
+}
+
+// waitForInvalidations invalidates the characters and responds with their cache entries
+// once they've all been fetched again.
+func (app *CharacterSheetServiceApp) waitForInvalidations(w http.ResponseWriter, r *http.Request, charKeys []string) {
+	done := make([]<-chan struct{}, len(charKeys))
+	for i, charKey := range charKeys {
+		done[i] = app.InvalidateCharacter(charKey)
+	}
+
+	for _, fetched := range done {
+		select {
+		case <-fetched:
+		case <-r.Context().Done():
+			// the client gave up; the fetches carry on regardless
+			return
+		}
+	}
+
+	WriteApiResponseJson(w, ApiResponse{
+		Cache:    app.CacheSnapshot(charKeys...),
+		Metadata: NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
+
+// InvalidateCharacter starts fetching the character again in full, as though every range
+// had expired and the sheet had changed.
+func (app *CharacterSheetServiceApp) InvalidateCharacter(charKey string) <-chan struct{} {
+	if entry, found := app.Cache.Get(charKey); found && entry.Attributes != nil {
+		expired := *entry
+		expired.Expires = time.Time{}
+		expired.RangeExpires = nil
+		expired.ModifiedTime = ""
+		app.Cache.Set(charKey, &expired)
+	}
+	return app.RefreshInBackground(context.Background(), charKey)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// adminRequest makes a request to an admin handler with the given bearer token.
+func adminRequest(handler http.HandlerFunc, method string, path string, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestRequireAdmin(t *testing.T) {
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake)
+	handler := app.RequireAdmin(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	tests := []struct {
+		name        string
+		adminSecret string
+		token       string
+		wantStatus  int
+	}{
+		{"disabled", "", "", http.StatusNotFound},
+		{"disabled ignores tokens", "", "anything", http.StatusNotFound},
+		{"no token", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "guess", http.StatusUnauthorized},
+		{"right token", "s3cret", "s3cret", http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		app.Config.AdminSecret = test.adminSecret
+		if w := adminRequest(handler, http.MethodGet, "/admin/cache", test.token); w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+	}
+}
+
+func TestAdminCacheSnapshot(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"30"}}})
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+		ConfigEntry{CharacterKey: "gimli", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B3"}}},
+		ConfigEntry{CharacterKey: "balin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B3"}}})
+	app.Config.AdminSecret = "s3cret"
+	app.PrimeCharacter("thorin")
+	app.PrimeCharacter("gimli")
+
+	// gimli's entry has expired, and a refresh of it is under way
+	expired := NewCachedEntry(&map[string]string{"hp": "30"}, defaultCacheTtl)
+	expired.Expires = time.Now().Add(-time.Minute)
+	app.Cache.Set("gimli", expired)
+	app.Cache.MarkUpdating("gimli")
+
+	w := adminRequest(app.RequireAdmin(app.HandleAdminCache), http.MethodGet, "/admin/cache", "s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var response ApiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+
+	tests := []struct {
+		charKey      string
+		wantHp       string
+		wantExpired  bool
+		wantUpdating bool
+	}{
+		{"thorin", "12", false, false},
+		{"gimli", "30", true, true},
+	}
+	for _, test := range tests {
+		entry, found := response.Cache[test.charKey]
+		if !found {
+			t.Errorf("%s missing from the snapshot", test.charKey)
+			continue
+		}
+		if hp := (*entry.Attributes)["hp"]; hp != test.wantHp {
+			t.Errorf("%s: hp = %q, want %q", test.charKey, hp, test.wantHp)
+		}
+		if entry.Expired != test.wantExpired || entry.Updating != test.wantUpdating {
+			t.Errorf("%s: expired, updating = %v, %v; want %v, %v",
+				test.charKey, entry.Expired, entry.Updating, test.wantExpired, test.wantUpdating)
+		}
+		if entry.Expires.IsZero() {
+			t.Errorf("%s: no expiry in the snapshot", test.charKey)
+		}
+	}
+	if _, found := response.Cache["balin"]; found {
+		t.Errorf("unprimed balin is in the snapshot")
+	}
+
+	if w := adminRequest(app.RequireAdmin(app.HandleAdminCache), http.MethodPost, "/admin/cache", "s3cret"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", w.Code)
+	}
+}
+
+// chdir switches to dir for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestSetSheetService(t *testing.T) {
+	oldFake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, oldFake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+
+	newFake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"7"}}})
+	app.SetSheetService(newFake.Service(t))
+	app.FetchCharacterAttributes(context.Background(), "thorin")
+
+	if got := len(oldFake.Requests()); got != 1 {
+		t.Errorf("old service got %d requests, want 1", got)
+	}
+	if got := len(newFake.Requests()); got != 1 {
+		t.Errorf("new service got %d requests, want 1", got)
+	}
+	// the cache carried over the swap
+	if entry, _ := app.Cache.Get("thorin"); (*entry.Attributes)["hp"] != "7" {
+		t.Errorf("hp = %q after the swap, want 7", (*entry.Attributes)["hp"])
+	}
+}
+
+func TestHandleAdminReloadCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		demo       bool
+		apiKey     string
+		wantStatus int
+	}{
+		{"not POST", http.MethodGet, false, `{"apiKey": "new-key"}`, http.StatusMethodNotAllowed},
+		{"demo mode", http.MethodPost, true, `{"apiKey": "new-key"}`, http.StatusConflict},
+		{"missing key file", http.MethodPost, false, "", http.StatusInternalServerError},
+		{"invalid key file", http.MethodPost, false, `{"apiKey": `, http.StatusInternalServerError},
+		{"reloaded", http.MethodPost, false, `{"apiKey": "new-key"}`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		if test.apiKey != "" {
+			if err := ioutil.WriteFile(filepath.Join(dir, "api-key.json"), []byte(test.apiKey), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		chdir(t, dir)
+
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		if test.demo {
+			app.DemoAttributes = map[string]map[string]string{}
+		}
+		oldService := app.SheetService()
+
+		w := adminRequest(app.HandleAdminReloadCredentials, test.method, "/admin/reload-credentials", "")
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.name, err)
+		}
+		if response.Metadata.StatusCode != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, response.Metadata.StatusCode, test.wantStatus)
+		}
+		if swapped := app.SheetService() != oldService; swapped != (test.wantStatus == http.StatusOK) {
+			t.Errorf("%s: sheet service swapped = %v", test.name, swapped)
+		}
+	}
+}
+
+func TestHandleAdminReloadGlobals(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		wantStatus int
+		wantKeys   []string
+	}{
+		{"characters only", `{"characters": [{"characterKey": "gimli", "sheetId": "sheet", "attributes": [{"name": "hp", "range": "B2"}]}]}`,
+			http.StatusOK, []string{"gimli"}},
+		{"changed globals", `{"keyStyle": "snake", "characters": [{"characterKey": "gimli", "sheetId": "sheet", "attributes": [{"name": "hp", "range": "B2"}]}]}`,
+			http.StatusOK, []string{"gimli"}},
+		// valid with the file's own tokens, but the running service has none
+		{"needs new globals", `{"accessTokens": [{"token": "gm-secret", "role": "gm"}], "characters": [{"characterKey": "gimli", "sheetId": "sheet", "requireAccessToken": true, "attributes": [{"name": "hp", "range": "B2"}]}]}`,
+			http.StatusBadRequest, []string{"thorin"}},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := ioutil.WriteFile(path, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		captureLog(t)
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.configFile = path
+
+		w := adminRequest(app.HandleAdminReload, http.MethodPost, "/admin/reload", "")
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		if keys := app.PrimingOrder(); !reflect.DeepEqual(keys, test.wantKeys) {
+			t.Errorf("%s: characters = %v, want %v", test.name, keys, test.wantKeys)
+		}
+		if app.Config.KeyStyle != "" {
+			t.Errorf("%s: keyStyle = %q, want the running one", test.name, app.Config.KeyStyle)
+		}
+	}
+}
+
+func TestAdminInvalidate(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"30"}}})
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+		ConfigEntry{CharacterKey: "gimli", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B3"}}})
+	app.Config.AdminSecret = "s3cret"
+	app.PrimeCharacter("thorin")
+	app.PrimeCharacter("gimli")
+	handler := app.RequireAdmin(app.HandleAdminCacheCharacter)
+
+	// both changed in the sheet, well before their TTLs are up
+	fake.lock.Lock()
+	fake.values["B2"], fake.values["B3"] = [][]interface{}{{"5"}}, [][]interface{}{{"25"}}
+	fake.lock.Unlock()
+
+	w := adminRequest(handler, http.MethodPost, "/admin/cache/thorin/invalidate", "s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var response ApiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+	if entry, found := response.Cache["thorin"]; !found || (*entry.Attributes)["hp"] != "5" {
+		t.Errorf("thorin's entry in the response = %+v, want hp 5", entry)
+	}
+	if _, found := response.Cache["gimli"]; found {
+		t.Errorf("gimli is in the response")
+	}
+	if hp := attributeMap(getResponse(t, app, "/gimli"))["hp"]; hp != "30" {
+		t.Errorf("gimli's hp = %q, want 30 until its TTL is up", hp)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"no token", http.MethodPost, "/admin/cache/thorin/invalidate", "", http.StatusUnauthorized},
+		{"GET", http.MethodGet, "/admin/cache/thorin/invalidate", "s3cret", http.StatusMethodNotAllowed},
+		{"unknown character", http.MethodPost, "/admin/cache/balin/invalidate", "s3cret", http.StatusNotFound},
+		{"unknown endpoint", http.MethodPost, "/admin/cache/thorin", "s3cret", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if w := adminRequest(handler, test.method, test.path, test.token); w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+	}
+}
+
+func TestAdminRefreshAll(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"30"}}})
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+		ConfigEntry{CharacterKey: "gimli", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B3"}}})
+	app.Config.AdminSecret = "s3cret"
+	// gimli was never primed, and is fetched all the same
+	app.PrimeCharacter("thorin")
+	handler := app.RequireAdmin(app.HandleAdminRefreshAll)
+
+	fake.lock.Lock()
+	fake.values["B2"] = [][]interface{}{{"5"}}
+	fake.lock.Unlock()
+
+	w := adminRequest(handler, http.MethodPost, "/admin/refresh-all", "s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var response ApiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+	got := map[string]string{}
+	for charKey, entry := range response.Cache {
+		got[charKey] = (*entry.Attributes)["hp"]
+	}
+	if want := map[string]string{"thorin": "5", "gimli": "30"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hp in the response = %v, want %v", got, want)
+	}
+
+	if w := adminRequest(handler, http.MethodGet, "/admin/refresh-all", "s3cret"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", w.Code)
+	}
+
+	// a client that gives up gets no response, but the fetch carries on
+	hold := make(chan struct{})
+	fake.lock.Lock()
+	fake.hold = hold
+	fake.values["B2"] = [][]interface{}{{"3"}}
+	fake.lock.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodPost, "/admin/refresh-all", nil).WithContext(ctx)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Body.Len() != 0 {
+		t.Errorf("responded %q to a client that gave up", w.Body.String())
+	}
+	fake.lock.Lock()
+	fake.hold = nil
+	fake.lock.Unlock()
+	close(hold)
+	waitFor(t, func() bool {
+		entry, found := app.Cache.Get("thorin")
+		return found && (*entry.Attributes)["hp"] == "3"
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// environment variable holding the Airtable access token, which overrides airtableToken
+const airtableTokenEnv = "AIRTABLE_TOKEN"
+
+var airtableApiUrl = "https://api.airtable.com/v0"
+
+var airtableClient = &http.Client{Timeout: 10 * time.Second}
+
+// AirtableConfig points a character at one record of an Airtable table, instead of a
+// Google Sheet. Each attribute's range is the name of the field it's read from.
+type AirtableConfig struct {
+	BaseId string `json:"baseId"`
+	Table  string `json:"table"`
+
+	// the character's record, by ID, or the first record matching a formula such as
+	// {Name} = 'Rowan'
+	RecordId        string `json:"recordId,omitempty"`
+	FilterByFormula string `json:"filterByFormula,omitempty"`
+}
+
+func (config AirtableConfig) Validate() error {
+	if config.BaseId == "" || config.Table == "" {
+		return fmt.Errorf("airtable needs a baseId and a table")
+	}
+	if (config.RecordId == "") == (config.FilterByFormula == "") {
+		return fmt.Errorf("airtable needs either a recordId or a filterByFormula")
+	}
+	return nil
+}
+
+// AirtableDataSource reads characters that have an airtable config.
+type AirtableDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+type airtableRecord struct {
+	Id     string                     `json:"id"`
+	Fields map[string]json.RawMessage `json:"fields"`
+}
+
+type airtableError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (config ServiceConfig) AirtableAccessToken() string {
+	if token := os.Getenv(airtableTokenEnv); token != "" {
+		return token
+	}
+	return config.AirtableToken
+}
+
+func (source AirtableDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	record, err := source.FetchRecord(ctx, *charConfig.Airtable)
+	if err != nil {
+		return FetchedAttributes{}, err
+	}
+
+	fetched := NewFetchedAttributes()
+	for _, attr := range charConfig.Attributes {
+		// fields that are empty are left out of the record altogether
+		field, found := record.Fields[attr.Range]
+		if !found {
+			continue
+		}
+		cells, err := AirtableFieldCells(field)
+		if err != nil {
+			fetched.Errors[attr.Name] = fmt.Sprintf("field '%s': %v", attr.Range, err)
+			continue
+		}
+
+		fetched.SetCells(attr, cells)
+	}
+
+	return fetched, nil
+}
+
+// FetchRecord reads the character's record, by its ID or as the first match of the
+// formula.
+func (source AirtableDataSource) FetchRecord(ctx context.Context, config AirtableConfig) (airtableRecord, error) {
+	tableUrl := fmt.Sprintf("%s/%s/%s", airtableApiUrl, url.PathEscape(config.BaseId), url.PathEscape(config.Table))
+
+	requestUrl := tableUrl + "/" + url.PathEscape(config.RecordId)
+	if config.RecordId == "" {
+		query := url.Values{}
+		query.Set("filterByFormula", config.FilterByFormula)
+		query.Set("maxRecords", "1")
+		requestUrl = tableUrl + "?" + query.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return airtableRecord{}, err
+	}
+	request.Header.Set("Authorization", "Bearer "+source.app.Config.AirtableAccessToken())
+
+	response, err := airtableClient.Do(request)
+	if err != nil {
+		return airtableRecord{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var apiError airtableError
+		json.NewDecoder(response.Body).Decode(&apiError)
+		if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+			return airtableRecord{}, fmt.Errorf("Airtable %w: %s %s", errTokenRejected, response.Status, apiError.Error.Message)
+		}
+		return airtableRecord{}, fmt.Errorf("Airtable returned %s %s", response.Status, apiError.Error.Message)
+	}
+
+	if config.RecordId != "" {
+		var record airtableRecord
+		if err := json.NewDecoder(response.Body).Decode(&record); err != nil {
+			return airtableRecord{}, fmt.Errorf("invalid Airtable record: %v", err)
+		}
+		return record, nil
+	}
+
+	var list struct {
+		Records []airtableRecord `json:"records"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&list); err != nil {
+		return airtableRecord{}, fmt.Errorf("invalid Airtable records: %v", err)
+	}
+	if len(list.Records) == 0 {
+		return airtableRecord{}, fmt.Errorf("no Airtable record in '%s' matches %s", config.Table, config.FilterByFormula)
+	}
+	return list.Records[0], nil
+}
+
+// AirtableFieldCells turns a field's value into cell strings: one for a text, number or
+// checkbox field, and one per item for multiple selects, linked records and the like.
+// Attachments are served as their URLs, so an attachment field can hold a portrait.
+func AirtableFieldCells(field json.RawMessage) ([]string, error) {
+	var items []interface{}
+	if err := json.Unmarshal(field, &items); err != nil {
+		var value interface{}
+		if err := json.Unmarshal(field, &value); err != nil {
+			return nil, err
+		}
+		items = []interface{}{value}
+	}
+
+	cells := []string{}
+	for _, item := range items {
+		switch value := item.(type) {
+		case string:
+			cells = append(cells, value)
+		case float64:
+			cells = append(cells, CellString(value))
+		case bool:
+			cells = append(cells, strings.ToUpper(fmt.Sprintf("%v", value)))
+		case map[string]interface{}:
+			// attachments have a url; collaborators and the like a name
+			if link, found := value["url"].(string); found {
+				cells = append(cells, link)
+			} else if name, found := value["name"].(string); found {
+				cells = append(cells, name)
+			} else {
+				return nil, fmt.Errorf("unsupported field value %v", value)
+			}
+		case nil:
+		default:
+			return nil, fmt.Errorf("unsupported field value %v", value)
+		}
+	}
+	return cells, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a record as the Airtable API returns it
+const airtableRecordJson = `{
+	"id": "recRowan",
+	"createdTime": "2021-10-01T19:00:00.000Z",
+	"fields": {
+		"Name": "Rowan",
+		"HP": 12,
+		"Inspired": true,
+		"Conditions": ["Poisoned", "Prone"],
+		"Portrait": [{"id": "att1", "url": "https://dl.airtable.com/rowan.png", "filename": "rowan.png"}],
+		"Player": {"id": "usr1", "email": "gm@example.com", "name": "Sam"}
+	}
+}`
+
+// newFakeAirtable serves a table of one record, by ID and by formula, to requests with the
+// right token.
+func newFakeAirtable(t *testing.T) *[]*http.Request {
+	requests := []*http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Header.Get("Authorization") != "Bearer pat-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"type": "AUTHENTICATION_REQUIRED", "message": "Authentication required"}}`))
+			return
+		}
+		switch {
+		case r.URL.Path == "/appParty/Characters/recRowan":
+			w.Write([]byte(airtableRecordJson))
+		case r.URL.Path == "/appParty/Characters" && r.URL.Query().Get("filterByFormula") == "{Name} = 'Rowan'":
+			w.Write([]byte(`{"records": [` + airtableRecordJson + `]}`))
+		case r.URL.Path == "/appParty/Characters":
+			w.Write([]byte(`{"records": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"type": "MODEL_ID_NOT_FOUND", "message": "Could not find a record"}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	previousUrl := airtableApiUrl
+	airtableApiUrl = server.URL
+	t.Cleanup(func() { airtableApiUrl = previousUrl })
+	return &requests
+}
+
+func TestAirtableDataSource(t *testing.T) {
+	attributes := []AttributeRow{
+		{Name: "name", Range: "Name"},
+		{Name: "hp", Range: "HP"},
+		{Name: "inspired", Range: "Inspired"},
+		{Name: "conditions", Range: "Conditions"},
+		{Name: "conditionList", Range: "Conditions", Type: AttributeTypeList},
+		{Name: "portrait", Range: "Portrait"},
+		{Name: "player", Range: "Player"},
+		{Name: "notes", Range: "Notes"},
+	}
+	want := map[string]string{
+		"name":          "Rowan",
+		"hp":            "12",
+		"inspired":      "TRUE",
+		"conditions":    "Poisoned, Prone",
+		"conditionList": `["Poisoned","Prone"]`,
+		"portrait":      "https://dl.airtable.com/rowan.png",
+		"player":        "Sam",
+	}
+
+	tests := []struct {
+		name         string
+		config       AirtableConfig
+		token        string
+		want         map[string]string
+		wantErr      string
+		wantAuthFail bool
+	}{
+		{"by record id", AirtableConfig{BaseId: "appParty", Table: "Characters", RecordId: "recRowan"}, "pat-secret", want, "", false},
+		{"by formula", AirtableConfig{BaseId: "appParty", Table: "Characters", FilterByFormula: "{Name} = 'Rowan'"}, "pat-secret", want, "", false},
+		{"no match", AirtableConfig{BaseId: "appParty", Table: "Characters", FilterByFormula: "{Name} = 'Smaug'"}, "pat-secret", nil, "no Airtable record", false},
+		{"unknown record", AirtableConfig{BaseId: "appParty", Table: "Characters", RecordId: "recSmaug"}, "pat-secret", nil, "404", false},
+		{"rejected token", AirtableConfig{BaseId: "appParty", Table: "Characters", RecordId: "recRowan"}, "wrong", nil, "Authentication required", true},
+	}
+
+	for _, test := range tests {
+		newFakeAirtable(t)
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		app.Config.AirtableToken = test.token
+		config := test.config
+
+		fetched, err := AirtableDataSource{app: app}.Fetch(context.Background(), ConfigEntry{CharacterKey: "rowan", Airtable: &config, Attributes: attributes})
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			if IsAuthError(err) != test.wantAuthFail {
+				t.Errorf("%s: IsAuthError = %v, want %v", test.name, IsAuthError(err), test.wantAuthFail)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(fetched.Values, test.want) {
+			t.Errorf("%s: values = %v, want %v", test.name, fetched.Values, test.want)
+		}
+	}
+}
+
+func TestAirtableAccessToken(t *testing.T) {
+	requests := newFakeAirtable(t)
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake)
+	app.Config.AirtableToken = "wrong"
+	t.Setenv(airtableTokenEnv, "pat-secret")
+
+	config := AirtableConfig{BaseId: "appParty", Table: "Characters", RecordId: "recRowan"}
+	if _, err := (AirtableDataSource{app: app}).FetchRecord(context.Background(), config); err != nil {
+		t.Errorf("error = %v; $%s should override airtableToken", err, airtableTokenEnv)
+	}
+	if len(*requests) != 1 {
+		t.Errorf("%d requests, want 1", len(*requests))
+	}
+}
+
+func TestAirtableFieldCells(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		want    []string
+		wantErr bool
+	}{
+		{"text", `"Rowan"`, []string{"Rowan"}, false},
+		{"number", `12.5`, []string{"12.5"}, false},
+		{"checkbox", `false`, []string{"FALSE"}, false},
+		{"multiple select", `["Poisoned", "Prone"]`, []string{"Poisoned", "Prone"}, false},
+		{"linked records", `["recBalin", "recDwalin"]`, []string{"recBalin", "recDwalin"}, false},
+		{"attachment", `[{"url": "https://dl.airtable.com/a.png"}]`, []string{"https://dl.airtable.com/a.png"}, false},
+		{"collaborator", `{"name": "Sam"}`, []string{"Sam"}, false},
+		{"null", `null`, []string{}, false},
+		{"unknown object", `{"id": "x"}`, nil, true},
+		{"nested list", `[["a"]]`, nil, true},
+		{"not JSON", `{`, nil, true},
+	}
+
+	for _, test := range tests {
+		cells, err := AirtableFieldCells(json.RawMessage(test.field))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(cells, test.want) {
+			t.Errorf("%s: cells = %v, want %v", test.name, cells, test.want)
+		}
+	}
+}
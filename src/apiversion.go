@@ -0,0 +1,27 @@
+package main
+
+import "net/http"
+
+// the response shape served when a client doesn't ask for a particular one
+const currentApiVersion = "1"
+
+var supportedApiVersions = []string{"1"}
+
+// RequestedApiVersion reads the version a client asked for from ?v= or the Accept-Version
+// header, falling back to the current version. ok is false if it's one we can't serve.
+func RequestedApiVersion(r *http.Request) (version string, ok bool) {
+	version = r.URL.Query().Get("v")
+	if version == "" {
+		version = r.Header.Get("Accept-Version")
+	}
+	if version == "" {
+		return currentApiVersion, true
+	}
+
+	for _, supported := range supportedApiVersions {
+		if version == supported {
+			return version, true
+		}
+	}
+	return version, false
+}
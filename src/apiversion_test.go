@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestedApiVersion(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		acceptVersion string
+		wantVersion   string
+		wantOk        bool
+	}{
+		{"default", "/thorin", "", currentApiVersion, true},
+		{"query", "/thorin?v=1", "", "1", true},
+		{"header", "/thorin", "1", "1", true},
+		{"query wins", "/thorin?v=1", "2", "1", true},
+		{"unsupported query", "/thorin?v=2", "", "2", false},
+		{"unsupported header", "/thorin", "0", "0", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.acceptVersion != "" {
+			r.Header.Set("Accept-Version", test.acceptVersion)
+		}
+		version, ok := RequestedApiVersion(r)
+		if version != test.wantVersion || ok != test.wantOk {
+			t.Errorf("%s: RequestedApiVersion = %q, %v, want %q, %v", test.name, version, ok, test.wantVersion, test.wantOk)
+		}
+	}
+}
+
+func TestHandleRequestApiVersion(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/thorin", http.StatusOK},
+		{"/thorin?v=1", http.StatusOK},
+		{"/thorin?v=2", http.StatusNotAcceptable},
+	}
+
+	for _, test := range tests {
+		response := getResponse(t, app, test.path)
+		if response.Metadata.StatusCode != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.path, response.Metadata.StatusCode, test.wantStatus)
+		}
+		if response.Metadata.ApiVersion != currentApiVersion {
+			t.Errorf("%s: apiVersion = %q, want %q", test.path, response.Metadata.ApiVersion, currentApiVersion)
+		}
+	}
+}
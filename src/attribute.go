@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const attributePathSeparator = "/attr/"
+
+// HandleAttributeRequest serves /<charKey>/attr/<attributeName>, a single attribute, for
+// overlays that only bind one value. With ?format=text the body is just the value, as
+// text/plain, for OBS text sources and widgets that can't parse JSON. It returns false if
+// the path isn't an attribute request.
+func (app *CharacterSheetServiceApp) HandleAttributeRequest(w http.ResponseWriter, r *http.Request, charKey string, role string) bool {
+	if _, configured := app.Characters()[charKey]; configured || !strings.Contains(charKey, attributePathSeparator) {
+		return false
+	}
+
+	parts := strings.SplitN(charKey, attributePathSeparator, 2)
+	charKey, requestedName := parts[0], parts[1]
+	charConfig, configured := app.Characters()[charKey]
+	if !configured {
+		return false
+	}
+	requestPath := r.URL.Path
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "text" {
+		// Invalid format - 400 Bad Request error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+				fmt.Sprintf("Invalid format '%s'; must be json or text.", format)),
+		})
+		return true
+	}
+
+	// the attribute may be asked for by its configured name or as it's served
+	visible := charConfig.VisibleTo(role)
+	name := ""
+	for _, attrName := range charConfig.AttributeNames() {
+		if (visible == nil || visible[attrName]) && (requestedName == attrName || requestedName == ApplyKeyStyle(app.Config.KeyStyle, attrName)) {
+			name = attrName
+			break
+		}
+	}
+	if name == "" {
+		// Unknown attribute - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				fmt.Sprintf("Character '%s' has no attribute '%s'; see /%s/schema for its attributes.", charKey, requestedName, charKey)),
+		})
+		return true
+	}
+
+	entry, found := app.LookupCharacter(r.Context(), charKey)
+	if !found || entry.Attributes == nil {
+		// Configured, but not yet primed - 503 Service Unavailable error
+		w.Header().Set("Retry-After", strconv.Itoa(primingRetryAfterSeconds))
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusServiceUnavailable,
+				fmt.Sprintf("Character '%s' is still being loaded; retry in %d seconds.", charKey, primingRetryAfterSeconds)),
+		})
+		return true
+	}
+
+	// ?raw=true serves the cell value as read from the sheet, as for the whole character
+	attributes := *entry.Attributes
+	if raw, _ := strconv.ParseBool(r.URL.Query().Get("raw")); raw {
+		attributes = entry.RawAttributes
+	}
+	selected := map[string]bool{name: true}
+
+	if format == "text" {
+		value := attributes[name]
+		if charConfig.ArrayAttributes()[name] {
+			value = ArrayValueText(value)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(value))
+
+		log.Printf("--- request: %s -> %s", requestPath, value)
+		return true
+	}
+
+	metadata := NewMetadata(requestPath, http.StatusOK, "")
+	metadata.Truncated = entry.Truncated
+	metadata.FetchFailed = entry.FetchFailed
+	metadata.Stale = entry.Stale
+	metadata.FetchError = entry.FetchError
+	metadata.DefaultedAttributes = FilterAttributeNames(entry.DefaultedAttributes, selected)
+	metadata.AttributeErrors = FilterAttributes(entry.AttributeErrors, selected)
+
+	states := ResolveAttributeStates(charConfig, *entry.Attributes)
+	app.WriteApiResponse(w, r, ApiResponse{
+		Attributes: app.RenderAttributes(charKey, FilterAttributes(attributes, selected), ""),
+		States:     StyleAttributeKeys(app.Config.KeyStyle, FilterAttributes(states, selected)),
+		Metadata:   metadata,
+	})
+	return true
+}
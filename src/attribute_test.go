@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAttributeText(t *testing.T) {
+	decimals := 1
+	fake := newFakeSheets(t, map[string][][]interface{}{
+		"B2":    {{"1234.56"}},
+		"B3":    {{"12"}},
+		"C2:C3": {{"Rope"}, {"Lantern"}},
+		"D2:E3": {{"Fireball", "3"}, {"Shield", "1"}},
+	})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Name: "gold", Range: "B2", Format: &AttributeFormat{Decimals: &decimals}},
+		{Name: "Max HP", Range: "B3", Private: true},
+		{Name: "inventory", Range: "C2:C3", Type: AttributeTypeList},
+		{Name: "spells", Range: "D2:E3", Type: AttributeTypeTable},
+	}})
+	app.Config.KeyStyle = KeyStyleCamel
+	app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+	app.PrimeCharacter("thorin")
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{"/thorin/attr/gold?format=text", http.StatusOK, "1,234.6"},
+		{"/thorin/attr/gold?format=text&raw=true", http.StatusOK, "1234.56"},
+		// by its configured name or its styled one
+		{"/thorin/attr/Max%20HP?format=text&token=gm-secret", http.StatusOK, "12"},
+		{"/thorin/attr/maxHp?format=text&token=gm-secret", http.StatusOK, "12"},
+		{"/thorin/attr/inventory?format=text", http.StatusOK, "Rope\nLantern"},
+		{"/thorin/attr/spells?format=text", http.StatusOK, "Fireball\t3\nShield\t1"},
+		// private attributes aren't there at all without a token
+		{"/thorin/attr/maxHp?format=text", http.StatusNotFound, ""},
+		{"/thorin/attr/mana?format=text", http.StatusNotFound, ""},
+		{"/thorin/attr/gold?format=xml", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.path, w.Code, test.wantStatus)
+			continue
+		}
+		if test.wantStatus != http.StatusOK {
+			continue
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+			t.Errorf("%s: Content-Type = %q, want text/plain", test.path, contentType)
+		}
+		if body := w.Body.String(); body != test.want {
+			t.Errorf("%s: body = %q, want %q", test.path, body, test.want)
+		}
+	}
+}
+
+func TestAttributeJson(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"Thorin"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Name: "hp", Range: "B2"},
+		{Name: "name", Range: "B3"},
+	}})
+	app.PrimeCharacter("thorin")
+
+	// just the one attribute, in the usual response
+	for _, path := range []string{"/thorin/attr/hp", "/thorin/attr/hp?format=json"} {
+		if got, want := attributeMap(getResponse(t, app, path)), map[string]string{"hp": "12"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: attributes = %v, want %v", path, got, want)
+		}
+	}
+}
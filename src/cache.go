@@ -0,0 +1,214 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type CacheConfig struct {
+	Backend        string `json:"backend"`
+	RedisAddress   string `json:"redisAddress"`
+	RedisPassword  string `json:"redisPassword"`
+	RedisDb        int    `json:"redisDb"`
+	RedisKeyPrefix string `json:"redisKeyPrefix"`
+
+	// randomly spread each entry's expiry by up to this percentage of the TTL; 0 disables
+	ExpiryJitterPercent float64 `json:"expiryJitterPercent"`
+
+	// evict characters nobody has requested for this long; 0 keeps everything cached
+	IdleEvictSeconds int `json:"idleEvictSeconds"`
+
+	// refresh entries this long before they expire, so the refreshed values are in place
+	// before the old ones go stale; 0 only refreshes after expiry
+	RefreshAheadSeconds int `json:"refreshAheadSeconds"`
+
+	// after consecutive failed fetches, wait the TTL times this multiplier per failure
+	// (default 2) before retrying, up to BackoffMaxSeconds (default 300)
+	BackoffMultiplier float64 `json:"backoffMultiplier"`
+	BackoffMaxSeconds int     `json:"backoffMaxSeconds"`
+}
+
+// Cache stores the most recently fetched attributes for each character. MarkUpdating
+// flags an entry as having a refresh in flight, and returns false if another caller
+// already claimed the refresh (or there is nothing to refresh). Evict drops an entry's
+// attributes so they're fetched again on the next lookup, while Delete forgets a character
+// that's no longer configured.
+//
+// Implementations must be safe for concurrent use: background refreshes write entries
+// while request handlers read them. Entries handed out by Get are shared with other
+// readers, so they are never mutated in place; callers copy an entry and Set the copy.
+type Cache interface {
+	Get(charKey string) (*CharacterAttributeCacheEntry, bool)
+	Set(charKey string, entry *CharacterAttributeCacheEntry)
+	MarkUpdating(charKey string) bool
+	Evict(charKey string)
+	Delete(charKey string)
+}
+
+type CharacterAttributeCacheEntry struct {
+	Attributes   *map[string]string `json:"attributes"`
+	Expires      time.Time          `json:"expires"`
+	Truncated    bool               `json:"truncated,omitempty"`
+	UpdatingFlag bool               `json:"-"`
+
+	FetchFailed         bool              `json:"fetchFailed,omitempty"`
+	Stale               bool              `json:"stale,omitempty"`
+	FetchError          string            `json:"fetchError,omitempty"`
+	ConsecutiveFailures int               `json:"consecutiveFailures,omitempty"`
+	DefaultedAttributes []string          `json:"defaultedAttributes,omitempty"`
+	AttributeErrors     map[string]string `json:"attributeErrors,omitempty"`
+
+	// the cell values as read from the sheet, before any formatting or defaults
+	RawAttributes map[string]string `json:"rawAttributes,omitempty"`
+
+	// range -> when it's due to be fetched again; Expires is the earliest of these
+	RangeExpires map[string]time.Time `json:"rangeExpires,omitempty"`
+
+	// the spreadsheet's Drive modifiedTime when it was read, if skipUnchangedSheets is on
+	ModifiedTime string `json:"modifiedTime,omitempty"`
+
+	// range -> the names last read from each headers range
+	HeaderNames map[string][]string `json:"headerNames,omitempty"`
+}
+
+// CharacterAttributeCache is the in-memory Cache; the lock guards the map, and entries
+// are replaced rather than modified once stored.
+type CharacterAttributeCache struct {
+	cacheMap map[string]*CharacterAttributeCacheEntry
+	lock     sync.RWMutex
+}
+
+func NewCache(config CacheConfig, size int) Cache {
+	switch config.Backend {
+	case "", "memory":
+		log.Println("  * using in-memory cache")
+		return NewCharacterAttributeCache(size)
+	case "redis":
+		log.Printf("  * using redis cache at %s", config.RedisAddress)
+		return NewRedisCharacterAttributeCache(config)
+	default:
+		log.Fatalf("Unknown cache backend '%s'; must be 'memory' or 'redis'", config.Backend)
+		return nil
+	}
+}
+
+func NewCharacterAttributeCache(size int) *CharacterAttributeCache {
+	return &CharacterAttributeCache{
+		cacheMap: make(map[string]*CharacterAttributeCacheEntry, size),
+	}
+}
+
+// how long fetched attributes are served before a refresh is triggered, unless the config
+// says otherwise
+const defaultCacheTtl = 30 * time.Second
+
+const (
+	defaultBackoffMultiplier = 2
+	defaultBackoffMax        = 5 * time.Minute
+)
+
+// FailureBackoff is how long to wait before retrying a character after the given number
+// of consecutive failed fetches, growing exponentially from its TTL up to the cap.
+func (config CacheConfig) FailureBackoff(ttl time.Duration, failures int) time.Duration {
+	multiplier := config.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = defaultBackoffMultiplier
+	}
+	max := defaultBackoffMax
+	if config.BackoffMaxSeconds > 0 {
+		max = time.Duration(config.BackoffMaxSeconds) * time.Second
+	}
+
+	backoff := ttl
+	for i := 1; i < failures && backoff < max; i++ {
+		backoff = time.Duration(float64(backoff) * multiplier)
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+func (config CacheConfig) RefreshAheadWindow() time.Duration {
+	return time.Duration(config.RefreshAheadSeconds) * time.Second
+}
+
+// CharacterTtl is how long a character's attributes are cached: its own cacheTtlSeconds,
+// then the global one, then the default.
+func (config ServiceConfig) CharacterTtl(charConfig ConfigEntry) time.Duration {
+	if charConfig.CacheTtlSeconds > 0 {
+		return time.Duration(charConfig.CacheTtlSeconds) * time.Second
+	}
+	if config.CacheTtlSeconds > 0 {
+		return time.Duration(config.CacheTtlSeconds) * time.Second
+	}
+	return defaultCacheTtl
+}
+
+// HasAttribute reports whether the entry has a value for the attribute.
+func (entry *CharacterAttributeCacheEntry) HasAttribute(name string) bool {
+	if entry.Attributes == nil {
+		return false
+	}
+	_, found := (*entry.Attributes)[name]
+	return found
+}
+
+func NewCachedEntry(charAttributes *map[string]string, ttl time.Duration) *CharacterAttributeCacheEntry {
+	return &CharacterAttributeCacheEntry{
+		Attributes:   charAttributes,
+		Expires:      time.Now().Add(ttl),
+		UpdatingFlag: false,
+	}
+}
+
+func (cache *CharacterAttributeCache) Get(charKey string) (*CharacterAttributeCacheEntry, bool) {
+	cache.lock.RLock()
+	entry, found := cache.cacheMap[charKey]
+	cache.lock.RUnlock()
+
+	if !found {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (cache *CharacterAttributeCache) Set(charKey string, entry *CharacterAttributeCacheEntry) {
+	cache.lock.Lock()
+	cache.cacheMap[charKey] = entry
+	cache.lock.Unlock()
+}
+
+func (cache *CharacterAttributeCache) MarkUpdating(charKey string) bool {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, found := cache.cacheMap[charKey]
+	if !found || entry.UpdatingFlag {
+		return false
+	}
+
+	// entries may be held by readers, so replace rather than mutate
+	updating := *entry
+	updating.UpdatingFlag = true
+	cache.cacheMap[charKey] = &updating
+	return true
+}
+
+func (cache *CharacterAttributeCache) Evict(charKey string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	// leave an empty, already-expired entry behind, which lookups treat as not yet primed
+	// and refresh
+	if _, found := cache.cacheMap[charKey]; found {
+		cache.cacheMap[charKey] = &CharacterAttributeCacheEntry{}
+	}
+}
+
+func (cache *CharacterAttributeCache) Delete(charKey string) {
+	cache.lock.Lock()
+	delete(cache.cacheMap, charKey)
+	cache.lock.Unlock()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// how long a stale entry is kept in redis after it expires, so it can still be served
+// while a refresh is in flight
+const redisStaleRetention = 1 * time.Hour
+
+// how long an instance may hold the updating flag before another instance may retry
+const redisUpdatingTimeout = 30 * time.Second
+
+// RedisClient is the subset of *redis.Client used by the cache, so it can be mocked.
+type RedisClient interface {
+	MGet(ctx context.Context, keys ...string) *redis.SliceCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
+type RedisCharacterAttributeCache struct {
+	client    RedisClient
+	keyPrefix string
+}
+
+func NewRedisCharacterAttributeCache(config CacheConfig) *RedisCharacterAttributeCache {
+	client := redis.NewClient(&redis.Options{
+		Addr:     config.RedisAddress,
+		Password: config.RedisPassword,
+		DB:       config.RedisDb,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		log.Fatalf("Unable to connect to redis: %v", err)
+	}
+
+	return NewRedisCacheWithClient(client, config.RedisKeyPrefix)
+}
+
+func NewRedisCacheWithClient(client RedisClient, keyPrefix string) *RedisCharacterAttributeCache {
+	if keyPrefix == "" {
+		keyPrefix = "sheetservice:"
+	}
+	return &RedisCharacterAttributeCache{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+func (cache *RedisCharacterAttributeCache) entryKey(charKey string) string {
+	return cache.keyPrefix + "character:" + charKey
+}
+
+func (cache *RedisCharacterAttributeCache) updatingKey(charKey string) string {
+	return cache.keyPrefix + "updating:" + charKey
+}
+
+func (cache *RedisCharacterAttributeCache) Get(charKey string) (*CharacterAttributeCacheEntry, bool) {
+	values, err := cache.client.MGet(context.Background(), cache.entryKey(charKey), cache.updatingKey(charKey)).Result()
+	if err != nil {
+		log.Printf("Unable to read '%s' from redis: %v", charKey, err)
+		return nil, false
+	}
+
+	entryJson, ok := values[0].(string)
+	if !ok {
+		return nil, false
+	}
+
+	var entry CharacterAttributeCacheEntry
+	if err := json.Unmarshal([]byte(entryJson), &entry); err != nil {
+		log.Printf("Invalid cache entry for '%s' in redis: %v", charKey, err)
+		return nil, false
+	}
+	entry.UpdatingFlag = values[1] != nil
+
+	return &entry, true
+}
+
+func (cache *RedisCharacterAttributeCache) Set(charKey string, entry *CharacterAttributeCacheEntry) {
+	ctx := context.Background()
+
+	entryJson, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Unable to encode cache entry for '%s': %v", charKey, err)
+		return
+	}
+
+	// let redis drop the entry on its own once it has been stale for a while
+	ttl := time.Until(entry.Expires) + redisStaleRetention
+	if err := cache.client.Set(ctx, cache.entryKey(charKey), entryJson, ttl).Err(); err != nil {
+		log.Printf("Unable to write '%s' to redis: %v", charKey, err)
+		return
+	}
+
+	if err := cache.client.Del(ctx, cache.updatingKey(charKey)).Err(); err != nil {
+		log.Printf("Unable to clear updating flag for '%s' in redis: %v", charKey, err)
+	}
+}
+
+func (cache *RedisCharacterAttributeCache) MarkUpdating(charKey string) bool {
+	// SETNX makes the flag a lock shared by every instance; the TTL releases it if the
+	// instance holding it dies mid-fetch
+	claimed, err := cache.client.SetNX(context.Background(), cache.updatingKey(charKey), 1, redisUpdatingTimeout).Result()
+	if err != nil {
+		log.Printf("Unable to mark '%s' as updating in redis: %v", charKey, err)
+		return false
+	}
+	return claimed
+}
+
+func (cache *RedisCharacterAttributeCache) Evict(charKey string) {
+	// a missing entry is re-primed by whichever instance is asked for it next
+	if err := cache.client.Del(context.Background(), cache.entryKey(charKey)).Err(); err != nil {
+		log.Printf("Unable to evict '%s' from redis: %v", charKey, err)
+	}
+}
+
+func (cache *RedisCharacterAttributeCache) Delete(charKey string) {
+	// other instances may still have the character configured, in which case they'll
+	// fetch it again
+	cache.Evict(charKey)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// mockRedisClient keeps keys in a map, enough to stand in for redis in the cache.
+type mockRedisClient struct {
+	lock   sync.Mutex
+	values map[string]string
+	ttls   map[string]time.Duration
+}
+
+func newMockRedisClient() *mockRedisClient {
+	return &mockRedisClient{values: map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (client *mockRedisClient) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if value, found := client.values[key]; found {
+			values[i] = value
+		}
+	}
+	return redis.NewSliceResult(values, nil)
+}
+
+func (client *mockRedisClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.values[key] = redisString(value)
+	client.ttls[key] = expiration
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (client *mockRedisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if _, found := client.values[key]; found {
+		return redis.NewBoolResult(false, nil)
+	}
+	client.values[key] = redisString(value)
+	client.ttls[key] = expiration
+	return redis.NewBoolResult(true, nil)
+}
+
+func (client *mockRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	deleted := int64(0)
+	for _, key := range keys {
+		if _, found := client.values[key]; found {
+			delete(client.values, key)
+			deleted++
+		}
+	}
+	return redis.NewIntResult(deleted, nil)
+}
+
+func redisString(value interface{}) string {
+	if bytes, ok := value.([]byte); ok {
+		return string(bytes)
+	}
+	return fmt.Sprint(value)
+}
+
+func TestCacheBackends(t *testing.T) {
+	backends := []struct {
+		name     string
+		newCache func() Cache
+	}{
+		{"memory", func() Cache { return NewCharacterAttributeCache(1) }},
+		{"redis", func() Cache { return NewRedisCacheWithClient(newMockRedisClient(), "") }},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			cache := backend.newCache()
+
+			if _, found := cache.Get("thorin"); found {
+				t.Fatalf("empty cache found 'thorin'")
+			}
+
+			cache.Set("thorin", NewCachedEntry(&map[string]string{"hp": "12", "name": "Thorin"}, defaultCacheTtl))
+			entry, found := cache.Get("thorin")
+			if !found {
+				t.Fatalf("'thorin' not found after Set")
+			}
+			if hp := (*entry.Attributes)["hp"]; hp != "12" {
+				t.Errorf("hp = %q, want 12", hp)
+			}
+			if entry.UpdatingFlag {
+				t.Errorf("new entry is flagged as updating")
+			}
+
+			if !cache.MarkUpdating("thorin") {
+				t.Fatalf("first MarkUpdating didn't claim the refresh")
+			}
+			if cache.MarkUpdating("thorin") {
+				t.Errorf("second MarkUpdating claimed a refresh already in flight")
+			}
+			if entry, _ := cache.Get("thorin"); !entry.UpdatingFlag {
+				t.Errorf("entry isn't flagged as updating after MarkUpdating")
+			}
+
+			// a new entry ends the refresh
+			cache.Set("thorin", NewCachedEntry(&map[string]string{"hp": "7"}, defaultCacheTtl))
+			entry, _ = cache.Get("thorin")
+			if entry.UpdatingFlag {
+				t.Errorf("entry still flagged as updating after Set")
+			}
+			if hp := (*entry.Attributes)["hp"]; hp != "7" {
+				t.Errorf("hp = %q after Set, want 7", hp)
+			}
+			if !cache.MarkUpdating("thorin") {
+				t.Errorf("MarkUpdating didn't claim a refresh after Set")
+			}
+
+			// an evicted entry has no attributes to serve
+			cache.Set("thorin", NewCachedEntry(&map[string]string{"hp": "7"}, defaultCacheTtl))
+			cache.Evict("thorin")
+			if entry, found := cache.Get("thorin"); found && entry.Attributes != nil {
+				t.Errorf("attributes %v still cached after Evict", *entry.Attributes)
+			}
+			cache.Evict("nobody")
+		})
+	}
+}
+
+func TestMemoryCacheMarkUpdatingMissing(t *testing.T) {
+	cache := NewCharacterAttributeCache(1)
+	if cache.MarkUpdating("nobody") {
+		t.Errorf("MarkUpdating claimed a refresh of a character that isn't cached")
+	}
+}
+
+func TestRedisCacheKeys(t *testing.T) {
+	tests := []struct {
+		prefix      string
+		wantEntry   string
+		wantUpdated string
+	}{
+		{"", "sheetservice:character:thorin", "sheetservice:updating:thorin"},
+		{"party:", "party:character:thorin", "party:updating:thorin"},
+	}
+
+	for _, test := range tests {
+		client := newMockRedisClient()
+		cache := NewRedisCacheWithClient(client, test.prefix)
+		entry := NewCachedEntry(&map[string]string{"hp": "12"}, defaultCacheTtl)
+		cache.Set("thorin", entry)
+		cache.MarkUpdating("thorin")
+
+		if _, found := client.values[test.wantEntry]; !found {
+			t.Errorf("prefix %q: entry not stored at %s", test.prefix, test.wantEntry)
+		}
+		if _, found := client.values[test.wantUpdated]; !found {
+			t.Errorf("prefix %q: updating flag not stored at %s", test.prefix, test.wantUpdated)
+		}
+		// stale entries are kept around so they can be served during a refresh
+		if ttl := client.ttls[test.wantEntry]; ttl <= redisStaleRetention {
+			t.Errorf("prefix %q: entry ttl %v doesn't outlast its expiry", test.prefix, ttl)
+		}
+		if ttl := client.ttls[test.wantUpdated]; ttl != redisUpdatingTimeout {
+			t.Errorf("prefix %q: updating flag ttl %v, want %v", test.prefix, ttl, redisUpdatingTimeout)
+		}
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   CacheConfig
+		failures int
+		want     time.Duration
+	}{
+		{"first failure", CacheConfig{}, 1, defaultCacheTtl},
+		{"second failure", CacheConfig{}, 2, 2 * defaultCacheTtl},
+		{"third failure", CacheConfig{}, 3, 4 * defaultCacheTtl},
+		{"capped", CacheConfig{}, 20, defaultBackoffMax},
+		{"custom multiplier", CacheConfig{BackoffMultiplier: 3}, 3, 9 * defaultCacheTtl},
+		{"custom cap", CacheConfig{BackoffMaxSeconds: 45}, 3, 45 * time.Second},
+		{"multiplier below 1", CacheConfig{BackoffMultiplier: 0.5}, 2, 2 * defaultCacheTtl},
+	}
+
+	for _, test := range tests {
+		if got := test.config.FailureBackoff(defaultCacheTtl, test.failures); got != test.want {
+			t.Errorf("%s: FailureBackoff(%d) = %v, want %v", test.name, test.failures, got, test.want)
+		}
+	}
+}
+
+func TestCharacterTtl(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    int
+		character int
+		want      time.Duration
+	}{
+		{"default", 0, 0, defaultCacheTtl},
+		{"global", 120, 0, 120 * time.Second},
+		{"character", 0, 5, 5 * time.Second},
+		{"character over global", 120, 5, 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		config := ServiceConfig{CacheTtlSeconds: test.global}
+		if got := config.CharacterTtl(ConfigEntry{CacheTtlSeconds: test.character}); got != test.want {
+			t.Errorf("%s: CharacterTtl = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
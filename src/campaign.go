@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Characters in a campaign are served at /<campaign>/<characterKey>, so two games can both
+// have a "rowan". Their CharacterKey is rewritten to that path as the config is read, and
+// the campaign itself lists its characters at /<campaign>.
+
+// JoinCampaign puts the character in a campaign, serving it under the campaign's path.
+func (configEntry *ConfigEntry) JoinCampaign(campaign string) {
+	configEntry.Campaign = campaign
+	configEntry.CharacterKey = campaign + "/" + configEntry.CharacterKey
+}
+
+// ValidateCampaigns checks that campaign names can't be mistaken for anything else served at
+// the top level.
+func (config ServiceConfig) ValidateCampaigns() error {
+	bareKeys := map[string]bool{}
+	for _, configEntry := range config.Characters {
+		if configEntry.Campaign == "" {
+			bareKeys[configEntry.CharacterKey] = true
+		}
+	}
+
+	for _, configEntry := range config.Characters {
+		campaign := configEntry.Campaign
+		if campaign == "" {
+			continue
+		}
+		if strings.Contains(campaign, "/") || strings.TrimSpace(campaign) != campaign {
+			return fmt.Errorf("character '%s': campaign '%s' can't contain slashes or surrounding spaces",
+				configEntry.CharacterKey, campaign)
+		}
+		for _, reserved := range reservedCharacterKeys {
+			if campaign == reserved {
+				return fmt.Errorf("campaign '%s' is reserved for the /%s endpoint", reserved, reserved)
+			}
+		}
+		if bareKeys[campaign] {
+			return fmt.Errorf("campaign '%s' has the same key as a character; rename one of them", campaign)
+		}
+	}
+	return nil
+}
+
+// CampaignKeys lists the characters of a campaign, highest priority first; it's empty when
+// there's no such campaign.
+func (app *CharacterSheetServiceApp) CampaignKeys(campaign string) []string {
+	characters := app.Characters()
+	keys := []string{}
+	for _, key := range app.PrimingOrder() {
+		if campaign != "" && characters[key].Campaign == campaign {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// HandleCampaignRequest serves /<campaign>, listing the campaign's characters from config
+// alone. It returns false if the path isn't a campaign.
+func (app *CharacterSheetServiceApp) HandleCampaignRequest(w http.ResponseWriter, r *http.Request, campaign string) bool {
+	keys := app.CampaignKeys(campaign)
+	if len(keys) == 0 {
+		return false
+	}
+
+	urls := make([]string, len(keys))
+	for i, key := range keys {
+		urls[i] = "/" + key
+	}
+	app.WriteApiResponse(w, r, ApiResponse{
+		CharacterUrls: urls,
+		Metadata:      NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+	return true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// IsArray tells list and table attributes, which serve their whole range as a JSON array,
+// from those with a single value.
+func (attr AttributeRow) IsArray() bool {
+	return attr.Type == AttributeTypeList || attr.Type == AttributeTypeTable
+}
+
+// ArrayAttributes names the character's list and table attributes.
+func (configEntry ConfigEntry) ArrayAttributes() map[string]bool {
+	arrays := map[string]bool{}
+	for _, attr := range configEntry.Attributes {
+		if attr.IsArray() {
+			arrays[attr.Name] = true
+		}
+	}
+	return arrays
+}
+
+// EncodeCells turns a range into the JSON kept in the cache for a list (every cell, in
+// row-major order) or table (an array of rows) attribute.
+func EncodeCells(attr AttributeRow, values [][]interface{}) string {
+	var cells interface{}
+	if attr.Type == AttributeTypeTable {
+		rows := [][]string{}
+		for _, row := range values {
+			cellStrings := []string{}
+			for _, cell := range row {
+				cellStrings = append(cellStrings, CellString(cell))
+			}
+			rows = append(rows, cellStrings)
+		}
+		cells = rows
+	} else {
+		list := []string{}
+		for _, row := range values {
+			for _, cell := range row {
+				list = append(list, CellString(cell))
+			}
+		}
+		cells = list
+	}
+
+	encoded, _ := json.Marshal(cells)
+	return string(encoded)
+}
+
+// TransformCells formats and truncates each cell of a list or table attribute.
+func (app *CharacterSheetServiceApp) TransformCells(attr AttributeRow, raw string) string {
+	cellAttr := attr
+	cellAttr.Type = ""
+
+	var transformed interface{}
+	if attr.Type == AttributeTypeTable {
+		var rows [][]string
+		if err := json.Unmarshal([]byte(raw), &rows); err != nil {
+			return raw
+		}
+		for _, row := range rows {
+			for i, cell := range row {
+				row[i] = app.TransformAttributeValue(cellAttr, cell)
+			}
+		}
+		transformed = rows
+	} else {
+		var list []string
+		if err := json.Unmarshal([]byte(raw), &list); err != nil {
+			return raw
+		}
+		for i, cell := range list {
+			list[i] = app.TransformAttributeValue(cellAttr, cell)
+		}
+		transformed = list
+	}
+
+	encoded, _ := json.Marshal(transformed)
+	return string(encoded)
+}
+
+// DecodeArrayValue is what's served for a list or table attribute: the array itself,
+// rather than its JSON as a string.
+func DecodeArrayValue(value string) interface{} {
+	if !json.Valid([]byte(value)) {
+		return value
+	}
+	return json.RawMessage(value)
+}
+
+// ArrayValueText lays a list or table attribute out as plain text: one cell per line for a
+// list, and one row per line with tab-separated cells for a table.
+func ArrayValueText(value string) string {
+	var rows [][]string
+	if err := json.Unmarshal([]byte(value), &rows); err == nil {
+		lines := make([]string, len(rows))
+		for i, row := range rows {
+			lines[i] = strings.Join(row, "\t")
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	var list []string
+	if err := json.Unmarshal([]byte(value), &list); err == nil {
+		return strings.Join(list, "\n")
+	}
+	return value
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEncodeCells(t *testing.T) {
+	values := [][]interface{}{{"Rope", 2.0}, {"Lantern"}, {1234567890.0, true}}
+
+	tests := []struct {
+		name     string
+		attrType string
+		values   [][]interface{}
+		want     string
+	}{
+		{"list, in row-major order", AttributeTypeList, values, `["Rope","2","Lantern","1234567890","true"]`},
+		{"table, by row", AttributeTypeTable, values, `[["Rope","2"],["Lantern"],["1234567890","true"]]`},
+		{"empty list", AttributeTypeList, nil, `[]`},
+		{"empty table", AttributeTypeTable, nil, `[]`},
+	}
+
+	for _, test := range tests {
+		if got := EncodeCells(AttributeRow{Name: "inventory", Type: test.attrType}, test.values); got != test.want {
+			t.Errorf("%s: EncodeCells() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestArrayValueText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`["Rope","Lantern"]`, "Rope\nLantern"},
+		{`[["Fireball","3"],["Shield","1"]]`, "Fireball\t3\nShield\t1"},
+		{`[]`, ""},
+		{`not an array`, "not an array"},
+	}
+
+	for _, test := range tests {
+		if got := ArrayValueText(test.value); got != test.want {
+			t.Errorf("ArrayValueText(%s) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestArrayAttributes(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{
+		"B2":    {{"12"}},
+		"C2:C4": {{"Rope"}, {"Lantern"}, {"Rations"}},
+		"D2:E3": {{"Fireball", "3"}, {"Shield", "1"}},
+	})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Name: "hp", Range: "B2"},
+		// each cell is cut to length on its own
+		{Name: "inventory", Range: "C2:C4", Type: AttributeTypeList, MaxLength: 4, Ellipsis: "."},
+		{Name: "spells", Range: "D2:E3", Type: AttributeTypeTable},
+	}})
+	app.PrimeCharacter("thorin")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/thorin", `{"hp":"12","inventory":["Rope","Lan.","Rat."],"spells":[["Fireball","3"],["Shield","1"]]}`},
+		{"/thorin?format=array", `[{"name":"hp","value":"12"},{"name":"inventory","value":["Rope","Lan.","Rat."]},` +
+			`{"name":"spells","value":[["Fireball","3"],["Shield","1"]]}]`},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		var response struct {
+			Attributes json.RawMessage `json:"attributes"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.path, err)
+		}
+		var compact bytes.Buffer
+		json.Compact(&compact, response.Attributes)
+		if compact.String() != test.want {
+			t.Errorf("%s: attributes = %s, want %s", test.path, compact.String(), test.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Answers for the chat bots (twitch.go, discord.go), which only ever show what the public
+// role may see. Characters that need an access token aren't shown in chat at all.
+
+// ChatCharacters are the characters chat may ask about: those that don't need a token.
+func (app *CharacterSheetServiceApp) ChatCharacters() map[string]ConfigEntry {
+	chatCharacters := map[string]ConfigEntry{}
+	for charKey, charConfig := range app.Characters() {
+		if !app.Config.TokenRequired(charConfig) {
+			chatCharacters[charKey] = charConfig
+		}
+	}
+	return chatCharacters
+}
+
+// FindChatCharacter matches a name from chat to a character key, ignoring case; characters
+// in a campaign can be named without it. With no name, it's the only character, if there's
+// just one.
+func (app *CharacterSheetServiceApp) FindChatCharacter(name string) (string, bool) {
+	characters := app.ChatCharacters()
+	if name == "" {
+		if len(characters) == 1 {
+			for charKey := range characters {
+				return charKey, true
+			}
+		}
+		return "", false
+	}
+
+	matches := []string{}
+	for charKey := range characters {
+		if strings.EqualFold(charKey, name) {
+			return charKey, true
+		}
+		if i := strings.LastIndex(charKey, "/"); i >= 0 && strings.EqualFold(charKey[i+1:], name) {
+			matches = append(matches, charKey)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], true
+	}
+	return "", false
+}
+
+func (app *CharacterSheetServiceApp) UnknownCharacterReply(name string) string {
+	names := []string{}
+	for charKey := range app.ChatCharacters() {
+		names = append(names, charKey)
+	}
+	sort.Strings(names)
+
+	if name == "" {
+		return fmt.Sprintf("Which character? One of: %s", strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("No character '%s'; try one of: %s", name, strings.Join(names, ", "))
+}
+
+// IsPublicAttribute tells whether name is an attribute the public may see; of charKey, or
+// of any character when charKey is "".
+func (app *CharacterSheetServiceApp) IsPublicAttribute(name string, charKey string) bool {
+	for key, charConfig := range app.ChatCharacters() {
+		if charKey != "" && key != charKey {
+			continue
+		}
+		names := map[string]string{}
+		visible := charConfig.VisibleTo(PublicRole)
+		for _, configured := range charConfig.AttributeNames() {
+			if visible == nil || visible[configured] {
+				names[configured] = ""
+			}
+		}
+		if _, found := matchAttributeName(name, names, app.Config.KeyStyle); found {
+			return true
+		}
+	}
+	return false
+}
+
+// ChatReply is the character's value of attribute, or all its public attributes when
+// attribute is "", cut to limit characters.
+func (app *CharacterSheetServiceApp) ChatReply(ctx context.Context, charKey string, attribute string, limit int) string {
+	charConfig, chattable := app.ChatCharacters()[charKey]
+	if !chattable {
+		return app.UnknownCharacterReply(charKey)
+	}
+
+	entry, found := app.LookupCharacter(ctx, charKey)
+	if !found || entry.Attributes == nil {
+		return fmt.Sprintf("No stats for %s yet.", charKey)
+	}
+	attributes := FilterAttributes(*entry.Attributes, charConfig.VisibleTo(PublicRole))
+
+	if attribute == "" {
+		parts := []string{}
+		for _, name := range orderedChatNames(charConfig, attributes) {
+			parts = append(parts, fmt.Sprintf("%s: %s", name, attributes[name]))
+		}
+		return truncateChatMessage(fmt.Sprintf("%s - %s", charKey, strings.Join(parts, " | ")), limit)
+	}
+
+	name, found := matchAttributeName(attribute, attributes, app.Config.KeyStyle)
+	if !found {
+		return fmt.Sprintf("%s has no %s.", charKey, attribute)
+	}
+	return truncateChatMessage(fmt.Sprintf("%s %s: %s", charKey, name, attributes[name]), limit)
+}
+
+// orderedChatNames puts the attributes in config order, followed by any that aren't
+// configured by name, such as those read from a headers table.
+func orderedChatNames(charConfig ConfigEntry, attributes map[string]string) []string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	ordered := charConfig.InConfigOrder(names)
+
+	configured := map[string]bool{}
+	for _, name := range ordered {
+		configured[name] = true
+	}
+	rest := []string{}
+	for _, name := range names {
+		if !configured[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(ordered, rest...)
+}
+
+// matchAttributeName finds the attribute a chat command names, ignoring case, as configured
+// or in the key style.
+func matchAttributeName(command string, attributes map[string]string, keyStyle string) (string, bool) {
+	for name := range attributes {
+		if strings.EqualFold(name, command) || strings.EqualFold(ApplyKeyStyle(keyStyle, name), command) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func truncateChatMessage(message string, limit int) string {
+	runes := []rune(message)
+	if len(runes) <= limit {
+		return message
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestChatSkipsTokenGatedCharacters(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name         string
+		global       bool
+		thorinNeeds  *bool
+		wantKnown    bool
+		wantReply    string
+		wantListed   string
+		wantAttrSeen bool
+	}{
+		{
+			name:         "no tokens required",
+			wantKnown:    true,
+			wantReply:    "thorin hp: 12",
+			wantListed:   "Which character? One of: balin, thorin",
+			wantAttrSeen: true,
+		},
+		{
+			name:       "required globally",
+			global:     true,
+			wantReply:  "No character 'thorin'; try one of: balin",
+			wantListed: "Which character? One of: balin",
+		},
+		{
+			name:        "required for the character",
+			thorinNeeds: &yes,
+			wantReply:   "No character 'thorin'; try one of: balin",
+			wantListed:  "Which character? One of: balin",
+		},
+		{
+			name:         "character opts out of the global requirement",
+			global:       true,
+			thorinNeeds:  &no,
+			wantKnown:    true,
+			wantReply:    "thorin hp: 12",
+			wantListed:   "Which character? One of: balin, thorin",
+			wantAttrSeen: true,
+		},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "C2": {{"9"}}, "C3": {{"30"}}})
+		app := newTestApp(t, fake,
+			ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}, {Name: "gold", Range: "C3"}},
+				RequireAccessToken: test.thorinNeeds},
+			ConfigEntry{CharacterKey: "balin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "C2"}},
+				RequireAccessToken: &no},
+		)
+		app.Config.RequireAccessToken = test.global
+		app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+		app.PrimeCharacter("thorin")
+		app.PrimeCharacter("balin")
+
+		if _, known := app.FindChatCharacter("thorin"); known != test.wantKnown {
+			t.Errorf("%s: FindChatCharacter known = %v, want %v", test.name, known, test.wantKnown)
+		}
+		if reply := app.ChatReply(context.Background(), "thorin", "hp", 500); reply != test.wantReply {
+			t.Errorf("%s: ChatReply = %q, want %q", test.name, reply, test.wantReply)
+		}
+		if reply := app.UnknownCharacterReply(""); reply != test.wantListed {
+			t.Errorf("%s: UnknownCharacterReply = %q, want %q", test.name, reply, test.wantListed)
+		}
+		if seen := app.IsPublicAttribute("gold", ""); seen != test.wantAttrSeen {
+			t.Errorf("%s: IsPublicAttribute(gold) = %v, want %v", test.name, seen, test.wantAttrSeen)
+		}
+	}
+}
@@ -0,0 +1,841 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/text/language"
+)
+
+type AttributeRow struct {
+	Name  string `json:"name"`
+	Range string `json:"range"`
+
+	// a fixed value, such as a character's race, served without reading the sheet; used
+	// in place of Range
+	Value *string `json:"value,omitempty"`
+
+	// what's read from a single-cell range: value (the default), note (the cell's note, in
+	// place of its value) or both (the note goes in NoteName)
+	Read     string `json:"read,omitempty"`
+	NoteName string `json:"noteName,omitempty"`
+
+	// when set, each cell of a multi-cell range maps to one of these names, in row-major order
+	Names []string `json:"names,omitempty"`
+
+	// row or column: the range is a table whose first row or column holds the attributes'
+	// names, and the next their values; see headers.go
+	Headers string `json:"headers,omitempty"`
+
+	// value used when the cell is empty
+	Default *string `json:"default,omitempty"`
+
+	// refresh this range on its own schedule, rather than the character's cache TTL
+	TtlSeconds int `json:"ttlSeconds,omitempty"`
+
+	Format *AttributeFormat `json:"format,omitempty"`
+
+	// text or number, as reported by /<charKey>/schema; guessed from format and thresholds
+	// when left out. list serves every cell of the range as a JSON array, and table serves
+	// it as an array of rows. int, float and bool serve JSON numbers and booleans instead of
+	// strings; see typed.go.
+	Type string `json:"type,omitempty"`
+
+	// cut values longer than this many characters, ending them with Ellipsis; 0 means no limit
+	MaxLength int    `json:"maxLength,omitempty"`
+	Ellipsis  string `json:"ellipsis,omitempty"`
+
+	// what a single-value attribute does when its range holds more than one cell: first
+	// (the default), last, join (with Separator, default ", ") or error
+	MultiRow  string `json:"multiRow,omitempty"`
+	Separator string `json:"separator,omitempty"`
+
+	// overrides the global valueRenderOption for this range
+	ValueRenderOption string `json:"valueRenderOption,omitempty"`
+
+	Thresholds         []AttributeThreshold `json:"thresholds,omitempty"`
+	ThresholdPercentOf string               `json:"thresholdPercentOf,omitempty"`
+
+	// which of the character's sources this is read from, e.g. foundry; defaults to the
+	// first of its sources
+	Source string `json:"source,omitempty"`
+
+	// left out for requests without an access token, so the overlay doesn't give away what
+	// only the GM should see
+	Private bool `json:"private,omitempty"`
+}
+
+// paths served by something other than the character lookup
+var reservedCharacterKeys = []string{"ws", "stats", "events", "party", "metrics", "healthz", "readyz", "overlay", "render", "discord", "actions", "admin", "debug"}
+
+const (
+	MultiRowFirst = "first"
+	MultiRowLast  = "last"
+	MultiRowJoin  = "join"
+	MultiRowError = "error"
+
+	defaultJoinSeparator = ", "
+)
+
+type ConfigEntry struct {
+	CharacterKey string         `json:"characterKey"`
+	SheetId      string         `json:"sheetId"`
+	Attributes   []AttributeRow `json:"attributes"`
+
+	// serves the character at /<campaign>/<characterKey>, so characters of different games
+	// can share a key; see campaign.go
+	Campaign string `json:"campaign,omitempty"`
+
+	// characters with a higher priority are primed first at startup
+	Priority int `json:"priority,omitempty"`
+
+	// tab name -> gid, used to find tabs when reading the CSV export fallback
+	SheetGids map[string]int64 `json:"sheetGids,omitempty"`
+
+	// attributes computed from the others after every fetch; see derived.go
+	Derived []DerivedAttribute `json:"derived,omitempty"`
+
+	// what the /actions endpoints change; see actions.go
+	Actions *ActionsConfig `json:"actions,omitempty"`
+
+	// role -> the only attributes that role may see; roles that aren't listed see them all.
+	// Requests without an access token have the "public" role, which never sees private
+	// attributes.
+	Visibility map[string][]string `json:"visibility,omitempty"`
+
+	// tokens accepted for this character only, such as its player's, on top of the global
+	// accessTokens
+	AccessTokens []AccessToken `json:"accessTokens,omitempty"`
+
+	// overrides the global requireAccessToken for this character
+	RequireAccessToken *bool `json:"requireAccessToken,omitempty"`
+
+	// overrides the global emptyValue for this character
+	EmptyValue *string `json:"emptyValue,omitempty"`
+
+	// overrides the global cacheTtlSeconds for this character
+	CacheTtlSeconds int `json:"cacheTtlSeconds,omitempty"`
+
+	// an html/template file served at /render/{characterKey}, executed with a RenderData
+	RenderTemplate string `json:"renderTemplate,omitempty"`
+
+	// a local .csv or .xlsx file to read instead of a Google Sheet; see localfile.go
+	File string `json:"file,omitempty"`
+
+	// a record in an Airtable base to read instead of a Google Sheet; see airtable.go
+	Airtable *AirtableConfig `json:"airtable,omitempty"`
+
+	// a Notion database page to read instead of a Google Sheet; see notion.go
+	Notion *NotionConfig `json:"notion,omitempty"`
+
+	// a public D&D Beyond character to read instead of a Google Sheet; see dndbeyond.go
+	DndBeyond *DndBeyondConfig `json:"dndBeyond,omitempty"`
+
+	// an actor in the Foundry VTT world to read instead of a Google Sheet; see foundry.go
+	Foundry *FoundryConfig `json:"foundry,omitempty"`
+
+	// a Pathbuilder 2e JSON export to read instead of a Google Sheet; see pathbuilder.go
+	Pathbuilder *PathbuilderConfig `json:"pathbuilder,omitempty"`
+
+	// a JSON API to read instead of a Google Sheet, with JSONPath ranges; see rest.go
+	Rest *RestConfig `json:"rest,omitempty"`
+
+	// when more than one of the sources above is set up, their names (sheetId, file,
+	// airtable, notion, dndBeyond, foundry, pathbuilder, rest), highest precedence first;
+	// see merge.go
+	Sources []string `json:"sources,omitempty"`
+}
+
+type ServiceConfig struct {
+	Cache      CacheConfig   `json:"cache"`
+	Tracing    TracingConfig `json:"tracing"`
+	Server     ServerConfig  `json:"server"`
+	Cors       CorsConfig    `json:"cors"`
+	Logging    LoggingConfig `json:"logging"`
+	Characters []ConfigEntry `json:"characters"`
+
+	// one of asIs (default), lower, camel or snake; applied to attribute names in responses
+	KeyStyle string `json:"keyStyle"`
+
+	// locale tag such as "fr-FR" used when formatting numbers; defaults to en-US
+	Locale string `json:"locale"`
+
+	// how the Sheets API renders values: FORMATTED_VALUE (the API default),
+	// UNFORMATTED_VALUE or FORMULA
+	ValueRenderOption string `json:"valueRenderOption"`
+
+	// how many edits away a mistyped character key may be and still be suggested on a
+	// 404; 0 uses the default, and a negative number turns suggestions off
+	SuggestionDistance int `json:"suggestionDistance"`
+
+	// check each sheet's modifiedTime through the Drive API before reading its values, and
+	// skip the read when it hasn't changed; needs the Drive API enabled for the key
+	SkipUnchangedSheets bool `json:"skipUnchangedSheets"`
+
+	// read publicly-shared sheets through their CSV export if the Sheets API fails
+	CsvFallback bool `json:"csvFallback"`
+
+	Limits LimitsConfig `json:"limits"`
+
+	// when set, responses carry an HMAC signature in X-Signature; see signing.go
+	SigningKey string `json:"signingKey"`
+
+	// URLs POSTed each attribute change a refresh finds; see webhooks.go
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	// bearer token for the /admin endpoints, which are disabled when this is empty
+	AdminSecret string `json:"adminSecret"`
+
+	// allow POST/PATCH /<charKey>, with the adminSecret, to write attributes back to the
+	// sheet. Needs a service account or application default credentials; API keys can't
+	// write.
+	WriteBack bool `json:"writeBack"`
+
+	// tokens for character requests, each with a role that decides which attributes it
+	// sees; see each character's visibility
+	AccessTokens []AccessToken `json:"accessTokens,omitempty"`
+
+	// turn away character requests without an access token, rather than serving them with
+	// the public role; characters can override it
+	RequireAccessToken bool `json:"requireAccessToken"`
+
+	// html/template file used for error pages when a browser asks for text/html; it's
+	// executed with the same response that would be sent as JSON
+	ErrorTemplate string `json:"errorTemplate"`
+
+	// write the cache to a static JSON file, for serving when this service is down
+	Snapshot SnapshotConfig `json:"snapshot"`
+
+	// what character requests get while maintenance mode is switched on at /admin/maintenance
+	Maintenance MaintenanceConfig `json:"maintenance"`
+
+	// how many recent requests /admin/logs keeps; defaults to 100
+	RequestLogSize int `json:"requestLogSize"`
+
+	// serve net/http/pprof under /debug/pprof/, behind the admin secret
+	EnableProfiling bool `json:"enableProfiling"`
+
+	// when set, attributes whose cells are empty (and have no default) are served with this
+	// value instead of being left out, so every configured attribute is always present
+	EmptyValue *string `json:"emptyValue,omitempty"`
+
+	// when set, a failed fetch with no earlier value to fall back on serves this for every
+	// attribute, rather than an empty string
+	OnErrorValue *string `json:"onErrorValue,omitempty"`
+
+	// strict (the default) or degraded; see startupmode.go
+	StartupMode string `json:"startupMode"`
+
+	// how long shutdown waits for in-flight refreshes; defaults to 10 seconds
+	ShutdownTimeoutSeconds int `json:"shutdownTimeoutSeconds"`
+
+	// how long fetched attributes are served before they're refreshed; defaults to 30 seconds
+	CacheTtlSeconds int `json:"cacheTtlSeconds"`
+
+	// start serving once every character with a priority above 0 is primed, rather
+	// than waiting for the whole roster
+	ReadyAfterPriorityPrimed bool `json:"readyAfterPriorityPrimed"`
+
+	// how Sheets API reads that are rate limited or hit a server error are retried
+	Retry RetryConfig `json:"retry"`
+
+	// personal access token for characters read from Airtable; $AIRTABLE_TOKEN overrides it
+	AirtableToken string `json:"airtableToken"`
+
+	// integration token for characters read from Notion; $NOTION_TOKEN overrides it
+	NotionToken string `json:"notionToken"`
+
+	// the Foundry VTT world that characters with a foundry config are read from
+	Foundry FoundryServerConfig `json:"foundry"`
+
+	// a bot answering chat commands such as !hp thorin; see twitch.go
+	Twitch TwitchConfig `json:"twitch"`
+
+	// a bot answering the /character slash command, and announcing changes; see discord.go
+	Discord DiscordConfig `json:"discord"`
+
+	// set text sources and show or hide sources in OBS from the attributes; see obs.go
+	Obs ObsConfig `json:"obs"`
+}
+
+// environment variable holding the whole config body, for deployments without a file
+const configJsonEnv = "CONFIG_JSON"
+
+// LoadServiceConfig reads the config from path, or from stdin when path is "-".
+func LoadServiceConfig(path string) ServiceConfig {
+	if path == "-" {
+		return LoadServiceConfigReader("stdin", os.Stdin)
+	}
+
+	log.Println("-- loading character configuration")
+
+	config, err := ReadServiceConfigFile(path)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	return config
+}
+
+// ReadServiceConfigFile is LoadServiceConfig for a file, returning errors rather than
+// exiting, so a running service can reload it.
+func ReadServiceConfigFile(path string) (ServiceConfig, error) {
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ServiceConfig{}, fmt.Errorf("unable to read config file: %v", err)
+	}
+
+	config, err := ParseServiceConfig(fileBytes)
+	if err != nil {
+		return config, fmt.Errorf("invalid %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+func LoadServiceConfigEnv() ServiceConfig {
+	return LoadServiceConfigReader("$"+configJsonEnv, strings.NewReader(os.Getenv(configJsonEnv)))
+}
+
+func LoadServiceConfigReader(source string, reader io.Reader) ServiceConfig {
+	log.Printf("-- loading character configuration from %s", source)
+
+	fileBytes, err := ioutil.ReadAll(reader)
+	if err != nil {
+		log.Fatalf("Unable to read config from %s: %v", source, err)
+	}
+
+	config, err := ParseServiceConfig(fileBytes)
+	if err != nil {
+		log.Fatalf("Invalid config from %s: %v", source, err)
+	}
+
+	return config
+}
+
+// LoadServiceConfigDir merges every *.json, *.yaml and *.yml file in a directory, e.g. one
+// file per player. Global settings may only be given in one of the files. Each subdirectory
+// is a campaign, whose files hold just its characters.
+func LoadServiceConfigDir(dir string) ServiceConfig {
+	log.Printf("-- loading character configuration from %s", dir)
+
+	config, err := ReadServiceConfigDir(dir)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	return config
+}
+
+// ReadServiceConfigDir is LoadServiceConfigDir, returning errors rather than exiting.
+func ReadServiceConfigDir(dir string) (ServiceConfig, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ServiceConfig{}, fmt.Errorf("unable to read config directory: %v", err)
+	}
+
+	// the config files, and for those in a subdirectory, its name as their campaign
+	paths := []string{}
+	campaigns := map[string]string{}
+	for _, fileInfo := range fileInfos {
+		if !fileInfo.IsDir() {
+			if isConfigFile(fileInfo.Name()) {
+				paths = append(paths, filepath.Join(dir, fileInfo.Name()))
+			}
+			continue
+		}
+
+		campaignInfos, err := ioutil.ReadDir(filepath.Join(dir, fileInfo.Name()))
+		if err != nil {
+			return ServiceConfig{}, fmt.Errorf("unable to read campaign directory: %v", err)
+		}
+		for _, campaignInfo := range campaignInfos {
+			if !campaignInfo.IsDir() && isConfigFile(campaignInfo.Name()) {
+				path := filepath.Join(dir, fileInfo.Name(), campaignInfo.Name())
+				paths = append(paths, path)
+				campaigns[path] = fileInfo.Name()
+			}
+		}
+	}
+
+	var merged ServiceConfig
+	settingsFile := ""
+	characterFiles := map[string]string{}
+
+	for _, path := range paths {
+		fileBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return ServiceConfig{}, fmt.Errorf("unable to read config file: %v", err)
+		}
+		if strings.ToLower(filepath.Ext(path)) != ".json" {
+			if fileBytes, err = yaml.YAMLToJSON(fileBytes); err != nil {
+				return ServiceConfig{}, fmt.Errorf("invalid %s: %v", path, err)
+			}
+		}
+
+		config, err := parseServiceConfigJson(fileBytes)
+		if err != nil {
+			return ServiceConfig{}, fmt.Errorf("invalid %s: %v", path, err)
+		}
+		log.Printf("  * read %s", path)
+
+		if campaign, found := campaigns[path]; found {
+			for i, configEntry := range config.Characters {
+				if configEntry.Campaign == "" {
+					config.Characters[i].JoinCampaign(campaign)
+				} else if configEntry.Campaign != campaign {
+					return ServiceConfig{}, fmt.Errorf("invalid %s: character '%s' is in campaign '%s', not '%s'",
+						path, configEntry.CharacterKey, configEntry.Campaign, campaign)
+				}
+			}
+		}
+
+		for _, configEntry := range config.Characters {
+			if otherPath, found := characterFiles[configEntry.CharacterKey]; found {
+				return ServiceConfig{}, fmt.Errorf("character '%s' is configured in both %s and %s", configEntry.CharacterKey, otherPath, path)
+			}
+			characterFiles[configEntry.CharacterKey] = path
+		}
+		characters := append(merged.Characters, config.Characters...)
+
+		config.Characters = nil
+		if !reflect.DeepEqual(config, ServiceConfig{}) {
+			if _, found := campaigns[path]; found {
+				return ServiceConfig{}, fmt.Errorf("global settings are in campaign file %s; keep them in %s", path, dir)
+			}
+			if settingsFile != "" {
+				return ServiceConfig{}, fmt.Errorf("global settings are in both %s and %s; keep them in one file", settingsFile, path)
+			}
+			settingsFile = path
+			merged = config
+		}
+		merged.Characters = characters
+	}
+
+	if err = merged.Validate(); err != nil {
+		return ServiceConfig{}, fmt.Errorf("invalid config in %s: %v", dir, err)
+	}
+
+	return merged, nil
+}
+
+// isConfigFile tells the config files in a config directory from the credentials that may
+// live alongside them
+func isConfigFile(name string) bool {
+	extension := strings.ToLower(filepath.Ext(name))
+	if extension != ".json" && extension != ".yaml" && extension != ".yml" {
+		return false
+	}
+	return name != apiKeyFile && name != serviceAccountFile
+}
+
+func ParseServiceConfig(fileBytes []byte) (ServiceConfig, error) {
+	config, err := parseServiceConfigJson(fileBytes)
+	if err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+func parseServiceConfigJson(fileBytes []byte) (ServiceConfig, error) {
+	var config ServiceConfig
+	var err error
+
+	// older config files are a bare list of characters rather than an object
+	if trimmed := bytes.TrimSpace(fileBytes); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &config.Characters)
+	} else {
+		err = json.Unmarshal(fileBytes, &config)
+	}
+	if err != nil {
+		return config, err
+	}
+
+	for i, configEntry := range config.Characters {
+		sheetId, err := ParseSheetId(configEntry.SheetId)
+		if err != nil {
+			return config, fmt.Errorf("character '%s': %v", configEntry.CharacterKey, err)
+		}
+		config.Characters[i].SheetId = sheetId
+
+		if configEntry.Campaign != "" {
+			config.Characters[i].JoinCampaign(configEntry.Campaign)
+		}
+
+		// sources with standard fields serve all of them unless some are picked out
+		if configEntry.DndBeyond != nil && !configEntry.ReadsFrom(SourceDndBeyond) {
+			config.Characters[i].Attributes = append(config.Characters[i].Attributes, DndBeyondAttributes()...)
+		}
+		if configEntry.Pathbuilder != nil && !configEntry.ReadsFrom(SourcePathbuilder) {
+			config.Characters[i].Attributes = append(config.Characters[i].Attributes, PathbuilderAttributes()...)
+		}
+	}
+
+	return config, nil
+}
+
+var sheetUrlPattern = regexp.MustCompile(`/spreadsheets/d/([a-zA-Z0-9_-]+)`)
+
+// ParseSheetId accepts either a bare spreadsheet ID or the spreadsheet's full URL, as
+// copied from the browser, and returns the ID.
+func ParseSheetId(sheetId string) (string, error) {
+	if !strings.Contains(sheetId, "/") {
+		return sheetId, nil
+	}
+
+	match := sheetUrlPattern.FindStringSubmatch(sheetId)
+	if match == nil {
+		return "", fmt.Errorf("sheetId '%s' looks like a URL, but has no /spreadsheets/d/<id>/ in it", sheetId)
+	}
+	return match[1], nil
+}
+
+func (config ServiceConfig) Validate() error {
+	if !ValidKeyStyle(config.KeyStyle) {
+		return fmt.Errorf("unknown keyStyle '%s'; must be asIs, lower, camel or snake", config.KeyStyle)
+	}
+
+	if config.StartupMode != "" && config.StartupMode != StartupModeStrict && config.StartupMode != StartupModeDegraded {
+		return fmt.Errorf("unknown startupMode '%s'; must be strict or degraded", config.StartupMode)
+	}
+
+	for _, accessToken := range config.AccessTokens {
+		if accessToken.Token == "" || accessToken.Role == "" {
+			return fmt.Errorf("each of accessTokens needs a token and a role")
+		}
+	}
+
+	if err := config.Server.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.Cors.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.Twitch.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.Discord.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.Obs.Validate(config.Characters); err != nil {
+		return err
+	}
+
+	for _, webhook := range config.Webhooks {
+		if err := webhook.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := config.Logging.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.Retry.Validate(); err != nil {
+		return err
+	}
+
+	if config.CacheTtlSeconds < 0 {
+		return fmt.Errorf("cacheTtlSeconds can't be negative")
+	}
+
+	if !ValidValueRenderOption(config.ValueRenderOption) {
+		return fmt.Errorf("unknown valueRenderOption '%s'", config.ValueRenderOption)
+	}
+
+	if config.Locale != "" {
+		if _, err := language.Parse(config.Locale); err != nil {
+			return fmt.Errorf("invalid locale '%s': %v", config.Locale, err)
+		}
+	}
+
+	if err := config.ValidateCampaigns(); err != nil {
+		return err
+	}
+
+	for _, configEntry := range config.Characters {
+		for _, reserved := range reservedCharacterKeys {
+			if configEntry.CharacterKey == reserved {
+				return fmt.Errorf("character key '%s' is reserved for the /%s endpoint", reserved, reserved)
+			}
+		}
+
+		if configEntry.CacheTtlSeconds < 0 {
+			return fmt.Errorf("character '%s': cacheTtlSeconds can't be negative", configEntry.CharacterKey)
+		}
+
+		for _, accessToken := range configEntry.AccessTokens {
+			if accessToken.Token == "" || accessToken.Role == "" {
+				return fmt.Errorf("character '%s': each of accessTokens needs a token and a role", configEntry.CharacterKey)
+			}
+		}
+		if config.TokenRequired(configEntry) && len(config.AccessTokens)+len(configEntry.AccessTokens) == 0 {
+			return fmt.Errorf("character '%s' requires an access token, but no accessTokens are configured", configEntry.CharacterKey)
+		}
+
+		if err := configEntry.ValidateSource(); err != nil {
+			return err
+		}
+		if configEntry.HasSource(SourceFoundry) {
+			if err := config.Foundry.Validate(); err != nil {
+				return fmt.Errorf("character '%s': %v", configEntry.CharacterKey, err)
+			}
+		}
+
+		if err := configEntry.ValidateDerived(); err != nil {
+			return err
+		}
+
+		if err := configEntry.ValidateVisibility(); err != nil {
+			return err
+		}
+
+		if err := configEntry.ValidateActions(); err != nil {
+			return err
+		}
+
+		if err := CheckKeyStyleCollisions(config.KeyStyle, configEntry); err != nil {
+			return err
+		}
+
+		for _, attr := range configEntry.Attributes {
+			if attr.Value != nil {
+				if attr.Range != "" || len(attr.Names) > 0 || attr.Name == "" {
+					return fmt.Errorf("character '%s': static attribute '%s' needs a name, and no range or names",
+						configEntry.CharacterKey, attr.Name)
+				}
+				if attr.IsArray() {
+					return fmt.Errorf("character '%s': static attribute '%s' can't be a %s",
+						configEntry.CharacterKey, attr.Name, attr.Type)
+				}
+				continue
+			}
+
+			if !ValidValueRenderOption(attr.ValueRenderOption) {
+				return fmt.Errorf("character '%s': unknown valueRenderOption '%s' on range '%s'",
+					configEntry.CharacterKey, attr.ValueRenderOption, attr.Range)
+			}
+
+			switch attr.Type {
+			case "", AttributeTypeText, AttributeTypeNumber, AttributeTypeString,
+				AttributeTypeInt, AttributeTypeFloat, AttributeTypeBool:
+			case AttributeTypeList, AttributeTypeTable:
+				if len(attr.Names) > 0 || (attr.Read != "" && attr.Read != ReadValue) {
+					return fmt.Errorf("character '%s': %s range '%s' needs a single name, and can't read notes",
+						configEntry.CharacterKey, attr.Type, attr.Range)
+				}
+			default:
+				return fmt.Errorf("character '%s': unknown type '%s' on range '%s'; must be text, number, list, table, string, int, float or bool",
+					configEntry.CharacterKey, attr.Type, attr.Range)
+			}
+
+			switch attr.Read {
+			case "", ReadValue, ReadNote:
+				if attr.NoteName != "" {
+					return fmt.Errorf("character '%s': noteName on range '%s' needs read set to both",
+						configEntry.CharacterKey, attr.Range)
+				}
+			case ReadBoth:
+				if attr.NoteName == "" {
+					return fmt.Errorf("character '%s': range '%s' reads both value and note, but has no noteName",
+						configEntry.CharacterKey, attr.Range)
+				}
+			default:
+				return fmt.Errorf("character '%s': unknown read '%s' on range '%s'; must be value, note or both",
+					configEntry.CharacterKey, attr.Read, attr.Range)
+			}
+			if attr.Read != "" && attr.Read != ReadValue && len(attr.Names) > 0 {
+				return fmt.Errorf("character '%s': notes can only be read from single-value range '%s'",
+					configEntry.CharacterKey, attr.Range)
+			}
+
+			switch attr.MultiRow {
+			case "", MultiRowFirst, MultiRowLast, MultiRowJoin, MultiRowError:
+			default:
+				return fmt.Errorf("character '%s': unknown multiRow '%s' on range '%s'; must be first, last, join or error",
+					configEntry.CharacterKey, attr.MultiRow, attr.Range)
+			}
+
+			if attr.MaxLength < 0 || (attr.MaxLength > 0 && utf8.RuneCountInString(attr.Ellipsis) >= attr.MaxLength) {
+				return fmt.Errorf("character '%s': maxLength on range '%s' must be longer than its ellipsis",
+					configEntry.CharacterKey, attr.Range)
+			}
+
+			if attr.Format != nil && attr.Format.Locale != "" {
+				if _, err := language.Parse(attr.Format.Locale); err != nil {
+					return fmt.Errorf("character '%s': invalid locale '%s' on range '%s': %v",
+						configEntry.CharacterKey, attr.Format.Locale, attr.Range, err)
+				}
+			}
+			if attr.Format != nil {
+				if err := attr.Format.Validate(); err != nil {
+					return fmt.Errorf("character '%s': format on range '%s': %v", configEntry.CharacterKey, attr.Range, err)
+				}
+			}
+
+			if len(attr.Thresholds) > 0 && attr.Name == "" {
+				return fmt.Errorf("character '%s': thresholds on range '%s' need a single 'name'",
+					configEntry.CharacterKey, attr.Range)
+			}
+
+			if attr.Headers != "" {
+				if err := attr.ValidateHeaders(); err != nil {
+					return fmt.Errorf("character '%s': headers on range '%s': %v", configEntry.CharacterKey, attr.Range, err)
+				}
+			}
+
+			if len(attr.Names) == 0 {
+				continue
+			}
+			if attr.Name != "" {
+				return fmt.Errorf("character '%s': range '%s' has both 'name' and 'names'; use one or the other",
+					configEntry.CharacterKey, attr.Range)
+			}
+
+			// named ranges can't be sized until they're fetched, so only A1 ranges are checked here
+			if rows, cols, ok := A1RangeSize(attr.Range); ok && rows*cols != len(attr.Names) {
+				return fmt.Errorf("character '%s': range '%s' has %d cells but %d names",
+					configEntry.CharacterKey, attr.Range, rows*cols, len(attr.Names))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (attr AttributeRow) AttributeNames() []string {
+	if len(attr.Names) > 0 {
+		return attr.Names
+	}
+	if attr.Read == ReadBoth {
+		return []string{attr.Name, attr.NoteName}
+	}
+	return []string{attr.Name}
+}
+
+func (configEntry ConfigEntry) AttributeNames() []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, attr := range configEntry.Attributes {
+		// attributes read from more than one source share a name
+		for _, name := range attr.AttributeNames() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	for _, derived := range configEntry.Derived {
+		names = append(names, derived.Name)
+	}
+	return names
+}
+
+// SheetAttributes returns the attributes read from the sheet, leaving out static ones.
+func (configEntry ConfigEntry) SheetAttributes() []AttributeRow {
+	attrs := []AttributeRow{}
+	for _, attr := range configEntry.Attributes {
+		if attr.Value == nil {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// InConfigOrder sorts attribute names into the order they're configured in; the order they
+// were collected in can depend on which ranges happened to be refetched.
+func (configEntry ConfigEntry) InConfigOrder(names []string) []string {
+	included := make(map[string]bool, len(names))
+	for _, name := range names {
+		included[name] = true
+	}
+
+	ordered := []string{}
+	for _, name := range configEntry.AttributeNames() {
+		if included[name] {
+			ordered = append(ordered, name)
+		}
+	}
+	return ordered
+}
+
+// UsesGoogleSheets is false when every character is read from some other source, so the
+// service can run without Google credentials.
+func (config ServiceConfig) UsesGoogleSheets() bool {
+	for _, configEntry := range config.Characters {
+		if configEntry.HasSource(SourceSheet) {
+			return true
+		}
+	}
+	return false
+}
+
+func (config ServiceConfig) CharacterMap() map[string]ConfigEntry {
+	configMap := make(map[string]ConfigEntry, len(config.Characters))
+	for _, configEntry := range config.Characters {
+		log.Printf("  * loaded config for '%s'\n", configEntry.CharacterKey)
+		configMap[configEntry.CharacterKey] = configEntry
+	}
+
+	return configMap
+}
+
+func ValidValueRenderOption(renderOption string) bool {
+	switch renderOption {
+	case "", "FORMATTED_VALUE", "UNFORMATTED_VALUE", "FORMULA":
+		return true
+	}
+	return false
+}
+
+func (config ServiceConfig) EmptyValueFor(configEntry ConfigEntry) *string {
+	if configEntry.EmptyValue != nil {
+		return configEntry.EmptyValue
+	}
+	return config.EmptyValue
+}
+
+func (config ServiceConfig) SuggestionMaxDistance() int {
+	if config.SuggestionDistance == 0 {
+		return defaultSuggestionDistance
+	}
+	return config.SuggestionDistance
+}
+
+// PrimingOrder lists each character key once, highest priority first, keeping config
+// file order for characters of equal priority.
+func (config ServiceConfig) PrimingOrder() []string {
+	entries := make([]ConfigEntry, len(config.Characters))
+	copy(entries, config.Characters)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Priority > entries[j].Priority
+	})
+
+	seen := make(map[string]bool, len(entries))
+	keys := make([]string, 0, len(entries))
+	for _, configEntry := range entries {
+		if !seen[configEntry.CharacterKey] {
+			seen[configEntry.CharacterKey] = true
+			keys = append(keys, configEntry.CharacterKey)
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		attr    AttributeRow
+		wantErr string
+	}{
+		{"single value", AttributeRow{Name: "hp", Range: "B2"}, ""},
+		{"row range", AttributeRow{Range: "Stats!B2:G2", Names: []string{"str", "dex", "con", "int", "wis", "cha"}}, ""},
+		{"named range", AttributeRow{Range: "Abilities", Names: []string{"str", "dex"}}, ""},
+		{"too few names", AttributeRow{Range: "B2:G2", Names: []string{"str", "dex"}}, "has 6 cells but 2 names"},
+		{"too many names", AttributeRow{Range: "B2", Names: []string{"str", "dex"}}, "has 1 cells but 2 names"},
+		{"name and names", AttributeRow{Name: "str", Range: "B2", Names: []string{"str"}}, "has both 'name' and 'names'"},
+	}
+
+	for _, test := range tests {
+		config := ServiceConfig{Characters: []ConfigEntry{{CharacterKey: "thorin", Attributes: []AttributeRow{test.attr}}}}
+		err := config.Validate()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateMaxLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength int
+		ellipsis  string
+		wantErr   bool
+	}{
+		{"no limit", 0, "", false},
+		{"limit", 10, "…", false},
+		{"negative", -1, "", true},
+		{"ellipsis as long as the limit", 3, "...", true},
+	}
+
+	for _, test := range tests {
+		attr := AttributeRow{Name: "name", Range: "B2", MaxLength: test.maxLength, Ellipsis: test.ellipsis}
+		config := ServiceConfig{Characters: []ConfigEntry{{CharacterKey: "thorin", Attributes: []AttributeRow{attr}}}}
+		if err := config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateMultiRow(t *testing.T) {
+	tests := []struct {
+		multiRow string
+		wantErr  bool
+	}{
+		{"", false},
+		{MultiRowFirst, false},
+		{MultiRowLast, false},
+		{MultiRowJoin, false},
+		{MultiRowError, false},
+		{"all", true},
+	}
+
+	for _, test := range tests {
+		attr := AttributeRow{Name: "gear", Range: "B2:B5", MultiRow: test.multiRow}
+		config := ServiceConfig{Characters: []ConfigEntry{{CharacterKey: "thorin", Attributes: []AttributeRow{attr}}}}
+		if err := config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("multiRow %q: error = %v, want error %v", test.multiRow, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateReservedKeys(t *testing.T) {
+	for _, charKey := range append([]string{"thorin"}, reservedCharacterKeys...) {
+		config := ServiceConfig{Characters: []ConfigEntry{{CharacterKey: charKey}}}
+		err := config.Validate()
+		if reserved := charKey != "thorin"; (err != nil) != reserved {
+			t.Errorf("%s: error = %v, want error %v", charKey, err, reserved)
+		}
+	}
+}
+
+func TestValidateAdminPaths(t *testing.T) {
+	// the admin and profiling endpoints sit under these
+	for _, charKey := range []string{"admin", "debug"} {
+		config := ServiceConfig{Characters: []ConfigEntry{{CharacterKey: charKey}}}
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: character key accepted", charKey)
+		}
+		campaign := ServiceConfig{Characters: []ConfigEntry{{CharacterKey: charKey + "/thorin", Campaign: charKey}}}
+		if err := campaign.Validate(); err == nil {
+			t.Errorf("%s: campaign accepted", charKey)
+		}
+	}
+}
+
+func TestValidateStaticAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		attr    AttributeRow
+		wantErr bool
+	}{
+		{"static", AttributeRow{Name: "race", Value: stringPointer("Dwarf")}, false},
+		{"empty value", AttributeRow{Name: "title", Value: stringPointer("")}, false},
+		{"with a range", AttributeRow{Name: "race", Range: "B2", Value: stringPointer("Dwarf")}, true},
+		{"with names", AttributeRow{Names: []string{"race"}, Value: stringPointer("Dwarf")}, true},
+		{"no name", AttributeRow{Value: stringPointer("Dwarf")}, true},
+	}
+
+	for _, test := range tests {
+		config := ServiceConfig{Characters: []ConfigEntry{{CharacterKey: "thorin", Attributes: []AttributeRow{test.attr}}}}
+		if err := config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		attr    AttributeRow
+		wantErr bool
+	}{
+		{"default", AttributeRow{Name: "sword", Range: "B2"}, false},
+		{"note", AttributeRow{Name: "sword", Range: "B2", Read: ReadNote}, false},
+		{"both", AttributeRow{Name: "sword", Range: "B2", Read: ReadBoth, NoteName: "swordNote"}, false},
+		{"both without noteName", AttributeRow{Name: "sword", Range: "B2", Read: ReadBoth}, true},
+		{"noteName without both", AttributeRow{Name: "sword", Range: "B2", NoteName: "swordNote"}, true},
+		{"unknown", AttributeRow{Name: "sword", Range: "B2", Read: "comment"}, true},
+		{"note with names", AttributeRow{Names: []string{"sword", "axe"}, Range: "B2:B3", Read: ReadNote}, true},
+	}
+
+	for _, test := range tests {
+		config := ServiceConfig{Characters: []ConfigEntry{{CharacterKey: "thorin", Attributes: []AttributeRow{test.attr}}}}
+		if err := config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateCacheTtl(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    int
+		character int
+		wantErr   bool
+	}{
+		{"unset", 0, 0, false},
+		{"set", 60, 10, false},
+		{"negative global", -1, 0, true},
+		{"negative character", 0, -1, true},
+	}
+
+	for _, test := range tests {
+		config := ServiceConfig{
+			CacheTtlSeconds: test.global,
+			Characters:      []ConfigEntry{{CharacterKey: "thorin", CacheTtlSeconds: test.character}},
+		}
+		if err := config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestPrimingOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		characters []ConfigEntry
+		want       []string
+	}{
+		{
+			name:       "no priorities keeps file order",
+			characters: []ConfigEntry{{CharacterKey: "a"}, {CharacterKey: "b"}, {CharacterKey: "c"}},
+			want:       []string{"a", "b", "c"},
+		},
+		{
+			name: "highest first, ties in file order",
+			characters: []ConfigEntry{
+				{CharacterKey: "a"}, {CharacterKey: "b", Priority: 5}, {CharacterKey: "c", Priority: 1},
+				{CharacterKey: "d", Priority: 5}, {CharacterKey: "e", Priority: -1},
+			},
+			want: []string{"b", "d", "c", "a", "e"},
+		},
+		{
+			name:       "duplicate keys once",
+			characters: []ConfigEntry{{CharacterKey: "a"}, {CharacterKey: "b", Priority: 2}, {CharacterKey: "a", Priority: 3}},
+			want:       []string{"a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		config := ServiceConfig{Characters: test.characters}
+		if got := config.PrimingOrder(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: PrimingOrder() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// writeConfigDir writes files, by name, into a new directory.
+func writeConfigDir(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadServiceConfigDir(t *testing.T) {
+	captureLog(t)
+	tests := []struct {
+		name           string
+		files          map[string]string
+		wantCharacters []string
+		wantKeyStyle   string
+		wantErr        string
+	}{
+		{
+			name: "merges two files",
+			files: map[string]string{
+				"settings.json": `{"keyStyle": "snake", "characters": [{"characterKey": "thorin", "sheetId": "a"}]}`,
+				"gimli.yaml":    "characters:\n  - characterKey: gimli\n    sheetId: b\n",
+				"api-key.json":  `{"apiKey": "not a config file"}`,
+				"notes.txt":     "ignored",
+			},
+			wantCharacters: []string{"gimli", "thorin"},
+			wantKeyStyle:   KeyStyleSnake,
+		},
+		{
+			name: "bare list of characters",
+			files: map[string]string{
+				"a.json": `[{"characterKey": "thorin", "sheetId": "a"}]`,
+				"b.yml":  "- characterKey: gimli\n  sheetId: b\n",
+			},
+			wantCharacters: []string{"thorin", "gimli"},
+		},
+		{
+			name: "character in two files",
+			files: map[string]string{
+				"a.json": `{"characters": [{"characterKey": "thorin", "sheetId": "a"}]}`,
+				"b.json": `{"characters": [{"characterKey": "thorin", "sheetId": "b"}]}`,
+			},
+			wantErr: "character 'thorin' is configured in both",
+		},
+		{
+			name: "settings in two files",
+			files: map[string]string{
+				"a.json": `{"keyStyle": "snake"}`,
+				"b.json": `{"adminSecret": "s3cret"}`,
+			},
+			wantErr: "global settings are in both",
+		},
+		{
+			name:    "invalid merged config",
+			files:   map[string]string{"a.json": `{"keyStyle": "kebab"}`},
+			wantErr: "unknown keyStyle",
+		},
+	}
+
+	for _, test := range tests {
+		config, err := ReadServiceConfigDir(writeConfigDir(t, test.files))
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+
+		characters := []string{}
+		for _, configEntry := range config.Characters {
+			characters = append(characters, configEntry.CharacterKey)
+		}
+		if !reflect.DeepEqual(characters, test.wantCharacters) {
+			t.Errorf("%s: characters = %v, want %v", test.name, characters, test.wantCharacters)
+		}
+		if config.KeyStyle != test.wantKeyStyle {
+			t.Errorf("%s: keyStyle = %q, want %q", test.name, config.KeyStyle, test.wantKeyStyle)
+		}
+	}
+}
+
+func TestValidValueRenderOption(t *testing.T) {
+	tests := []struct {
+		renderOption string
+		want         bool
+	}{
+		{"", true},
+		{"FORMATTED_VALUE", true},
+		{"UNFORMATTED_VALUE", true},
+		{"FORMULA", true},
+		{"formula", false},
+		{"RAW", false},
+	}
+
+	for _, test := range tests {
+		if got := ValidValueRenderOption(test.renderOption); got != test.want {
+			t.Errorf("ValidValueRenderOption(%q) = %v, want %v", test.renderOption, got, test.want)
+		}
+	}
+}
+
+func TestParseSheetId(t *testing.T) {
+	tests := []struct {
+		name    string
+		sheetId string
+		want    string
+		wantErr bool
+	}{
+		{"bare id", "1aBcD_e-F2", "1aBcD_e-F2", false},
+		{"full url", "https://docs.google.com/spreadsheets/d/1aBcD_e-F2/edit#gid=0", "1aBcD_e-F2", false},
+		{"url without trailing path", "https://docs.google.com/spreadsheets/d/1aBcD_e-F2", "1aBcD_e-F2", false},
+		{"malformed url", "https://docs.google.com/document/d/1aBcD_e-F2/edit", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseSheetId(test.sheetId)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("%s: ParseSheetId(%q) = %q, %v, want %q, error %v", test.name, test.sheetId, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestParseServiceConfigSheetUrl(t *testing.T) {
+	config, err := ParseServiceConfig([]byte(`{"characters": [{"characterKey": "thorin",
+		"sheetId": "https://docs.google.com/spreadsheets/d/1aBcD_e-F2/edit#gid=0"}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if sheetId := config.Characters[0].SheetId; sheetId != "1aBcD_e-F2" {
+		t.Errorf("sheetId = %q, want 1aBcD_e-F2", sheetId)
+	}
+
+	if _, err := ParseServiceConfig([]byte(`{"characters": [{"characterKey": "thorin",
+		"sheetId": "https://example.com/thorin"}]}`)); err == nil || !strings.Contains(err.Error(), "character 'thorin'") {
+		t.Errorf("malformed sheet URL: error = %v, want one naming the character", err)
+	}
+}
+
+func TestLoadServiceConfigSources(t *testing.T) {
+	captureLog(t)
+	configJson := `{"keyStyle": "camel", "characters": [{"characterKey": "thorin", "sheetId": "sheet",
+		"attributes": [{"name": "hp", "range": "B2"}]}]}`
+	want, err := ParseServiceConfig([]byte(configJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(t.TempDir(), "party.json")
+	if err := ioutil.WriteFile(configPath, []byte(configJson), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		load func() ServiceConfig
+	}{
+		{"file", func() ServiceConfig { return LoadServiceConfig(configPath) }},
+		{"environment", func() ServiceConfig {
+			t.Setenv(configJsonEnv, configJson)
+			return LoadServiceConfigEnv()
+		}},
+		{"reader", func() ServiceConfig { return LoadServiceConfigReader("test", strings.NewReader(configJson)) }},
+		{"stdin", func() ServiceConfig {
+			file, err := os.Open(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			stdin := os.Stdin
+			os.Stdin = file
+			defer func() { os.Stdin = stdin }()
+			return LoadServiceConfig("-")
+		}},
+	}
+
+	for _, test := range tests {
+		if got := test.load(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: config = %+v, want %+v", test.name, got, want)
+		}
+	}
+}
+
+func TestInConfigOrder(t *testing.T) {
+	configEntry := ConfigEntry{CharacterKey: "thorin", Attributes: []AttributeRow{
+		{Name: "hp", Range: "B2"},
+		{Range: "B3:D3", Names: []string{"str", "dex", "con"}},
+		{Name: "ac", Range: "B4"},
+	}}
+
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, []string{}},
+		{[]string{"ac", "hp"}, []string{"hp", "ac"}},
+		{[]string{"con", "ac", "str"}, []string{"str", "con", "ac"}},
+		{[]string{"ac", "unknown", "dex"}, []string{"dex", "ac"}},
+	}
+
+	for _, test := range tests {
+		if got := configEntry.InConfigOrder(test.names); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("InConfigOrder(%v) = %v, want %v", test.names, got, test.want)
+		}
+	}
+}
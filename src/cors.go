@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+const defaultCorsMaxAgeSeconds = 600
+
+// headers browsers may send on cross-origin requests, and the ones they may read back
+var (
+	corsAllowedMethods = "GET, POST, PATCH, OPTIONS"
+	corsAllowedHeaders = "Accept-Version, Authorization, Content-Type, If-None-Match, X-API-Key"
+	corsExposedHeaders = "ETag, " + signatureHeader
+)
+
+type CorsConfig struct {
+	// origins such as "https://overlay.example.com" that browsers may read responses
+	// from; "https://*.example.com" matches its subdomains. Any origin when left out.
+	AllowedOrigins []string `json:"allowedOrigins"`
+
+	// how long browsers may cache a preflight; defaults to 600
+	MaxAgeSeconds int `json:"maxAgeSeconds"`
+}
+
+func (config CorsConfig) Validate() error {
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			(parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+			return fmt.Errorf("cors origin '%s' must be * or scheme://host[:port]", origin)
+		}
+	}
+	if config.MaxAgeSeconds < 0 {
+		return fmt.Errorf("cors maxAgeSeconds can't be negative")
+	}
+	return nil
+}
+
+// AllowsAnyOrigin tells whether any site may read responses, which is how the service
+// behaved before origins could be configured.
+func (config CorsConfig) AllowsAnyOrigin() bool {
+	if len(config.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (config CorsConfig) AllowsOrigin(origin string) bool {
+	if config.AllowsAnyOrigin() {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range config.AllowedOrigins {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "/"))
+		if allowed == origin {
+			return true
+		}
+		// "https://*.example.com" matches "https://a.example.com", but not "https://example.com"
+		if i := strings.Index(allowed, "://*."); i >= 0 {
+			prefix, suffix := allowed[:i+3], allowed[i+4:]
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+				len(origin) > len(prefix)+len(suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CorsMiddleware adds the CORS headers for allowed origins and answers preflight requests,
+// so handlers don't have to.
+func (app *CharacterSheetServiceApp) CorsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := app.Config.Cors
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && config.AllowsOrigin(origin)
+
+		if config.AllowsAnyOrigin() {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			// the response depends on the origin, so caches mustn't share it between origins
+			w.Header().Add("Vary", "Origin")
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+		if allowed {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !allowed {
+			// Origin not in allowedOrigins - 403 Forbidden error
+			WriteApiResponseJson(w, ApiResponse{
+				Metadata: NewMetadata(r.URL.Path, http.StatusForbidden,
+					fmt.Sprintf("Origin '%s' is not allowed to make requests to this service.", origin)),
+			})
+			return
+		}
+
+		maxAge := config.MaxAgeSeconds
+		if maxAge == 0 {
+			maxAge = defaultCorsMaxAgeSeconds
+		}
+		w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// CheckWebSocketOrigin turns away websockets opened by pages on origins that aren't allowed.
+// Clients that aren't browsers don't send an Origin, and are let through.
+func (app *CharacterSheetServiceApp) CheckWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || app.Config.Cors.AllowsOrigin(origin) {
+		return nil
+	}
+	return fmt.Errorf("origin '%s' is not allowed", origin)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowsOrigin(t *testing.T) {
+	config := CorsConfig{AllowedOrigins: []string{"https://overlay.example.com/", "https://*.streams.example.com", "http://localhost:8080"}}
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"exact", "https://overlay.example.com", true},
+		{"exact in another case", "https://Overlay.Example.com", true},
+		{"subdomain", "https://obs.streams.example.com", true},
+		{"deeper subdomain", "https://a.obs.streams.example.com", true},
+		{"bare apex", "https://streams.example.com", false},
+		{"only the dot", "https://.streams.example.com", false},
+		{"lookalike", "https://evilstreams.example.com", false},
+		{"scheme mismatch", "http://overlay.example.com", false},
+		{"wildcard scheme mismatch", "http://obs.streams.example.com", false},
+		{"port", "http://localhost:8080", true},
+		{"other port", "http://localhost:3000", false},
+		{"suffix of an exact origin", "https://overlay.example.com.evil.com", false},
+		{"unlisted", "https://example.org", false},
+	}
+
+	for _, test := range tests {
+		if got := config.AllowsOrigin(test.origin); got != test.want {
+			t.Errorf("%s: AllowsOrigin(%q) = %v, want %v", test.name, test.origin, got, test.want)
+		}
+	}
+
+	for _, config := range []CorsConfig{{}, {AllowedOrigins: []string{"https://overlay.example.com", "*"}}} {
+		if !config.AllowsOrigin("https://example.org") {
+			t.Errorf("%v: didn't allow any origin", config.AllowedOrigins)
+		}
+	}
+}
+
+func TestCorsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CorsConfig
+		wantErr bool
+	}{
+		{"any", CorsConfig{AllowedOrigins: []string{"*"}}, false},
+		{"origins", CorsConfig{AllowedOrigins: []string{"https://overlay.example.com", "http://localhost:8080/", "https://*.example.com"}}, false},
+		{"no scheme", CorsConfig{AllowedOrigins: []string{"overlay.example.com"}}, true},
+		{"other scheme", CorsConfig{AllowedOrigins: []string{"ftp://overlay.example.com"}}, true},
+		{"path", CorsConfig{AllowedOrigins: []string{"https://overlay.example.com/widgets"}}, true},
+		{"query", CorsConfig{AllowedOrigins: []string{"https://overlay.example.com?a=b"}}, true},
+		{"negative max age", CorsConfig{MaxAgeSeconds: -1}, true},
+	}
+
+	for _, test := range tests {
+		if err := test.config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestCorsMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowedOrigins  []string
+		method          string
+		origin          string
+		preflight       bool
+		wantStatus      int
+		wantAllowOrigin string
+		wantVary        bool
+		wantHandled     bool
+	}{
+		{"any origin", nil, http.MethodGet, "https://example.org", false, http.StatusOK, "*", false, true},
+		{"any origin, no Origin", nil, http.MethodGet, "", false, http.StatusOK, "*", false, true},
+		{"allowed", []string{"https://overlay.example.com"}, http.MethodGet, "https://overlay.example.com", false, http.StatusOK, "https://overlay.example.com", true, true},
+		// browsers keep the response from the page; the request itself still goes through
+		{"not allowed", []string{"https://overlay.example.com"}, http.MethodGet, "https://example.org", false, http.StatusOK, "", true, true},
+		{"no Origin", []string{"https://overlay.example.com"}, http.MethodGet, "", false, http.StatusOK, "", true, true},
+		{"preflight allowed", []string{"https://*.example.com"}, http.MethodOptions, "https://obs.example.com", true, http.StatusNoContent, "https://obs.example.com", true, false},
+		{"preflight not allowed", []string{"https://*.example.com"}, http.MethodOptions, "https://example.com", true, http.StatusForbidden, "", true, false},
+		{"preflight, any origin", nil, http.MethodOptions, "https://example.org", true, http.StatusNoContent, "*", false, false},
+		{"OPTIONS that isn't a preflight", []string{"https://overlay.example.com"}, http.MethodOptions, "https://overlay.example.com", false, http.StatusOK, "https://overlay.example.com", true, true},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		app.Config.Cors = CorsConfig{AllowedOrigins: test.allowedOrigins, MaxAgeSeconds: 60}
+		handled := false
+		handler := app.CorsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handled = true
+		}))
+
+		r := httptest.NewRequest(test.method, "/thorin", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.preflight {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != test.wantAllowOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", test.name, got, test.wantAllowOrigin)
+		}
+		if vary := w.Header().Get("Vary") == "Origin"; vary != test.wantVary {
+			t.Errorf("%s: Vary: Origin = %v, want %v", test.name, vary, test.wantVary)
+		}
+		if handled != test.wantHandled {
+			t.Errorf("%s: handled = %v, want %v", test.name, handled, test.wantHandled)
+		}
+		if test.wantStatus == http.StatusNoContent {
+			if got := w.Header().Get("Access-Control-Max-Age"); got != "60" {
+				t.Errorf("%s: Access-Control-Max-Age = %q, want 60", test.name, got)
+			}
+			if w.Header().Get("Access-Control-Allow-Methods") == "" || w.Header().Get("Access-Control-Allow-Headers") == "" {
+				t.Errorf("%s: preflight is missing the allowed methods or headers", test.name)
+			}
+		}
+	}
+}
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		wantErr bool
+	}{
+		{"allowed", "https://overlay.example.com", false},
+		{"not allowed", "https://example.org", true},
+		{"not a browser", "", false},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		app.Config.Cors = CorsConfig{AllowedOrigins: []string{"https://overlay.example.com"}}
+
+		r := httptest.NewRequest(http.MethodGet, "/ws/thorin", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if err := app.CheckWebSocketOrigin(nil, r); (err != nil) != test.wantErr {
+			t.Errorf("%s: CheckWebSocketOrigin() = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
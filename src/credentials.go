@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	apiKeyFile             = "api-key.json"
+	serviceAccountFile     = "credentials.json"
+	applicationCredentials = "GOOGLE_APPLICATION_CREDENTIALS"
+)
+
+// read-only access is all the service needs, whichever account it runs as, unless it
+// writes back to the sheets
+var credentialScopes = []string{sheets.SpreadsheetsReadonlyScope, drive.DriveMetadataReadonlyScope}
+
+func ConfigureCredentialScopes(writeBack bool) {
+	if writeBack {
+		credentialScopes = []string{sheets.SpreadsheetsScope, drive.DriveMetadataReadonlyScope}
+		return
+	}
+	credentialScopes = []string{sheets.SpreadsheetsReadonlyScope, drive.DriveMetadataReadonlyScope}
+}
+
+// CredentialSource is one place Google credentials may come from. Find returns found=false
+// when the source simply isn't there, and an error when it's there but unusable.
+type CredentialSource struct {
+	Description string
+	Find        func() (option option.ClientOption, found bool, err error)
+}
+
+// credentialSources are tried in order; the first one present is used.
+var credentialSources = []CredentialSource{
+	{Description: apiKeyFile + " (API key)", Find: findApiKeyCredentials},
+	{Description: serviceAccountFile + " (service account)", Find: findServiceAccountCredentials},
+	{Description: "application default credentials ($" + applicationCredentials + ", gcloud or the metadata server)", Find: findApplicationDefaultCredentials},
+}
+
+// FindCredentials probes each credential source in order, failing only if none is present.
+func FindCredentials() (option.ClientOption, string, error) {
+	for _, source := range credentialSources {
+		clientOption, found, err := source.Find()
+		if err != nil {
+			return nil, "", err
+		}
+		if found {
+			return clientOption, source.Description, nil
+		}
+	}
+
+	looked := []string{}
+	for _, source := range credentialSources {
+		looked = append(looked, source.Description)
+	}
+	return nil, "", fmt.Errorf("No Google credentials found; looked for: %s", strings.Join(looked, ", "))
+}
+
+func findApiKeyCredentials() (option.ClientOption, bool, error) {
+	fileBytes, err := ioutil.ReadFile(apiKeyFile)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("Unable to read API config file: %v", err)
+	}
+
+	var apiConfig ApiConfig
+	if err := json.Unmarshal(fileBytes, &apiConfig); err != nil {
+		return nil, false, fmt.Errorf("Invalid %s: %v", apiKeyFile, err)
+	}
+	return option.WithAPIKey(apiConfig.ApiKey), true, nil
+}
+
+// findServiceAccountCredentials reads a service account key, for private sheets shared
+// with the service account's email address.
+func findServiceAccountCredentials() (option.ClientOption, bool, error) {
+	fileBytes, err := ioutil.ReadFile(serviceAccountFile)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("Unable to read %s: %v", serviceAccountFile, err)
+	}
+
+	credentials, err := google.CredentialsFromJSON(context.Background(), fileBytes, credentialScopes...)
+	if err != nil {
+		return nil, false, fmt.Errorf("Invalid %s: %v", serviceAccountFile, err)
+	}
+
+	var serviceAccount struct {
+		ClientEmail string `json:"client_email"`
+	}
+	if json.Unmarshal(fileBytes, &serviceAccount) == nil && serviceAccount.ClientEmail != "" {
+		log.Printf("  * private sheets must be shared with %s", serviceAccount.ClientEmail)
+	}
+	return option.WithCredentials(credentials), true, nil
+}
+
+// findApplicationDefaultCredentials uses whatever Google's client libraries would find on
+// their own: $GOOGLE_APPLICATION_CREDENTIALS, `gcloud auth application-default login`, or
+// the metadata server when running on Google Cloud.
+func findApplicationDefaultCredentials() (option.ClientOption, bool, error) {
+	credentials, err := google.FindDefaultCredentials(context.Background(), credentialScopes...)
+	if err != nil {
+		// a file named by the environment variable should be usable
+		if path := os.Getenv(applicationCredentials); path != "" {
+			return nil, false, fmt.Errorf("Invalid $%s (%s): %v", applicationCredentials, path, err)
+		}
+		return nil, false, nil
+	}
+	return option.WithCredentials(credentials), true, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindCredentials(t *testing.T) {
+	tests := []struct {
+		name            string
+		files           map[string]string
+		applicationEnv  string
+		wantDescription string
+		wantErr         string
+	}{
+		{
+			name:            "api key",
+			files:           map[string]string{apiKeyFile: `{"apiKey": "key"}`},
+			wantDescription: apiKeyFile + " (API key)",
+		},
+		{
+			name:            "service account",
+			files:           map[string]string{serviceAccountFile: `{"type": "service_account"}`},
+			wantDescription: serviceAccountFile + " (service account)",
+		},
+		{
+			name:    "unusable service account",
+			files:   map[string]string{serviceAccountFile: `{"type": "service_account"`},
+			wantErr: "Invalid " + serviceAccountFile,
+		},
+		{
+			name:            "application default credentials",
+			files:           map[string]string{"adc.json": `{"type": "service_account"}`},
+			applicationEnv:  "adc.json",
+			wantDescription: "application default credentials ($" + applicationCredentials + ", gcloud or the metadata server)",
+		},
+		{
+			name:           "missing application default credentials",
+			applicationEnv: "/etc/gcloud/credentials.json",
+			wantErr:        "Invalid $" + applicationCredentials,
+		},
+		{
+			name:            "first source wins",
+			files:           map[string]string{apiKeyFile: `{"apiKey": "key"}`, serviceAccountFile: `{}`},
+			applicationEnv:  "/etc/gcloud/credentials.json",
+			wantDescription: apiKeyFile + " (API key)",
+		},
+		{
+			name:    "unusable source",
+			files:   map[string]string{apiKeyFile: `{"apiKey": `, serviceAccountFile: `{}`},
+			wantErr: "Invalid " + apiKeyFile,
+		},
+		{
+			name:    "none present",
+			wantErr: "No Google credentials found",
+		},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		for name, contents := range test.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		chdir(t, dir)
+		t.Setenv(applicationCredentials, test.applicationEnv)
+
+		clientOption, description, err := FindCredentials()
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if clientOption == nil {
+			t.Errorf("%s: no client option", test.name)
+		}
+		if description != test.wantDescription {
+			t.Errorf("%s: description = %q, want %q", test.name, description, test.wantDescription)
+		}
+	}
+}
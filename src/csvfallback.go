@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+const csvExportUrlFormat = "https://docs.google.com/spreadsheets/d/%s/export?format=csv&gid=%d"
+
+var csvExportClient = &http.Client{Timeout: 10 * time.Second}
+
+// FetchValueRangesFromCsvExport reads a publicly-shared sheet through its CSV export, as a
+// best-effort stand-in for BatchGet. Only A1 ranges can be read this way; named ranges are
+// left empty unless an earlier fetch found where they are (see SheetLayout.ResolveRanges).
+func FetchValueRangesFromCsvExport(ctx context.Context, charConfig ConfigEntry) ([]*sheets.ValueRange, error) {
+	grids := map[int64][][]string{}
+	valueRanges := make([]*sheets.ValueRange, len(charConfig.Attributes))
+
+	for i, attr := range charConfig.Attributes {
+		valueRanges[i] = &sheets.ValueRange{Range: attr.Range}
+		if attr.Range == "" {
+			continue
+		}
+
+		parsed, ok := ParseA1Range(attr.Range)
+		if !ok {
+			log.Printf("  * range '%s' can't be read from a CSV export; skipping", attr.Range)
+			continue
+		}
+
+		// ranges without a tab name refer to the first tab, which is normally gid 0
+		gid, found := charConfig.SheetGids[parsed.Sheet]
+		if !found && parsed.Sheet != "" {
+			log.Printf("  * no gid configured in sheetGids for tab '%s'; skipping", parsed.Sheet)
+			continue
+		}
+
+		grid, downloaded := grids[gid]
+		if !downloaded {
+			var err error
+			grid, err = DownloadCsvExport(ctx, charConfig.SheetId, gid)
+			if err != nil {
+				return nil, err
+			}
+			grids[gid] = grid
+		}
+
+		valueRanges[i].Values = ExtractCsvRange(grid, parsed)
+	}
+
+	return valueRanges, nil
+}
+
+func DownloadCsvExport(ctx context.Context, sheetId string, gid int64) ([][]string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(csvExportUrlFormat, sheetId, gid), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := csvExportClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CSV export of gid %d returned %s", gid, response.Status)
+	}
+
+	return ParseCsvExport(response.Body)
+}
+
+func ParseCsvExport(reader io.Reader) ([][]string, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	return csvReader.ReadAll()
+}
+
+// ExtractCsvRange returns the cells of an A1 range from a CSV grid, trimming trailing empty
+// cells and rows the same way the Sheets API does.
+func ExtractCsvRange(grid [][]string, parsed A1Range) [][]interface{} {
+	values := [][]interface{}{}
+
+	for r := parsed.StartRow - 1; r < parsed.EndRow && r < len(grid); r++ {
+		row := []interface{}{}
+		lastNonEmpty := -1
+		for c := parsed.StartCol - 1; c < parsed.EndCol && c < len(grid[r]); c++ {
+			row = append(row, grid[r][c])
+			if grid[r][c] != "" {
+				lastNonEmpty = len(row) - 1
+			}
+		}
+		values = append(values, row[:lastNonEmpty+1])
+	}
+
+	for len(values) > 0 && len(values[len(values)-1]) == 0 {
+		values = values[:len(values)-1]
+	}
+
+	return values
+}
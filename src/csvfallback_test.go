@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCsvExportToAttributes(t *testing.T) {
+	export := "Name,Thorin Oakenshield,,\n" +
+		"HP,27,38,\n" +
+		"\"Notes, long\",\"line one\nline two\",,\n" +
+		"STR,DEX,CON,\n" +
+		"16,12,14,\n"
+	grid, err := ParseCsvExport(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ParseCsvExport: %v", err)
+	}
+
+	attributes := []AttributeRow{
+		{Name: "name", Range: "B1"},
+		{Name: "hp", Range: "B2"},
+		{Name: "notes", Range: "B3"},
+		{Range: "A5:C5", Names: []string{"str", "dex", "con"}},
+		{Name: "empty", Range: "D1"},
+		{Name: "offTheGrid", Range: "Z99"},
+	}
+	want := map[string]string{
+		"name":  "Thorin Oakenshield",
+		"hp":    "27",
+		"notes": "line one\nline two",
+		"str":   "16",
+		"dex":   "12",
+		"con":   "14",
+	}
+
+	charMap := map[string]string{}
+	for _, attr := range attributes {
+		parsed, _ := ParseA1Range(attr.Range)
+		values := ExtractCsvRange(grid, parsed)
+		if len(attr.Names) > 0 {
+			if err := MapRangeToNames(attr, values, charMap); err != nil {
+				t.Errorf("%s: %v", attr.Range, err)
+			}
+		} else if len(values) > 0 {
+			charMap[attr.Name] = values[0][0].(string)
+		}
+	}
+
+	if !reflect.DeepEqual(charMap, want) {
+		t.Errorf("attributes = %v, want %v", charMap, want)
+	}
+}
+
+func TestExtractCsvRange(t *testing.T) {
+	grid := [][]string{
+		{"a", "b", "", ""},
+		{"", "", "", ""},
+		{"c", "", "d"},
+	}
+
+	tests := []struct {
+		a1Range string
+		want    [][]interface{}
+	}{
+		{"A1", [][]interface{}{{"a"}}},
+		{"A1:D1", [][]interface{}{{"a", "b"}}},
+		{"A1:C3", [][]interface{}{{"a", "b"}, {}, {"c", "", "d"}}},
+		{"A2:D2", [][]interface{}{}},
+		{"C1:D2", [][]interface{}{}},
+		{"A3:E9", [][]interface{}{{"c", "", "d"}}},
+	}
+
+	for _, test := range tests {
+		parsed, _ := ParseA1Range(test.a1Range)
+		if got := ExtractCsvRange(grid, parsed); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ExtractCsvRange(%s) = %v, want %v", test.a1Range, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/api/sheets/v4"
+)
+
+// DataSource is where characters' attributes are read from. Fetch reads the attributes
+// of charConfig, which may be only some of the character's (the ones due a refresh), and
+// returns their raw values by name; formatting, defaults and derived attributes are
+// applied afterwards, the same way for every source.
+type DataSource interface {
+	Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error)
+}
+
+type FetchedAttributes struct {
+	// attribute name -> raw value; attributes left out are empty
+	Values map[string]string
+
+	// attribute name -> why it couldn't be read; these keep their last known values
+	Errors map[string]string
+
+	// some values were cut short by the configured limits
+	Truncated bool
+
+	// range -> the names read from the header row or column of each headers range
+	HeaderNames map[string][]string
+}
+
+// VersionedDataSource is a DataSource that can tell when a character's data last changed,
+// so data that hasn't changed isn't read again. Version returns "" when it doesn't know.
+type VersionedDataSource interface {
+	DataSource
+	Version(ctx context.Context, charConfig ConfigEntry) string
+}
+
+// errTokenRejected is wrapped by sources that authenticate with an access token of their
+// own, such as Airtable, when the token is turned away.
+var errTokenRejected = errors.New("access token was rejected")
+
+func NewFetchedAttributes() FetchedAttributes {
+	return FetchedAttributes{
+		Values:      map[string]string{},
+		Errors:      map[string]string{},
+		HeaderNames: map[string][]string{},
+	}
+}
+
+// SetCells stores the value of an attribute read as a flat list of cells by a source other
+// than a spreadsheet: a list or table of them for array attributes, and otherwise the cells
+// joined with commas.
+func (fetched FetchedAttributes) SetCells(attr AttributeRow, cells []string) {
+	if attr.IsArray() {
+		rows := make([][]interface{}, len(cells))
+		for i, cell := range cells {
+			rows[i] = []interface{}{cell}
+		}
+		fetched.Values[attr.Name] = EncodeCells(attr, rows)
+	} else {
+		fetched.Values[attr.Name] = strings.Join(cells, ", ")
+	}
+}
+
+// MapDataSource serves fixed attribute values, keyed by character; it backs demo mode.
+type MapDataSource map[string]map[string]string
+
+func (source MapDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	fetched := NewFetchedAttributes()
+	for _, name := range charConfig.AttributeNames() {
+		if value, found := source[charConfig.CharacterKey][name]; found {
+			fetched.Values[name] = value
+		}
+	}
+	return fetched, nil
+}
+
+// the sources a character can be read from, by the config field that sets each one up
+const (
+	SourceSheet       = "sheetId"
+	SourceFile        = "file"
+	SourceAirtable    = "airtable"
+	SourceNotion      = "notion"
+	SourceDndBeyond   = "dndBeyond"
+	SourceFoundry     = "foundry"
+	SourcePathbuilder = "pathbuilder"
+	SourceRest        = "rest"
+)
+
+// how each source is named in errors
+var sourceDescriptions = map[string]string{
+	SourceSheet:       "a Google Sheet",
+	SourceFile:        "a local file",
+	SourceAirtable:    "Airtable",
+	SourceNotion:      "Notion",
+	SourceDndBeyond:   "D&D Beyond",
+	SourceFoundry:     "Foundry",
+	SourcePathbuilder: "Pathbuilder",
+	SourceRest:        "a REST API",
+}
+
+// SourceFor picks the data source of a character: a merge of its sources if it has more
+// than one, its local file, Airtable record and so on if it has one of those, and otherwise
+// the app's.
+func (app *CharacterSheetServiceApp) SourceFor(charConfig ConfigEntry) DataSource {
+	if app.DemoAttributes != nil {
+		return app.Source
+	}
+
+	sources := charConfig.SourceOrder()
+	if len(sources) > 1 {
+		return MergedDataSource{app: app}
+	}
+	switch sources[0] {
+	case SourceFile:
+		return LocalFileDataSource{app: app}
+	case SourceAirtable:
+		return AirtableDataSource{app: app}
+	case SourceNotion:
+		return NotionDataSource{app: app}
+	case SourceDndBeyond:
+		return DndBeyondDataSource{app: app}
+	case SourceFoundry:
+		return FoundryDataSource{app: app}
+	case SourcePathbuilder:
+		return PathbuilderDataSource{app: app}
+	case SourceRest:
+		return RestDataSource{app: app}
+	}
+	return app.Source
+}
+
+// ConfiguredSources lists the sources a character has set up. One with none of them is a
+// Google Sheet, as characters always were.
+func (configEntry ConfigEntry) ConfiguredSources() []string {
+	sources := []string{}
+	if configEntry.SheetId != "" {
+		sources = append(sources, SourceSheet)
+	}
+	if configEntry.File != "" {
+		sources = append(sources, SourceFile)
+	}
+	if configEntry.Airtable != nil {
+		sources = append(sources, SourceAirtable)
+	}
+	if configEntry.Notion != nil {
+		sources = append(sources, SourceNotion)
+	}
+	if configEntry.DndBeyond != nil {
+		sources = append(sources, SourceDndBeyond)
+	}
+	if configEntry.Foundry != nil {
+		sources = append(sources, SourceFoundry)
+	}
+	if configEntry.Pathbuilder != nil {
+		sources = append(sources, SourcePathbuilder)
+	}
+	if configEntry.Rest != nil {
+		sources = append(sources, SourceRest)
+	}
+	if len(sources) == 0 {
+		sources = append(sources, SourceSheet)
+	}
+	return sources
+}
+
+// SourceOrder is the character's sources, highest precedence first.
+func (configEntry ConfigEntry) SourceOrder() []string {
+	if len(configEntry.Sources) > 0 {
+		return configEntry.Sources
+	}
+	return configEntry.ConfiguredSources()
+}
+
+func (configEntry ConfigEntry) HasSource(source string) bool {
+	for _, configured := range configEntry.ConfiguredSources() {
+		if configured == source {
+			return true
+		}
+	}
+	return false
+}
+
+// AttributeSource is the source an attribute is read from: its own source, or else the
+// character's first.
+func (configEntry ConfigEntry) AttributeSource(attr AttributeRow) string {
+	if attr.Source != "" {
+		return attr.Source
+	}
+	return configEntry.SourceOrder()[0]
+}
+
+// ReadsFrom is true when any attribute is read from the source.
+func (configEntry ConfigEntry) ReadsFrom(source string) bool {
+	for _, attr := range configEntry.SheetAttributes() {
+		if configEntry.AttributeSource(attr) == source {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSource checks the set up of each of a character's sources, and that its attributes
+// can be read from the sources they name. Sources that look attributes up by field name,
+// rather than by range, have no notes, and no ranges to split across names.
+func (configEntry ConfigEntry) ValidateSource() error {
+	charKey := configEntry.CharacterKey
+
+	var err error
+	if configEntry.File != "" {
+		if extension := strings.ToLower(filepath.Ext(configEntry.File)); extension != ".csv" && extension != ".xlsx" {
+			err = fmt.Errorf("file must be a .csv or .xlsx")
+		}
+	}
+	if err == nil && configEntry.Airtable != nil {
+		err = configEntry.Airtable.Validate()
+	}
+	if err == nil && configEntry.Notion != nil {
+		err = configEntry.Notion.Validate()
+	}
+	if err == nil && configEntry.DndBeyond != nil {
+		err = configEntry.DndBeyond.Validate()
+	}
+	if err == nil && configEntry.Foundry != nil {
+		err = configEntry.Foundry.Validate()
+	}
+	if err == nil && configEntry.Pathbuilder != nil {
+		err = configEntry.Pathbuilder.Validate()
+	}
+	if err == nil && configEntry.Rest != nil {
+		err = configEntry.Rest.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("character '%s': %v", charKey, err)
+	}
+
+	// with more than one source, sources says which wins when they both have an attribute
+	configured := configEntry.ConfiguredSources()
+	if len(configured) > 1 || len(configEntry.Sources) > 0 {
+		listed := map[string]bool{}
+		for _, source := range configEntry.Sources {
+			if !configEntry.HasSource(source) || listed[source] {
+				break
+			}
+			listed[source] = true
+		}
+		if len(listed) != len(configured) || len(configEntry.Sources) != len(configured) {
+			return fmt.Errorf("character '%s': sources must list each of %s once, highest precedence first",
+				charKey, strings.Join(configured, ", "))
+		}
+	}
+
+	byName := map[string]AttributeRow{}
+	for _, attr := range configEntry.SheetAttributes() {
+		// ranges of several names have no name of their own
+		if attr.Name != "" {
+			if other, found := byName[attr.Name]; found && other.Type != attr.Type {
+				return fmt.Errorf("character '%s': attribute '%s' is read from more than one source, with different types",
+					charKey, attr.Name)
+			}
+			byName[attr.Name] = attr
+		}
+
+		if attr.Source != "" && !configEntry.HasSource(attr.Source) {
+			return fmt.Errorf("character '%s': attribute '%s' is read from %s, which isn't set up; must be one of %s",
+				charKey, attr.Name, attr.Source, strings.Join(configured, ", "))
+		}
+
+		source := configEntry.AttributeSource(attr)
+		description := sourceDescriptions[source]
+		if attr.Read != "" && attr.Read != ReadValue && source != SourceSheet {
+			return fmt.Errorf("character '%s': notes can't be read from %s", charKey, description)
+		}
+		if len(attr.Names) > 0 && source != SourceSheet && source != SourceFile {
+			return fmt.Errorf("character '%s': names can't be read from %s; give each field an attribute of its own",
+				charKey, description)
+		}
+		if attr.Headers != "" && source != SourceSheet && source != SourceFile {
+			return fmt.Errorf("character '%s': headers can't be read from %s; give each field an attribute of its own",
+				charKey, description)
+		}
+		if source == SourceDndBeyond && !IsDndBeyondField(attr.Range) {
+			return fmt.Errorf("character '%s': '%s' isn't a D&D Beyond field; must be one of %s",
+				charKey, attr.Range, strings.Join(dndBeyondFields, ", "))
+		}
+		if source == SourceRest {
+			if _, err := ParseJsonPath(attr.Range); err != nil {
+				return fmt.Errorf("character '%s': %v", charKey, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SheetsDataSource reads attributes from Google Sheets, falling back to the CSV export
+// when that's configured.
+type SheetsDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+func (source SheetsDataSource) Version(ctx context.Context, charConfig ConfigEntry) string {
+	if !source.app.Config.SkipUnchangedSheets {
+		return ""
+	}
+	return source.app.SheetModifiedTime(ctx, charConfig.SheetId)
+}
+
+func (source SheetsDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	app := source.app
+	charKey := charConfig.CharacterKey
+
+	ctx, span := tracer.Start(ctx, "Sheets BatchGet")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("character.key", charKey),
+		attribute.Int("sheets.range_count", len(charConfig.Attributes)),
+	)
+
+	// named ranges move when rows are inserted, so look up where they are now
+	var unresolved map[string]string
+	if charConfig.HasNamedRanges() {
+		layout, err := app.FetchSheetLayout(ctx, charConfig.SheetId)
+		if err != nil {
+			log.Printf("Unable to read named ranges of sheet for '%s'; reading them by name: %v", charKey, err)
+			layout = app.LastSheetLayout(charConfig.SheetId)
+		}
+		if layout != nil {
+			charConfig, unresolved = layout.ResolveRanges(charConfig)
+		}
+	}
+
+	// Query sheet for list of ranges
+	valueRanges, err := app.BatchGetValueRanges(ctx, charConfig)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		if !app.Config.CsvFallback {
+			return FetchedAttributes{}, err
+		}
+		log.Printf("Sheets API failed for '%s' (%v); falling back to CSV export", charKey, err)
+		var csvErr error
+		if valueRanges, csvErr = FetchValueRangesFromCsvExport(ctx, charConfig); csvErr != nil {
+			// the Sheets error says whether the credentials are to blame
+			log.Printf("Unable to read CSV export for '%s': %v", charKey, csvErr)
+			return FetchedAttributes{}, err
+		}
+	}
+
+	fetched := app.MapValueRanges(charConfig, valueRanges)
+	for name, message := range unresolved {
+		fetched.Errors[name] = message
+	}
+
+	// notes aren't in the values, and need a call of their own each
+	for _, attr := range charConfig.Attributes {
+		if (attr.Read == ReadNote || attr.Read == ReadBoth) && attr.Range != "" {
+			noteName := attr.Name
+			if attr.Read == ReadBoth {
+				noteName = attr.NoteName
+			}
+			if note, err := app.FetchCellNote(ctx, charConfig.SheetId, attr.Range); err != nil {
+				log.Printf("Unable to read note for '%s': %v", charKey, err)
+				fetched.Errors[noteName] = err.Error()
+			} else if note != "" {
+				fetched.Values[noteName] = note
+			}
+		}
+	}
+
+	return fetched, nil
+}
+
+// MapValueRanges maps the cells of each attribute's range, in the same order as the
+// attributes, to their names.
+func (app *CharacterSheetServiceApp) MapValueRanges(charConfig ConfigEntry, valueRanges []*sheets.ValueRange) FetchedAttributes {
+	charKey := charConfig.CharacterKey
+
+	fetched := NewFetchedAttributes()
+	for i, attr := range charConfig.Attributes {
+		// BatchGet can return fewer ranges than requested, or nils, when some ranges are
+		// invalid; keep the last known values for those and carry on with the rest
+		if i >= len(valueRanges) || valueRanges[i] == nil {
+			log.Printf("Range '%s' for '%s' is missing from the Sheets response", attr.Range, charKey)
+			for _, name := range attr.AttributeNames() {
+				fetched.Errors[name] = fmt.Sprintf("range '%s' missing from Sheets response", attr.Range)
+			}
+			continue
+		}
+		valueRange := valueRanges[i]
+
+		// guard against a range that accidentally covers a huge part of the sheet
+		var cellsTruncated bool
+		valueRange.Values, cellsTruncated = TruncateCells(valueRange.Values, app.Config.Limits.CellsPerAttribute())
+		if cellsTruncated {
+			log.Printf("WARNING: range '%s' for '%s' exceeds %d cells; truncating",
+				attr.Range, charKey, app.Config.Limits.CellsPerAttribute())
+			fetched.Truncated = true
+		}
+
+		if attr.Headers != "" {
+			names := MapHeaderTable(attr, valueRange.Values, fetched.Values)
+			fetched.HeaderNames[attr.Range] = names
+		} else if len(attr.Names) > 0 {
+			// multi-cell range; map each cell to a name in row-major order
+			if err := MapRangeToNames(attr, valueRange.Values, fetched.Values); err != nil {
+				log.Printf("Unable to map range for '%s': %v", charKey, err)
+				for _, name := range attr.Names {
+					fetched.Errors[name] = err.Error()
+				}
+			}
+		} else if attr.IsArray() {
+			fetched.Values[attr.Name] = EncodeCells(attr, valueRange.Values)
+		} else if value, found, err := SelectSingleValue(attr, valueRange.Values); err != nil {
+			log.Printf("Range '%s' for '%s': %v", attr.Range, charKey, err)
+			fetched.Errors[attr.Name] = err.Error()
+		} else if found {
+			fetched.Values[attr.Name] = value
+		}
+	}
+
+	return fetched
+}
+
+// DocumentPath looks up a dotted path in a JSON document, for sources that serve one per
+// character. Segments into lists are either an index or, for lists of named things such as
+// items, a name.
+func DocumentPath(document interface{}, path string) (interface{}, bool) {
+	value := document
+	for _, segment := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			next, found := node[segment]
+			if !found {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			if index, err := strconv.Atoi(segment); err == nil {
+				if index < 0 || index >= len(node) {
+					return nil, false
+				}
+				value = node[index]
+				continue
+			}
+			found := false
+			for _, item := range node {
+				if object, ok := item.(map[string]interface{}); ok && object["name"] == segment {
+					value, found = object, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// DocumentValueCells turns a value from a JSON document into cell strings. Lists of objects
+// are served as their names, and lists of lists (Pathbuilder's feats, say) as their first
+// elements.
+func DocumentValueCells(value interface{}) ([]string, error) {
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{typed}, nil
+	case float64:
+		return []string{CellString(typed)}, nil
+	case bool:
+		return []string{strings.ToUpper(strconv.FormatBool(typed))}, nil
+	case []interface{}:
+		cells := []string{}
+		for _, item := range typed {
+			if tuple, ok := item.([]interface{}); ok && len(tuple) > 0 {
+				item = tuple[0]
+			}
+			if object, ok := item.(map[string]interface{}); ok {
+				if name, ok := object["name"].(string); ok {
+					cells = append(cells, name)
+					continue
+				}
+				return nil, fmt.Errorf("list items have no name")
+			}
+			itemCells, err := DocumentValueCells(item)
+			if err != nil {
+				return nil, err
+			}
+			cells = append(cells, itemCells...)
+		}
+		return cells, nil
+	case map[string]interface{}:
+		// resources such as hit points are {value, max}; the path should say which
+		if current, found := typed["value"]; found {
+			return DocumentValueCells(current)
+		}
+		return nil, fmt.Errorf("is an object; give the path of a value inside it")
+	default:
+		return nil, fmt.Errorf("unsupported value %v", typed)
+	}
+}
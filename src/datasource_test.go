@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMapDataSource(t *testing.T) {
+	source := MapDataSource{"thorin": {"hp": "12", "name": "Thorin", "gold": "30"}}
+
+	tests := []struct {
+		name       string
+		charConfig ConfigEntry
+		want       map[string]string
+	}{
+		{
+			name: "configured attributes only",
+			charConfig: ConfigEntry{CharacterKey: "thorin", Attributes: []AttributeRow{
+				{Name: "hp", Range: "B2"}, {Name: "name", Range: "B3"},
+			}},
+			want: map[string]string{"hp": "12", "name": "Thorin"},
+		},
+		{
+			name:       "missing attribute",
+			charConfig: ConfigEntry{CharacterKey: "thorin", Attributes: []AttributeRow{{Name: "ac", Range: "B4"}}},
+			want:       map[string]string{},
+		},
+		{
+			name:       "unknown character",
+			charConfig: ConfigEntry{CharacterKey: "smaug", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+			want:       map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		fetched, err := source.Fetch(context.Background(), test.charConfig)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if !reflect.DeepEqual(fetched.Values, test.want) {
+			t.Errorf("%s: values = %v, want %v", test.name, fetched.Values, test.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// DerivedAttribute is computed from other attributes after each fetch: it takes the label
+// of the first rule that matches, or Default if none do. Or, given an Expression such as
+// "floor((str - 10) / 2)", it's the number that works out to, or Default when an attribute
+// it uses isn't a number.
+type DerivedAttribute struct {
+	Name       string        `json:"name"`
+	Rules      []DerivedRule `json:"rules,omitempty"`
+	Expression string        `json:"expression,omitempty"`
+	Default    string        `json:"default,omitempty"`
+
+	// as for attributes, so values worked out from private ones can be kept private too
+	Private bool `json:"private,omitempty"`
+}
+
+// DerivedRule matches when every condition in All holds, and at least one in Any does
+// (if there are any).
+type DerivedRule struct {
+	Label string             `json:"label"`
+	All   []DerivedCondition `json:"all,omitempty"`
+	Any   []DerivedCondition `json:"any,omitempty"`
+}
+
+// DerivedCondition compares an attribute against either a literal Value, or Percent of
+// another attribute (100 when left out). Numbers are compared numerically; anything else
+// only supports == and !=.
+type DerivedCondition struct {
+	Attribute string   `json:"attribute"`
+	Op        string   `json:"op"`
+	Value     *string  `json:"value,omitempty"`
+	CompareTo string   `json:"compareTo,omitempty"`
+	Percent   *float64 `json:"percent,omitempty"`
+}
+
+var derivedOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (condition DerivedCondition) Matches(charAttributes map[string]string) bool {
+	value, found := charAttributes[condition.Attribute]
+	if !found {
+		return false
+	}
+
+	var other string
+	if condition.Value != nil {
+		other = *condition.Value
+	} else if other, found = charAttributes[condition.CompareTo]; !found {
+		return false
+	}
+
+	number, numeric := ParseNumericValue(value)
+	otherNumber, otherNumeric := ParseNumericValue(other)
+	if numeric && otherNumeric {
+		if condition.Percent != nil {
+			otherNumber = otherNumber * *condition.Percent / 100
+		}
+		switch condition.Op {
+		case "==":
+			return number == otherNumber
+		case "!=":
+			return number != otherNumber
+		case "<":
+			return number < otherNumber
+		case "<=":
+			return number <= otherNumber
+		case ">":
+			return number > otherNumber
+		case ">=":
+			return number >= otherNumber
+		}
+		return false
+	}
+
+	switch condition.Op {
+	case "==":
+		return value == other
+	case "!=":
+		return value != other
+	}
+	return false
+}
+
+func (rule DerivedRule) Matches(charAttributes map[string]string) bool {
+	for _, condition := range rule.All {
+		if !condition.Matches(charAttributes) {
+			return false
+		}
+	}
+	if len(rule.Any) == 0 {
+		return true
+	}
+	for _, condition := range rule.Any {
+		if condition.Matches(charAttributes) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyDerivedAttributes evaluates each derived attribute in config order, so later ones
+// may build on earlier ones.
+func ApplyDerivedAttributes(charConfig ConfigEntry, charMap map[string]string) {
+	for _, derived := range charConfig.Derived {
+		charMap[derived.Name] = derived.Default
+		if derived.Expression != "" {
+			// checked, and compiled, by ValidateDerived
+			if expression, err := CompileExpression(derived.Expression); err == nil {
+				if result, err := expression.Evaluate(charMap); err == nil {
+					// rounded enough to hide floating point noise, e.g. 0.1 + 0.2
+					charMap[derived.Name] = strconv.FormatFloat(math.Round(result*1e9)/1e9, 'f', -1, 64)
+				}
+			}
+			continue
+		}
+		for _, rule := range derived.Rules {
+			if rule.Matches(charMap) {
+				charMap[derived.Name] = rule.Label
+				break
+			}
+		}
+	}
+}
+
+// ValidateDerived checks that derived attributes only refer to attributes defined before them.
+func (configEntry ConfigEntry) ValidateDerived() error {
+	defined := map[string]bool{}
+	for _, attr := range configEntry.Attributes {
+		for _, name := range attr.AttributeNames() {
+			defined[name] = true
+		}
+	}
+
+	for _, derived := range configEntry.Derived {
+		if derived.Name == "" || defined[derived.Name] {
+			return fmt.Errorf("character '%s': derived attribute '%s' needs a name of its own",
+				configEntry.CharacterKey, derived.Name)
+		}
+
+		if (len(derived.Rules) == 0) == (derived.Expression == "") {
+			return fmt.Errorf("character '%s': derived attribute '%s' needs either rules or an expression",
+				configEntry.CharacterKey, derived.Name)
+		}
+		if derived.Expression != "" {
+			expression, err := CompileExpression(derived.Expression)
+			if err != nil {
+				return fmt.Errorf("character '%s': derived attribute '%s': %v", configEntry.CharacterKey, derived.Name, err)
+			}
+			for _, name := range expression.Names() {
+				if !defined[name] && !configEntry.HasHeaderRanges() {
+					return fmt.Errorf("character '%s': derived attribute '%s' refers to undefined attribute '%s'",
+						configEntry.CharacterKey, derived.Name, name)
+				}
+			}
+		}
+
+		for _, rule := range derived.Rules {
+			if len(rule.All)+len(rule.Any) == 0 {
+				return fmt.Errorf("character '%s': rule '%s' of derived attribute '%s' has no conditions",
+					configEntry.CharacterKey, rule.Label, derived.Name)
+			}
+
+			for _, condition := range append(append([]DerivedCondition{}, rule.All...), rule.Any...) {
+				if !derivedOps[condition.Op] {
+					return fmt.Errorf("character '%s': derived attribute '%s' has unknown op '%s'",
+						configEntry.CharacterKey, derived.Name, condition.Op)
+				}
+				if (condition.Value == nil) == (condition.CompareTo == "") {
+					return fmt.Errorf("character '%s': each condition of derived attribute '%s' needs one of value or compareTo",
+						configEntry.CharacterKey, derived.Name)
+				}
+				if condition.Attribute == "" {
+					return fmt.Errorf("character '%s': each condition of derived attribute '%s' needs an attribute",
+						configEntry.CharacterKey, derived.Name)
+				}
+				for _, name := range []string{condition.Attribute, condition.CompareTo} {
+					if name != "" && !defined[name] && !configEntry.HasHeaderRanges() {
+						return fmt.Errorf("character '%s': derived attribute '%s' refers to undefined attribute '%s'",
+							configEntry.CharacterKey, derived.Name, name)
+					}
+				}
+			}
+		}
+
+		defined[derived.Name] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyDerivedAttributes(t *testing.T) {
+	half := 50.0
+	configEntry := ConfigEntry{CharacterKey: "thorin", Derived: []DerivedAttribute{
+		{
+			Name:    "condition",
+			Default: "healthy",
+			Rules: []DerivedRule{
+				{Label: "down", All: []DerivedCondition{{Attribute: "hp", Op: "<=", Value: stringPointer("0")}}},
+				// bloodied and raging, or bloodied and concentrating
+				{Label: "desperate", All: []DerivedCondition{{Attribute: "hp", Op: "<", CompareTo: "maxHp", Percent: &half}},
+					Any: []DerivedCondition{{Attribute: "rage", Op: "==", Value: stringPointer("yes")}, {Attribute: "concentrating", Op: "==", Value: stringPointer("yes")}}},
+				{Label: "bloodied", All: []DerivedCondition{{Attribute: "hp", Op: "<", CompareTo: "maxHp", Percent: &half}}},
+			},
+		},
+		// builds on the derived attribute before it
+		{Name: "alert", Rules: []DerivedRule{
+			{Label: "!", Any: []DerivedCondition{{Attribute: "condition", Op: "==", Value: stringPointer("down")}, {Attribute: "condition", Op: "==", Value: stringPointer("desperate")}}},
+		}},
+	}}
+
+	tests := []struct {
+		name          string
+		attributes    map[string]string
+		wantCondition string
+		wantAlert     string
+	}{
+		{"healthy", map[string]string{"hp": "40", "maxHp": "40", "rage": "no"}, "healthy", ""},
+		{"bloodied", map[string]string{"hp": "19", "maxHp": "40", "rage": "no"}, "bloodied", ""},
+		{"at half", map[string]string{"hp": "20", "maxHp": "40"}, "healthy", ""},
+		{"desperate by any", map[string]string{"hp": "19", "maxHp": "40", "rage": "no", "concentrating": "yes"}, "desperate", "!"},
+		{"first rule wins", map[string]string{"hp": "0", "maxHp": "40", "rage": "yes"}, "down", "!"},
+		{"missing attribute", map[string]string{"hp": "19"}, "healthy", ""},
+		{"not a number", map[string]string{"hp": "?", "maxHp": "40"}, "healthy", ""},
+	}
+
+	for _, test := range tests {
+		ApplyDerivedAttributes(configEntry, test.attributes)
+		if got := test.attributes["condition"]; got != test.wantCondition {
+			t.Errorf("%s: condition = %q, want %q", test.name, got, test.wantCondition)
+		}
+		if got := test.attributes["alert"]; got != test.wantAlert {
+			t.Errorf("%s: alert = %q, want %q", test.name, got, test.wantAlert)
+		}
+	}
+}
+
+func TestValidateDerived(t *testing.T) {
+	attributes := []AttributeRow{{Name: "hp", Range: "B2"}, {Name: "maxHp", Range: "B3"}}
+	condition := DerivedCondition{Attribute: "hp", Op: "<", CompareTo: "maxHp"}
+
+	tests := []struct {
+		name    string
+		derived []DerivedAttribute
+		wantErr string
+	}{
+		{"valid", []DerivedAttribute{{Name: "hurt", Rules: []DerivedRule{{Label: "yes", All: []DerivedCondition{condition}}}}}, ""},
+		{"undefined attribute", []DerivedAttribute{{Name: "hurt", Rules: []DerivedRule{{Label: "yes",
+			All: []DerivedCondition{{Attribute: "tempHp", Op: ">", Value: stringPointer("0")}}}}}}, "undefined attribute 'tempHp'"},
+		{"undefined compareTo", []DerivedAttribute{{Name: "hurt", Rules: []DerivedRule{{Label: "yes",
+			Any: []DerivedCondition{{Attribute: "hp", Op: "<", CompareTo: "maxHP"}}}}}}, "undefined attribute 'maxHP'"},
+		{"refers to a later derived attribute", []DerivedAttribute{
+			{Name: "alert", Rules: []DerivedRule{{Label: "!", All: []DerivedCondition{{Attribute: "hurt", Op: "==", Value: stringPointer("yes")}}}}},
+			{Name: "hurt", Rules: []DerivedRule{{Label: "yes", All: []DerivedCondition{condition}}}},
+		}, "undefined attribute 'hurt'"},
+		{"name taken", []DerivedAttribute{{Name: "hp", Rules: []DerivedRule{{Label: "yes", All: []DerivedCondition{condition}}}}}, "needs a name of its own"},
+		{"no conditions", []DerivedAttribute{{Name: "hurt", Rules: []DerivedRule{{Label: "yes"}}}}, "has no conditions"},
+		{"unknown op", []DerivedAttribute{{Name: "hurt", Rules: []DerivedRule{{Label: "yes",
+			All: []DerivedCondition{{Attribute: "hp", Op: "=<", CompareTo: "maxHp"}}}}}}, "unknown op '=<'"},
+		{"value and compareTo", []DerivedAttribute{{Name: "hurt", Rules: []DerivedRule{{Label: "yes",
+			All: []DerivedCondition{{Attribute: "hp", Op: "<", CompareTo: "maxHp", Value: stringPointer("10")}}}}}}, "one of value or compareTo"},
+		{"expression", []DerivedAttribute{{Name: "percent", Expression: "hp / maxHp * 100"}}, ""},
+		{"expression with trailing garbage", []DerivedAttribute{{Name: "percent", Expression: "hp + 1 {"}}, "unclosed {"},
+		{"expression with empty braces", []DerivedAttribute{{Name: "percent", Expression: "hp {}"}}, "empty {}"},
+		{"expression with undefined attribute", []DerivedAttribute{{Name: "percent", Expression: "hp / maxHP"}}, "undefined attribute 'maxHP'"},
+	}
+
+	for _, test := range tests {
+		err := ConfigEntry{CharacterKey: "thorin", Attributes: attributes, Derived: test.derived}.ValidateDerived()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The Discord bot answers the /character slash command, which Discord delivers by POSTing
+// to /discord/interactions; set that as the application's Interactions Endpoint URL in the
+// developer portal. The command is registered when the service starts. Attribute changes
+// can also be announced to a channel.
+
+const (
+	defaultDiscordApiUrl = "https://discord.com/api/v10"
+	discordCommandName   = "character"
+
+	// Discord rejects messages longer than this
+	discordMessageLimit = 2000
+
+	// interaction and response types, from Discord's API
+	discordInteractionPing    = 1
+	discordInteractionCommand = 2
+	discordResponsePong       = 1
+	discordResponseMessage    = 4
+	discordOptionString       = 3
+)
+
+var discordClient = &http.Client{Timeout: 10 * time.Second}
+
+type DiscordConfig struct {
+	// the bot's token; the bot is off when this is empty
+	BotToken string `json:"botToken"`
+
+	// from the application's page in the developer portal; the public key (hex) verifies
+	// that interactions come from Discord
+	ApplicationId string `json:"applicationId"`
+	PublicKey     string `json:"publicKey"`
+
+	// registers the command in this server only, where it's usable at once, rather than
+	// globally
+	GuildId string `json:"guildId,omitempty"`
+
+	// where attribute changes are announced; not announced when left out. Only the
+	// AnnounceAttributes are announced when given, and never private ones.
+	AnnounceChannelId  string   `json:"announceChannelId,omitempty"`
+	AnnounceAttributes []string `json:"announceAttributes,omitempty"`
+
+	// defaults to https://discord.com/api/v10
+	ApiUrl string `json:"apiUrl,omitempty"`
+}
+
+func (config DiscordConfig) Enabled() bool {
+	return config.BotToken != ""
+}
+
+func (config DiscordConfig) Validate() error {
+	if !config.Enabled() {
+		return nil
+	}
+	if config.ApplicationId == "" {
+		return fmt.Errorf("discord needs the bot's applicationId")
+	}
+	if key, err := hex.DecodeString(config.PublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("discord publicKey must be the application's hex encoded public key")
+	}
+	return nil
+}
+
+func (config DiscordConfig) apiUrl(path string) string {
+	base := config.ApiUrl
+	if base == "" {
+		base = defaultDiscordApiUrl
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// discordRequest calls the Discord API as the bot.
+func (config DiscordConfig) discordRequest(method string, path string, body interface{}) error {
+	bodyJson, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, config.apiUrl(path), bytes.NewReader(bodyJson))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+config.BotToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := discordClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("discord responded %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// RegisterDiscordCommands creates or updates the /character command.
+func RegisterDiscordCommands(config DiscordConfig) error {
+	path := fmt.Sprintf("/applications/%s/commands", config.ApplicationId)
+	if config.GuildId != "" {
+		path = fmt.Sprintf("/applications/%s/guilds/%s/commands", config.ApplicationId, config.GuildId)
+	}
+
+	commands := []map[string]interface{}{{
+		"name":        discordCommandName,
+		"description": "Show a character's stats",
+		"options": []map[string]interface{}{
+			{"type": discordOptionString, "name": "name", "description": "the character", "required": true},
+			{"type": discordOptionString, "name": "attribute", "description": "just this attribute"},
+		},
+	}}
+	return config.discordRequest(http.MethodPut, path, commands)
+}
+
+type discordInteraction struct {
+	Type int `json:"type"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+func (interaction discordInteraction) Option(name string) string {
+	for _, option := range interaction.Data.Options {
+		if option.Name == name {
+			return strings.TrimSpace(fmt.Sprint(option.Value))
+		}
+	}
+	return ""
+}
+
+// VerifyDiscordSignature checks the Ed25519 signature Discord sends with every interaction,
+// over the timestamp followed by the body.
+func VerifyDiscordSignature(publicKey string, r *http.Request, body []byte) bool {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	message := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	return ed25519.Verify(ed25519.PublicKey(key), message, signature)
+}
+
+func (app *CharacterSheetServiceApp) HandleDiscordInteraction(w http.ResponseWriter, r *http.Request) {
+	config := app.Config.Discord
+	if !config.Enabled() {
+		// Discord disabled - 404 Not Found error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusNotFound,
+				"The Discord bot is disabled; set discord.botToken in config.json to enable it."),
+		})
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64*1024))
+	if err != nil || r.Method != http.MethodPost || !VerifyDiscordSignature(config.PublicKey, r, body) {
+		// Discord checks that unsigned requests are refused - 401 Unauthorized error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusUnauthorized, "Invalid interaction signature."),
+		})
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		// Malformed interaction - 400 Bad Request error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusBadRequest, fmt.Sprintf("Invalid interaction: %v", err)),
+		})
+		return
+	}
+
+	response := map[string]interface{}{"type": discordResponsePong}
+	if interaction.Type == discordInteractionCommand {
+		content := app.AnswerDiscordCommand(r.Context(), interaction)
+		response = map[string]interface{}{
+			"type": discordResponseMessage,
+			"data": map[string]interface{}{"content": content},
+		}
+	} else if interaction.Type != discordInteractionPing {
+		log.Printf("  * ignoring discord interaction of type %d", interaction.Type)
+	}
+
+	responseJson, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJson)
+}
+
+// AnswerDiscordCommand replies to /character; like the other chat bots, it only knows the
+// characters that don't need an access token.
+func (app *CharacterSheetServiceApp) AnswerDiscordCommand(ctx context.Context, interaction discordInteraction) string {
+	if interaction.Data.Name != discordCommandName {
+		return fmt.Sprintf("Unknown command '%s'.", interaction.Data.Name)
+	}
+
+	name := interaction.Option("name")
+	attribute := interaction.Option("attribute")
+	log.Printf("--- discord: /%s %s %s", discordCommandName, name, attribute)
+
+	charKey, known := app.FindChatCharacter(name)
+	if !known {
+		return app.UnknownCharacterReply(name)
+	}
+	return app.ChatReply(ctx, charKey, attribute, discordMessageLimit)
+}
+
+// AnnounceToDiscord posts the public changes to the announce channel, one message per
+// refresh, in the background so a slow API doesn't hold the refresh up.
+func (app *CharacterSheetServiceApp) AnnounceToDiscord(changes []AttributeChange) {
+	config := app.Config.Discord
+	if !config.Enabled() || config.AnnounceChannelId == "" || len(changes) == 0 {
+		return
+	}
+
+	// the channel is as public as chat, so characters that need a token aren't announced
+	charKey := changes[0].CharacterKey
+	charConfig, chattable := app.ChatCharacters()[charKey]
+	if !chattable {
+		return
+	}
+	visible := charConfig.VisibleTo(PublicRole)
+	lines := []string{}
+	for _, change := range changes {
+		if (visible == nil || visible[change.Attribute]) && matchesAny(config.AnnounceAttributes, change.Attribute) {
+			lines = append(lines, fmt.Sprintf("**%s** %s: %s → %s", charKey, change.Attribute, change.OldValue, change.NewValue))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	go func() {
+		path := fmt.Sprintf("/channels/%s/messages", config.AnnounceChannelId)
+		message := map[string]string{"content": truncateChatMessage(strings.Join(lines, "\n"), discordMessageLimit)}
+		if err := config.discordRequest(http.MethodPost, path, message); err != nil {
+			log.Printf("WARNING: unable to announce changes to '%s' on discord: %v", charKey, err)
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscordSkipsTokenGatedCharacters(t *testing.T) {
+	yes := true
+
+	tests := []struct {
+		name         string
+		requireToken *bool
+		wantReply    string
+		wantAnnounce string
+	}{
+		{
+			name:         "public character",
+			wantReply:    "thorin hp: 12",
+			wantAnnounce: "**thorin** hp: 12 → 7",
+		},
+		{
+			name:         "character that needs a token",
+			requireToken: &yes,
+			wantReply:    "No character 'thorin'; try one of: ",
+		},
+	}
+
+	for _, test := range tests {
+		announced := make(chan string, 1)
+		discord := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var message map[string]string
+			json.NewDecoder(r.Body).Decode(&message)
+			announced <- message["content"]
+		}))
+		defer discord.Close()
+
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}},
+			RequireAccessToken: test.requireToken, AccessTokens: []AccessToken{{Token: "gm-secret", Role: "gm"}}})
+		app.Config.Discord = DiscordConfig{BotToken: "bot", AnnounceChannelId: "table", ApiUrl: discord.URL}
+		app.PrimeCharacter("thorin")
+
+		var interaction discordInteraction
+		json.Unmarshal([]byte(`{"type": 2, "data": {"name": "character", "options": [
+			{"name": "name", "value": "thorin"}, {"name": "attribute", "value": "hp"}]}}`), &interaction)
+		if reply := app.AnswerDiscordCommand(context.Background(), interaction); reply != test.wantReply {
+			t.Errorf("%s: reply = %q, want %q", test.name, reply, test.wantReply)
+		}
+
+		app.AnnounceToDiscord([]AttributeChange{{CharacterKey: "thorin", Attribute: "hp", OldValue: "12", NewValue: "7"}})
+		select {
+		case message := <-announced:
+			if test.wantAnnounce == "" {
+				t.Errorf("%s: announced %q, want nothing", test.name, message)
+			} else if !strings.Contains(message, test.wantAnnounce) {
+				t.Errorf("%s: announced %q, want %q", test.name, message, test.wantAnnounce)
+			}
+		case <-time.After(200 * time.Millisecond):
+			if test.wantAnnounce != "" {
+				t.Errorf("%s: nothing announced, want %q", test.name, test.wantAnnounce)
+			}
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dndBeyondApiUrl = "https://character-service.dndbeyond.com/character/v5/character"
+
+var dndBeyondClient = &http.Client{Timeout: 10 * time.Second}
+
+// DndBeyondConfig points a character at a D&D Beyond character, which has to be shared
+// publicly. Its standard 5e fields are served without any ranges to configure: when none of
+// the character's attributes are read from it, every field in dndBeyondFields is served under
+// its own name, and otherwise each attribute's range names the field it's read from.
+type DndBeyondConfig struct {
+	// the character's ID, or its URL as copied from the browser
+	CharacterId string `json:"characterId"`
+}
+
+// the fields a D&D Beyond character is mapped to, in the order they're served
+var dndBeyondFields = []string{
+	"name", "race", "class", "level", "xp", "proficiencyBonus",
+	"hp", "maxHp", "tempHp", "ac", "inspiration", "deathSaveSuccesses", "deathSaveFailures",
+	"str", "dex", "con", "int", "wis", "cha",
+	"strMod", "dexMod", "conMod", "intMod", "wisMod", "chaMod",
+	"spellSlots1", "spellSlots2", "spellSlots3", "spellSlots4", "spellSlots5",
+	"spellSlots6", "spellSlots7", "spellSlots8", "spellSlots9",
+	"spellSlots1Max", "spellSlots2Max", "spellSlots3Max", "spellSlots4Max", "spellSlots5Max",
+	"spellSlots6Max", "spellSlots7Max", "spellSlots8Max", "spellSlots9Max",
+	"pactSlots", "pactSlotsMax",
+}
+
+// D&D Beyond's stat IDs run from 1 to 6 in this order
+var dndBeyondAbilities = []struct{ Field, Name string }{
+	{"str", "strength"}, {"dex", "dexterity"}, {"con", "constitution"},
+	{"int", "intelligence"}, {"wis", "wisdom"}, {"cha", "charisma"},
+}
+
+var dndBeyondIdPattern = regexp.MustCompile(`(?:^|/characters/)(\d+)(?:[/?#]|$)`)
+
+// ParseDndBeyondId accepts a bare character ID, or the character's URL.
+func ParseDndBeyondId(characterId string) (string, error) {
+	match := dndBeyondIdPattern.FindStringSubmatch(characterId)
+	if match == nil {
+		return "", fmt.Errorf("dndBeyond characterId '%s' isn't a character ID or /characters/<id> URL", characterId)
+	}
+	return match[1], nil
+}
+
+func (config DndBeyondConfig) Validate() error {
+	_, err := ParseDndBeyondId(config.CharacterId)
+	return err
+}
+
+func DndBeyondAttributes() []AttributeRow {
+	attributes := make([]AttributeRow, len(dndBeyondFields))
+	for i, field := range dndBeyondFields {
+		attributes[i] = AttributeRow{Name: field, Range: field, Source: SourceDndBeyond}
+	}
+	return attributes
+}
+
+func IsDndBeyondField(field string) bool {
+	for _, known := range dndBeyondFields {
+		if field == known {
+			return true
+		}
+	}
+	return false
+}
+
+// DndBeyondDataSource reads characters that have a dndBeyond config.
+type DndBeyondDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+type dndBeyondModifier struct {
+	Type        string      `json:"type"`
+	SubType     string      `json:"subType"`
+	Value       *float64    `json:"value"`
+	StatId      *int        `json:"statId"`
+	ComponentId json.Number `json:"componentId"`
+}
+
+type dndBeyondStat struct {
+	Id    int      `json:"id"`
+	Value *float64 `json:"value"`
+}
+
+type dndBeyondCharacter struct {
+	Name string `json:"name"`
+	Race struct {
+		FullName string `json:"fullName"`
+	} `json:"race"`
+	Classes []struct {
+		Level      int `json:"level"`
+		Definition struct {
+			Name string `json:"name"`
+		} `json:"definition"`
+	} `json:"classes"`
+	CurrentXp          float64  `json:"currentXp"`
+	BaseHitPoints      float64  `json:"baseHitPoints"`
+	BonusHitPoints     *float64 `json:"bonusHitPoints"`
+	OverrideHitPoints  *float64 `json:"overrideHitPoints"`
+	RemovedHitPoints   float64  `json:"removedHitPoints"`
+	TemporaryHitPoints float64  `json:"temporaryHitPoints"`
+	Inspiration        bool     `json:"inspiration"`
+	DeathSaves         struct {
+		FailCount    *float64 `json:"failCount"`
+		SuccessCount *float64 `json:"successCount"`
+	} `json:"deathSaves"`
+	Stats         []dndBeyondStat                `json:"stats"`
+	BonusStats    []dndBeyondStat                `json:"bonusStats"`
+	OverrideStats []dndBeyondStat                `json:"overrideStats"`
+	Modifiers     map[string][]dndBeyondModifier `json:"modifiers"`
+	Inventory     []struct {
+		Equipped   bool `json:"equipped"`
+		IsAttuned  bool `json:"isAttuned"`
+		Definition struct {
+			Id          json.Number `json:"id"`
+			FilterType  string      `json:"filterType"`
+			ArmorClass  *float64    `json:"armorClass"`
+			ArmorTypeId int         `json:"armorTypeId"`
+			CanAttune   bool        `json:"canAttune"`
+		} `json:"definition"`
+	} `json:"inventory"`
+	SpellSlots []dndBeyondSlots `json:"spellSlots"`
+	PactMagic  []dndBeyondSlots `json:"pactMagic"`
+}
+
+type dndBeyondSlots struct {
+	Level     int `json:"level"`
+	Used      int `json:"used"`
+	Available int `json:"available"`
+}
+
+func (source DndBeyondDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	character, err := source.FetchCharacter(ctx, *charConfig.DndBeyond)
+	if err != nil {
+		return FetchedAttributes{}, err
+	}
+
+	fields := character.Fields()
+	fetched := NewFetchedAttributes()
+	for _, attr := range charConfig.Attributes {
+		if value, found := fields[attr.Range]; found {
+			fetched.Values[attr.Name] = value
+		}
+	}
+	return fetched, nil
+}
+
+func (source DndBeyondDataSource) FetchCharacter(ctx context.Context, config DndBeyondConfig) (*dndBeyondCharacter, error) {
+	characterId, err := ParseDndBeyondId(config.CharacterId)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, dndBeyondApiUrl+"/"+characterId, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := dndBeyondClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var body struct {
+		Success bool                `json:"success"`
+		Message string              `json:"message"`
+		Data    *dndBeyondCharacter `json:"data"`
+	}
+	decodeErr := json.NewDecoder(response.Body).Decode(&body)
+
+	if response.StatusCode == http.StatusForbidden || response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("D&D Beyond returned %s for character %s; is it shared publicly? %s",
+			response.Status, characterId, body.Message)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("D&D Beyond returned %s %s", response.Status, body.Message)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("invalid D&D Beyond character: %v", decodeErr)
+	}
+	if !body.Success || body.Data == nil {
+		return nil, fmt.Errorf("D&D Beyond couldn't return character %s: %s", characterId, body.Message)
+	}
+	return body.Data, nil
+}
+
+// Fields works out the standard fields the way the character sheet shows them. Armor class
+// only counts equipped armor and shields, Dexterity, unarmored defense and flat bonuses, so
+// characters with more unusual sources of AC should configure an attribute of their own.
+func (character *dndBeyondCharacter) Fields() map[string]string {
+	fields := map[string]string{
+		"name":        character.Name,
+		"race":        character.Race.FullName,
+		"xp":          CellString(character.CurrentXp),
+		"inspiration": strings.ToUpper(strconv.FormatBool(character.Inspiration)),
+	}
+
+	level := 0
+	classes := []string{}
+	for _, class := range character.Classes {
+		level += class.Level
+		classes = append(classes, fmt.Sprintf("%s %d", class.Definition.Name, class.Level))
+	}
+	fields["class"] = strings.Join(classes, " / ")
+	fields["level"] = strconv.Itoa(level)
+	if level > 0 {
+		fields["proficiencyBonus"] = fmt.Sprintf("+%d", 2+(level-1)/4)
+	}
+
+	modifiers := character.ActiveModifiers()
+
+	scores := map[string]int{}
+	for i, ability := range dndBeyondAbilities {
+		score := int(dndBeyondStatValue(character.Stats, i+1) + dndBeyondStatValue(character.BonusStats, i+1))
+		for _, modifier := range modifiers {
+			if modifier.SubType == ability.Name+"-score" && modifier.Value != nil {
+				if modifier.Type == "bonus" {
+					score += int(*modifier.Value)
+				} else if modifier.Type == "set" && int(*modifier.Value) > score {
+					score = int(*modifier.Value)
+				}
+			}
+		}
+		if override := dndBeyondStatValue(character.OverrideStats, i+1); override > 0 {
+			score = int(override)
+		}
+		scores[ability.Field] = score
+		fields[ability.Field] = strconv.Itoa(score)
+		fields[ability.Field+"Mod"] = fmt.Sprintf("%+d", abilityModifier(score))
+	}
+
+	maxHp := character.BaseHitPoints + float64(abilityModifier(scores["con"])*level)
+	if character.BonusHitPoints != nil {
+		maxHp += *character.BonusHitPoints
+	}
+	for _, modifier := range modifiers {
+		if modifier.Type == "bonus" && modifier.SubType == "hit-points-per-level" && modifier.Value != nil {
+			maxHp += *modifier.Value * float64(level)
+		}
+	}
+	if character.OverrideHitPoints != nil {
+		maxHp = *character.OverrideHitPoints
+	}
+	fields["maxHp"] = CellString(maxHp)
+	fields["hp"] = CellString(maxHp - character.RemovedHitPoints)
+	fields["tempHp"] = CellString(character.TemporaryHitPoints)
+
+	fields["ac"] = strconv.Itoa(character.ArmorClass(scores, modifiers))
+
+	if character.DeathSaves.SuccessCount != nil {
+		fields["deathSaveSuccesses"] = CellString(*character.DeathSaves.SuccessCount)
+	}
+	if character.DeathSaves.FailCount != nil {
+		fields["deathSaveFailures"] = CellString(*character.DeathSaves.FailCount)
+	}
+
+	// levels the character has no slots at are left out, rather than served as 0/0
+	for _, slots := range character.SpellSlots {
+		if slots.Available > 0 && slots.Level >= 1 && slots.Level <= 9 {
+			fields[fmt.Sprintf("spellSlots%d", slots.Level)] = strconv.Itoa(slots.Available - slots.Used)
+			fields[fmt.Sprintf("spellSlots%dMax", slots.Level)] = strconv.Itoa(slots.Available)
+		}
+	}
+	pactSlots, pactSlotsMax := 0, 0
+	for _, slots := range character.PactMagic {
+		pactSlots += slots.Available - slots.Used
+		pactSlotsMax += slots.Available
+	}
+	if pactSlotsMax > 0 {
+		fields["pactSlots"] = strconv.Itoa(pactSlots)
+		fields["pactSlotsMax"] = strconv.Itoa(pactSlotsMax)
+	}
+
+	return fields
+}
+
+// ActiveModifiers are the modifiers from race, class, background and feats, and from items
+// that are equipped (and attuned, if they need to be).
+func (character *dndBeyondCharacter) ActiveModifiers() []dndBeyondModifier {
+	activeItems := map[string]bool{}
+	for _, item := range character.Inventory {
+		if item.Equipped && (item.IsAttuned || !item.Definition.CanAttune) {
+			activeItems[item.Definition.Id.String()] = true
+		}
+	}
+
+	active := []dndBeyondModifier{}
+	for origin, modifiers := range character.Modifiers {
+		for _, modifier := range modifiers {
+			if origin != "item" || activeItems[modifier.ComponentId.String()] {
+				active = append(active, modifier)
+			}
+		}
+	}
+	return active
+}
+
+func (character *dndBeyondCharacter) ArmorClass(scores map[string]int, modifiers []dndBeyondModifier) int {
+	dexMod := abilityModifier(scores["dex"])
+
+	armorClass := 10 + dexMod
+	armored := false
+	for _, item := range character.Inventory {
+		if !item.Equipped || item.Definition.FilterType != "Armor" || item.Definition.ArmorClass == nil {
+			continue
+		}
+		itemClass := int(*item.Definition.ArmorClass)
+		switch item.Definition.ArmorTypeId {
+		case 1: // light
+			armorClass, armored = itemClass+dexMod, true
+		case 2: // medium
+			if dexMod > 2 {
+				armorClass, armored = itemClass+2, true
+			} else {
+				armorClass, armored = itemClass+dexMod, true
+			}
+		case 3: // heavy
+			armorClass, armored = itemClass, true
+		}
+	}
+	for _, item := range character.Inventory {
+		if item.Equipped && item.Definition.FilterType == "Armor" && item.Definition.ArmorTypeId == 4 && item.Definition.ArmorClass != nil {
+			armorClass += int(*item.Definition.ArmorClass)
+		}
+	}
+
+	for _, modifier := range modifiers {
+		switch {
+		case modifier.Type == "bonus" && modifier.SubType == "armor-class" && modifier.Value != nil:
+			armorClass += int(*modifier.Value)
+		case modifier.Type == "set" && modifier.SubType == "unarmored-armor-class" && !armored:
+			// a barbarian's or monk's unarmored defense adds a second ability modifier
+			if modifier.StatId != nil && *modifier.StatId >= 1 && *modifier.StatId <= 6 {
+				armorClass += abilityModifier(scores[dndBeyondAbilities[*modifier.StatId-1].Field])
+			}
+			if modifier.Value != nil {
+				armorClass += int(*modifier.Value)
+			}
+		}
+	}
+
+	return armorClass
+}
+
+func dndBeyondStatValue(stats []dndBeyondStat, id int) float64 {
+	for _, stat := range stats {
+		if stat.Id == id && stat.Value != nil {
+			return *stat.Value
+		}
+	}
+	return 0
+}
+
+func abilityModifier(score int) int {
+	// round down, including for scores below 10
+	if score < 10 {
+		return (score - 11) / 2
+	}
+	return (score - 10) / 2
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a character as the character service returns it, trimmed to the fields that are read. The
+// gauntlets set Strength, the unequipped ring's AC bonus doesn't count, and the chain shirt
+// and shield replace the barbarian's unarmored defense.
+const dndBeyondCharacterJson = `{
+	"id": 4201,
+	"success": true,
+	"message": "Character successfully received.",
+	"data": {
+		"name": "Thorin",
+		"race": {"fullName": "Mountain Dwarf"},
+		"classes": [
+			{"level": 3, "definition": {"name": "Fighter"}},
+			{"level": 2, "definition": {"name": "Barbarian"}}
+		],
+		"currentXp": 6500,
+		"baseHitPoints": 40,
+		"bonusHitPoints": null,
+		"overrideHitPoints": null,
+		"removedHitPoints": 10,
+		"temporaryHitPoints": 5,
+		"inspiration": true,
+		"deathSaves": {"failCount": 1, "successCount": 2},
+		"stats": [
+			{"id": 1, "value": 15}, {"id": 2, "value": 14}, {"id": 3, "value": 14},
+			{"id": 4, "value": 10}, {"id": 5, "value": 12}, {"id": 6, "value": 8}
+		],
+		"bonusStats": [{"id": 1, "value": null}],
+		"overrideStats": [{"id": 1, "value": null}],
+		"modifiers": {
+			"race": [{"type": "bonus", "subType": "constitution-score", "value": 2, "componentId": 1}],
+			"class": [{"type": "set", "subType": "unarmored-armor-class", "value": null, "statId": 3, "componentId": 2}],
+			"item": [
+				{"type": "set", "subType": "strength-score", "value": 19, "componentId": 100},
+				{"type": "bonus", "subType": "armor-class", "value": 1, "componentId": 200}
+			]
+		},
+		"inventory": [
+			{"equipped": true, "isAttuned": true, "definition": {"id": 100, "filterType": "Wondrous item", "canAttune": true}},
+			{"equipped": false, "isAttuned": false, "definition": {"id": 200, "filterType": "Ring", "canAttune": true}},
+			{"equipped": true, "definition": {"id": 300, "filterType": "Armor", "armorClass": 13, "armorTypeId": 2}},
+			{"equipped": true, "definition": {"id": 400, "filterType": "Armor", "armorClass": 2, "armorTypeId": 4}}
+		],
+		"spellSlots": [{"level": 1, "used": 1, "available": 3}, {"level": 2, "used": 0, "available": 0}],
+		"pactMagic": [{"level": 1, "used": 1, "available": 2}]
+	}
+}`
+
+// newFakeDndBeyond serves one public character, and answers for a private one the way the
+// character service does.
+func newFakeDndBeyond(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/4201":
+			w.Write([]byte(dndBeyondCharacterJson))
+		case "/4202":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"id": 4202, "success": false, "message": "Unauthorized Access Attempt.", "data": null}`))
+		case "/4203":
+			w.Write([]byte(`{"id": 4203, "success": false, "message": "Character is being migrated.", "data": null}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	previousUrl := dndBeyondApiUrl
+	dndBeyondApiUrl = server.URL
+	t.Cleanup(func() { dndBeyondApiUrl = previousUrl })
+}
+
+func TestDndBeyondDataSource(t *testing.T) {
+	newFakeDndBeyond(t)
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake)
+	source := DndBeyondDataSource{app: app}
+
+	fetched, err := source.Fetch(context.Background(), ConfigEntry{CharacterKey: "thorin", DndBeyond: &DndBeyondConfig{CharacterId: "4201"}, Attributes: DndBeyondAttributes()})
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	want := map[string]string{
+		"name": "Thorin", "race": "Mountain Dwarf", "class": "Fighter 3 / Barbarian 2",
+		"level": "5", "xp": "6500", "proficiencyBonus": "+3",
+		"hp": "45", "maxHp": "55", "tempHp": "5", "ac": "17", "inspiration": "TRUE",
+		"deathSaveSuccesses": "2", "deathSaveFailures": "1",
+		"str": "19", "dex": "14", "con": "16", "int": "10", "wis": "12", "cha": "8",
+		"strMod": "+4", "dexMod": "+2", "conMod": "+3", "intMod": "+0", "wisMod": "+1", "chaMod": "-1",
+		// levels without slots are left out
+		"spellSlots1": "2", "spellSlots1Max": "3",
+		"pactSlots": "1", "pactSlotsMax": "2",
+	}
+	if !reflect.DeepEqual(fetched.Values, want) {
+		t.Errorf("values = %v, want %v", fetched.Values, want)
+	}
+
+	// an attribute's range picks the field it's read from
+	fetched, err = source.Fetch(context.Background(), ConfigEntry{CharacterKey: "thorin", DndBeyond: &DndBeyondConfig{CharacterId: "https://www.dndbeyond.com/characters/4201/builder"}, Attributes: []AttributeRow{
+		{Name: "Hit Points", Range: "hp"},
+	}})
+	if err != nil || !reflect.DeepEqual(fetched.Values, map[string]string{"Hit Points": "45"}) {
+		t.Errorf("values = %v, %v, want Hit Points from hp", fetched.Values, err)
+	}
+}
+
+func TestFetchDndBeyondErrors(t *testing.T) {
+	newFakeDndBeyond(t)
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake)
+
+	tests := []struct {
+		name        string
+		characterId string
+		wantErr     string
+	}{
+		{"private", "4202", "is it shared publicly?"},
+		{"unsuccessful", "4203", "Character is being migrated"},
+		{"server error", "4204", "500"},
+		{"not an ID", "https://www.dndbeyond.com/profile/thorin", "isn't a character ID"},
+	}
+
+	for _, test := range tests {
+		_, err := DndBeyondDataSource{app: app}.FetchCharacter(context.Background(), DndBeyondConfig{CharacterId: test.characterId})
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestAbilityModifier(t *testing.T) {
+	tests := []struct {
+		score int
+		want  int
+	}{
+		{1, -5}, {8, -1}, {9, -1}, {10, 0}, {11, 0}, {19, 4}, {20, 5}, {30, 10},
+	}
+
+	for _, test := range tests {
+		if got := abilityModifier(test.score); got != test.want {
+			t.Errorf("abilityModifier(%d) = %d, want %d", test.score, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// the error page served to browsers when no errorTemplate is configured. Templates are
+// executed with the ApiResponse that would otherwise have been sent as JSON.
+const defaultErrorTemplate = `<!DOCTYPE html>
+<html>
+<head><title>{{.Metadata.StatusCode}} {{.Metadata.StatusMessage}}</title></head>
+<body>
+<h1>{{.Metadata.StatusCode}} {{.Metadata.StatusMessage}}</h1>
+<p>{{.Metadata.ErrorMessage}}</p>
+{{- if .CharacterUrls}}
+<p>Valid character paths:</p>
+<ul>
+{{- range .CharacterUrls}}
+<li><a href="{{.}}">{{.}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`
+
+func LoadErrorTemplate(path string) *template.Template {
+	if path == "" {
+		return template.Must(template.New("error").Parse(defaultErrorTemplate))
+	}
+
+	errorTemplate, err := template.ParseFiles(path)
+	if err != nil {
+		log.Fatalf("Invalid errorTemplate: %v", err)
+	}
+	log.Printf("  * loaded error template from %s", path)
+	return errorTemplate
+}
+
+// AcceptsHtml reports whether the request's Accept header lists text/html, as browsers'
+// do. API clients get JSON unless they ask otherwise.
+func AcceptsHtml(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == "text/html" {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteApiResponse writes errors as an HTML page for browsers, and everything else as JSON,
+// or as a 304 when the client already has the same attributes.
+func (app *CharacterSheetServiceApp) WriteApiResponse(w http.ResponseWriter, r *http.Request, response ApiResponse) {
+	if response.HasETag() {
+		if etag := AttributesETag(response); ETagMatches(r.Header.Get("If-None-Match"), etag) {
+			WriteNotModified(w, response.Metadata.RequestUri, etag)
+			return
+		}
+	}
+
+	if response.Metadata.StatusCode < http.StatusBadRequest || !AcceptsHtml(r) {
+		WriteApiResponseJson(w, response)
+		return
+	}
+
+	var page bytes.Buffer
+	if err := app.ErrorTemplate.Execute(&page, response); err != nil {
+		log.Printf("Unable to render error template: %v", err)
+		WriteApiResponseJson(w, response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(response.Metadata.StatusCode)
+	w.Write(page.Bytes())
+
+	log.Printf("--- request: %s -> %s (html)", response.Metadata.RequestUri, response.Metadata.ErrorMessage)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsHtml(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"*/*", false},
+		{"text/html", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", true},
+		{"application/json, text/html;q=0.5", true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/thorin", nil)
+		r.Header.Set("Accept", test.accept)
+		if got := AcceptsHtml(r); got != test.want {
+			t.Errorf("AcceptsHtml(%q) = %v, want %v", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "error.html")
+	if err := ioutil.WriteFile(templatePath, []byte(`<p class="oops">{{.Metadata.StatusCode}}: {{.Metadata.ErrorMessage}}</p>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		template     string
+		path         string
+		accept       string
+		wantStatus   int
+		wantHtml     bool
+		wantContains string
+	}{
+		{"api client error", "", "/smaug", "application/json", http.StatusNotFound, false, `"statusCode": 404`},
+		{"browser error", "", "/smaug", "text/html", http.StatusNotFound, true, `<a href="/thorin">/thorin</a>`},
+		{"custom template", templatePath, "/smaug", "text/html", http.StatusNotFound, true, `<p class="oops">404: No character`},
+		{"browser success", "", "/thorin", "text/html", http.StatusOK, false, `"hp": "12"`},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.ErrorTemplate = LoadErrorTemplate(test.template)
+		app.PrimeCharacter("thorin")
+
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, r)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		contentType := w.Header().Get("Content-Type")
+		if isHtml := strings.HasPrefix(contentType, "text/html"); isHtml != test.wantHtml {
+			t.Errorf("%s: Content-Type = %q, want html %v", test.name, contentType, test.wantHtml)
+		}
+		if !test.wantHtml && !json.Valid(w.Body.Bytes()) {
+			t.Errorf("%s: response isn't JSON: %s", test.name, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), test.wantContains) {
+			t.Errorf("%s: body %q doesn't contain %q", test.name, w.Body.String(), test.wantContains)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Character responses carry an ETag hashed from their attributes, states and metadata, so
+// overlays that poll can send it back in If-None-Match and get an empty 304 while nothing
+// changes - including whether the values are stale, defaulted or failed to fetch. The body
+// also has a timestamp in it, so the tag is weak: the same tag means the same values, not
+// the same bytes.
+
+// HasETag is true for successful responses with attributes in them.
+func (response ApiResponse) HasETag() bool {
+	return response.Metadata.StatusCode == http.StatusOK && response.Attributes != nil
+}
+
+func AttributesETag(response ApiResponse) string {
+	// which request asked, and when, doesn't change what's served
+	metadata := response.Metadata
+	metadata.RequestUri = ""
+	metadata.RequestTimestamp = nil
+
+	hashed, _ := json.Marshal(struct {
+		Attributes interface{}       `json:"attributes"`
+		States     map[string]string `json:"states"`
+		Metadata   ResponseMetadata  `json:"metadata"`
+	}{response.Attributes, response.States, metadata})
+
+	sum := sha256.Sum256(hashed)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ETagMatches compares an If-None-Match header against an ETag, using the weak comparison
+// If-None-Match calls for.
+func ETagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func SetETagHeader(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+}
+
+func WriteNotModified(w http.ResponseWriter, requestUri string, etag string) {
+	SetETagHeader(w, etag)
+	w.WriteHeader(http.StatusNotModified)
+
+	log.Printf("--- request: %s -> not modified", requestUri)
+}
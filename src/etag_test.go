@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAttributesETag(t *testing.T) {
+	base := func() ApiResponse {
+		timestamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		return ApiResponse{
+			Attributes: &map[string]string{"hp": "12"},
+			Metadata: ResponseMetadata{StatusCode: http.StatusOK, RequestUri: "/thorin",
+				RequestTimestamp: &timestamp},
+		}
+	}
+	later := time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		change   func(response *ApiResponse)
+		wantSame bool
+	}{
+		{"unchanged", func(response *ApiResponse) {}, true},
+		{"later request", func(response *ApiResponse) { response.Metadata.RequestTimestamp = &later }, true},
+		{"other uri", func(response *ApiResponse) { response.Metadata.RequestUri = "/thorin?format=array" }, true},
+		{"attribute", func(response *ApiResponse) { response.Attributes = &map[string]string{"hp": "7"} }, false},
+		{"state", func(response *ApiResponse) { response.States = map[string]string{"hp": "low"} }, false},
+		{"stale", func(response *ApiResponse) { response.Metadata.Stale = true }, false},
+		{"fetch failed", func(response *ApiResponse) { response.Metadata.FetchFailed = true }, false},
+		{"fetch error", func(response *ApiResponse) { response.Metadata.FetchError = "auth" }, false},
+		{"truncated", func(response *ApiResponse) { response.Metadata.Truncated = true }, false},
+		{"defaulted", func(response *ApiResponse) { response.Metadata.DefaultedAttributes = []string{"hp"} }, false},
+		{"attribute error", func(response *ApiResponse) {
+			response.Metadata.AttributeErrors = map[string]string{"hp": "bad range"}
+		}, false},
+	}
+
+	want := AttributesETag(base())
+	for _, test := range tests {
+		response := base()
+		test.change(&response)
+		if same := AttributesETag(response) == want; same != test.wantSame {
+			t.Errorf("%s: same ETag = %v, want %v", test.name, same, test.wantSame)
+		}
+	}
+}
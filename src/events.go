@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// HandleEvents serves /events/{characterKey} as a Server-Sent Events stream: the current
+// attributes are sent on connect, and again each time a refresh changes them. Each event
+// carries the same JSON as a websocket update.
+func (app *CharacterSheetServiceApp) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+	charKey := strings.TrimPrefix(requestPath, "/events/")
+
+	if _, configured := app.Characters()[charKey]; !configured {
+		// Result not found - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			CharacterUrls: app.ValidUrls(),
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				fmt.Sprintf("No character '%s' found; see list of valid character paths in the payload.", charKey)),
+		})
+		return
+	}
+
+	// checked before the stream's headers are sent, so a client without a token gets a 401
+	if _, ok := app.CharacterRole(r, charKey); !ok {
+		// Missing or unknown access token - 401 Unauthorized error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusUnauthorized, AccessDeniedMessage(r)),
+		})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		// Streaming unsupported - 500 Internal Server Error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusInternalServerError, "Event streams aren't supported by this server."),
+		})
+		return
+	}
+
+	changed := app.Notifier.Subscribe(charKey)
+	defer app.Notifier.Unsubscribe(charKey, changed)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	log.Printf("--- events: %s connected to '%s'", r.RemoteAddr, charKey)
+	for {
+		update, err := json.Marshal(app.NewWebSocketUpdate(r, charKey))
+		if err != nil {
+			log.Printf("Unable to encode event for '%s': %v", charKey, err)
+			return
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", update); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			log.Printf("--- events: %s disconnected from '%s'", r.RemoteAddr, charKey)
+			return
+		}
+	}
+}
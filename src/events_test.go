@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receiveEvent reads the next event from a Server-Sent Events stream.
+func receiveEvent(t *testing.T, stream *bufio.Reader) WebSocketUpdate {
+	t.Helper()
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no event received: %v", err)
+		}
+		if data := strings.TrimPrefix(line, "data: "); data != line {
+			var update WebSocketUpdate
+			if err := json.Unmarshal([]byte(data), &update); err != nil {
+				t.Fatalf("event isn't JSON: %v", err)
+			}
+			return update
+		}
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+		ConfigEntry{CharacterKey: "gimli", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+	app.PrimeCharacter("gimli")
+	server := httptest.NewServer(http.HandlerFunc(app.HandleEvents))
+	t.Cleanup(server.Close)
+
+	response, err := http.Get(server.URL + "/events/thorin")
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", contentType)
+	}
+	stream := bufio.NewReader(response.Body)
+
+	// the current attributes are sent on connect
+	if update := receiveEvent(t, stream); update.CharacterKey != "thorin" || updateValue(update, "hp") != "12" {
+		t.Fatalf("first event = %+v, want thorin's current hp 12", update)
+	}
+
+	// and again when they change, but not for other characters
+	waitFor(t, func() bool { return app.Notifier.subscriberCount("thorin") == 1 })
+	app.UpdateCachedEntry("gimli", NewCachedEntry(&map[string]string{"hp": "30"}, defaultCacheTtl))
+	app.UpdateCachedEntry("thorin", NewCachedEntry(&map[string]string{"hp": "7"}, defaultCacheTtl))
+	if update := receiveEvent(t, stream); update.CharacterKey != "thorin" || updateValue(update, "hp") != "7" {
+		t.Errorf("event after the cache changed = %+v, want thorin's hp 7", update)
+	}
+
+	// the subscription ends with the connection
+	response.Body.Close()
+	waitFor(t, func() bool { return app.Notifier.subscriberCount("thorin") == 0 })
+}
+
+func TestHandleEventsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"unknown character", "/events/smaug", http.StatusNotFound},
+		{"no token", "/events/thorin", http.StatusUnauthorized},
+		{"unknown token", "/events/thorin?token=guess", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.RequireAccessToken = true
+		app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+		app.PrimeCharacter("thorin")
+
+		// a stream that was let through would end here, rather than hang the test
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		w := httptest.NewRecorder()
+		app.HandleEvents(w, httptest.NewRequest(http.MethodGet, test.path, nil).WithContext(ctx))
+		cancel()
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		if contentType := w.Header().Get("Content-Type"); strings.HasPrefix(contentType, "text/event-stream") {
+			t.Errorf("%s: Content-Type = %q, want an API response", test.name, contentType)
+		}
+		if app.Notifier.subscriberCount("thorin") != 0 {
+			t.Errorf("%s: subscribed without access", test.name)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+//go:embed config.json example/api-key.json example/demo-attributes.json
+var exampleFiles embed.FS
+
+// embedded file -> file name written by -example
+var exampleFileNames = map[string]string{
+	"config.json":          "config.json",
+	"example/api-key.json": "api-key.json",
+}
+
+func WriteExampleFiles(dir string) error {
+	log.Println("-- writing example configuration")
+
+	for embeddedName, fileName := range exampleFileNames {
+		path := filepath.Join(dir, fileName)
+		if _, err := os.Stat(path); err == nil {
+			log.Printf("  * %s already exists; leaving it alone", path)
+			continue
+		}
+
+		fileBytes, err := exampleFiles.ReadFile(embeddedName)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(path, fileBytes, 0644); err != nil {
+			return err
+		}
+		log.Printf("  * wrote %s", path)
+	}
+
+	return nil
+}
+
+func LoadDemoConfig() ServiceConfig {
+	log.Println("-- loading embedded demo configuration")
+
+	fileBytes, err := exampleFiles.ReadFile("config.json")
+	if err != nil {
+		log.Fatalf("Unable to read embedded config: %v", err)
+	}
+
+	config, err := ParseServiceConfig(fileBytes)
+	if err != nil {
+		log.Fatalf("Invalid embedded config.json: %v", err)
+	}
+
+	// demo mode never talks to anything but its own memory
+	config.Cache = CacheConfig{}
+	config.Tracing = TracingConfig{}
+
+	return config
+}
+
+func LoadDemoAttributes() map[string]map[string]string {
+	fileBytes, err := exampleFiles.ReadFile("example/demo-attributes.json")
+	if err != nil {
+		log.Fatalf("Unable to read embedded demo attributes: %v", err)
+	}
+
+	var demoAttributes map[string]map[string]string
+	if err = json.Unmarshal(fileBytes, &demoAttributes); err != nil {
+		log.Fatalf("Invalid embedded demo-attributes.json: %v", err)
+	}
+	log.Println("  * serving fake attributes; Google Sheets will not be contacted")
+
+	return demoAttributes
+}
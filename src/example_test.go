@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteExampleFiles(t *testing.T) {
+	captureLog(t)
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "api-key.json")
+	if err := ioutil.WriteFile(existing, []byte(`{"apiKey": "mine"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteExampleFiles(dir); err != nil {
+		t.Fatalf("WriteExampleFiles: %v", err)
+	}
+
+	tests := []struct {
+		fileName string
+		want     string
+	}{
+		{"config.json", ""},
+		{"api-key.json", `{"apiKey": "mine"}`},
+	}
+	for _, test := range tests {
+		written, err := ioutil.ReadFile(filepath.Join(dir, test.fileName))
+		if err != nil {
+			t.Errorf("%s not written: %v", test.fileName, err)
+			continue
+		}
+		if test.want != "" && string(written) != test.want {
+			t.Errorf("%s = %q; an existing file was overwritten", test.fileName, written)
+		}
+	}
+
+	// the written config is the one the service starts from
+	configBytes, _ := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	config, err := ParseServiceConfig(configBytes)
+	if err != nil {
+		t.Fatalf("written config.json is invalid: %v", err)
+	}
+	if len(config.Characters) == 0 {
+		t.Errorf("written config.json has no characters")
+	}
+}
+
+func TestDemoMode(t *testing.T) {
+	captureLog(t)
+	app := NewCharacterSheetApp(CommandLineOptions{Demo: true})
+
+	if app.SheetService() != nil {
+		t.Errorf("demo mode created a Google Sheets client")
+	}
+	if _, redis := app.Cache.(*RedisCharacterAttributeCache); redis {
+		t.Errorf("demo mode uses redis")
+	}
+
+	demoAttributes := LoadDemoAttributes()
+	for charKey, want := range demoAttributes {
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/"+charKey, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("/%s: status = %d, want 200", charKey, w.Code)
+		}
+
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("/%s: response isn't JSON: %v", charKey, err)
+		}
+		for name, value := range want {
+			if got := attributeMap(response)[name]; got != value {
+				t.Errorf("/%s: %s = %q, want %q", charKey, name, got, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expression is a compiled arithmetic expression over a character's attributes, such as
+// "hp / maxHp * 100" or "floor((str - 10) / 2)". It has numbers, attribute names (in braces
+// when they aren't plain identifiers, e.g. {Max HP}), + - * / % and ^, parentheses, and
+// the functions in expressionFunctions.
+type Expression struct {
+	source string
+	root   expressionNode
+	names  []string
+}
+
+// attribute values are looked up as numbers; evaluation fails on any that aren't
+type expressionNode func(lookup func(name string) (float64, error)) (float64, error)
+
+var expressionFunctions = map[string]struct {
+	minArgs, maxArgs int
+	apply            func(args []float64) float64
+}{
+	"floor": {1, 1, func(args []float64) float64 { return math.Floor(args[0]) }},
+	"ceil":  {1, 1, func(args []float64) float64 { return math.Ceil(args[0]) }},
+	"abs":   {1, 1, func(args []float64) float64 { return math.Abs(args[0]) }},
+	"round": {1, 2, func(args []float64) float64 {
+		// round(x, places)
+		scale := 1.0
+		if len(args) == 2 {
+			scale = math.Pow(10, math.Round(args[1]))
+		}
+		return math.Round(args[0]*scale) / scale
+	}},
+	"min": {1, -1, func(args []float64) float64 {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result
+	}},
+	"max": {1, -1, func(args []float64) float64 {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result
+	}},
+	"clamp": {3, 3, func(args []float64) float64 { return math.Max(args[1], math.Min(args[2], args[0])) }},
+}
+
+// compiledExpressions holds each expression that's been parsed, by its source, so derived
+// attributes are parsed once when the config is validated rather than on every fetch.
+var compiledExpressions sync.Map
+
+func ParseExpression(source string) (*Expression, error) {
+	parser := &expressionParser{input: source}
+	parser.next()
+
+	root, err := parser.parseSum()
+	if err == nil {
+		// the lexer may have given up on something after the last complete term
+		err = parser.err
+	}
+	if err == nil && parser.token != "" {
+		err = fmt.Errorf("unexpected '%s'", parser.token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression '%s': %v", source, err)
+	}
+	return &Expression{source: source, root: root, names: parser.names}, nil
+}
+
+// CompileExpression is ParseExpression, reusing the result of any earlier call for the
+// same source.
+func CompileExpression(source string) (*Expression, error) {
+	if expression, found := compiledExpressions.Load(source); found {
+		return expression.(*Expression), nil
+	}
+	expression, err := ParseExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	compiledExpressions.Store(source, expression)
+	return expression, nil
+}
+
+// Names are the attributes the expression refers to.
+func (expression *Expression) Names() []string {
+	return expression.names
+}
+
+// Evaluate works the expression out from the attributes' values, which must all be numbers.
+func (expression *Expression) Evaluate(charAttributes map[string]string) (float64, error) {
+	result, err := expression.root(func(name string) (float64, error) {
+		value, found := charAttributes[name]
+		if !found {
+			return 0, fmt.Errorf("'%s' has no value", name)
+		}
+		number, ok := ParseTypedNumber(value)
+		if !ok {
+			return 0, fmt.Errorf("'%s' isn't a number: %s", name, value)
+		}
+		return number, nil
+	})
+	if err == nil && (math.IsNaN(result) || math.IsInf(result, 0)) {
+		err = fmt.Errorf("'%s' has no finite value", expression.source)
+	}
+	return result, err
+}
+
+type expressionParser struct {
+	input string
+	pos   int
+
+	// the current token: a number, an identifier, a {name}, or a single operator character;
+	// "" at the end
+	token   string
+	isName  bool
+	isNum   bool
+	literal float64
+	names   []string
+	err     error
+}
+
+func (parser *expressionParser) next() {
+	for parser.pos < len(parser.input) && unicode.IsSpace(rune(parser.input[parser.pos])) {
+		parser.pos++
+	}
+	parser.isName, parser.isNum = false, false
+	if parser.pos >= len(parser.input) {
+		parser.token = ""
+		return
+	}
+
+	start := parser.pos
+	c, size := utf8.DecodeRuneInString(parser.input[start:])
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for parser.pos < len(parser.input) && (parser.input[parser.pos] >= '0' && parser.input[parser.pos] <= '9' || parser.input[parser.pos] == '.') {
+			parser.pos++
+		}
+		parser.token = parser.input[start:parser.pos]
+		var err error
+		if parser.literal, err = strconv.ParseFloat(parser.token, 64); err != nil {
+			parser.err = fmt.Errorf("invalid number '%s'", parser.token)
+		}
+		parser.isNum = true
+	case c == '_' || unicode.IsLetter(c):
+		for parser.pos < len(parser.input) {
+			r, size := utf8.DecodeRuneInString(parser.input[parser.pos:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			parser.pos += size
+		}
+		parser.token = parser.input[start:parser.pos]
+		parser.isName = true
+	case c == '{':
+		end := strings.IndexByte(parser.input[start:], '}')
+		if end < 0 {
+			parser.err = fmt.Errorf("unclosed {")
+			parser.token = ""
+			parser.pos = len(parser.input)
+			return
+		}
+		parser.token = parser.input[start+1 : start+end]
+		parser.pos = start + end + 1
+		parser.isName = true
+		if strings.TrimSpace(parser.token) == "" {
+			parser.err = fmt.Errorf("empty {}")
+		}
+	default:
+		parser.token = string(c)
+		parser.pos += size
+	}
+}
+
+func (parser *expressionParser) parseSum() (expressionNode, error) {
+	left, err := parser.parseProduct()
+	for err == nil && (parser.token == "+" || parser.token == "-") && !parser.isName {
+		operator := parser.token
+		parser.next()
+		var right expressionNode
+		if right, err = parser.parseProduct(); err == nil {
+			left = binaryNode(operator, left, right)
+		}
+	}
+	return left, err
+}
+
+func (parser *expressionParser) parseProduct() (expressionNode, error) {
+	left, err := parser.parseUnary()
+	for err == nil && (parser.token == "*" || parser.token == "/" || parser.token == "%") && !parser.isName {
+		operator := parser.token
+		parser.next()
+		var right expressionNode
+		if right, err = parser.parseUnary(); err == nil {
+			left = binaryNode(operator, left, right)
+		}
+	}
+	return left, err
+}
+
+func (parser *expressionParser) parseUnary() (expressionNode, error) {
+	if !parser.isName && (parser.token == "-" || parser.token == "+") {
+		negate := parser.token == "-"
+		parser.next()
+		operand, err := parser.parseUnary()
+		if err != nil || !negate {
+			return operand, err
+		}
+		return func(lookup func(string) (float64, error)) (float64, error) {
+			value, err := operand(lookup)
+			return -value, err
+		}, nil
+	}
+
+	base, err := parser.parsePrimary()
+	if err == nil && parser.token == "^" && !parser.isName {
+		parser.next()
+		var exponent expressionNode
+		if exponent, err = parser.parseUnary(); err == nil {
+			base = binaryNode("^", base, exponent)
+		}
+	}
+	return base, err
+}
+
+func (parser *expressionParser) parsePrimary() (expressionNode, error) {
+	if parser.err != nil {
+		return nil, parser.err
+	}
+
+	switch {
+	case parser.isNum:
+		literal := parser.literal
+		parser.next()
+		return func(func(string) (float64, error)) (float64, error) { return literal, nil }, nil
+
+	case parser.isName:
+		name := parser.token
+		braced := parser.input[parser.pos-1] == '}'
+		parser.next()
+		if parser.token == "(" && !parser.isName && !braced {
+			return parser.parseCall(name)
+		}
+		parser.names = append(parser.names, name)
+		return func(lookup func(string) (float64, error)) (float64, error) { return lookup(name) }, nil
+
+	case parser.token == "(":
+		parser.next()
+		inner, err := parser.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if parser.token != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		parser.next()
+		return inner, nil
+
+	case parser.token == "":
+		return nil, fmt.Errorf("unexpected end")
+	}
+	return nil, fmt.Errorf("unexpected '%s'", parser.token)
+}
+
+func (parser *expressionParser) parseCall(name string) (expressionNode, error) {
+	function, found := expressionFunctions[name]
+	if !found {
+		return nil, fmt.Errorf("unknown function %s()", name)
+	}
+
+	parser.next() // (
+	args := []expressionNode{}
+	for parser.token != ")" {
+		arg, err := parser.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if parser.token == "," {
+			parser.next()
+		} else if parser.token != ")" {
+			return nil, fmt.Errorf("missing ) after %s(", name)
+		}
+	}
+	parser.next()
+
+	if len(args) < function.minArgs || (function.maxArgs >= 0 && len(args) > function.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments to %s()", name)
+	}
+	return func(lookup func(string) (float64, error)) (float64, error) {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			value, err := arg(lookup)
+			if err != nil {
+				return 0, err
+			}
+			values[i] = value
+		}
+		return function.apply(values), nil
+	}, nil
+}
+
+func binaryNode(operator string, left expressionNode, right expressionNode) expressionNode {
+	return func(lookup func(string) (float64, error)) (float64, error) {
+		a, err := left(lookup)
+		if err != nil {
+			return 0, err
+		}
+		b, err := right(lookup)
+		if err != nil {
+			return 0, err
+		}
+		switch operator {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		case "/":
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		case "%":
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return math.Mod(a, b), nil
+		}
+		return math.Pow(a, b), nil
+	}
+}
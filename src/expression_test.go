@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	attributes := map[string]string{"hp": "10", "maxHp": "40", "str": "15", "Max HP": "40", "forçe": "3", "zero": "0", "name": "Thorin"}
+
+	tests := []struct {
+		name    string
+		source  string
+		want    float64
+		wantErr bool
+	}{
+		// precedence
+		{"product before sum", "2 + 3 * 4", 14, false},
+		{"parentheses", "(2 + 3) * 4", 20, false},
+		{"left to right", "10 - 4 - 3", 3, false},
+		{"division left to right", "40 / 4 / 2", 5, false},
+		{"power before product", "2 * 3 ^ 2", 18, false},
+		{"power is right associative", "2 ^ 3 ^ 2", 512, false},
+		{"modulo", "17 % 5 + 1", 3, false},
+
+		// unary minus
+		{"negated power", "-2 ^ 2", -4, false},
+		{"negative exponent", "2 ^ -1", 0.5, false},
+		{"double negation", "--3", 3, false},
+		{"unary plus", "+3 - -2", 5, false},
+
+		// attributes
+		{"percent", "hp / maxHp * 100", 25, false},
+		{"braced name", "{Max HP} - hp", 30, false},
+		{"unicode name", "forçe + 1", 4, false},
+		{"modifier", "floor((str - 10) / 2)", 2, false},
+		{"missing attribute", "mana + 1", 0, true},
+		{"not a number", "name + 1", 0, true},
+
+		// functions
+		{"ceil", "ceil(hp / 3)", 4, false},
+		{"abs", "abs(hp - maxHp)", 30, false},
+		{"round", "round(2.5)", 3, false},
+		{"round to places", "round(hp / 3, 2)", 3.33, false},
+		{"min", "min(hp, maxHp, 5)", 5, false},
+		{"max", "max(hp)", 10, false},
+		{"clamp", "clamp(hp * 10, 0, maxHp)", 40, false},
+
+		// division by zero
+		{"division by zero", "hp / zero", 0, true},
+		{"modulo by zero", "hp % 0", 0, true},
+		{"infinite", "10 ^ 400", 0, true},
+	}
+
+	for _, test := range tests {
+		expression, err := ParseExpression(test.source)
+		if err != nil {
+			t.Errorf("%s: ParseExpression(%q) error = %v", test.name, test.source, err)
+			continue
+		}
+		got, err := expression.Evaluate(attributes)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: %q error = %v, want error %v", test.name, test.source, err, test.wantErr)
+			continue
+		}
+		if err == nil && math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: %q = %v, want %v", test.name, test.source, got, test.want)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"empty", ""},
+		{"trailing operator", "hp +"},
+		{"trailing unclosed brace", "hp + 1 {"},
+		{"empty braces", "hp {}"},
+		{"blank braces", "{ } + 1"},
+		{"missing )", "(hp + 1"},
+		{"extra )", "hp + 1)"},
+		{"two terms", "hp maxHp"},
+		{"unknown operator", "hp & 1"},
+		{"unknown character", "hp § 1"},
+		{"bad number", "1.2.3"},
+		{"unknown function", "sqrt(hp)"},
+		{"too few arguments", "clamp(hp, 0)"},
+		{"too many arguments", "floor(hp, 2)"},
+		{"no arguments", "min()"},
+		{"unclosed call", "max(hp, 1"},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseExpression(test.source); err == nil {
+			t.Errorf("%s: ParseExpression(%q) succeeded", test.name, test.source)
+		}
+	}
+}
+
+func TestExpressionNames(t *testing.T) {
+	expression, err := ParseExpression("floor({Max HP} / 2) + hp - forçe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Max HP", "hp", "forçe"}; !reflect.DeepEqual(expression.Names(), want) {
+		t.Errorf("names = %v, want %v", expression.Names(), want)
+	}
+}
+
+func TestCompileExpression(t *testing.T) {
+	first, err := CompileExpression("hp * 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := CompileExpression("hp * 2")
+	if first != second {
+		t.Errorf("the same source was compiled twice")
+	}
+	if _, err := CompileExpression("hp *"); err == nil {
+		t.Errorf("invalid expression compiled")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// numbers are formatted US-style unless a locale is configured
+const defaultLocale = "en-US"
+
+const (
+	FormatCaseUpper = "upper"
+	FormatCaseLower = "lower"
+	FormatCaseTitle = "title"
+)
+
+type AttributeFormat struct {
+	// round numbers to this many decimal places
+	Decimals *int `json:"decimals,omitempty"`
+
+	// locale tag such as "fr-FR", controlling the thousands separator and decimal mark;
+	// overrides the global locale
+	Locale string `json:"locale,omitempty"`
+
+	// show a + on numbers that aren't negative, as modifiers are written
+	Sign bool `json:"sign,omitempty"`
+
+	// added around values that aren't empty, e.g. a suffix of " gp"
+	Prefix string `json:"prefix,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+
+	// upper, lower or title
+	Case string `json:"case,omitempty"`
+
+	// rewrites dates in a Go time layout, e.g. "Jan 2, 2006" or "02/01/2006"; see dateLayouts
+	// for the dates that are recognised
+	Date string `json:"date,omitempty"`
+}
+
+// the ways dates are read from cells: ISO, then as Google Sheets shows them in US locales
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"1/2/2006 15:04:05",
+	"1/2/2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+}
+
+func (format AttributeFormat) Validate() error {
+	switch format.Case {
+	case "", FormatCaseUpper, FormatCaseLower, FormatCaseTitle:
+	default:
+		return fmt.Errorf("unknown case '%s'; must be upper, lower or title", format.Case)
+	}
+	if format.Date != "" {
+		// a layout with none of the reference date's parts formats every date the same
+		sample := time.Date(1999, time.November, 28, 23, 59, 58, 0, time.UTC)
+		if sample.Format(format.Date) == format.Date {
+			return fmt.Errorf("date format '%s' has no parts of Go's reference date, Mon Jan 2 15:04:05 2006", format.Date)
+		}
+	}
+	return nil
+}
+
+// FormatAttributeValue applies the format to a cell value: numeric formatting to numbers,
+// date formatting to dates, then the case, prefix and suffix. Other values are only given
+// the case, prefix and suffix.
+func FormatAttributeValue(format *AttributeFormat, globalLocale string, value string) string {
+	if format == nil {
+		return value
+	}
+
+	locale := format.Locale
+	if locale == "" {
+		locale = globalLocale
+	}
+	if locale == "" {
+		locale = defaultLocale
+	}
+	tag := language.Make(locale)
+
+	if numericValue, ok := ParseNumericValue(value); ok {
+		options := []number.Option{}
+		if format.Decimals != nil {
+			options = append(options, number.Scale(*format.Decimals))
+		}
+		value = message.NewPrinter(tag).Sprint(number.Decimal(numericValue, options...))
+		if format.Sign && !strings.HasPrefix(value, "-") {
+			value = "+" + value
+		}
+	} else if format.Date != "" {
+		for _, layout := range dateLayouts {
+			if date, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+				value = date.Format(format.Date)
+				break
+			}
+		}
+	}
+
+	switch format.Case {
+	case FormatCaseUpper:
+		value = cases.Upper(tag).String(value)
+	case FormatCaseLower:
+		value = cases.Lower(tag).String(value)
+	case FormatCaseTitle:
+		value = cases.Title(tag).String(value)
+	}
+
+	if value == "" {
+		return value
+	}
+	return format.Prefix + value + format.Suffix
+}
+
+// TrimAffixes takes the prefix and suffix back off a formatted value, so it can be read as
+// a number again.
+func (format *AttributeFormat) TrimAffixes(value string) string {
+	if format == nil {
+		return value
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(value, format.Prefix), format.Suffix)
+}
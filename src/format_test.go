@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatAttributeValue(t *testing.T) {
+	zero := 0
+	two := 2
+
+	tests := []struct {
+		name         string
+		format       *AttributeFormat
+		globalLocale string
+		value        string
+		want         string
+	}{
+		{"no format", nil, "fr-FR", "1234.5", "1234.5"},
+		{"default locale", &AttributeFormat{Decimals: &two}, "", "1234.5", "1,234.50"},
+		{"global locale", &AttributeFormat{Decimals: &two}, "de-DE", "1234.5", "1.234,50"},
+		{"attribute locale wins", &AttributeFormat{Decimals: &two, Locale: "en-US"}, "de-DE", "1234.5", "1,234.50"},
+		{"rounded", &AttributeFormat{Decimals: &zero}, "", "1234.6", "1,235"},
+		{"not a number", &AttributeFormat{Decimals: &two}, "de-DE", "Thorin", "Thorin"},
+		{"sign", &AttributeFormat{Sign: true}, "", "3", "+3"},
+		{"sign on zero", &AttributeFormat{Sign: true}, "", "0", "+0"},
+		{"sign on negative", &AttributeFormat{Sign: true}, "", "-2", "-2"},
+		{"sign on text", &AttributeFormat{Sign: true}, "", "Thorin", "Thorin"},
+		{"prefix and suffix", &AttributeFormat{Prefix: "~", Suffix: " gp"}, "", "1234", "~1,234 gp"},
+		// empty cells stay empty rather than showing a bare " gp"
+		{"suffix on empty", &AttributeFormat{Suffix: " gp"}, "", "", ""},
+		{"upper", &AttributeFormat{Case: FormatCaseUpper}, "", "Thorin", "THORIN"},
+		{"lower", &AttributeFormat{Case: FormatCaseLower}, "", "Thorin", "thorin"},
+		{"title", &AttributeFormat{Case: FormatCaseTitle}, "", "thorin oakenshield", "Thorin Oakenshield"},
+		{"case before suffix", &AttributeFormat{Case: FormatCaseUpper, Suffix: " (dwarf)"}, "", "Thorin", "THORIN (dwarf)"},
+		{"ISO date", &AttributeFormat{Date: "Jan 2, 2006"}, "", "2021-10-01", "Oct 1, 2021"},
+		{"US date", &AttributeFormat{Date: "02/01/2006"}, "", "10/1/2021", "01/10/2021"},
+		{"date and time", &AttributeFormat{Date: "15:04"}, "", "2021-10-01 19:30:00", "19:30"},
+		{"spelled out date", &AttributeFormat{Date: "2006-01-02"}, "", "October 1, 2021", "2021-10-01"},
+		{"not a date", &AttributeFormat{Date: "Jan 2, 2006"}, "", "Durin's Day", "Durin's Day"},
+		// a number is formatted as one, even with a date format
+		{"number with date format", &AttributeFormat{Date: "Jan 2, 2006"}, "", "44470", "44,470"},
+	}
+
+	for _, test := range tests {
+		if got := FormatAttributeValue(test.format, test.globalLocale, test.value); got != test.want {
+			t.Errorf("%s: FormatAttributeValue(%q) = %q, want %q", test.name, test.value, got, test.want)
+		}
+	}
+}
+
+func TestAttributeFormatValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  AttributeFormat
+		wantErr string
+	}{
+		{"empty", AttributeFormat{}, ""},
+		{"every option", AttributeFormat{Sign: true, Prefix: "+", Suffix: " gp", Case: FormatCaseTitle, Date: "Jan 2, 2006"}, ""},
+		{"unknown case", AttributeFormat{Case: "camel"}, "unknown case"},
+		{"date without a layout", AttributeFormat{Date: "YYYY-MM-DD"}, "no parts of Go's reference date"},
+	}
+
+	for _, test := range tests {
+		err := test.format.Validate()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestTrimAffixes(t *testing.T) {
+	format := &AttributeFormat{Prefix: "HP ", Suffix: "/30"}
+	if got := format.TrimAffixes("HP 12/30"); got != "12" {
+		t.Errorf("TrimAffixes() = %q, want 12", got)
+	}
+	if got := (*AttributeFormat)(nil).TrimAffixes("12"); got != "12" {
+		t.Errorf("TrimAffixes() without a format = %q, want 12", got)
+	}
+}
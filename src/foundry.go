@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// environment variable holding the Foundry REST API key, which overrides foundry.apiKey
+const foundryApiKeyEnv = "FOUNDRY_API_KEY"
+
+var foundryClient = &http.Client{Timeout: 10 * time.Second}
+
+// FoundryServerConfig is how to reach a Foundry VTT world. Foundry has no REST API of its
+// own, so this goes through a REST API module installed in the world, which serves each
+// actor's document as JSON.
+type FoundryServerConfig struct {
+	// the module's URL for an actor, with {actorId} where the actor's ID goes, e.g.
+	// http://localhost:30000/api/actors/{actorId}
+	ActorUrl string `json:"actorUrl"`
+
+	// sent in the apiKeyHeader header, x-api-key unless set; $FOUNDRY_API_KEY overrides it
+	ApiKey       string `json:"apiKey"`
+	ApiKeyHeader string `json:"apiKeyHeader"`
+}
+
+// FoundryConfig points a character at an actor in the Foundry world. Each attribute's range
+// is the path of a value in the actor's document, as written in Foundry's roll formulas,
+// e.g. system.attributes.hp.value; lists, such as items, are served as their names.
+type FoundryConfig struct {
+	ActorId string `json:"actorId"`
+}
+
+func (config FoundryConfig) Validate() error {
+	if config.ActorId == "" {
+		return fmt.Errorf("foundry needs an actorId")
+	}
+	return nil
+}
+
+func (config FoundryServerConfig) Validate() error {
+	if !strings.Contains(config.ActorUrl, "{actorId}") {
+		return fmt.Errorf("foundry.actorUrl must have {actorId} in it")
+	}
+	if _, err := url.Parse(config.ActorUrl); err != nil {
+		return fmt.Errorf("invalid foundry.actorUrl: %v", err)
+	}
+	return nil
+}
+
+func (config FoundryServerConfig) AccessKey() string {
+	if key := os.Getenv(foundryApiKeyEnv); key != "" {
+		return key
+	}
+	return config.ApiKey
+}
+
+// FoundryDataSource reads characters that have a foundry config.
+type FoundryDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+func (source FoundryDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	actor, err := source.FetchActor(ctx, charConfig.Foundry.ActorId)
+	if err != nil {
+		return FetchedAttributes{}, err
+	}
+
+	fetched := NewFetchedAttributes()
+	for _, attr := range charConfig.Attributes {
+		value, found := DocumentPath(actor, attr.Range)
+		if !found {
+			fetched.Errors[attr.Name] = fmt.Sprintf("no '%s' in the Foundry actor", attr.Range)
+			continue
+		}
+		cells, err := DocumentValueCells(value)
+		if err != nil {
+			fetched.Errors[attr.Name] = fmt.Sprintf("'%s': %v", attr.Range, err)
+			continue
+		}
+		if len(cells) > 0 {
+			fetched.SetCells(attr, cells)
+		}
+	}
+	return fetched, nil
+}
+
+func (source FoundryDataSource) FetchActor(ctx context.Context, actorId string) (map[string]interface{}, error) {
+	server := source.app.Config.Foundry
+	actorUrl := strings.ReplaceAll(server.ActorUrl, "{actorId}", url.PathEscape(actorId))
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, actorUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if key := server.AccessKey(); key != "" {
+		header := server.ApiKeyHeader
+		if header == "" {
+			header = "x-api-key"
+		}
+		request.Header.Set(header, key)
+	}
+
+	response, err := foundryClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("Foundry %w: %s", errTokenRejected, response.Status)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Foundry returned %s for actor %s", response.Status, actorId)
+	}
+
+	var actor map[string]interface{}
+	if err := json.NewDecoder(response.Body).Decode(&actor); err != nil {
+		return nil, fmt.Errorf("invalid Foundry actor: %v", err)
+	}
+
+	// some modules wrap the document, e.g. {"data": {...}}
+	if _, found := actor["system"]; !found {
+		if wrapped, ok := actor["data"].(map[string]interface{}); ok {
+			actor = wrapped
+		}
+	}
+	return actor, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a dnd5e actor as a REST API module serves it, trimmed to the fields that are read
+const foundryActorJson = `{
+	"_id": "a1B2c3D4e5F6g7H8",
+	"name": "Gimli",
+	"type": "character",
+	"system": {
+		"attributes": {
+			"hp": {"value": 31, "max": 44, "temp": null},
+			"ac": {"flat": null, "calc": "default", "value": 18},
+			"inspiration": false
+		},
+		"abilities": {"str": {"value": 17}},
+		"details": {"race": "Dwarf", "biography": {"value": ""}}
+	},
+	"items": [
+		{"_id": "i1", "name": "Battleaxe", "type": "weapon", "system": {"quantity": 1}},
+		{"_id": "i2", "name": "Rations", "type": "consumable", "system": {"quantity": 4}}
+	]
+}`
+
+// newFakeFoundry serves one actor, bare and wrapped in {"data": ...} as some modules serve it,
+// to requests that have the API key in the given header.
+func newFakeFoundry(t *testing.T, header string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(header) != "foundry-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "Invalid API key"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/actors/a1B2c3D4e5F6g7H8":
+			w.Write([]byte(foundryActorJson))
+		case "/api/actors/wrapped":
+			w.Write([]byte(`{"data": ` + foundryActorJson + `}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "Actor not found"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/api/actors/{actorId}"
+}
+
+func TestFoundryDataSource(t *testing.T) {
+	attributes := []AttributeRow{
+		{Name: "name", Range: "name"},
+		{Name: "hp", Range: "system.attributes.hp.value"},
+		{Name: "maxHp", Range: "system.attributes.hp.max"},
+		{Name: "tempHp", Range: "system.attributes.hp.temp"},
+		{Name: "ac", Range: "system.attributes.ac"},
+		{Name: "inspired", Range: "system.attributes.inspiration"},
+		{Name: "items", Range: "items", Type: AttributeTypeList},
+		{Name: "rations", Range: "items.Rations.system.quantity"},
+		{Name: "firstItem", Range: "items.0.name"},
+		{Name: "biography", Range: "system.details.biography"},
+		{Name: "abilities", Range: "system.abilities"},
+		{Name: "mana", Range: "system.attributes.mana.value"},
+	}
+	want := map[string]string{
+		"name":      "Gimli",
+		"hp":        "31",
+		"maxHp":     "44",
+		"ac":        "18",
+		"inspired":  "FALSE",
+		"items":     `["Battleaxe","Rations"]`,
+		"rations":   "4",
+		"firstItem": "Battleaxe",
+		"biography": "",
+	}
+
+	tests := []struct {
+		name         string
+		header       string
+		actorId      string
+		key          string
+		want         map[string]string
+		wantErr      string
+		wantAuthFail bool
+	}{
+		{"default header", "", "a1B2c3D4e5F6g7H8", "foundry-key", want, "", false},
+		{"configured header", "Authorization", "a1B2c3D4e5F6g7H8", "foundry-key", want, "", false},
+		{"wrapped document", "", "wrapped", "foundry-key", want, "", false},
+		{"unknown actor", "", "missing", "foundry-key", nil, "404", false},
+		{"rejected key", "", "a1B2c3D4e5F6g7H8", "wrong", nil, "401", true},
+	}
+
+	for _, test := range tests {
+		header := test.header
+		if header == "" {
+			header = "x-api-key"
+		}
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		app.Config.Foundry = FoundryServerConfig{ActorUrl: newFakeFoundry(t, header), ApiKey: test.key, ApiKeyHeader: test.header}
+
+		fetched, err := FoundryDataSource{app: app}.Fetch(context.Background(), ConfigEntry{CharacterKey: "gimli", Foundry: &FoundryConfig{ActorId: test.actorId}, Attributes: attributes})
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			if IsAuthError(err) != test.wantAuthFail {
+				t.Errorf("%s: IsAuthError = %v, want %v", test.name, IsAuthError(err), test.wantAuthFail)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(fetched.Values, test.want) {
+			t.Errorf("%s: values = %v, want %v", test.name, fetched.Values, test.want)
+		}
+		// objects without a value and missing paths are reported per attribute
+		for _, name := range []string{"abilities", "mana"} {
+			if _, found := fetched.Errors[name]; !found {
+				t.Errorf("%s: no error for %s", test.name, name)
+			}
+		}
+	}
+}
+
+func TestFoundryApiKey(t *testing.T) {
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake)
+	app.Config.Foundry = FoundryServerConfig{ActorUrl: newFakeFoundry(t, "x-api-key"), ApiKey: "wrong"}
+	t.Setenv(foundryApiKeyEnv, "foundry-key")
+
+	actor, err := FoundryDataSource{app: app}.FetchActor(context.Background(), "a1B2c3D4e5F6g7H8")
+	if err != nil || actor["name"] != "Gimli" {
+		t.Errorf("actor = %v, %v; $%s should override apiKey", actor["name"], err, foundryApiKeyEnv)
+	}
+}
+
+func TestFoundryServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		actorUrl string
+		wantErr  bool
+	}{
+		{"valid", "http://localhost:30000/api/actors/{actorId}", false},
+		{"no placeholder", "http://localhost:30000/api/actors", true},
+		{"not a URL", "http://[::1/{actorId}", true},
+	}
+
+	for _, test := range tests {
+		err := FoundryServerConfig{ActorUrl: test.actorUrl}.Validate()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// the first row holds the names, and the row below their values
+	HeadersRow = "row"
+
+	// the first column holds the names, and the column beside it their values
+	HeadersColumn = "column"
+)
+
+// HasHeaderRanges tells whether some of the character's names are only known once the sheet
+// is read, so references to attributes that aren't configured can't be checked.
+func (configEntry ConfigEntry) HasHeaderRanges() bool {
+	for _, attr := range configEntry.Attributes {
+		if attr.Headers != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (attr AttributeRow) ValidateHeaders() error {
+	if attr.Headers != HeadersRow && attr.Headers != HeadersColumn {
+		return fmt.Errorf("unknown headers '%s'; must be row or column", attr.Headers)
+	}
+	if attr.Name != "" || len(attr.Names) > 0 {
+		return fmt.Errorf("names are read from the sheet, so can't have name or names")
+	}
+	if attr.Read != "" && attr.Read != ReadValue {
+		return fmt.Errorf("notes can't be read from a table")
+	}
+	if attr.Private {
+		return fmt.Errorf("a table can't be private; give its private values names instead")
+	}
+	if len(attr.Thresholds) > 0 {
+		return fmt.Errorf("thresholds need a single named attribute")
+	}
+	switch attr.Type {
+	case "", AttributeTypeText, AttributeTypeNumber, AttributeTypeString:
+	default:
+		return fmt.Errorf("values of a table are served as text, not %s", attr.Type)
+	}
+	return nil
+}
+
+// MapHeaderTable reads a headers range into charMap and returns the names it found, in
+// the order they're in the table. Blank names are skipped, as are empty values, which are
+// left out as empty cells always are.
+func MapHeaderTable(attr AttributeRow, values [][]interface{}, charMap map[string]string) []string {
+	cell := func(row int, col int) string {
+		if row >= len(values) || col >= len(values[row]) {
+			return ""
+		}
+		return strings.TrimSpace(CellString(values[row][col]))
+	}
+
+	count := 0
+	if attr.Headers == HeadersRow && len(values) > 0 {
+		count = len(values[0])
+	} else if attr.Headers == HeadersColumn {
+		count = len(values)
+	}
+
+	names := []string{}
+	for i := 0; i < count; i++ {
+		var name, value string
+		if attr.Headers == HeadersRow {
+			name, value = cell(0, i), cell(1, i)
+		} else {
+			name, value = cell(i, 0), cell(i, 1)
+		}
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+		if value != "" {
+			charMap[name] = value
+		}
+	}
+	return names
+}
+
+// WithHeaderNames returns a copy of the config where each headers range has the names last
+// read from it (range -> names), so it's handled like a range with configured names.
+func (configEntry ConfigEntry) WithHeaderNames(headerNames map[string][]string) ConfigEntry {
+	named := configEntry
+	named.Attributes = make([]AttributeRow, len(configEntry.Attributes))
+	for i, attr := range configEntry.Attributes {
+		if attr.Headers != "" {
+			attr.Names = headerNames[attr.Range]
+		}
+		named.Attributes[i] = attr
+	}
+	return named
+}
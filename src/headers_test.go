@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapHeaderTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		headers   string
+		values    [][]interface{}
+		wantNames []string
+		wantMap   map[string]string
+	}{
+		{"row", HeadersRow, [][]interface{}{{"Str", "Dex"}, {"16", 12.0}},
+			[]string{"Str", "Dex"}, map[string]string{"Str": "16", "Dex": "12"}},
+		{"column", HeadersColumn, [][]interface{}{{"Str", "16"}, {"Dex", "12"}},
+			[]string{"Str", "Dex"}, map[string]string{"Str": "16", "Dex": "12"}},
+		// blank names are skipped, and empty values left out
+		{"blanks", HeadersRow, [][]interface{}{{" Str ", "", "Con"}, {"16", "12"}},
+			[]string{"Str", "Con"}, map[string]string{"Str": "16"}},
+		{"names only", HeadersColumn, [][]interface{}{{"Str"}, {"Dex"}},
+			[]string{"Str", "Dex"}, map[string]string{}},
+		{"empty", HeadersRow, nil, []string{}, map[string]string{}},
+	}
+
+	for _, test := range tests {
+		charMap := map[string]string{}
+		names := MapHeaderTable(AttributeRow{Range: "A1:C2", Headers: test.headers}, test.values, charMap)
+		if !reflect.DeepEqual(names, test.wantNames) {
+			t.Errorf("%s: names = %q, want %q", test.name, names, test.wantNames)
+		}
+		if !reflect.DeepEqual(charMap, test.wantMap) {
+			t.Errorf("%s: attributes = %v, want %v", test.name, charMap, test.wantMap)
+		}
+	}
+}
+
+func TestValidateHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		attr    AttributeRow
+		wantErr string
+	}{
+		{"row", AttributeRow{Range: "A1:F2", Headers: HeadersRow}, ""},
+		{"column of numbers", AttributeRow{Range: "A1:B6", Headers: HeadersColumn, Type: AttributeTypeNumber}, ""},
+		{"unknown headers", AttributeRow{Range: "A1:F2", Headers: "diagonal"}, "must be row or column"},
+		{"with a name", AttributeRow{Name: "stats", Range: "A1:F2", Headers: HeadersRow}, "can't have name or names"},
+		{"with names", AttributeRow{Range: "A1:F2", Headers: HeadersRow, Names: []string{"str"}}, "can't have name or names"},
+		{"notes", AttributeRow{Range: "A1:F2", Headers: HeadersRow, Read: ReadNote}, "notes can't be read"},
+		{"list", AttributeRow{Range: "A1:F2", Headers: HeadersRow, Type: AttributeTypeList}, "served as text"},
+	}
+
+	for _, test := range tests {
+		err := test.attr.ValidateHeaders()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestHeaderAttributes(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{
+		"A1:C2": {{"Str", "Dex", "Con"}, {"16", "12", "14"}},
+		"B5":    {{"30"}},
+	})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Range: "A1:C2", Headers: HeadersRow},
+		{Name: "hp", Range: "B5"},
+	}})
+
+	app.PrimeCharacter("thorin")
+	if got, want := attributeMap(getResponse(t, app, "/thorin")), map[string]string{"Str": "16", "Dex": "12", "Con": "14", "hp": "30"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("attributes = %v, want %v", got, want)
+	}
+
+	// a column was renamed in the sheet
+	fake.lock.Lock()
+	fake.values["A1:C2"] = [][]interface{}{{"Str", "Wis", "Con"}, {"16", "10", "14"}}
+	fake.lock.Unlock()
+	app.PrimeCharacter("thorin")
+	if got, want := attributeMap(getResponse(t, app, "/thorin")), map[string]string{"Str": "16", "Wis": "10", "Con": "14", "hp": "30"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("attributes after renaming = %v, want %v", got, want)
+	}
+
+	// the names last read are kept with the values when the sheet can't be read
+	fake.Fail(http.StatusServiceUnavailable)
+	app.PrimeCharacter("thorin")
+	response := getResponse(t, app, "/thorin")
+	if got, want := attributeMap(response), map[string]string{"Str": "16", "Wis": "10", "Con": "14", "hp": "30"}; !reflect.DeepEqual(got, want) || !response.Metadata.Stale {
+		t.Errorf("attributes after a failed fetch = %v, stale %v, want %v, stale", got, response.Metadata.Stale, want)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	HealthCheckOk     = "ok"
+	HealthCheckFailed = "failed"
+)
+
+// HandleHealthz answers as long as the process is serving requests at all, for liveness
+// checks that should only restart the service when it's wedged.
+func (app *CharacterSheetServiceApp) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// Not GET - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	WriteApiResponseJson(w, ApiResponse{
+		Checks:   map[string]string{"process": HealthCheckOk},
+		Metadata: NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
+
+// HandleReadyz reports whether this instance should be sent traffic: the config is loaded,
+// there's a Sheets client, and startup priming finished with every character it waited
+// for read successfully at least once.
+func (app *CharacterSheetServiceApp) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// Not GET - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	checks, ready := app.ReadinessChecks()
+	if !ready {
+		// Not ready to serve - 503 Service Unavailable error
+		WriteApiResponseJson(w, ApiResponse{
+			Checks:   checks,
+			Metadata: NewMetadata(r.URL.Path, http.StatusServiceUnavailable, "Not ready; see the failed checks in the payload."),
+		})
+		return
+	}
+
+	WriteApiResponseJson(w, ApiResponse{
+		Checks:   checks,
+		Metadata: NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
+
+// ReadinessChecks maps each readiness check to "ok", "failed" or why it failed.
+func (app *CharacterSheetServiceApp) ReadinessChecks() (map[string]string, bool) {
+	// the config is loaded and validated before the server starts listening
+	checks := map[string]string{
+		"config":       HealthCheckOk,
+		"sheetsClient": HealthCheckOk,
+		"priming":      HealthCheckOk,
+	}
+
+	// demo mode and local files never talk to Google
+	if app.DemoAttributes == nil && app.Config.UsesGoogleSheets() && app.SheetService() == nil {
+		checks["sheetsClient"] = "no usable Google credentials are loaded"
+	}
+
+	if atomic.LoadInt32(&app.primed) == 0 {
+		checks["priming"] = "initial cache priming hasn't finished"
+	} else if failed := app.UnprimedCharacters(); len(failed) > 0 {
+		checks["priming"] = fmt.Sprintf("unable to read %d of the characters primed at startup", len(failed))
+		for _, charKey := range failed {
+			checks["character:"+charKey] = HealthCheckFailed
+		}
+	}
+
+	ready := true
+	for _, result := range checks {
+		if result != HealthCheckOk {
+			ready = false
+		}
+	}
+	return checks, ready
+}
+
+// UnprimedCharacters lists the characters startup priming waits for that are still only
+// serving the onErrorValue, having never been read. Characters primed after the server
+// starts (see readyAfterPriorityPrimed) don't hold readiness up.
+func (app *CharacterSheetServiceApp) UnprimedCharacters() []string {
+	unprimed := []string{}
+	characters := app.Characters()
+	for _, charKey := range app.PrimingOrder() {
+		if app.Config.ReadyAfterPriorityPrimed && characters[charKey].Priority <= 0 {
+			continue
+		}
+		if entry, found := app.Cache.Get(charKey); found && entry.FetchFailed {
+			unprimed = append(unprimed, charKey)
+		}
+	}
+	return unprimed
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandleReadyz(t *testing.T) {
+	tests := []struct {
+		name         string
+		primed       bool
+		gimliFails   bool
+		priorityOnly bool
+		noSheets     bool
+		wantStatus   int
+		wantNotOk    map[string]string
+	}{
+		{name: "ready", primed: true, wantStatus: http.StatusOK},
+		{name: "still priming", wantStatus: http.StatusServiceUnavailable,
+			wantNotOk: map[string]string{"priming": "initial cache priming hasn't finished"}},
+		{name: "a character never read", primed: true, gimliFails: true, wantStatus: http.StatusServiceUnavailable,
+			wantNotOk: map[string]string{"priming": "unable to read 1 of the characters primed at startup", "character:gimli": HealthCheckFailed}},
+		// gimli has no priority, so isn't waited for
+		{name: "only priority characters", primed: true, gimliFails: true, priorityOnly: true, wantStatus: http.StatusOK},
+		{name: "no Sheets client", primed: true, noSheets: true, wantStatus: http.StatusServiceUnavailable,
+			wantNotOk: map[string]string{"sheetsClient": "no usable Google credentials are loaded"}},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake,
+			ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Priority: 1, Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+			ConfigEntry{CharacterKey: "gimli", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.ReadyAfterPriorityPrimed = test.priorityOnly
+		app.PrimeCharacter("thorin")
+		if test.gimliFails {
+			fake.Fail(http.StatusServiceUnavailable)
+		}
+		app.PrimeCharacter("gimli")
+		if test.primed {
+			atomic.StoreInt32(&app.primed, 1)
+		}
+		if test.noSheets {
+			app.SetSheetService(nil)
+		}
+
+		w := httptest.NewRecorder()
+		app.HandleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.name, err)
+		}
+		notOk := map[string]string{}
+		for check, result := range response.Checks {
+			if result != HealthCheckOk {
+				notOk[check] = result
+			}
+		}
+		if test.wantNotOk == nil {
+			test.wantNotOk = map[string]string{}
+		}
+		if !reflect.DeepEqual(notOk, test.wantNotOk) {
+			t.Errorf("%s: failed checks = %v, want %v", test.name, notOk, test.wantNotOk)
+		}
+	}
+}
+
+func TestReadinessWithoutGoogle(t *testing.T) {
+	// characters read from local files don't need a Sheets client
+	app := newTestApp(t, newFakeSheets(t, nil), ConfigEntry{CharacterKey: "thorin", File: "thorin.csv", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.SetSheetService(nil)
+	atomic.StoreInt32(&app.primed, 1)
+
+	if checks, ready := app.ReadinessChecks(); !ready {
+		t.Errorf("checks = %v, want ready", checks)
+	}
+}
+
+func TestHandleHealthz(t *testing.T) {
+	tests := []struct {
+		method     string
+		wantStatus int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodHead, http.StatusOK},
+		{http.MethodPost, http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		// it answers even before priming has finished
+		app := newTestApp(t, newFakeSheets(t, nil))
+		w := httptest.NewRecorder()
+		app.HandleHealthz(w, httptest.NewRequest(test.method, "/healthz", nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.method, w.Code, test.wantStatus)
+		}
+	}
+
+	app := newTestApp(t, newFakeSheets(t, nil))
+	w := httptest.NewRecorder()
+	app.HandleReadyz(w, httptest.NewRequest(http.MethodPut, "/readyz", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT /readyz: status = %d, want 405", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// how often idle entries are looked for, unless the idle window itself is shorter
+const idleSweepInterval = 1 * time.Minute
+
+// IdleTracker records when each character was last requested, so entries nobody is
+// watching can be evicted and re-primed on their next request.
+type IdleTracker struct {
+	lastAccessed map[string]time.Time
+	lock         sync.Mutex
+}
+
+func NewIdleTracker() *IdleTracker {
+	return &IdleTracker{lastAccessed: map[string]time.Time{}}
+}
+
+func (tracker *IdleTracker) Touch(charKey string, at time.Time) {
+	tracker.lock.Lock()
+	tracker.lastAccessed[charKey] = at
+	tracker.lock.Unlock()
+}
+
+func (tracker *IdleTracker) LastAccessed(charKey string) (time.Time, bool) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	at, found := tracker.lastAccessed[charKey]
+	return at, found
+}
+
+// IdleSince returns the characters that haven't been requested since cutoff, and forgets
+// them until they're requested again.
+func (tracker *IdleTracker) IdleSince(cutoff time.Time) []string {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	idle := []string{}
+	for charKey, at := range tracker.lastAccessed {
+		if at.Before(cutoff) {
+			idle = append(idle, charKey)
+			delete(tracker.lastAccessed, charKey)
+		}
+	}
+	return idle
+}
+
+func (config CacheConfig) IdleWindow() time.Duration {
+	return time.Duration(config.IdleEvictSeconds) * time.Second
+}
+
+// EvictIdleCharacters periodically drops cached attributes for characters that haven't
+// been requested within the idle window. It never returns.
+func (app *CharacterSheetServiceApp) EvictIdleCharacters(window time.Duration) {
+	interval := idleSweepInterval
+	if window < interval {
+		interval = window
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, charKey := range app.IdleTracker.IdleSince(now.Add(-window)) {
+			log.Printf("***** '%s' idle for %v; evicting from cache *****", charKey, window)
+			app.Cache.Evict(charKey)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestIdleTracker(t *testing.T) {
+	start := time.Date(2021, 10, 1, 19, 0, 0, 0, time.UTC)
+	tracker := NewIdleTracker()
+	tracker.Touch("thorin", start)
+	tracker.Touch("balin", start.Add(10*time.Minute))
+	tracker.Touch("gimli", start.Add(20*time.Minute))
+
+	tests := []struct {
+		name   string
+		cutoff time.Time
+		want   []string
+	}{
+		{"nothing idle", start, []string{}},
+		{"older than the cutoff", start.Add(15 * time.Minute), []string{"balin", "thorin"}},
+		// idle characters are forgotten until they're requested again
+		{"already evicted", start.Add(15 * time.Minute), []string{}},
+		{"the rest", start.Add(time.Hour), []string{"gimli"}},
+	}
+
+	for _, test := range tests {
+		got := tracker.IdleSince(test.cutoff)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: IdleSince = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if _, found := tracker.LastAccessed("thorin"); found {
+		t.Errorf("evicted character still tracked")
+	}
+	tracker.Touch("thorin", start.Add(time.Hour))
+	if at, found := tracker.LastAccessed("thorin"); !found || !at.Equal(start.Add(time.Hour)) {
+		t.Errorf("LastAccessed = %v, %v after Touch", at, found)
+	}
+}
+
+func TestEvictIdleCharacters(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+	app.IdleTracker.Touch("thorin", time.Now())
+
+	go app.EvictIdleCharacters(20 * time.Millisecond)
+	waitFor(t, func() bool {
+		entry, found := app.Cache.Get("thorin")
+		return found && entry.Attributes == nil
+	})
+
+	// the next request re-primes it
+	fetches := len(fake.Requests())
+	if response := getResponse(t, app, "/thorin"); response.Metadata.StatusCode != http.StatusOK {
+		t.Errorf("status = %d for an evicted character, want 200", response.Metadata.StatusCode)
+	}
+	if len(fake.Requests()) == fetches {
+		t.Errorf("evicted character served without being fetched again")
+	}
+	if _, tracked := app.IdleTracker.LastAccessed("thorin"); !tracked {
+		t.Errorf("requested character isn't tracked again")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// jitter is capped so an entry can never expire immediately or live twice as long
+const maxExpiryJitterPercent = 50
+
+// ExpiryJitter spreads cache expiry times by up to +/- percent of the TTL, so characters
+// primed together don't all refresh at the same instant.
+type ExpiryJitter struct {
+	percent float64
+	random  *rand.Rand
+	lock    sync.Mutex
+}
+
+func NewExpiryJitter(percent float64, seed int64) *ExpiryJitter {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > maxExpiryJitterPercent {
+		percent = maxExpiryJitterPercent
+	}
+	return &ExpiryJitter{
+		percent: percent,
+		random:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (jitter *ExpiryJitter) Apply(expires time.Time, ttl time.Duration) time.Time {
+	if jitter == nil || jitter.percent == 0 {
+		return expires
+	}
+
+	jitter.lock.Lock()
+	factor := jitter.random.Float64()*2 - 1 // [-1, 1)
+	jitter.lock.Unlock()
+
+	return expires.Add(time.Duration(factor * jitter.percent / 100 * float64(ttl)))
+}
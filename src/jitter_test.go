@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiryJitter(t *testing.T) {
+	base := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	ttl := 30 * time.Second
+
+	tests := []struct {
+		name    string
+		percent float64
+		band    time.Duration
+	}{
+		{"disabled", 0, 0},
+		{"ten percent", 10, 3 * time.Second},
+		{"capped at fifty", 80, 15 * time.Second},
+		{"negative is off", -5, 0},
+	}
+
+	for _, test := range tests {
+		jitter := NewExpiryJitter(test.percent, 42)
+		seen := map[time.Time]bool{}
+		for i := 0; i < 100; i++ {
+			expires := jitter.Apply(base, ttl)
+			if expires.Before(base.Add(-test.band)) || expires.After(base.Add(test.band)) {
+				t.Fatalf("%s: expiry %v outside %v +/- %v", test.name, expires, base, test.band)
+			}
+			seen[expires] = true
+		}
+		if test.band == 0 && len(seen) != 1 {
+			t.Errorf("%s: expiry varies without jitter", test.name)
+		}
+		if test.band > 0 && len(seen) < 90 {
+			t.Errorf("%s: only %d distinct expiries across 100 updates", test.name, len(seen))
+		}
+	}
+}
+
+func TestExpiryJitterSeeded(t *testing.T) {
+	base := time.Now()
+	first, second := NewExpiryJitter(20, 7), NewExpiryJitter(20, 7)
+	for i := 0; i < 10; i++ {
+		if a, b := first.Apply(base, defaultCacheTtl), second.Apply(base, defaultCacheTtl); !a.Equal(b) {
+			t.Fatalf("update %d: same seed gave %v and %v", i, a, b)
+		}
+	}
+}
+
+func TestUpdateCachedEntryJitter(t *testing.T) {
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin"})
+	app.ExpiryJitter = NewExpiryJitter(10, 1)
+
+	offsets := map[time.Duration]bool{}
+	for i := 0; i < 20; i++ {
+		entry := NewCachedEntry(&map[string]string{"hp": "12"}, defaultCacheTtl)
+		unjittered := entry.Expires
+		app.UpdateCachedEntry("thorin", entry)
+
+		cached, _ := app.Cache.Get("thorin")
+		offset := cached.Expires.Sub(unjittered)
+		if offset < -3*time.Second || offset > 3*time.Second {
+			t.Fatalf("expiry moved by %v, outside +/- 10%% of %v", offset, defaultCacheTtl)
+		}
+		offsets[offset] = true
+	}
+	if len(offsets) < 15 {
+		t.Errorf("only %d distinct expiry offsets across 20 updates", len(offsets))
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JsonPath is a compiled JSONPath expression. It supports the parts campaign APIs usually
+// need: $, .name and ['name'], [index] (negative from the end), * and [*], ..name for
+// recursive descent, and filters such as [?(@.name == 'Rope')] or [?(@.equipped)].
+type JsonPath struct {
+	steps []jsonPathStep
+}
+
+const (
+	jsonPathChild = iota
+	jsonPathIndex
+	jsonPathWildcard
+	jsonPathDescend
+	jsonPathFilter
+)
+
+type jsonPathStep struct {
+	kind   int
+	key    string
+	index  int
+	filter *jsonPathFilterExpr
+}
+
+type jsonPathFilterExpr struct {
+	path     []string
+	operator string
+	operand  interface{}
+}
+
+func ParseJsonPath(expression string) (*JsonPath, error) {
+	if !strings.HasPrefix(expression, "$") {
+		return nil, fmt.Errorf("JSONPath '%s' must start with $", expression)
+	}
+
+	path := &JsonPath{}
+	rest := expression[1:]
+	for rest != "" {
+		var err error
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			path.steps = append(path.steps, jsonPathStep{kind: jsonPathDescend})
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				continue
+			}
+			rest, err = path.parseName(rest)
+		case strings.HasPrefix(rest, "."):
+			rest, err = path.parseName(rest[1:])
+		case strings.HasPrefix(rest, "["):
+			rest, err = path.parseBracket(rest[1:])
+		default:
+			err = fmt.Errorf("unexpected '%s'", rest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSONPath '%s': %v", expression, err)
+		}
+	}
+	return path, nil
+}
+
+func (path *JsonPath) parseName(rest string) (string, error) {
+	end := strings.IndexAny(rest, ".[")
+	if end < 0 {
+		end = len(rest)
+	}
+	name := rest[:end]
+	if name == "" {
+		return "", fmt.Errorf("missing name")
+	}
+	if name == "*" {
+		path.steps = append(path.steps, jsonPathStep{kind: jsonPathWildcard})
+	} else {
+		path.steps = append(path.steps, jsonPathStep{kind: jsonPathChild, key: name})
+	}
+	return rest[end:], nil
+}
+
+func (path *JsonPath) parseBracket(rest string) (string, error) {
+	if strings.HasPrefix(rest, "?(") {
+		end, _ := jsonPathUnquotedIndex(rest, []string{")]"})
+		if end < 0 {
+			return "", fmt.Errorf("unclosed filter")
+		}
+		filter, err := parseJsonPathFilter(strings.TrimSpace(rest[2:end]))
+		if err != nil {
+			return "", err
+		}
+		path.steps = append(path.steps, jsonPathStep{kind: jsonPathFilter, filter: filter})
+		return rest[end+2:], nil
+	}
+
+	end := strings.Index(rest, "]")
+	if end < 0 {
+		return "", fmt.Errorf("unclosed [")
+	}
+	selector := strings.TrimSpace(rest[:end])
+	switch {
+	case selector == "*":
+		path.steps = append(path.steps, jsonPathStep{kind: jsonPathWildcard})
+	case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+		path.steps = append(path.steps, jsonPathStep{kind: jsonPathChild, key: selector[1 : len(selector)-1]})
+	default:
+		index, err := strconv.Atoi(selector)
+		if err != nil {
+			return "", fmt.Errorf("unsupported selector [%s]", selector)
+		}
+		path.steps = append(path.steps, jsonPathStep{kind: jsonPathIndex, index: index})
+	}
+	return rest[end+1:], nil
+}
+
+// two-character operators first, so <= isn't read as <
+var jsonPathOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// jsonPathUnquotedIndex finds the first of candidates in expression that isn't inside a
+// quoted literal, returning -1 if there's none.
+func jsonPathUnquotedIndex(expression string, candidates []string) (int, string) {
+	quote := byte(0)
+	for i := 0; i < len(expression); i++ {
+		switch c := expression[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		default:
+			for _, candidate := range candidates {
+				if strings.HasPrefix(expression[i:], candidate) {
+					return i, candidate
+				}
+			}
+		}
+	}
+	return -1, ""
+}
+
+func parseJsonPathFilter(expression string) (*jsonPathFilterExpr, error) {
+	filter := &jsonPathFilterExpr{}
+	left := expression
+	if i, operator := jsonPathUnquotedIndex(expression, jsonPathOperators); i >= 0 {
+		filter.operator = operator
+		left = strings.TrimSpace(expression[:i])
+		operand := strings.TrimSpace(expression[i+len(operator):])
+		if len(operand) >= 2 && (operand[0] == '\'' || operand[0] == '"') && operand[len(operand)-1] == operand[0] {
+			filter.operand = operand[1 : len(operand)-1]
+		} else if number, err := strconv.ParseFloat(operand, 64); err == nil {
+			filter.operand = number
+		} else if operand == "true" || operand == "false" {
+			filter.operand = operand == "true"
+		} else {
+			return nil, fmt.Errorf("unsupported filter value '%s'", operand)
+		}
+	}
+
+	if left != "@" && !strings.HasPrefix(left, "@.") {
+		return nil, fmt.Errorf("filter must compare @ or @.<path>, not '%s'", left)
+	}
+	if left != "@" {
+		filter.path = strings.Split(left[2:], ".")
+	}
+	return filter, nil
+}
+
+// Select returns every value the path matches in document, in document order.
+func (path *JsonPath) Select(document interface{}) []interface{} {
+	nodes := []interface{}{document}
+	for _, step := range path.steps {
+		next := []interface{}{}
+		for _, node := range nodes {
+			next = append(next, step.apply(node)...)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (step jsonPathStep) apply(node interface{}) []interface{} {
+	switch step.kind {
+	case jsonPathChild:
+		if object, ok := node.(map[string]interface{}); ok {
+			if value, found := object[step.key]; found {
+				return []interface{}{value}
+			}
+		}
+	case jsonPathIndex:
+		if list, ok := node.([]interface{}); ok {
+			index := step.index
+			if index < 0 {
+				index += len(list)
+			}
+			if index >= 0 && index < len(list) {
+				return []interface{}{list[index]}
+			}
+		}
+	case jsonPathWildcard:
+		return jsonPathChildren(node)
+	case jsonPathDescend:
+		// the node itself and everything below it, for the next step to select from
+		descendants := []interface{}{node}
+		for _, child := range jsonPathChildren(node) {
+			descendants = append(descendants, step.apply(child)...)
+		}
+		return descendants
+	case jsonPathFilter:
+		matched := []interface{}{}
+		for _, child := range jsonPathChildren(node) {
+			if step.filter.matches(child) {
+				matched = append(matched, child)
+			}
+		}
+		return matched
+	}
+	return nil
+}
+
+// jsonPathChildren are a list's items, or an object's values in key order.
+func jsonPathChildren(node interface{}) []interface{} {
+	switch typed := node.(type) {
+	case []interface{}:
+		return typed
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		children := make([]interface{}, len(keys))
+		for i, key := range keys {
+			children[i] = typed[key]
+		}
+		return children
+	}
+	return nil
+}
+
+func (filter *jsonPathFilterExpr) matches(node interface{}) bool {
+	value := node
+	for _, key := range filter.path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = object[key]; !ok {
+			return false
+		}
+	}
+
+	if filter.operator == "" {
+		// existence; false and null don't count
+		return value != nil && value != false
+	}
+
+	switch operand := filter.operand.(type) {
+	case string:
+		text, ok := value.(string)
+		if !ok {
+			return filter.operator == "!="
+		}
+		return compareOrdered(filter.operator, strings.Compare(text, operand))
+	case float64:
+		number, ok := value.(float64)
+		if !ok {
+			return filter.operator == "!="
+		}
+		switch {
+		case number < operand:
+			return compareOrdered(filter.operator, -1)
+		case number > operand:
+			return compareOrdered(filter.operator, 1)
+		}
+		return compareOrdered(filter.operator, 0)
+	case bool:
+		if filter.operator == "!=" {
+			return value != operand
+		}
+		return filter.operator == "==" && value == operand
+	}
+	return false
+}
+
+func compareOrdered(operator string, comparison int) bool {
+	switch operator {
+	case "==":
+		return comparison == 0
+	case "!=":
+		return comparison != 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJsonPathSelect(t *testing.T) {
+	var document interface{}
+	err := json.Unmarshal([]byte(`{
+		"name": "Thorin",
+		"stats": {"hp": 12, "max hp": 30},
+		"items": [
+			{"name": "Rope", "weight": 10, "equipped": false},
+			{"name": "Orcrist", "weight": 3, "equipped": true},
+			{"name": "Rope's end", "weight": 1, "note": "a < 'b==c'"}
+		],
+		"party": {"balin": {"hp": 9}, "dwalin": {"hp": 14}}
+	}`), &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []interface{}
+	}{
+		{"root", "$", []interface{}{document}},
+		{"child", "$.name", []interface{}{"Thorin"}},
+		{"nested child", "$.stats.hp", []interface{}{12.0}},
+		{"quoted child", "$.stats['max hp']", []interface{}{30.0}},
+		{"double quoted child", `$["name"]`, []interface{}{"Thorin"}},
+		{"missing child", "$.mana", []interface{}{}},
+		{"index", "$.items[1].name", []interface{}{"Orcrist"}},
+		{"negative index", "$.items[-1].weight", []interface{}{1.0}},
+		{"index out of range", "$.items[3]", []interface{}{}},
+		{"wildcard", "$.items[*].weight", []interface{}{10.0, 3.0, 1.0}},
+		{"dot wildcard", "$.party.*.hp", []interface{}{9.0, 14.0}},
+		// objects are walked in key order
+		{"recursive descent", "$..hp", []interface{}{9.0, 14.0, 12.0}},
+		{"recursive descent into a bracket", "$..items[0].name", []interface{}{"Rope"}},
+		{"filter by string", "$.items[?(@.name == 'Rope')].weight", []interface{}{10.0}},
+		{"filter by number", "$.items[?(@.weight < 5)].name", []interface{}{"Orcrist", "Rope's end"}},
+		{"filter with <=", "$.items[?(@.weight <= 3)].name", []interface{}{"Orcrist", "Rope's end"}},
+		{"filter with !=", "$.items[?(@.name != 'Rope')].weight", []interface{}{3.0, 1.0}},
+		{"filter by bool", "$.items[?(@.equipped == true)].name", []interface{}{"Orcrist"}},
+		{"filter by existence", "$.items[?(@.equipped)].name", []interface{}{"Orcrist"}},
+		{"filter literal with an operator", `$.items[?(@.note == "a < 'b==c'")].name`, []interface{}{"Rope's end"}},
+		{"filter literal with a bracket", "$.items[?(@.name == 'x)]')].name", []interface{}{}},
+		{"filter on the node", "$.items[*].weight[?(@ > 100)]", []interface{}{}},
+	}
+
+	for _, test := range tests {
+		path, err := ParseJsonPath(test.path)
+		if err != nil {
+			t.Errorf("%s: ParseJsonPath(%q) error = %v", test.name, test.path, err)
+			continue
+		}
+		if got := path.Select(document); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %s = %v, want %v", test.name, test.path, got, test.want)
+		}
+	}
+}
+
+func TestParseJsonPathFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       string
+		wantPath     []string
+		wantOperator string
+		wantOperand  interface{}
+	}{
+		{"string", "@.name == 'Rope'", []string{"name"}, "==", "Rope"},
+		{"number", "@.stats.hp >= 10", []string{"stats", "hp"}, ">=", 10.0},
+		{"bool", "@.equipped != false", []string{"equipped"}, "!=", false},
+		{"existence", "@.equipped", []string{"equipped"}, "", nil},
+		{"operator inside the literal", "@.a < 'x==y'", []string{"a"}, "<", "x==y"},
+		{"comparison inside the literal", `@.a == "b < c"`, []string{"a"}, "==", "b < c"},
+		{"the node itself", "@ > 3", nil, ">", 3.0},
+	}
+
+	for _, test := range tests {
+		filter, err := parseJsonPathFilter(test.filter)
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(filter.path, test.wantPath) || filter.operator != test.wantOperator || filter.operand != test.wantOperand {
+			t.Errorf("%s: filter = %v %q %v, want %v %q %v", test.name,
+				filter.path, filter.operator, filter.operand, test.wantPath, test.wantOperator, test.wantOperand)
+		}
+	}
+}
+
+func TestParseJsonPathErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"no root", "name"},
+		{"missing name", "$.name."},
+		{"unclosed bracket", "$.items[0"},
+		{"unclosed filter", "$.items[?(@.name == 'Rope'"},
+		{"unsupported selector", "$.items[0:2]"},
+		{"unsupported filter value", "$.items[?(@.name == Rope)]"},
+		{"filter without @", "$.items[?(name == 'Rope')]"},
+		{"unexpected", "$name"},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseJsonPath(test.path); err == nil {
+			t.Errorf("%s: ParseJsonPath(%q) succeeded", test.name, test.path)
+		}
+	}
+}
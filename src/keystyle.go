@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	KeyStyleAsIs  = "asIs"
+	KeyStyleLower = "lower"
+	KeyStyleCamel = "camel"
+	KeyStyleSnake = "snake"
+)
+
+func ValidKeyStyle(keyStyle string) bool {
+	switch keyStyle {
+	case "", KeyStyleAsIs, KeyStyleLower, KeyStyleCamel, KeyStyleSnake:
+		return true
+	}
+	return false
+}
+
+func ApplyKeyStyle(keyStyle string, name string) string {
+	switch keyStyle {
+	case KeyStyleLower:
+		return strings.ToLower(name)
+	case KeyStyleCamel:
+		words := splitKeyWords(name)
+		for i, word := range words {
+			word = strings.ToLower(word)
+			if i > 0 {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			}
+			words[i] = word
+		}
+		return strings.Join(words, "")
+	case KeyStyleSnake:
+		words := splitKeyWords(name)
+		for i, word := range words {
+			words[i] = strings.ToLower(word)
+		}
+		return strings.Join(words, "_")
+	default:
+		return name
+	}
+}
+
+func StyleAttributeKeys(keyStyle string, attributes map[string]string) map[string]string {
+	if keyStyle == "" || keyStyle == KeyStyleAsIs {
+		return attributes
+	}
+
+	styled := make(map[string]string, len(attributes))
+	for name, value := range attributes {
+		styled[ApplyKeyStyle(keyStyle, name)] = value
+	}
+	return styled
+}
+
+// CheckKeyStyleCollisions returns an error if styling would turn two attribute names into one.
+func CheckKeyStyleCollisions(keyStyle string, configEntry ConfigEntry) error {
+	seen := map[string]string{}
+	for _, name := range configEntry.AttributeNames() {
+		styled := ApplyKeyStyle(keyStyle, name)
+		if other, found := seen[styled]; found && other != name {
+			return fmt.Errorf("character '%s': attributes '%s' and '%s' both become '%s' with keyStyle '%s'",
+				configEntry.CharacterKey, other, name, styled, keyStyle)
+		}
+		seen[styled] = name
+	}
+	return nil
+}
+
+// splitKeyWords breaks a name into words on separators and camelCase boundaries, so
+// "hpMax", "hp_max", "HP-Max" and "HPMax" all split into "hp"/"HP" and "Max".
+func splitKeyWords(name string) []string {
+	runes := []rune(name)
+	words := []string{}
+	start := -1
+
+	for i, r := range runes {
+		if r == '_' || r == '-' || unicode.IsSpace(r) {
+			if start >= 0 {
+				words = append(words, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+
+		if start >= 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+
+	return words
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyKeyStyle(t *testing.T) {
+	tests := []struct {
+		name                            string
+		wantLower, wantCamel, wantSnake string
+	}{
+		{"hpMax", "hpmax", "hpMax", "hp_max"},
+		{"hp_max", "hp_max", "hpMax", "hp_max"},
+		{"HP-Max", "hp-max", "hpMax", "hp_max"},
+		{"HPMax", "hpmax", "hpMax", "hp_max"},
+		{"Player Name", "player name", "playerName", "player_name"},
+		{"spellSlots2", "spellslots2", "spellSlots2", "spell_slots2"},
+		{"ac", "ac", "ac", "ac"},
+	}
+
+	for _, test := range tests {
+		for _, style := range []struct{ keyStyle, want string }{
+			{"", test.name},
+			{KeyStyleAsIs, test.name},
+			{KeyStyleLower, test.wantLower},
+			{KeyStyleCamel, test.wantCamel},
+			{KeyStyleSnake, test.wantSnake},
+		} {
+			if got := ApplyKeyStyle(style.keyStyle, test.name); got != style.want {
+				t.Errorf("ApplyKeyStyle(%q, %q) = %q, want %q", style.keyStyle, test.name, got, style.want)
+			}
+		}
+	}
+}
+
+func TestCheckKeyStyleCollisions(t *testing.T) {
+	configEntry := ConfigEntry{
+		CharacterKey: "thorin",
+		Attributes: []AttributeRow{
+			{Name: "hpMax", Range: "B2"},
+			{Name: "hp_max", Range: "B3"},
+			{Name: "HPMAX", Range: "B4"},
+		},
+	}
+
+	tests := []struct {
+		keyStyle string
+		wantErr  string
+	}{
+		{KeyStyleAsIs, ""},
+		{KeyStyleLower, "'hpMax' and 'HPMAX' both become 'hpmax'"},
+		{KeyStyleCamel, "'hpMax' and 'hp_max' both become 'hpMax'"},
+		{KeyStyleSnake, "'hpMax' and 'hp_max' both become 'hp_max'"},
+	}
+
+	for _, test := range tests {
+		err := CheckKeyStyleCollisions(test.keyStyle, configEntry)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.keyStyle, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: error = %v, want one containing %q", test.keyStyle, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateKeyStyle(t *testing.T) {
+	for _, keyStyle := range []string{"", KeyStyleAsIs, KeyStyleLower, KeyStyleCamel, KeyStyleSnake} {
+		if err := (ServiceConfig{KeyStyle: keyStyle}).Validate(); err != nil {
+			t.Errorf("keyStyle %q: unexpected error %v", keyStyle, err)
+		}
+	}
+	if err := (ServiceConfig{KeyStyle: "kebab"}).Validate(); err == nil {
+		t.Errorf("keyStyle kebab: no error")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import "unicode/utf8"
+
+const (
+	defaultMaxCellsPerAttribute = 1000
+	defaultMaxResponseBytes     = 1024 * 1024
+)
+
+// LimitsConfig caps how much sheet data is held per character; zero means use the default.
+type LimitsConfig struct {
+	MaxCellsPerAttribute int `json:"maxCellsPerAttribute"`
+	MaxResponseBytes     int `json:"maxResponseBytes"`
+}
+
+func (limits LimitsConfig) CellsPerAttribute() int {
+	if limits.MaxCellsPerAttribute > 0 {
+		return limits.MaxCellsPerAttribute
+	}
+	return defaultMaxCellsPerAttribute
+}
+
+func (limits LimitsConfig) ResponseBytes() int {
+	if limits.MaxResponseBytes > 0 {
+		return limits.MaxResponseBytes
+	}
+	return defaultMaxResponseBytes
+}
+
+// TruncateCells keeps at most maxCells cells of a range, in row-major order.
+func TruncateCells(values [][]interface{}, maxCells int) ([][]interface{}, bool) {
+	count := 0
+	for r, row := range values {
+		if count+len(row) > maxCells {
+			truncated := append(values[:r:r], row[:maxCells-count])
+			return truncated, true
+		}
+		count += len(row)
+	}
+	return values, false
+}
+
+// TruncateAttributes drops attributes, in reverse config order, until the names and values
+// fit within maxBytes.
+func TruncateAttributes(charConfig ConfigEntry, charMap map[string]string, maxBytes int) bool {
+	size := 0
+	for name, value := range charMap {
+		size += len(name) + len(value)
+	}
+	if size <= maxBytes {
+		return false
+	}
+
+	names := charConfig.AttributeNames()
+	for i := len(names) - 1; i >= 0 && size > maxBytes; i-- {
+		if value, found := charMap[names[i]]; found {
+			size -= len(names[i]) + len(value)
+			delete(charMap, names[i])
+		}
+	}
+	return true
+}
+
+// TruncateValue cuts value to at most maxLength runes, the last of which are ellipsis.
+// A maxLength of 0 leaves the value alone.
+func TruncateValue(value string, maxLength int, ellipsis string) string {
+	if maxLength <= 0 || utf8.RuneCountInString(value) <= maxLength {
+		return value
+	}
+
+	keep := maxLength - utf8.RuneCountInString(ellipsis)
+	runes := []rune(value)
+	return string(runes[:keep]) + ellipsis
+}
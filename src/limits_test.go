@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTruncateCells(t *testing.T) {
+	tests := []struct {
+		name          string
+		values        [][]interface{}
+		maxCells      int
+		want          [][]interface{}
+		wantTruncated bool
+	}{
+		{"under the limit", [][]interface{}{{"a", "b"}, {"c"}}, 3, [][]interface{}{{"a", "b"}, {"c"}}, false},
+		{"mid-row", [][]interface{}{{"a", "b"}, {"c", "d"}}, 3, [][]interface{}{{"a", "b"}, {"c"}}, true},
+		{"at a row end", [][]interface{}{{"a", "b"}, {"c", "d"}}, 2, [][]interface{}{{"a", "b"}, {}}, true},
+		{"empty", [][]interface{}{}, 1, [][]interface{}{}, false},
+	}
+
+	for _, test := range tests {
+		got, truncated := TruncateCells(test.values, test.maxCells)
+		if truncated != test.wantTruncated || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: TruncateCells = %v, %v; want %v, %v", test.name, got, truncated, test.want, test.wantTruncated)
+		}
+	}
+}
+
+func TestTruncateAttributes(t *testing.T) {
+	charConfig := ConfigEntry{Attributes: []AttributeRow{
+		{Name: "name", Range: "B1"}, {Name: "hp", Range: "B2"}, {Name: "notes", Range: "B3"},
+	}}
+	charMap := map[string]string{"name": "Thorin", "hp": "27", "notes": "a long backstory"}
+
+	if !TruncateAttributes(charConfig, charMap, 20) {
+		t.Errorf("attributes over the limit not truncated")
+	}
+	// the last configured attributes go first
+	if want := map[string]string{"name": "Thorin", "hp": "27"}; !reflect.DeepEqual(charMap, want) {
+		t.Errorf("truncated to %v, want %v", charMap, want)
+	}
+	if TruncateAttributes(charConfig, charMap, 20) {
+		t.Errorf("attributes within the limit truncated")
+	}
+}
+
+func TestFetchTruncatesLargeRange(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{
+		"A1:E1": {{"1", "2", "3", "4", "5"}},
+		"B2":    {{"12"}},
+	})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Range: "A1:E1", Names: []string{"a", "b", "c", "d", "e"}},
+		{Name: "hp", Range: "B2"},
+	}})
+	app.Config.Limits.MaxCellsPerAttribute = 3
+	app.FetchCharacterAttributes(context.Background(), "thorin")
+
+	w := httptest.NewRecorder()
+	app.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/thorin", nil))
+	var response ApiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+
+	if want := map[string]string{"a": "1", "b": "2", "c": "3", "hp": "12"}; !reflect.DeepEqual(attributeMap(response), want) {
+		t.Errorf("attributes = %v, want %v", attributeMap(response), want)
+	}
+	if !response.Metadata.Truncated {
+		t.Errorf("metadata doesn't say the attributes were truncated")
+	}
+}
+
+func TestTruncateValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		maxLength int
+		ellipsis  string
+		want      string
+	}{
+		{"no limit", "Thorin Oakenshield", 0, "…", "Thorin Oakenshield"},
+		{"under the limit", "Thorin", 10, "…", "Thorin"},
+		{"at the limit", "Thorin Oak", 10, "…", "Thorin Oak"},
+		{"over the limit", "Thorin Oakenshield", 10, "…", "Thorin Oa…"},
+		{"no ellipsis", "Thorin Oakenshield", 6, "", "Thorin"},
+		{"multi-rune ellipsis", "Thorin Oakenshield", 10, "...", "Thorin ..."},
+		{"multibyte at the boundary", "Éowyn of Rohan", 6, "…", "Éowyn…"},
+		{"multibyte value", "ドワーフの王トーリン", 5, "…", "ドワーフ…"},
+	}
+
+	for _, test := range tests {
+		if got := TruncateValue(test.value, test.maxLength, test.ellipsis); got != test.want {
+			t.Errorf("%s: TruncateValue(%q, %d) = %q, want %q", test.name, test.value, test.maxLength, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// LocalFileDataSource reads characters whose config has a file instead of a sheetId: a
+// .csv, or an .xlsx workbook as saved by Excel or LibreOffice, for games run offline. Ranges
+// are A1 references; an .xlsx can also use the workbook's named ranges. Cells are read as
+// their stored values, without number formats, and formulas as their last computed result.
+type LocalFileDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+// Workbook is a local file's cells, by tab name. A CSV has a single, unnamed tab.
+type Workbook struct {
+	Tabs     map[string][][]string
+	FirstTab string
+	Names    map[string]string
+}
+
+// Version is the file's modification time, so an unchanged file isn't read again.
+func (source LocalFileDataSource) Version(ctx context.Context, charConfig ConfigEntry) string {
+	return FileVersion(charConfig.File)
+}
+
+// FileVersion is a file's modification time, or "" when it can't be read.
+func FileVersion(fileName string) string {
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		return ""
+	}
+	return fileInfo.ModTime().UTC().Format(time.RFC3339Nano)
+}
+
+func (source LocalFileDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	workbook, err := ReadWorkbook(charConfig.File)
+	if err != nil {
+		return FetchedAttributes{}, err
+	}
+
+	rangeErrors := map[string]string{}
+	valueRanges := make([]*sheets.ValueRange, len(charConfig.Attributes))
+	for i, attr := range charConfig.Attributes {
+		valueRanges[i] = &sheets.ValueRange{Range: attr.Range}
+
+		values, err := workbook.Range(attr.Range)
+		if err != nil {
+			log.Printf("Range '%s' for '%s': %v", attr.Range, charConfig.CharacterKey, err)
+			for _, name := range attr.AttributeNames() {
+				rangeErrors[name] = err.Error()
+			}
+			continue
+		}
+		valueRanges[i].Values = values
+	}
+
+	fetched := source.app.MapValueRanges(charConfig, valueRanges)
+	for name, message := range rangeErrors {
+		fetched.Errors[name] = message
+	}
+	return fetched, nil
+}
+
+func ReadWorkbook(fileName string) (*Workbook, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		file, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		grid, err := ParseCsvExport(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV file %s: %v", fileName, err)
+		}
+		return &Workbook{Tabs: map[string][][]string{"": grid}}, nil
+	case ".xlsx":
+		return ReadXlsxWorkbook(fileName)
+	default:
+		return nil, fmt.Errorf("unsupported file %s; must be .csv or .xlsx", fileName)
+	}
+}
+
+// Range returns the cells of an A1 range, or of a named range, trimmed the same way the
+// Sheets API trims them.
+func (workbook *Workbook) Range(cellRange string) ([][]interface{}, error) {
+	parsed, ok := ParseA1Range(cellRange)
+	if !ok {
+		named, found := workbook.Names[cellRange]
+		if !found {
+			return nil, fmt.Errorf("no range or named range '%s' in file", cellRange)
+		}
+		if parsed, ok = ParseA1Range(named); !ok {
+			return nil, fmt.Errorf("named range '%s' refers to '%s', which isn't a single range", cellRange, named)
+		}
+	}
+
+	tab := parsed.Sheet
+	if len(workbook.Tabs) == 1 && workbook.FirstTab == "" {
+		// a CSV file has just the one tab, whatever the range calls it
+		tab = ""
+	} else if tab == "" {
+		tab = workbook.FirstTab
+	}
+	grid, found := workbook.Tabs[tab]
+	if !found {
+		return nil, fmt.Errorf("no tab '%s' in file", tab)
+	}
+
+	return ExtractCsvRange(grid, parsed), nil
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		Id   string `xml:"id,attr"`
+	} `xml:"sheets>sheet"`
+	DefinedNames []struct {
+		Name         string `xml:"name,attr"`
+		LocalSheetId string `xml:"localSheetId,attr"`
+		Value        string `xml:",chardata"`
+	} `xml:"definedNames>definedName"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// rich text strings are split into runs, each with its own <t>
+type xlsxString struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (str xlsxString) String() string {
+	if len(str.Runs) == 0 {
+		return str.Text
+	}
+	text := ""
+	for _, run := range str.Runs {
+		text += run.Text
+	}
+	return text
+}
+
+type xlsxSharedStrings struct {
+	Strings []xlsxString `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string     `xml:"r,attr"`
+			Type   string     `xml:"t,attr"`
+			Value  string     `xml:"v"`
+			Inline xlsxString `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXlsxWorkbook reads every tab of an .xlsx file. It only needs the handful of parts
+// that hold cell values, rather than a full spreadsheet library.
+func ReadXlsxWorkbook(fileName string) (*Workbook, error) {
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %v", fileName, err)
+	}
+	defer archive.Close()
+
+	parts := map[string]*zip.File{}
+	for _, part := range archive.File {
+		parts[part.Name] = part
+	}
+	readPart := func(name string, into interface{}) error {
+		part, found := parts[name]
+		if !found {
+			return fmt.Errorf("%s has no %s", fileName, name)
+		}
+		reader, err := part.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		if err := xml.NewDecoder(reader).Decode(into); err != nil && err != io.EOF {
+			return fmt.Errorf("invalid %s in %s: %v", name, fileName, err)
+		}
+		return nil
+	}
+
+	var workbookPart xlsxWorkbook
+	if err := readPart("xl/workbook.xml", &workbookPart); err != nil {
+		return nil, err
+	}
+	var relationships xlsxRelationships
+	if err := readPart("xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return nil, err
+	}
+	var sharedStrings xlsxSharedStrings
+	if _, found := parts["xl/sharedStrings.xml"]; found {
+		if err := readPart("xl/sharedStrings.xml", &sharedStrings); err != nil {
+			return nil, err
+		}
+	}
+
+	targets := map[string]string{}
+	for _, relationship := range relationships.Relationships {
+		// targets are relative to xl/, unless they're absolute within the archive
+		if strings.HasPrefix(relationship.Target, "/") {
+			targets[relationship.Id] = strings.TrimPrefix(relationship.Target, "/")
+		} else {
+			targets[relationship.Id] = path.Join("xl", relationship.Target)
+		}
+	}
+
+	workbook := &Workbook{Tabs: map[string][][]string{}, Names: map[string]string{}}
+	for i, sheet := range workbookPart.Sheets {
+		var worksheet xlsxWorksheet
+		if err := readPart(targets[sheet.Id], &worksheet); err != nil {
+			return nil, err
+		}
+
+		grid := [][]string{}
+		for _, row := range worksheet.Rows {
+			for _, cell := range row.Cells {
+				col, rowNumber, ok := parseCellRef(cell.Ref)
+				if !ok {
+					continue
+				}
+
+				value := cell.Value
+				switch cell.Type {
+				case "s":
+					if index, err := strconv.Atoi(cell.Value); err == nil && index < len(sharedStrings.Strings) {
+						value = sharedStrings.Strings[index].String()
+					}
+				case "inlineStr":
+					value = cell.Inline.String()
+				case "b":
+					value = strings.ToUpper(strconv.FormatBool(cell.Value == "1"))
+				}
+
+				for len(grid) < rowNumber {
+					grid = append(grid, []string{})
+				}
+				for len(grid[rowNumber-1]) < col {
+					grid[rowNumber-1] = append(grid[rowNumber-1], "")
+				}
+				grid[rowNumber-1][col-1] = value
+			}
+		}
+
+		workbook.Tabs[sheet.Name] = grid
+		if i == 0 {
+			workbook.FirstTab = sheet.Name
+		}
+	}
+
+	// names scoped to a single tab are ignored, as are ones that aren't a plain range
+	for _, definedName := range workbookPart.DefinedNames {
+		if definedName.LocalSheetId == "" && !strings.HasPrefix(definedName.Name, "_xlnm.") {
+			workbook.Names[definedName.Name] = definedName.Value
+		}
+	}
+
+	return workbook, nil
+}
+
+// parseCellRef splits a cell reference such as "B12" into its column and row numbers.
+func parseCellRef(ref string) (col int, row int, ok bool) {
+	split := strings.IndexAny(ref, "0123456789")
+	if split <= 0 {
+		return 0, 0, false
+	}
+	row, err := strconv.Atoi(ref[split:])
+	if err != nil || row < 1 {
+		return 0, 0, false
+	}
+	return a1ColumnNumber(ref[:split]), row, true
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeXlsx writes an .xlsx file with the given parts, as a spreadsheet program would
+// save them.
+func writeXlsx(t *testing.T, fileName string, parts map[string]string) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	for name, contents := range parts {
+		writer, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(contents))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+}
+
+// thorinXlsx is a two-tab workbook as saved by Excel: shared, inline and rich text strings,
+// a boolean, a formula's cached result, and workbook and tab-scoped names.
+var thorinXlsx = map[string]string{
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+  <sheets>
+    <sheet name="Stats" sheetId="1" r:id="rId1"/>
+    <sheet name="Gear" sheetId="2" r:id="rId2"/>
+  </sheets>
+  <definedNames>
+    <definedName name="HitPoints">Stats!$B$2</definedName>
+    <definedName name="Local" localSheetId="0">Stats!$B$3</definedName>
+    <definedName name="_xlnm.Print_Area">Stats!$A$1:$B$4</definedName>
+  </definedNames>
+</workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+  <Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`,
+	"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="3" uniqueCount="3">
+  <si><t>Name</t></si>
+  <si><t>Thorin</t></si>
+  <si><r><t>Orc</t></r><r><t>rist</t></r></si>
+</sst>`,
+	"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <sheetData>
+    <row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+    <row r="2"><c r="B2"><v>12</v></c></row>
+    <row r="3"><c r="B3"><f>B2*2</f><v>24</v></c></row>
+    <row r="4"><c r="B4" t="b"><v>1</v></c></row>
+  </sheetData>
+</worksheet>`,
+	"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <sheetData>
+    <row r="1"><c r="A1" t="s"><v>2</v></c></row>
+    <row r="2"><c r="A2" t="inlineStr"><is><t>Rope</t></is></c></row>
+  </sheetData>
+</worksheet>`,
+}
+
+func TestLocalFileDataSource(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "thorin.csv")
+	if err := ioutil.WriteFile(csvFile, []byte("Name,Thorin\nhp,12\nac,\"17\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	xlsxFile := filepath.Join(dir, "thorin.xlsx")
+	writeXlsx(t, xlsxFile, thorinXlsx)
+
+	tests := []struct {
+		name       string
+		file       string
+		attributes []AttributeRow
+		want       map[string]string
+		wantErrors []string
+	}{
+		{
+			name: "csv",
+			file: csvFile,
+			attributes: []AttributeRow{
+				{Name: "name", Range: "B1"},
+				{Name: "hp", Range: "B2"},
+				// a CSV has one tab, whatever a range calls it
+				{Name: "ac", Range: "Stats!B3"},
+			},
+			want: map[string]string{"name": "Thorin", "hp": "12", "ac": "17"},
+		},
+		{
+			name: "xlsx",
+			file: xlsxFile,
+			attributes: []AttributeRow{
+				{Name: "name", Range: "B1"},
+				{Name: "hp", Range: "Stats!B2"},
+				{Name: "double", Range: "B3"},
+				{Name: "alive", Range: "B4"},
+				{Name: "weapon", Range: "Gear!A1"},
+				{Name: "gear", Range: "Gear!A2"},
+				{Name: "named", Range: "HitPoints"},
+			},
+			want: map[string]string{
+				"name": "Thorin", "hp": "12", "double": "24", "alive": "TRUE",
+				"weapon": "Orcrist", "gear": "Rope", "named": "12",
+			},
+		},
+		{
+			name: "bad ranges",
+			file: xlsxFile,
+			attributes: []AttributeRow{
+				{Name: "hp", Range: "B2"},
+				{Name: "local", Range: "Local"},
+				{Name: "lost", Range: "Spells!A1"},
+			},
+			want:       map[string]string{"hp": "12"},
+			wantErrors: []string{"local", "lost"},
+		},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		source := LocalFileDataSource{app: app}
+
+		fetched, err := source.Fetch(context.Background(), ConfigEntry{CharacterKey: "thorin", File: test.file, Attributes: test.attributes})
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		for name, value := range fetched.Values {
+			if value == "" {
+				delete(fetched.Values, name)
+			}
+		}
+		if !reflect.DeepEqual(fetched.Values, test.want) {
+			t.Errorf("%s: values = %v, want %v", test.name, fetched.Values, test.want)
+		}
+		for _, name := range test.wantErrors {
+			if _, found := fetched.Errors[name]; !found {
+				t.Errorf("%s: no error for %s", test.name, name)
+			}
+		}
+		if len(fetched.Errors) != len(test.wantErrors) {
+			t.Errorf("%s: errors = %v, want ones for %v", test.name, fetched.Errors, test.wantErrors)
+		}
+	}
+}
+
+func TestReadWorkbookErrors(t *testing.T) {
+	dir := t.TempDir()
+	notZip := filepath.Join(dir, "thorin.xlsx")
+	ioutil.WriteFile(notZip, []byte("not a workbook"), 0644)
+	noWorkbook := filepath.Join(dir, "empty.xlsx")
+	writeXlsx(t, noWorkbook, map[string]string{"docProps/app.xml": "<Properties/>"})
+	badSheet := filepath.Join(dir, "bad.xlsx")
+	parts := map[string]string{}
+	for name, contents := range thorinXlsx {
+		parts[name] = contents
+	}
+	parts["xl/worksheets/sheet1.xml"] = "<worksheet><sheetData><row>"
+	writeXlsx(t, badSheet, parts)
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"unsupported", filepath.Join(dir, "thorin.ods"), "must be .csv or .xlsx"},
+		{"missing", filepath.Join(dir, "missing.csv"), "no such file"},
+		{"not a zip", notZip, "unable to open"},
+		{"no workbook", noWorkbook, "has no xl/workbook.xml"},
+		{"broken worksheet", badSheet, "invalid xl/worksheets/sheet1.xml"},
+	}
+
+	for _, test := range tests {
+		if _, err := ReadWorkbook(test.file); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestFileVersion(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "thorin.csv")
+	if version := FileVersion(fileName); version != "" {
+		t.Errorf("version of a missing file = %q, want \"\"", version)
+	}
+
+	ioutil.WriteFile(fileName, []byte("hp,12\n"), 0644)
+	modified := time.Date(2021, 10, 1, 19, 0, 0, 0, time.UTC)
+	os.Chtimes(fileName, modified, modified)
+	if version := FileVersion(fileName); version != "2021-10-01T19:00:00Z" {
+		t.Errorf("version = %q, want the modification time", version)
+	}
+}
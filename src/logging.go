@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+// LoggingConfig switches the log from its plain lines to structured slog records. Left
+// out, the log is unchanged.
+type LoggingConfig struct {
+	// text (key=value pairs) or json
+	Format string `json:"format"`
+
+	// debug, info (the default), warn or error
+	Level string `json:"level"`
+}
+
+// nil unless a logging format is configured; requests are only logged with their fields
+// when it's set
+var structuredLogger *slog.Logger
+
+func (config LoggingConfig) Validate() error {
+	if config.Format != "" && config.Format != LogFormatText && config.Format != LogFormatJson {
+		return fmt.Errorf("unknown logging format '%s'; must be text or json", config.Format)
+	}
+	var level slog.Level
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return fmt.Errorf("unknown logging level '%s'; must be debug, info, warn or error", config.Level)
+		}
+	}
+	return nil
+}
+
+// ConfigureLogging sends everything written with the log package through slog, with a
+// level worked out from the line's prefix.
+func ConfigureLogging(config LoggingConfig) {
+	if config.Format == "" {
+		structuredLogger = nil
+		return
+	}
+
+	var level slog.Level
+	level.UnmarshalText([]byte(config.Level))
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if config.Format == LogFormatJson {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+	structuredLogger = slog.New(handler)
+
+	log.SetFlags(0)
+	log.SetOutput(logLineWriter{structuredLogger})
+}
+
+// logLineWriter turns each line from the log package into a slog record.
+type logLineWriter struct {
+	logger *slog.Logger
+}
+
+func (writer logLineWriter) Write(line []byte) (int, error) {
+	level, message := LogLineLevel(strings.TrimRight(string(line), "\n"))
+	writer.logger.Log(context.Background(), level, message)
+	return len(line), nil
+}
+
+// LogLineLevel reads the level of a plain log line from its prefix, and strips the prefix.
+func LogLineLevel(line string) (slog.Level, string) {
+	switch {
+	case strings.HasPrefix(line, "!!! "):
+		return slog.LevelError, strings.TrimPrefix(line, "!!! ")
+	case strings.HasPrefix(line, "WARNING: "):
+		return slog.LevelWarn, strings.TrimPrefix(line, "WARNING: ")
+	case strings.HasPrefix(line, "Unable "):
+		return slog.LevelWarn, line
+	case strings.HasPrefix(line, "*****"):
+		return slog.LevelDebug, strings.TrimSpace(strings.Trim(line, "*"))
+	case strings.HasPrefix(line, "--- "):
+		return slog.LevelDebug, strings.TrimPrefix(line, "--- ")
+	case strings.HasPrefix(line, "-- "):
+		return slog.LevelInfo, strings.TrimPrefix(line, "-- ")
+	case strings.HasPrefix(line, "  * "):
+		return slog.LevelInfo, strings.TrimPrefix(line, "  * ")
+	}
+	return slog.LevelInfo, line
+}
+
+// LogRequest records a finished request with its fields, when structured logging is on.
+func LogRequest(entry RequestLogEntry) {
+	if structuredLogger == nil {
+		return
+	}
+
+	level := slog.LevelInfo
+	if entry.Status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	structuredLogger.LogAttrs(context.Background(), level, "request",
+		slog.String("method", entry.Method),
+		slog.String("path", entry.Path),
+		slog.String("character", entry.CharacterKey),
+		slog.Int("status", entry.Status),
+		slog.Float64("latencyMs", entry.LatencyMs),
+		slog.String("cache", entry.Cache),
+	)
+}
+
+type requestStateKey struct{}
+
+// requestState is filled in while a request is handled, for its log entry.
+type requestState struct {
+	cache string
+}
+
+// SetCacheState notes whether a request's lookup was a hit, stale or a miss.
+func SetCacheState(ctx context.Context, state string) {
+	if requestState, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		requestState.cache = state
+	}
+}
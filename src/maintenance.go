@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+const defaultMaintenanceMessage = "The character sheets are being updated; back shortly."
+
+type MaintenanceConfig struct {
+	// served in place of attributes while maintenance mode is on
+	Message string `json:"message"`
+
+	// respond 200 rather than 503, for overlays that treat any error as broken
+	Serve200 bool `json:"serve200"`
+}
+
+func (config MaintenanceConfig) StatusCode() int {
+	if config.Serve200 {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+func (config MaintenanceConfig) MaintenanceMessage() string {
+	if config.Message != "" {
+		return config.Message
+	}
+	return defaultMaintenanceMessage
+}
+
+func (app *CharacterSheetServiceApp) InMaintenance() bool {
+	return atomic.LoadInt32(&app.maintenance) == 1
+}
+
+func (app *CharacterSheetServiceApp) SetMaintenance(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&app.maintenance, value)
+}
+
+// HandleAdminMaintenance reports maintenance mode on GET, and switches it with
+// POST ?enabled=true|false.
+func (app *CharacterSheetServiceApp) HandleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			// Invalid or missing flag - 400 Bad Request error
+			WriteApiResponseJson(w, ApiResponse{
+				Metadata: NewMetadata(r.URL.Path, http.StatusBadRequest,
+					"Use ?enabled=true or ?enabled=false to switch maintenance mode."),
+			})
+			return
+		}
+		app.SetMaintenance(enabled)
+		if enabled {
+			log.Println("***** maintenance mode on *****")
+		} else {
+			log.Println("***** maintenance mode off *****")
+		}
+	default:
+		// Not GET or POST - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET or POST for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	metadata := NewMetadata(r.URL.Path, http.StatusOK, "")
+	metadata.Maintenance = app.InMaintenance()
+	WriteApiResponseJson(w, ApiResponse{Metadata: metadata})
+}
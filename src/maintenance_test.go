@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+
+	tests := []struct {
+		name            string
+		method          string
+		query           string
+		config          MaintenanceConfig
+		wantAdminStatus int
+		wantStatus      int
+		wantMessage     string
+		wantAttributes  bool
+	}{
+		{"off", http.MethodGet, "", MaintenanceConfig{}, http.StatusOK, http.StatusOK, "", true},
+		{"entering", http.MethodPost, "?enabled=true", MaintenanceConfig{}, http.StatusOK, http.StatusServiceUnavailable, defaultMaintenanceMessage, false},
+		{"custom response", http.MethodGet, "", MaintenanceConfig{Message: "Back after the break", Serve200: true}, http.StatusOK, http.StatusOK, "Back after the break", false},
+		{"bad flag leaves it on", http.MethodPost, "?enabled=maybe", MaintenanceConfig{}, http.StatusBadRequest, http.StatusServiceUnavailable, defaultMaintenanceMessage, false},
+		{"wrong method", http.MethodDelete, "", MaintenanceConfig{}, http.StatusMethodNotAllowed, http.StatusServiceUnavailable, defaultMaintenanceMessage, false},
+		{"leaving", http.MethodPost, "?enabled=false", MaintenanceConfig{}, http.StatusOK, http.StatusOK, "", true},
+	}
+
+	for _, test := range tests {
+		app.Config.Maintenance = test.config
+		w := adminRequest(app.HandleAdminMaintenance, test.method, "/admin/maintenance"+test.query, "")
+		var adminResponse ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &adminResponse); err != nil {
+			t.Fatalf("%s: admin response isn't JSON: %v", test.name, err)
+		}
+		if adminResponse.Metadata.StatusCode != test.wantAdminStatus {
+			t.Errorf("%s: admin status = %d, want %d", test.name, adminResponse.Metadata.StatusCode, test.wantAdminStatus)
+		}
+		wantMaintenance := test.wantMessage != ""
+		if test.wantAdminStatus == http.StatusOK && adminResponse.Metadata.Maintenance != wantMaintenance {
+			t.Errorf("%s: admin reports maintenance %v, want %v", test.name, adminResponse.Metadata.Maintenance, wantMaintenance)
+		}
+
+		response := getResponse(t, app, "/thorin")
+		if response.Metadata.StatusCode != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, response.Metadata.StatusCode, test.wantStatus)
+		}
+		if response.Metadata.Maintenance != wantMaintenance || response.Metadata.ErrorMessage != test.wantMessage {
+			t.Errorf("%s: maintenance, message = %v, %q, want %v, %q",
+				test.name, response.Metadata.Maintenance, response.Metadata.ErrorMessage, wantMaintenance, test.wantMessage)
+		}
+		if (response.Attributes != nil) != test.wantAttributes {
+			t.Errorf("%s: attributes = %v, want attributes %v", test.name, response.Attributes, test.wantAttributes)
+		}
+	}
+}
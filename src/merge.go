@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// MergedDataSource reads a character with more than one source, e.g. its build from a Google
+// Sheet and its live hit points from Foundry. Each source reads the attributes that name it,
+// and when several sources have an attribute of the same name, the value comes from the
+// first of them in the character's sources that has one; a source that fails, or has nothing
+// for it, gives way to the next. Sources are read one after another.
+type MergedDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+func (source MergedDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	merged := NewFetchedAttributes()
+	var firstErr error
+	succeeded := 0
+
+	for _, name := range charConfig.SourceOrder() {
+		sourceConfig := charConfig.ForSource(name)
+		if len(sourceConfig.Attributes) == 0 {
+			continue
+		}
+
+		fetched, err := source.app.SourceFor(sourceConfig).Fetch(ctx, sourceConfig)
+		if err != nil {
+			log.Printf("Unable to read %s for '%s': %v", sourceDescriptions[name], charConfig.CharacterKey, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			fetched = NewFetchedAttributes()
+			for _, attrName := range sourceConfig.AttributeNames() {
+				fetched.Errors[attrName] = err.Error()
+			}
+		} else {
+			succeeded++
+		}
+
+		for attrName, value := range fetched.Values {
+			if _, found := merged.Values[attrName]; !found {
+				merged.Values[attrName] = value
+				delete(merged.Errors, attrName)
+			}
+		}
+		for attrName, message := range fetched.Errors {
+			_, found := merged.Values[attrName]
+			_, failed := merged.Errors[attrName]
+			if !found && !failed {
+				merged.Errors[attrName] = message
+			}
+		}
+		for cellRange, names := range fetched.HeaderNames {
+			merged.HeaderNames[cellRange] = names
+		}
+		merged.Truncated = merged.Truncated || fetched.Truncated
+	}
+
+	// when every source failed, the whole fetch did
+	if succeeded == 0 && firstErr != nil {
+		return FetchedAttributes{}, firstErr
+	}
+	return merged, nil
+}
+
+// ForSource is the character as read from just one of its sources, with only the attributes
+// read from it.
+func (configEntry ConfigEntry) ForSource(source string) ConfigEntry {
+	sourceConfig := ConfigEntry{
+		CharacterKey: configEntry.CharacterKey,
+		Attributes:   []AttributeRow{},
+		Sources:      []string{source},
+	}
+	switch source {
+	case SourceSheet:
+		sourceConfig.SheetId = configEntry.SheetId
+		sourceConfig.SheetGids = configEntry.SheetGids
+	case SourceFile:
+		sourceConfig.File = configEntry.File
+	case SourceAirtable:
+		sourceConfig.Airtable = configEntry.Airtable
+	case SourceNotion:
+		sourceConfig.Notion = configEntry.Notion
+	case SourceDndBeyond:
+		sourceConfig.DndBeyond = configEntry.DndBeyond
+	case SourceFoundry:
+		sourceConfig.Foundry = configEntry.Foundry
+	case SourcePathbuilder:
+		sourceConfig.Pathbuilder = configEntry.Pathbuilder
+	case SourceRest:
+		sourceConfig.Rest = configEntry.Rest
+	}
+
+	for _, attr := range configEntry.Attributes {
+		if configEntry.AttributeSource(attr) == source {
+			sourceConfig.Attributes = append(sourceConfig.Attributes, attr)
+		}
+	}
+	return sourceConfig
+}
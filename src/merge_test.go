@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergedDataSource(t *testing.T) {
+	newFakeNotion(t)
+	csvFile := filepath.Join(t.TempDir(), "balin.csv")
+	if err := ioutil.WriteFile(csvFile, []byte("Name,Balin\nhp,15\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// hp is in all three sources, with a different value in each
+	attributes := []AttributeRow{
+		{Name: "hp", Range: "B2", Source: SourceSheet},
+		{Name: "hp", Range: "B2", Source: SourceFile},
+		{Name: "hp", Range: "HP", Source: SourceNotion},
+		{Name: "class", Range: "Class", Source: SourceNotion},
+		{Name: "ac", Range: "B3", Source: SourceSheet},
+	}
+
+	tests := []struct {
+		name        string
+		sources     []string
+		notionToken string
+		sheetStatus int
+		want        map[string]string
+		wantErrors  []string
+		wantErr     bool
+	}{
+		{
+			name:        "sheet first",
+			sources:     []string{SourceSheet, SourceFile, SourceNotion},
+			notionToken: "secret_notion",
+			want:        map[string]string{"hp": "12", "class": "Fighter", "ac": "16"},
+		},
+		{
+			name:        "file first",
+			sources:     []string{SourceFile, SourceSheet, SourceNotion},
+			notionToken: "secret_notion",
+			want:        map[string]string{"hp": "15", "class": "Fighter", "ac": "16"},
+		},
+		{
+			name:        "notion first",
+			sources:     []string{SourceNotion, SourceFile, SourceSheet},
+			notionToken: "secret_notion",
+			want:        map[string]string{"hp": "9", "class": "Fighter", "ac": "16"},
+		},
+		{
+			// the failed source gives way for hp, and its other attributes are errors
+			name:        "first source fails",
+			sources:     []string{SourceNotion, SourceFile, SourceSheet},
+			notionToken: "wrong",
+			want:        map[string]string{"hp": "15", "ac": "16"},
+			wantErrors:  []string{"class"},
+		},
+		{
+			name:        "sheet fails",
+			sources:     []string{SourceSheet, SourceNotion, SourceFile},
+			notionToken: "secret_notion",
+			sheetStatus: 503,
+			want:        map[string]string{"hp": "9", "class": "Fighter"},
+			wantErrors:  []string{"ac"},
+		},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"16"}}})
+		if test.sheetStatus != 0 {
+			fake.Fail(test.sheetStatus)
+		}
+		charConfig := ConfigEntry{
+			CharacterKey: "balin",
+			SheetId:      "sheet",
+			File:         csvFile,
+			Notion:       &NotionConfig{PageId: notionPageId},
+			Sources:      test.sources,
+			Attributes:   attributes,
+		}
+		app := newTestApp(t, fake, charConfig)
+		app.Config.NotionToken = test.notionToken
+
+		source := app.SourceFor(charConfig)
+		if _, merged := source.(MergedDataSource); !merged {
+			t.Fatalf("%s: source = %T, want MergedDataSource", test.name, source)
+		}
+		fetched, err := source.Fetch(context.Background(), charConfig)
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(fetched.Values, test.want) {
+			t.Errorf("%s: values = %v, want %v", test.name, fetched.Values, test.want)
+		}
+		if len(fetched.Errors) != len(test.wantErrors) {
+			t.Errorf("%s: errors = %v, want ones for %v", test.name, fetched.Errors, test.wantErrors)
+		}
+		for _, name := range test.wantErrors {
+			if _, found := fetched.Errors[name]; !found {
+				t.Errorf("%s: no error for %s", test.name, name)
+			}
+		}
+	}
+}
+
+func TestMergedDataSourceAllFail(t *testing.T) {
+	newFakeNotion(t)
+	fake := newFakeSheets(t, nil)
+	fake.Fail(503)
+	charConfig := ConfigEntry{
+		CharacterKey: "balin",
+		SheetId:      "sheet",
+		Notion:       &NotionConfig{PageId: notionPageId},
+		Attributes: []AttributeRow{
+			{Name: "hp", Range: "B2"},
+			{Name: "class", Range: "Class", Source: SourceNotion},
+		},
+	}
+	app := newTestApp(t, fake, charConfig)
+	app.Config.NotionToken = "wrong"
+
+	// when every source fails, so does the character, with the first source's error
+	_, err := app.SourceFor(charConfig).Fetch(context.Background(), charConfig)
+	if err == nil || IsAuthError(err) {
+		t.Errorf("error = %v, want the sheet's", err)
+	}
+}
+
+func TestSourceOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ConfigEntry
+		want   []string
+	}{
+		{"a sheet", ConfigEntry{SheetId: "sheet"}, []string{SourceSheet}},
+		{"nothing", ConfigEntry{}, []string{SourceSheet}},
+		{"configured", ConfigEntry{SheetId: "sheet", Foundry: &FoundryConfig{ActorId: "a"}}, []string{SourceSheet, SourceFoundry}},
+		{"in the given order", ConfigEntry{SheetId: "sheet", Foundry: &FoundryConfig{ActorId: "a"}, Sources: []string{SourceFoundry, SourceSheet}}, []string{SourceFoundry, SourceSheet}},
+	}
+
+	for _, test := range tests {
+		if got := test.config.SourceOrder(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: SourceOrder() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics are served in the Prometheus text format, written out by hand rather than
+// pulling in the client library for a handful of counters.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+func (app *CharacterSheetServiceApp) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		// Not GET - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", metricsContentType)
+	app.Stats.WriteMetrics(w, app.PrimingOrder())
+}
+
+// WriteMetrics reports the counters of every configured character, plus the requests that
+// weren't for a character under character="".
+func (stats *ServiceStats) WriteMetrics(w io.Writer, charKeys []string) {
+	metric := func(name string, metricType string, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	}
+	seconds := func(nanos int64) string {
+		return strconv.FormatFloat(time.Duration(nanos).Seconds(), 'f', -1, 64)
+	}
+
+	metric("sheetservice_uptime_seconds", "gauge", "Seconds since the service started.")
+	fmt.Fprintf(w, "sheetservice_uptime_seconds %d\n", int64(time.Since(stats.started).Seconds()))
+
+	metric("sheetservice_sheets_calls_total", "counter", "Calls made to the Google Sheets API, by result.")
+	calls := atomic.LoadInt64(&stats.sheetsCalls)
+	errors := atomic.LoadInt64(&stats.sheetsErrors)
+	fmt.Fprintf(w, "sheetservice_sheets_calls_total{result=\"ok\"} %d\n", calls-errors)
+	fmt.Fprintf(w, "sheetservice_sheets_calls_total{result=\"error\"} %d\n", errors)
+
+	metric("sheetservice_sheets_call_duration_seconds", "summary", "Time spent waiting on the Google Sheets API.")
+	fmt.Fprintf(w, "sheetservice_sheets_call_duration_seconds_sum %s\n", seconds(atomic.LoadInt64(&stats.sheetsNanos)))
+	fmt.Fprintf(w, "sheetservice_sheets_call_duration_seconds_count %d\n", calls)
+
+	metric("sheetservice_sheets_retries_total", "counter", "Google Sheets API calls retried after a rate limit or server error.")
+	fmt.Fprintf(w, "sheetservice_sheets_retries_total %d\n", atomic.LoadInt64(&stats.sheetsRetries))
+
+	metric("sheetservice_sheets_retries_exhausted_total", "counter", "Google Sheets API calls that still failed after the last retry.")
+	fmt.Fprintf(w, "sheetservice_sheets_retries_exhausted_total %d\n", atomic.LoadInt64(&stats.sheetsRetriesExhausted))
+
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	if stats.lastSheetsError != "" {
+		metric("sheetservice_sheets_last_error_timestamp_seconds", "gauge", "When a Google Sheets API call last failed.")
+		fmt.Fprintf(w, "sheetservice_sheets_last_error_timestamp_seconds %d\n", stats.lastSheetsErrorAt.Unix())
+	}
+
+	metric("sheetservice_cache_lookups_total", "counter", "Character lookups, by whether the cache had fresh, stale or no attributes.")
+	for _, charKey := range charKeys {
+		fmt.Fprintf(w, "sheetservice_cache_lookups_total{character=%q,result=\"hit\"} %d\n", charKey, stats.hits[charKey]-stats.stale[charKey])
+		fmt.Fprintf(w, "sheetservice_cache_lookups_total{character=%q,result=\"stale\"} %d\n", charKey, stats.stale[charKey])
+		fmt.Fprintf(w, "sheetservice_cache_lookups_total{character=%q,result=\"miss\"} %d\n", charKey, stats.misses[charKey])
+	}
+
+	metric("sheetservice_fetch_errors_total", "counter", "Failed refreshes of a character, by kind of failure.")
+	for _, charKey := range charKeys {
+		for _, kind := range []string{FetchErrorAuth, FetchErrorTransient} {
+			fmt.Fprintf(w, "sheetservice_fetch_errors_total{character=%q,kind=%q} %d\n",
+				charKey, kind, stats.fetchErrors[fetchErrorKey{charKey, kind}])
+		}
+	}
+
+	metric("sheetservice_last_refresh_timestamp_seconds", "gauge", "When each character's attributes were last written to the cache.")
+	for _, charKey := range charKeys {
+		if lastRefresh, found := stats.lastRefresh[charKey]; found {
+			fmt.Fprintf(w, "sheetservice_last_refresh_timestamp_seconds{character=%q} %d\n", charKey, lastRefresh.Unix())
+		}
+	}
+
+	responseKeys := make([]responseKey, 0, len(stats.responses))
+	for key := range stats.responses {
+		responseKeys = append(responseKeys, key)
+	}
+	sort.Slice(responseKeys, func(i, j int) bool {
+		if responseKeys[i].charKey != responseKeys[j].charKey {
+			return responseKeys[i].charKey < responseKeys[j].charKey
+		}
+		return responseKeys[i].status < responseKeys[j].status
+	})
+	metric("sheetservice_requests_total", "counter", "HTTP responses, by character and status code.")
+	for _, key := range responseKeys {
+		fmt.Fprintf(w, "sheetservice_requests_total{character=%q,code=\"%d\"} %d\n", key.charKey, key.status, stats.responses[key])
+	}
+
+	requestKeys := make([]string, 0, len(stats.requestCount))
+	for charKey := range stats.requestCount {
+		requestKeys = append(requestKeys, charKey)
+	}
+	sort.Strings(requestKeys)
+	metric("sheetservice_request_duration_seconds", "summary", "Time spent handling HTTP requests, by character.")
+	for _, charKey := range requestKeys {
+		fmt.Fprintf(w, "sheetservice_request_duration_seconds_sum{character=%q} %s\n", charKey, seconds(stats.requestNanos[charKey]))
+		fmt.Fprintf(w, "sheetservice_request_duration_seconds_count{character=%q} %d\n", charKey, stats.requestCount[charKey])
+	}
+}
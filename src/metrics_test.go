@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	stats := NewServiceStats()
+	started := time.Now()
+	stats.RecordSheetsCall(started, nil)
+	stats.RecordSheetsCall(started, nil)
+	stats.RecordSheetsCall(started, errors.New("rate limited"))
+	stats.CountSheetsRetry()
+	stats.CountSheetsRetriesExhausted()
+	// a stale lookup is counted as a hit, then as stale
+	stats.CountLookup("thorin", true)
+	stats.CountLookup("thorin", true)
+	stats.CountStale("thorin")
+	stats.CountLookup("gimli", false)
+	stats.CountFetchError("gimli", FetchErrorTransient)
+	stats.RecordRefresh("thorin", time.Unix(1633114800, 0))
+	stats.RecordResponse("thorin", http.StatusOK, 1500*time.Millisecond)
+	stats.RecordResponse("thorin", http.StatusOK, 500*time.Millisecond)
+	stats.RecordResponse("thorin", http.StatusNotModified, 0)
+	stats.RecordResponse("", http.StatusNotFound, 0)
+
+	var metrics bytes.Buffer
+	stats.WriteMetrics(&metrics, []string{"thorin", "gimli"})
+	lines := strings.Split(metrics.String(), "\n")
+
+	for _, want := range []string{
+		"# TYPE sheetservice_sheets_calls_total counter",
+		`sheetservice_sheets_calls_total{result="ok"} 2`,
+		`sheetservice_sheets_calls_total{result="error"} 1`,
+		"sheetservice_sheets_call_duration_seconds_count 3",
+		"sheetservice_sheets_retries_total 1",
+		"sheetservice_sheets_retries_exhausted_total 1",
+		`sheetservice_cache_lookups_total{character="thorin",result="hit"} 1`,
+		`sheetservice_cache_lookups_total{character="thorin",result="stale"} 1`,
+		`sheetservice_cache_lookups_total{character="thorin",result="miss"} 0`,
+		`sheetservice_cache_lookups_total{character="gimli",result="miss"} 1`,
+		`sheetservice_fetch_errors_total{character="gimli",kind="transient"} 1`,
+		`sheetservice_fetch_errors_total{character="gimli",kind="auth"} 0`,
+		`sheetservice_last_refresh_timestamp_seconds{character="thorin"} 1633114800`,
+		`sheetservice_requests_total{character="",code="404"} 1`,
+		`sheetservice_requests_total{character="thorin",code="200"} 2`,
+		`sheetservice_requests_total{character="thorin",code="304"} 1`,
+		`sheetservice_request_duration_seconds_sum{character="thorin"} 2`,
+		`sheetservice_request_duration_seconds_count{character="thorin"} 3`,
+	} {
+		if !containsLine(lines, want) {
+			t.Errorf("no %q in\n%s", want, metrics.String())
+		}
+	}
+
+	// characters that were never refreshed have no refresh time to report
+	if strings.Contains(metrics.String(), `sheetservice_last_refresh_timestamp_seconds{character="gimli"}`) {
+		t.Errorf("reported a refresh time for gimli")
+	}
+	if !strings.Contains(metrics.String(), "sheetservice_sheets_last_error_timestamp_seconds ") {
+		t.Errorf("no last error time after a failed call")
+	}
+}
+
+func TestWriteMetricsWithoutErrors(t *testing.T) {
+	var metrics bytes.Buffer
+	NewServiceStats().WriteMetrics(&metrics, nil)
+	if strings.Contains(metrics.String(), "sheetservice_sheets_last_error_timestamp_seconds") {
+		t.Errorf("reported a last error time before any call failed")
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	app := newTestApp(t, newFakeSheets(t, nil))
+
+	w := httptest.NewRecorder()
+	app.HandleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != metricsContentType {
+		t.Errorf("status, Content-Type = %d, %q, want 200, %q", w.Code, w.Header().Get("Content-Type"), metricsContentType)
+	}
+
+	w = httptest.NewRecorder()
+	app.HandleMetrics(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, want 405", w.Code)
+	}
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack passes through to the underlying writer so websocket upgrades still work
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Flush passes through to the underlying writer so event streams aren't buffered
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				// http.ErrAbortHandler is net/http's sanctioned way of aborting a response
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				log.Printf("!!! panic serving %s: %v\n%s", r.URL.Path, err, debug.Stack())
+
+				// Unexpected failure - 500 Internal Server Error
+				WriteApiResponseJson(w, ApiResponse{
+					Metadata: NewMetadata(r.URL.Path, http.StatusInternalServerError,
+						fmt.Sprintf("Internal error while handling '%s'; see the service log for details.", r.URL.Path)),
+				})
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog collects what's logged for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buffer
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	tests := []struct {
+		name  string
+		panic interface{}
+	}{
+		{"string", "boom"},
+		{"error", errors.New("boom")},
+		{"nil map", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logged := captureLog(t)
+			handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.panic == nil {
+					var attributes map[string]string
+					attributes["hp"] = "12"
+				}
+				panic(test.panic)
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/thorin", nil))
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want 500", w.Code)
+			}
+			var response ApiResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("response isn't JSON: %v", err)
+			}
+			if response.Metadata.StatusCode != http.StatusInternalServerError {
+				t.Errorf("metadata status = %d, want 500", response.Metadata.StatusCode)
+			}
+			if !strings.Contains(logged.String(), "panic serving /thorin") {
+				t.Errorf("panic not logged: %q", logged.String())
+			}
+			if !strings.Contains(logged.String(), "goroutine ") {
+				t.Errorf("stack not logged: %q", logged.String())
+			}
+		})
+	}
+}
+
+func TestRecoverMiddlewarePassesAbort(t *testing.T) {
+	captureLog(t)
+	handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/thorin", nil))
+}
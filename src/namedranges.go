@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// SheetLayout is where a spreadsheet's metadata says things are: the A1 range each named
+// range covers right now (or just its name, if it's open-ended), and the gid of each tab.
+type SheetLayout struct {
+	NamedRanges map[string]string
+	Gids        map[string]int64
+}
+
+// HasNamedRanges tells whether any of the character's ranges aren't A1 references, and so
+// are taken to be named ranges.
+func (configEntry ConfigEntry) HasNamedRanges() bool {
+	for _, attr := range configEntry.Attributes {
+		if _, ok := ParseA1Range(attr.Range); !ok && attr.Value == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchSheetLayout reads the spreadsheet's named ranges and tabs. The last layout read for
+// each sheet is kept, for when the Sheets API can't be reached; see LastSheetLayout.
+func (app *CharacterSheetServiceApp) FetchSheetLayout(ctx context.Context, sheetId string) (*SheetLayout, error) {
+	sheetService := app.SheetService()
+	if sheetService == nil {
+		return nil, errNoCredentials
+	}
+
+	call := sheetService.Spreadsheets.Get(sheetId).
+		Fields("namedRanges(name,range),sheets(properties(sheetId,title))")
+	var spreadsheet *sheets.Spreadsheet
+	err := app.CallSheetsApi(ctx, fmt.Sprintf("reading named ranges of sheet %s", sheetId), func() error {
+		var err error
+		spreadsheet, err = call.Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &SheetLayout{NamedRanges: map[string]string{}, Gids: map[string]int64{}}
+	titles := map[int64]string{}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties != nil {
+			layout.Gids[sheet.Properties.Title] = sheet.Properties.SheetId
+			titles[sheet.Properties.SheetId] = sheet.Properties.Title
+		}
+	}
+	for _, namedRange := range spreadsheet.NamedRanges {
+		if namedRange.Range == nil {
+			continue
+		}
+		if a1Range, ok := GridRangeA1(namedRange.Range, titles[namedRange.Range.SheetId]); ok {
+			layout.NamedRanges[namedRange.Name] = a1Range
+		} else {
+			layout.NamedRanges[namedRange.Name] = namedRange.Name
+		}
+	}
+
+	app.sheetLayoutsLock.Lock()
+	if app.sheetLayouts == nil {
+		app.sheetLayouts = map[string]*SheetLayout{}
+	}
+	app.sheetLayouts[sheetId] = layout
+	app.sheetLayoutsLock.Unlock()
+
+	return layout, nil
+}
+
+func (app *CharacterSheetServiceApp) LastSheetLayout(sheetId string) *SheetLayout {
+	app.sheetLayoutsLock.Lock()
+	defer app.sheetLayoutsLock.Unlock()
+	return app.sheetLayouts[sheetId]
+}
+
+// GridRangeA1 writes a grid range from the API in A1 notation. Ranges that are open-ended,
+// such as whole columns, can't be, and are left for the Sheets API to resolve by name.
+func GridRangeA1(gridRange *sheets.GridRange, title string) (string, bool) {
+	// end indexes are exclusive, so 0 means there's no end
+	if gridRange.EndRowIndex == 0 || gridRange.EndColumnIndex == 0 || title == "" {
+		return "", false
+	}
+	return fmt.Sprintf("'%s'!%s%d:%s%d", strings.ReplaceAll(title, "'", "''"),
+		a1ColumnLetters(int(gridRange.StartColumnIndex)+1), gridRange.StartRowIndex+1,
+		a1ColumnLetters(int(gridRange.EndColumnIndex)), gridRange.EndRowIndex), true
+}
+
+// ResolveRanges returns a copy of the character's config with its named ranges swapped for
+// the A1 ranges they cover, so they're sized and read like any other range, and with the
+// layout's tab gids for the CSV fallback. Named ranges the sheet doesn't have are left with
+// no range, and an error each, rather than failing the whole BatchGet.
+func (layout *SheetLayout) ResolveRanges(charConfig ConfigEntry) (ConfigEntry, map[string]string) {
+	errors := map[string]string{}
+	resolved := charConfig
+	resolved.Attributes = make([]AttributeRow, len(charConfig.Attributes))
+	for i, attr := range charConfig.Attributes {
+		if _, ok := ParseA1Range(attr.Range); !ok && attr.Value == nil {
+			if a1Range, found := layout.NamedRanges[attr.Range]; found {
+				attr.Range = a1Range
+			} else {
+				log.Printf("WARNING: sheet for '%s' has no named range '%s'", charConfig.CharacterKey, attr.Range)
+				for _, name := range attr.AttributeNames() {
+					errors[name] = fmt.Sprintf("no named range '%s' in the sheet", attr.Range)
+				}
+				attr.Range = ""
+			}
+		}
+		resolved.Attributes[i] = attr
+	}
+
+	resolved.SheetGids = map[string]int64{}
+	for title, gid := range layout.Gids {
+		resolved.SheetGids[title] = gid
+	}
+	for title, gid := range charConfig.SheetGids {
+		resolved.SheetGids[title] = gid
+	}
+	return resolved, errors
+}
+
+func a1ColumnLetters(column int) string {
+	letters := ""
+	for column > 0 {
+		column--
+		letters = string(rune('A'+column%26)) + letters
+		column /= 26
+	}
+	return letters
+}
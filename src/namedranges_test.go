@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+func TestGridRangeA1(t *testing.T) {
+	tests := []struct {
+		gridRange sheets.GridRange
+		title     string
+		want      string
+		wantOk    bool
+	}{
+		{sheets.GridRange{StartRowIndex: 1, EndRowIndex: 2, StartColumnIndex: 1, EndColumnIndex: 2}, "Stats", "'Stats'!B2:B2", true},
+		{sheets.GridRange{StartRowIndex: 0, EndRowIndex: 10, StartColumnIndex: 25, EndColumnIndex: 28}, "Inventory", "'Inventory'!Z1:AB10", true},
+		{sheets.GridRange{EndRowIndex: 1, EndColumnIndex: 1}, "Dwarf's Sheet", "'Dwarf''s Sheet'!A1:A1", true},
+		// whole columns and rows have no end to write
+		{sheets.GridRange{StartColumnIndex: 1, EndColumnIndex: 2}, "Stats", "", false},
+		{sheets.GridRange{StartRowIndex: 1, EndRowIndex: 2}, "Stats", "", false},
+		{sheets.GridRange{EndRowIndex: 1, EndColumnIndex: 1}, "", "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := GridRangeA1(&test.gridRange, test.title)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("GridRangeA1(%+v, %q) = %q, %v, want %q, %v", test.gridRange, test.title, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestResolveRanges(t *testing.T) {
+	layout := &SheetLayout{
+		NamedRanges: map[string]string{"HitPoints": "'Stats'!B2:B2", "Spells": "Spells"},
+		Gids:        map[string]int64{"Stats": 0, "Spells": 123},
+	}
+	charConfig := ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", SheetGids: map[string]int64{"Spells": 456},
+		Attributes: []AttributeRow{
+			{Name: "hp", Range: "HitPoints"},
+			{Name: "ac", Range: "B3"},
+			{Name: "spells", Range: "Spells", Type: AttributeTypeList},
+			{Name: "gold", Range: "Gold"},
+			{Name: "race", Value: stringPointer("Dwarf")},
+		}}
+
+	resolved, errors := layout.ResolveRanges(charConfig)
+	ranges := []string{}
+	for _, attr := range resolved.Attributes {
+		ranges = append(ranges, attr.Range)
+	}
+	if want := []string{"'Stats'!B2:B2", "B3", "Spells", "", ""}; !reflect.DeepEqual(ranges, want) {
+		t.Errorf("ranges = %q, want %q", ranges, want)
+	}
+	if want := map[string]string{"gold": "no named range 'Gold' in the sheet"}; !reflect.DeepEqual(errors, want) {
+		t.Errorf("errors = %v, want %v", errors, want)
+	}
+	// gids set in the config win over the sheet's
+	if want := map[string]int64{"Stats": 0, "Spells": 456}; !reflect.DeepEqual(resolved.SheetGids, want) {
+		t.Errorf("gids = %v, want %v", resolved.SheetGids, want)
+	}
+	if charConfig.Attributes[0].Range != "HitPoints" {
+		t.Errorf("the config itself was changed")
+	}
+}
+
+func TestNamedRanges(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{
+		"'Stats'!B2:B2": {{"12"}},
+		"'Stats'!B3:B3": {{"30"}},
+		"B4":            {{"16"}},
+		"HitPoints":     {{"9"}},
+	})
+	fake.layout = &sheets.Spreadsheet{
+		Sheets: []*sheets.Sheet{{Properties: &sheets.SheetProperties{SheetId: 0, Title: "Stats"}}},
+		NamedRanges: []*sheets.NamedRange{
+			{Name: "HitPoints", Range: &sheets.GridRange{SheetId: 0, StartRowIndex: 1, EndRowIndex: 2, StartColumnIndex: 1, EndColumnIndex: 2}},
+		},
+	}
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Name: "hp", Range: "HitPoints"},
+		{Name: "str", Range: "B4"},
+		{Name: "gold", Range: "Gold"},
+	}})
+
+	app.PrimeCharacter("thorin")
+	response := getResponse(t, app, "/thorin")
+	if got, want := attributeMap(response), map[string]string{"hp": "12", "str": "16"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("attributes = %v, want %v", got, want)
+	}
+	if _, found := response.Metadata.AttributeErrors["gold"]; !found {
+		t.Errorf("no attribute error for the missing named range")
+	}
+
+	// a row was inserted above it
+	fake.lock.Lock()
+	fake.layout.NamedRanges[0].Range.StartRowIndex, fake.layout.NamedRanges[0].Range.EndRowIndex = 2, 3
+	fake.lock.Unlock()
+	app.PrimeCharacter("thorin")
+	if got := attributeMap(getResponse(t, app, "/thorin"))["hp"]; got != "30" {
+		t.Errorf("hp after the range moved = %q, want 30", got)
+	}
+
+	// where the named range last was is used when the metadata can't be read
+	fake.lock.Lock()
+	fake.layout = nil
+	fake.lock.Unlock()
+	app.PrimeCharacter("thorin")
+	if got := attributeMap(getResponse(t, app, "/thorin"))["hp"]; got != "30" {
+		t.Errorf("hp without metadata = %q, want 30", got)
+	}
+
+	// and it's read by name if it never could be
+	other := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "HitPoints"}}})
+	other.PrimeCharacter("thorin")
+	if got := attributeMap(getResponse(t, other, "/thorin"))["hp"]; got != "9" {
+		t.Errorf("hp read by name = %q, want 9", got)
+	}
+}
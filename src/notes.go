@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	ReadValue = "value"
+	ReadNote  = "note"
+	ReadBoth  = "both"
+)
+
+// FetchCellNote reads the note on the first cell of a range. Values.BatchGet doesn't return
+// notes, so this needs a spreadsheet Get with grid data, trimmed down to just the note.
+func (app *CharacterSheetServiceApp) FetchCellNote(ctx context.Context, sheetId string, cellRange string) (string, error) {
+	sheetService := app.SheetService()
+	if sheetService == nil {
+		return "", errNoCredentials
+	}
+
+	call := sheetService.Spreadsheets.Get(sheetId).
+		Ranges(cellRange).
+		IncludeGridData(true).
+		Fields("sheets/data/rowData/values/note")
+	var spreadsheet *sheets.Spreadsheet
+	err := app.CallSheetsApi(ctx, fmt.Sprintf("reading note for range '%s'", cellRange), func() error {
+		var err error
+		spreadsheet, err = call.Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to read note for range '%s': %v", cellRange, err)
+	}
+
+	for _, sheet := range spreadsheet.Sheets {
+		for _, data := range sheet.Data {
+			if len(data.RowData) > 0 && len(data.RowData[0].Values) > 0 {
+				return data.RowData[0].Values[0].Note, nil
+			}
+		}
+	}
+	return "", nil
+}
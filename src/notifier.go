@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+)
+
+// AttributeChangeNotifier lets request handlers wait for a character's attributes to change.
+type AttributeChangeNotifier struct {
+	subscribers map[string]map[chan struct{}]bool
+	lock        sync.Mutex
+}
+
+func NewAttributeChangeNotifier() *AttributeChangeNotifier {
+	return &AttributeChangeNotifier{
+		subscribers: make(map[string]map[chan struct{}]bool),
+	}
+}
+
+func (notifier *AttributeChangeNotifier) Subscribe(charKey string) chan struct{} {
+	// buffered so Notify never blocks on a subscriber that isn't currently listening
+	changed := make(chan struct{}, 1)
+
+	notifier.lock.Lock()
+	if notifier.subscribers[charKey] == nil {
+		notifier.subscribers[charKey] = make(map[chan struct{}]bool)
+	}
+	notifier.subscribers[charKey][changed] = true
+	notifier.lock.Unlock()
+
+	return changed
+}
+
+func (notifier *AttributeChangeNotifier) Unsubscribe(charKey string, changed chan struct{}) {
+	notifier.lock.Lock()
+	delete(notifier.subscribers[charKey], changed)
+	if len(notifier.subscribers[charKey]) == 0 {
+		delete(notifier.subscribers, charKey)
+	}
+	notifier.lock.Unlock()
+}
+
+func (notifier *AttributeChangeNotifier) Notify(charKey string) {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	for changed := range notifier.subscribers[charKey] {
+		select {
+		case changed <- struct{}{}:
+		default:
+			// already has a pending notification
+		}
+	}
+}
+
+func AttributesEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if otherValue, found := b[name]; !found || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func (notifier *AttributeChangeNotifier) subscriberCount(charKey string) int {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+	return len(notifier.subscribers[charKey])
+}
+
+func TestLongPollReleasedByUpdate(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/thorin?wait=30", nil))
+		done <- w
+	}()
+	waitFor(t, func() bool { return app.Notifier.subscriberCount("thorin") == 1 })
+
+	// an update that changes nothing doesn't release the request
+	app.UpdateCachedEntry("thorin", NewCachedEntry(&map[string]string{"hp": "12"}, defaultCacheTtl))
+	select {
+	case <-done:
+		t.Fatalf("long-poll released by an unchanged update")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	app.UpdateCachedEntry("thorin", NewCachedEntry(&map[string]string{"hp": "7"}, defaultCacheTtl))
+	select {
+	case w := <-done:
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("response isn't JSON: %v", err)
+		}
+		if hp := attributeMap(response)["hp"]; hp != "7" {
+			t.Errorf("hp = %q, want the updated 7", hp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("long-poll not released by the update")
+	}
+
+	if count := app.Notifier.subscriberCount("thorin"); count != 0 {
+		t.Errorf("%d subscribers left after the request", count)
+	}
+}
+
+func TestLongPollWaitParameter(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+
+	tests := []struct {
+		wait       string
+		wantStatus int
+	}{
+		{"0", http.StatusOK},
+		{"1", http.StatusOK},
+		{"-1", http.StatusBadRequest},
+		{"121", http.StatusBadRequest},
+		{"soon", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/thorin?wait="+test.wait, nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("wait=%s: status = %d, want %d", test.wait, w.Code, test.wantStatus)
+		}
+	}
+}
+
+func TestAttributesEqual(t *testing.T) {
+	tests := []struct {
+		a, b map[string]string
+		want bool
+	}{
+		{map[string]string{}, map[string]string{}, true},
+		{map[string]string{"hp": "12"}, map[string]string{"hp": "12"}, true},
+		{map[string]string{"hp": "12"}, map[string]string{"hp": "7"}, false},
+		{map[string]string{"hp": "12"}, map[string]string{"ac": "12"}, false},
+		{map[string]string{"hp": "12"}, map[string]string{"hp": "12", "ac": "16"}, false},
+	}
+
+	for _, test := range tests {
+		if got := AttributesEqual(test.a, test.b); got != test.want {
+			t.Errorf("AttributesEqual(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// environment variable holding the Notion integration token, which overrides notionToken
+const notionTokenEnv = "NOTION_TOKEN"
+
+var notionApiUrl = "https://api.notion.com/v1"
+
+// the API version the property values below are read from
+const notionApiVersion = "2022-06-28"
+
+var notionClient = &http.Client{Timeout: 10 * time.Second}
+
+// NotionConfig points a character at a page in a Notion database. Each attribute's range is
+// the name of the page property it's read from. The page has to be shared with the
+// integration whose token is configured.
+type NotionConfig struct {
+	// the page's ID, or its URL as copied from the browser
+	PageId string `json:"pageId"`
+}
+
+var notionPageIdPattern = regexp.MustCompile(`([0-9a-fA-F]{32})$`)
+
+// ParseNotionPageId accepts a bare page ID, with or without dashes, or the page's URL, which
+// ends in the ID after the page's title.
+func ParseNotionPageId(pageId string) (string, error) {
+	trimmed := pageId
+	if i := strings.IndexAny(trimmed, "?#"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+	trimmed = strings.ReplaceAll(strings.TrimRight(trimmed, "/"), "-", "")
+
+	match := notionPageIdPattern.FindStringSubmatch(trimmed)
+	if match == nil {
+		return "", fmt.Errorf("notion pageId '%s' has no 32-character page ID in it", pageId)
+	}
+	return strings.ToLower(match[1]), nil
+}
+
+func (config NotionConfig) Validate() error {
+	if config.PageId == "" {
+		return fmt.Errorf("notion needs a pageId")
+	}
+	_, err := ParseNotionPageId(config.PageId)
+	return err
+}
+
+// NotionDataSource reads characters that have a notion config.
+type NotionDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+type notionPage struct {
+	Id         string                            `json:"id"`
+	Properties map[string]map[string]interface{} `json:"properties"`
+}
+
+type notionError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (config ServiceConfig) NotionAccessToken() string {
+	if token := os.Getenv(notionTokenEnv); token != "" {
+		return token
+	}
+	return config.NotionToken
+}
+
+func (source NotionDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	page, err := source.FetchPage(ctx, *charConfig.Notion)
+	if err != nil {
+		return FetchedAttributes{}, err
+	}
+
+	fetched := NewFetchedAttributes()
+	for _, attr := range charConfig.Attributes {
+		property, found := page.Properties[attr.Range]
+		if !found {
+			fetched.Errors[attr.Name] = fmt.Sprintf("no property '%s' on the Notion page", attr.Range)
+			continue
+		}
+		cells, err := NotionPropertyCells(property)
+		if err != nil {
+			fetched.Errors[attr.Name] = fmt.Sprintf("property '%s': %v", attr.Range, err)
+			continue
+		}
+		if len(cells) > 0 {
+			fetched.SetCells(attr, cells)
+		}
+	}
+
+	return fetched, nil
+}
+
+func (source NotionDataSource) FetchPage(ctx context.Context, config NotionConfig) (notionPage, error) {
+	pageId, err := ParseNotionPageId(config.PageId)
+	if err != nil {
+		return notionPage{}, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, notionApiUrl+"/pages/"+pageId, nil)
+	if err != nil {
+		return notionPage{}, err
+	}
+	request.Header.Set("Authorization", "Bearer "+source.app.Config.NotionAccessToken())
+	request.Header.Set("Notion-Version", notionApiVersion)
+
+	response, err := notionClient.Do(request)
+	if err != nil {
+		return notionPage{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var apiError notionError
+		json.NewDecoder(response.Body).Decode(&apiError)
+		if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+			return notionPage{}, fmt.Errorf("Notion %w: %s %s", errTokenRejected, response.Status, apiError.Message)
+		}
+		// pages that aren't shared with the integration are reported as not found
+		return notionPage{}, fmt.Errorf("Notion returned %s %s", response.Status, apiError.Message)
+	}
+
+	var page notionPage
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+		return notionPage{}, fmt.Errorf("invalid Notion page: %v", err)
+	}
+	return page, nil
+}
+
+// NotionPropertyCells turns a page property into cell strings, by its type: one for text,
+// numbers, checkboxes, selects and dates, and one per item for multi-selects, people,
+// files and relations. Formulas and rollups are read as whatever they compute.
+func NotionPropertyCells(property map[string]interface{}) ([]string, error) {
+	propertyType, _ := property["type"].(string)
+	value := property[propertyType]
+
+	switch propertyType {
+	case "title", "rich_text":
+		text := ""
+		for _, item := range notionList(value) {
+			if plainText, ok := item["plain_text"].(string); ok {
+				text += plainText
+			}
+		}
+		if text == "" {
+			return nil, nil
+		}
+		return []string{text}, nil
+	case "number":
+		if value == nil {
+			return nil, nil
+		}
+		return []string{CellString(value)}, nil
+	case "checkbox", "boolean":
+		checked, _ := value.(bool)
+		return []string{strings.ToUpper(fmt.Sprintf("%v", checked))}, nil
+	case "url", "email", "phone_number", "string", "created_time", "last_edited_time":
+		if text, ok := value.(string); ok && text != "" {
+			return []string{text}, nil
+		}
+		return nil, nil
+	case "select", "status":
+		if option, ok := value.(map[string]interface{}); ok {
+			return []string{fmt.Sprintf("%v", option["name"])}, nil
+		}
+		return nil, nil
+	case "multi_select", "people":
+		cells := []string{}
+		for _, item := range notionList(value) {
+			cells = append(cells, fmt.Sprintf("%v", item["name"]))
+		}
+		return cells, nil
+	case "created_by", "last_edited_by":
+		if user, ok := value.(map[string]interface{}); ok {
+			return []string{fmt.Sprintf("%v", user["name"])}, nil
+		}
+		return nil, nil
+	case "date":
+		date, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		// a date range is written as an ISO 8601 interval
+		if end, ok := date["end"].(string); ok && end != "" {
+			return []string{fmt.Sprintf("%v/%s", date["start"], end)}, nil
+		}
+		return []string{fmt.Sprintf("%v", date["start"])}, nil
+	case "files":
+		cells := []string{}
+		for _, item := range notionList(value) {
+			// files uploaded to Notion have a url that expires after an hour
+			for _, kind := range []string{"file", "external"} {
+				if file, ok := item[kind].(map[string]interface{}); ok {
+					cells = append(cells, fmt.Sprintf("%v", file["url"]))
+				}
+			}
+		}
+		return cells, nil
+	case "relation":
+		cells := []string{}
+		for _, item := range notionList(value) {
+			cells = append(cells, fmt.Sprintf("%v", item["id"]))
+		}
+		return cells, nil
+	case "unique_id":
+		id, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		if prefix, ok := id["prefix"].(string); ok && prefix != "" {
+			return []string{prefix + "-" + CellString(id["number"])}, nil
+		}
+		return []string{CellString(id["number"])}, nil
+	case "formula", "rollup":
+		computed, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		if computed["type"] == "array" {
+			cells := []string{}
+			for _, item := range notionList(computed["array"]) {
+				itemCells, err := NotionPropertyCells(item)
+				if err != nil {
+					return nil, err
+				}
+				cells = append(cells, itemCells...)
+			}
+			return cells, nil
+		}
+		return NotionPropertyCells(computed)
+	default:
+		return nil, fmt.Errorf("unsupported property type '%s'", propertyType)
+	}
+}
+
+func notionList(value interface{}) []map[string]interface{} {
+	items, _ := value.([]interface{})
+	list := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok {
+			list = append(list, object)
+		}
+	}
+	return list
+}
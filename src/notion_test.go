@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a page as the Notion API returns it, trimmed to the properties read below
+const notionPageJson = `{
+	"object": "page",
+	"id": "59833787-2cf9-4fdf-8782-e53db20768a5",
+	"properties": {
+		"Name": {"id": "title", "type": "title", "title": [
+			{"type": "text", "plain_text": "Balin "},
+			{"type": "text", "plain_text": "Fundinson"}
+		]},
+		"HP": {"id": "a%3Bb", "type": "number", "number": 9},
+		"Inspired": {"id": "c", "type": "checkbox", "checkbox": false},
+		"Class": {"id": "d", "type": "select", "select": {"id": "1", "name": "Fighter", "color": "red"}},
+		"Conditions": {"id": "e", "type": "multi_select", "multi_select": [{"name": "Blinded"}, {"name": "Deafened"}]},
+		"Born": {"id": "f", "type": "date", "date": {"start": "2021-10-01", "end": null}},
+		"Level": {"id": "g", "type": "formula", "formula": {"type": "number", "number": 5}},
+		"Notes": {"id": "h", "type": "rich_text", "rich_text": []},
+		"Layout": {"id": "i", "type": "button", "button": {}}
+	}
+}`
+
+const notionPageId = "598337872cf94fdf8782e53db20768a5"
+
+// newFakeNotion serves one page to requests with the right token and API version.
+func newFakeNotion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret_notion" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"object": "error", "status": 401, "code": "unauthorized", "message": "API token is invalid."}`))
+			return
+		}
+		if r.Header.Get("Notion-Version") != notionApiVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"object": "error", "status": 400, "code": "missing_version", "message": "Notion-Version header failed validation"}`))
+			return
+		}
+		if r.URL.Path != "/pages/"+notionPageId {
+			// as for pages that aren't shared with the integration
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"object": "error", "status": 404, "code": "object_not_found", "message": "Could not find page"}`))
+			return
+		}
+		w.Write([]byte(notionPageJson))
+	}))
+	t.Cleanup(server.Close)
+
+	previousUrl := notionApiUrl
+	notionApiUrl = server.URL
+	t.Cleanup(func() { notionApiUrl = previousUrl })
+}
+
+func TestNotionDataSource(t *testing.T) {
+	attributes := []AttributeRow{
+		{Name: "name", Range: "Name"},
+		{Name: "hp", Range: "HP"},
+		{Name: "inspired", Range: "Inspired"},
+		{Name: "class", Range: "Class"},
+		{Name: "conditions", Range: "Conditions", Type: AttributeTypeList},
+		{Name: "born", Range: "Born"},
+		{Name: "level", Range: "Level"},
+		{Name: "notes", Range: "Notes"},
+		{Name: "layout", Range: "Layout"},
+		{Name: "mana", Range: "Mana"},
+	}
+	want := map[string]string{
+		"name":       "Balin Fundinson",
+		"hp":         "9",
+		"inspired":   "FALSE",
+		"class":      "Fighter",
+		"conditions": `["Blinded","Deafened"]`,
+		"born":       "2021-10-01",
+		"level":      "5",
+	}
+
+	tests := []struct {
+		name         string
+		pageId       string
+		token        string
+		want         map[string]string
+		wantErr      string
+		wantAuthFail bool
+	}{
+		{"by id", notionPageId, "secret_notion", want, "", false},
+		{"by url", "https://www.notion.so/party/Balin-59833787-2cf9-4fdf-8782-e53db20768a5?pvs=4", "secret_notion", want, "", false},
+		{"not shared", "00000000000000000000000000000000", "secret_notion", nil, "Could not find page", false},
+		{"rejected token", notionPageId, "wrong", nil, "API token is invalid", true},
+	}
+
+	for _, test := range tests {
+		newFakeNotion(t)
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		app.Config.NotionToken = test.token
+
+		fetched, err := NotionDataSource{app: app}.Fetch(context.Background(), ConfigEntry{CharacterKey: "balin", Notion: &NotionConfig{PageId: test.pageId}, Attributes: attributes})
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			if IsAuthError(err) != test.wantAuthFail {
+				t.Errorf("%s: IsAuthError = %v, want %v", test.name, IsAuthError(err), test.wantAuthFail)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(fetched.Values, test.want) {
+			t.Errorf("%s: values = %v, want %v", test.name, fetched.Values, test.want)
+		}
+		// missing and unsupported properties are reported per attribute
+		if _, found := fetched.Errors["mana"]; !found {
+			t.Errorf("%s: no error for a missing property", test.name)
+		}
+		if _, found := fetched.Errors["layout"]; !found {
+			t.Errorf("%s: no error for an unsupported property", test.name)
+		}
+	}
+}
+
+func TestParseNotionPageId(t *testing.T) {
+	tests := []struct {
+		name   string
+		pageId string
+		want   string
+	}{
+		{"bare", notionPageId, notionPageId},
+		{"dashed", "59833787-2CF9-4FDF-8782-E53DB20768A5", notionPageId},
+		{"url", "https://www.notion.so/Balin-598337872cf94fdf8782e53db20768a5", notionPageId},
+		{"url with a query", "https://www.notion.so/598337872cf94fdf8782e53db20768a5/?v=1#heading", notionPageId},
+		{"too short", "598337872cf94fdf", ""},
+		{"not hex", "https://www.notion.so/Balin", ""},
+	}
+
+	for _, test := range tests {
+		pageId, err := ParseNotionPageId(test.pageId)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: ParseNotionPageId(%q) = %q, want an error", test.name, test.pageId, pageId)
+			}
+			continue
+		}
+		if err != nil || pageId != test.want {
+			t.Errorf("%s: ParseNotionPageId(%q) = %q, %v, want %q", test.name, test.pageId, pageId, err, test.want)
+		}
+	}
+}
+
+func TestNotionPropertyCells(t *testing.T) {
+	tests := []struct {
+		name     string
+		property string
+		want     []string
+	}{
+		{"empty number", `{"type": "number", "number": null}`, nil},
+		{"status", `{"type": "status", "status": {"name": "Alive"}}`, []string{"Alive"}},
+		{"people", `{"type": "people", "people": [{"name": "Sam"}, {"name": "Alex"}]}`, []string{"Sam", "Alex"}},
+		{"date range", `{"type": "date", "date": {"start": "2021-10-01", "end": "2021-10-03"}}`, []string{"2021-10-01/2021-10-03"}},
+		{"files", `{"type": "files", "files": [{"file": {"url": "https://s3/a.png"}}, {"external": {"url": "https://b.png"}}]}`, []string{"https://s3/a.png", "https://b.png"}},
+		{"relation", `{"type": "relation", "relation": [{"id": "abc"}]}`, []string{"abc"}},
+		{"unique id", `{"type": "unique_id", "unique_id": {"prefix": "PC", "number": 3}}`, []string{"PC-3"}},
+		{"formula text", `{"type": "formula", "formula": {"type": "string", "string": "Dwarf"}}`, []string{"Dwarf"}},
+		{"rollup array", `{"type": "rollup", "rollup": {"type": "array", "array": [{"type": "number", "number": 1}, {"type": "number", "number": 2}]}}`, []string{"1", "2"}},
+		{"last edited by", `{"type": "last_edited_by", "last_edited_by": {"name": "Sam"}}`, []string{"Sam"}},
+	}
+
+	for _, test := range tests {
+		var property map[string]interface{}
+		if err := json.Unmarshal([]byte(test.property), &property); err != nil {
+			t.Fatal(err)
+		}
+		cells, err := NotionPropertyCells(property)
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cells, test.want) {
+			t.Errorf("%s: cells = %v, want %v", test.name, cells, test.want)
+		}
+	}
+}
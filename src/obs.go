@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// The OBS controller keeps scenes in step with the characters over obs-websocket (v5, built
+// into OBS 28 and later): text sources are set from attributes, and sources are shown or
+// hidden by conditions like those of derived attributes. OBS is updated whenever a
+// character changes, and fully on every (re)connect.
+
+const (
+	// obs-websocket message types
+	obsOpHello           = 0
+	obsOpIdentify        = 1
+	obsOpIdentified      = 2
+	obsOpRequest         = 6
+	obsOpRequestResponse = 7
+
+	obsMaxReconnectDelay = 1 * time.Minute
+
+	// how long OBS has to answer a request
+	obsRequestTimeout = 10 * time.Second
+)
+
+type ObsConfig struct {
+	// e.g. ws://localhost:4455; the controller is off when this is empty
+	Url string `json:"url"`
+
+	// the server password set in OBS under Tools -> WebSocket Server Settings, if any
+	Password string `json:"password"`
+
+	Texts      []ObsText       `json:"texts"`
+	Visibility []ObsVisibility `json:"visibility"`
+}
+
+// ObsText sets a text source to Text, with each {name} replaced by the character's value
+// of that attribute, e.g. "HP {hp}/{maxHp}".
+type ObsText struct {
+	Character string `json:"character"`
+	Source    string `json:"source"`
+	Text      string `json:"text"`
+}
+
+// ObsVisibility shows a source in a scene while every condition in All holds, and at least
+// one in Any does (if there are any), and hides it otherwise.
+type ObsVisibility struct {
+	Character string             `json:"character"`
+	Scene     string             `json:"scene"`
+	Source    string             `json:"source"`
+	All       []DerivedCondition `json:"all,omitempty"`
+	Any       []DerivedCondition `json:"any,omitempty"`
+}
+
+func (config ObsConfig) Enabled() bool {
+	return config.Url != ""
+}
+
+func (config ObsConfig) Validate(characters []ConfigEntry) error {
+	if !config.Enabled() {
+		return nil
+	}
+	parsed, err := url.Parse(config.Url)
+	if err != nil || (parsed.Scheme != "ws" && parsed.Scheme != "wss") || parsed.Host == "" {
+		return fmt.Errorf("obs url '%s' must be a ws:// or wss:// URL", config.Url)
+	}
+
+	configured := map[string]bool{}
+	for _, configEntry := range characters {
+		configured[configEntry.CharacterKey] = true
+	}
+	for _, text := range config.Texts {
+		if !configured[text.Character] || text.Source == "" {
+			return fmt.Errorf("obs text for source '%s' needs a source and a configured character, not '%s'",
+				text.Source, text.Character)
+		}
+	}
+	for _, visibility := range config.Visibility {
+		if !configured[visibility.Character] || visibility.Scene == "" || visibility.Source == "" {
+			return fmt.Errorf("obs visibility for source '%s' needs a scene, a source and a configured character, not '%s'",
+				visibility.Source, visibility.Character)
+		}
+		if len(visibility.All)+len(visibility.Any) == 0 {
+			return fmt.Errorf("obs visibility for source '%s' has no conditions", visibility.Source)
+		}
+		for _, condition := range append(append([]DerivedCondition{}, visibility.All...), visibility.Any...) {
+			if !derivedOps[condition.Op] || condition.Attribute == "" || (condition.Value == nil) == (condition.CompareTo == "") {
+				return fmt.Errorf("obs visibility for source '%s': each condition needs an attribute, a known op, and one of value or compareTo",
+					visibility.Source)
+			}
+		}
+	}
+	return nil
+}
+
+// Characters lists the characters the controller follows.
+func (config ObsConfig) Characters() []string {
+	all := []string{}
+	for _, text := range config.Texts {
+		all = append(all, text.Character)
+	}
+	for _, visibility := range config.Visibility {
+		all = append(all, visibility.Character)
+	}
+
+	seen := map[string]bool{}
+	charKeys := []string{}
+	for _, charKey := range all {
+		if !seen[charKey] {
+			seen[charKey] = true
+			charKeys = append(charKeys, charKey)
+		}
+	}
+	return charKeys
+}
+
+// FillObsText replaces each {name} in text with the attribute's value; unknown names are
+// left as they are.
+func FillObsText(text string, charAttributes map[string]string) string {
+	var filled strings.Builder
+	for {
+		start := strings.Index(text, "{")
+		end := -1
+		if start >= 0 {
+			end = strings.Index(text[start:], "}")
+		}
+		if end < 0 {
+			filled.WriteString(text)
+			return filled.String()
+		}
+		end += start
+
+		name := text[start+1 : end]
+		value, found := charAttributes[name]
+		if !found {
+			value = text[start : end+1]
+		}
+		filled.WriteString(text[:start])
+		filled.WriteString(value)
+		text = text[end+1:]
+	}
+}
+
+type obsMessage struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+}
+
+// obsConnection is one session with OBS.
+type obsConnection struct {
+	ws        *websocket.Conn
+	responses chan obsMessage
+	requestId int
+}
+
+// obsRequester makes obs-websocket requests, returning the responseData and whether OBS
+// carried the request out.
+type obsRequester interface {
+	request(requestType string, requestData interface{}) (json.RawMessage, bool, error)
+}
+
+// obsScene is what was last sent to OBS in a session, so only changes are sent again.
+type obsScene struct {
+	texts        map[string]string
+	visible      map[string]bool
+	sceneItemIds map[string]int
+}
+
+func newObsScene() *obsScene {
+	return &obsScene{
+		texts:        map[string]string{},
+		visible:      map[string]bool{},
+		sceneItemIds: map[string]int{},
+	}
+}
+
+// RunObsController keeps OBS in step with the characters until ctx is cancelled,
+// reconnecting with a growing delay when the connection drops.
+func (app *CharacterSheetServiceApp) RunObsController(ctx context.Context, config ObsConfig) {
+	// subscribed for good, so changes made while reconnecting aren't lost
+	updates := make(chan string, 16)
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, charKey := range config.Characters() {
+		changed := app.Notifier.Subscribe(charKey)
+		defer app.Notifier.Unsubscribe(charKey, changed)
+		go forwardChanges(charKey, changed, stop, updates)
+	}
+
+	delay := time.Second
+	for {
+		identified, err := app.serveObs(ctx, config, updates)
+		if ctx.Err() != nil {
+			return
+		}
+		if identified {
+			delay = time.Second
+		}
+		log.Printf("WARNING: obs connection lost: %v; reconnecting in %v", err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > obsMaxReconnectDelay {
+			delay = obsMaxReconnectDelay
+		}
+	}
+}
+
+func (app *CharacterSheetServiceApp) serveObs(ctx context.Context, config ObsConfig, updates chan string) (identified bool, err error) {
+	wsConfig, err := websocket.NewConfig(config.Url, "http://localhost/")
+	if err != nil {
+		return false, err
+	}
+	wsConfig.Protocol = []string{"obswebsocket.json"}
+	ws, err := websocket.DialConfig(wsConfig)
+	if err != nil {
+		return false, err
+	}
+	defer ws.Close()
+
+	conn := &obsConnection{
+		ws:        ws,
+		responses: make(chan obsMessage, 16),
+	}
+	// a new session starts from scratch, so OBS is fully updated on every (re)connect
+	scene := newObsScene()
+
+	// reading all the time also answers OBS's keepalive pings
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			var message obsMessage
+			if err := websocket.JSON.Receive(ws, &message); err != nil {
+				readErr <- err
+				close(conn.responses)
+				return
+			}
+			select {
+			case conn.responses <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := conn.identify(config.Password); err != nil {
+		return false, err
+	}
+	log.Printf("-- obs: connected to %s", config.Url)
+
+	for _, charKey := range config.Characters() {
+		if err := app.syncObs(ctx, conn, scene, config, charKey); err != nil {
+			return true, err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case err := <-readErr:
+			return true, err
+		case charKey := <-updates:
+			if err := app.syncObs(ctx, conn, scene, config, charKey); err != nil {
+				return true, err
+			}
+		}
+	}
+}
+
+// syncObs brings the sources bound to a character up to date with its cached attributes.
+func (app *CharacterSheetServiceApp) syncObs(ctx context.Context, obs obsRequester, scene *obsScene, config ObsConfig, charKey string) error {
+	entry, found := app.LookupCharacter(ctx, charKey)
+	if !found || entry.Attributes == nil {
+		return nil
+	}
+	return scene.Sync(obs, config, charKey, *entry.Attributes)
+}
+
+// Sync sends OBS the requests that bring the sources bound to a character in line with its
+// attributes: text settings that changed, and sources whose visibility changed.
+func (scene *obsScene) Sync(obs obsRequester, config ObsConfig, charKey string, charAttributes map[string]string) error {
+	for _, text := range config.Texts {
+		if text.Character != charKey {
+			continue
+		}
+		filled := FillObsText(text.Text, charAttributes)
+		if last, sent := scene.texts[text.Source]; sent && last == filled {
+			continue
+		}
+		if _, _, err := obs.request("SetInputSettings", map[string]interface{}{
+			"inputName":     text.Source,
+			"inputSettings": map[string]string{"text": filled},
+		}); err != nil {
+			return err
+		}
+		scene.texts[text.Source] = filled
+	}
+
+	for _, visibility := range config.Visibility {
+		if visibility.Character != charKey {
+			continue
+		}
+		show := DerivedRule{All: visibility.All, Any: visibility.Any}.Matches(charAttributes)
+		key := visibility.Scene + "\x00" + visibility.Source
+		if last, sent := scene.visible[key]; sent && last == show {
+			continue
+		}
+
+		sceneItemId, known := scene.sceneItemIds[key]
+		if !known {
+			response, ok, err := obs.request("GetSceneItemId", map[string]interface{}{
+				"sceneName":  visibility.Scene,
+				"sourceName": visibility.Source,
+			})
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// not in the scene; tried again on the next change
+				continue
+			}
+			var data struct {
+				SceneItemId int `json:"sceneItemId"`
+			}
+			json.Unmarshal(response, &data)
+			sceneItemId = data.SceneItemId
+			scene.sceneItemIds[key] = sceneItemId
+		}
+
+		if _, _, err := obs.request("SetSceneItemEnabled", map[string]interface{}{
+			"sceneName":        visibility.Scene,
+			"sceneItemId":      sceneItemId,
+			"sceneItemEnabled": show,
+		}); err != nil {
+			return err
+		}
+		scene.visible[key] = show
+		log.Printf("--- obs: %s '%s' in '%s' for '%s'", map[bool]string{true: "showing", false: "hiding"}[show],
+			visibility.Source, visibility.Scene, charKey)
+	}
+	return nil
+}
+
+// identify answers OBS's Hello, authenticating when the server has a password.
+func (conn *obsConnection) identify(password string) error {
+	hello, err := conn.receive(obsOpHello)
+	if err != nil {
+		return err
+	}
+	var helloData struct {
+		Authentication *struct {
+			Challenge string `json:"challenge"`
+			Salt      string `json:"salt"`
+		} `json:"authentication"`
+	}
+	json.Unmarshal(hello.D, &helloData)
+
+	identify := map[string]interface{}{"rpcVersion": 1, "eventSubscriptions": 0}
+	if helloData.Authentication != nil {
+		if password == "" {
+			return fmt.Errorf("obs requires a password")
+		}
+		identify["authentication"] = ObsAuthentication(password, helloData.Authentication.Salt, helloData.Authentication.Challenge)
+	}
+	if err := conn.send(obsOpIdentify, identify); err != nil {
+		return err
+	}
+
+	// OBS closes the connection instead when authentication fails
+	if _, err := conn.receive(obsOpIdentified); err != nil {
+		return fmt.Errorf("obs didn't accept the connection (wrong password?): %v", err)
+	}
+	return nil
+}
+
+// ObsAuthentication is the obs-websocket authentication string for a password:
+// base64(sha256(base64(sha256(password + salt)) + challenge)).
+func ObsAuthentication(password string, salt string, challenge string) string {
+	secret := sha256.Sum256([]byte(password + salt))
+	auth := sha256.Sum256([]byte(base64.StdEncoding.EncodeToString(secret[:]) + challenge))
+	return base64.StdEncoding.EncodeToString(auth[:])
+}
+
+func (conn *obsConnection) send(op int, data interface{}) error {
+	dataJson, _ := json.Marshal(data)
+	return websocket.JSON.Send(conn.ws, obsMessage{Op: op, D: dataJson})
+}
+
+// receive waits for the next message of type op, skipping any others.
+func (conn *obsConnection) receive(op int) (obsMessage, error) {
+	timeout := time.After(obsRequestTimeout)
+	for {
+		select {
+		case message, ok := <-conn.responses:
+			if !ok {
+				return obsMessage{}, fmt.Errorf("connection closed")
+			}
+			if message.Op == op {
+				return message, nil
+			}
+		case <-timeout:
+			return obsMessage{}, fmt.Errorf("timed out waiting for obs")
+		}
+	}
+}
+
+// request makes an obs-websocket request and returns its responseData, and whether OBS
+// carried it out. Requests OBS refuses, such as for a source that doesn't exist, are logged
+// but don't end the session.
+func (conn *obsConnection) request(requestType string, requestData interface{}) (json.RawMessage, bool, error) {
+	conn.requestId++
+	requestId := strconv.Itoa(conn.requestId)
+	if err := conn.send(obsOpRequest, map[string]interface{}{
+		"requestType": requestType,
+		"requestId":   requestId,
+		"requestData": requestData,
+	}); err != nil {
+		return nil, false, err
+	}
+
+	for {
+		message, err := conn.receive(obsOpRequestResponse)
+		if err != nil {
+			return nil, false, err
+		}
+		var response struct {
+			RequestId     string `json:"requestId"`
+			RequestStatus struct {
+				Result  bool   `json:"result"`
+				Comment string `json:"comment"`
+			} `json:"requestStatus"`
+			ResponseData json.RawMessage `json:"responseData"`
+		}
+		json.Unmarshal(message.D, &response)
+		if response.RequestId != requestId {
+			continue
+		}
+		if !response.RequestStatus.Result {
+			log.Printf("WARNING: obs refused %s: %s", requestType, response.RequestStatus.Comment)
+		}
+		return response.ResponseData, response.RequestStatus.Result, nil
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// fakeObs records the requests made of it, and answers as OBS would for a scene with the
+// given sources in it.
+type fakeObs struct {
+	sceneItemIds map[string]int
+	err          error
+	requests     []string
+}
+
+func (obs *fakeObs) request(requestType string, requestData interface{}) (json.RawMessage, bool, error) {
+	if obs.err != nil {
+		return nil, false, obs.err
+	}
+	data, _ := json.Marshal(requestData)
+	obs.requests = append(obs.requests, requestType+" "+string(data))
+
+	if requestType == "GetSceneItemId" {
+		source := requestData.(map[string]interface{})["sourceName"].(string)
+		sceneItemId, found := obs.sceneItemIds[source]
+		if !found {
+			return nil, false, nil
+		}
+		return json.RawMessage(fmt.Sprintf(`{"sceneItemId": %d}`, sceneItemId)), true, nil
+	}
+	return nil, true, nil
+}
+
+func TestObsSceneSync(t *testing.T) {
+	captureLog(t)
+	config := ObsConfig{
+		Url: "ws://localhost:4455",
+		Texts: []ObsText{
+			{Character: "thorin", Source: "Thorin HP", Text: "HP {hp}/{maxHp}"},
+			{Character: "gimli", Source: "Gimli HP", Text: "HP {hp}"},
+		},
+		Visibility: []ObsVisibility{
+			{Character: "thorin", Scene: "Main", Source: "Skull", All: []DerivedCondition{{Attribute: "hp", Op: "<=", Value: stringPointer("0")}}},
+			{Character: "thorin", Scene: "Main", Source: "Missing", Any: []DerivedCondition{{Attribute: "hp", Op: ">", Value: stringPointer("0")}}},
+		},
+	}
+
+	// each step syncs thorin with these attributes, and expects just these requests
+	steps := []struct {
+		name       string
+		attributes map[string]string
+		want       []string
+	}{
+		{
+			name:       "first sync",
+			attributes: map[string]string{"hp": "12", "maxHp": "30"},
+			want: []string{
+				`SetInputSettings {"inputName":"Thorin HP","inputSettings":{"text":"HP 12/30"}}`,
+				`GetSceneItemId {"sceneName":"Main","sourceName":"Skull"}`,
+				`SetSceneItemEnabled {"sceneItemEnabled":false,"sceneItemId":7,"sceneName":"Main"}`,
+				// not in the scene, so nothing's set
+				`GetSceneItemId {"sceneName":"Main","sourceName":"Missing"}`,
+			},
+		},
+		{
+			// nothing's sent for what's unchanged, but the missing source is looked for again
+			name:       "unchanged",
+			attributes: map[string]string{"hp": "12", "maxHp": "30"},
+			want:       []string{`GetSceneItemId {"sceneName":"Main","sourceName":"Missing"}`},
+		},
+		{
+			// the text changed, but the skull stays hidden
+			name:       "text changed",
+			attributes: map[string]string{"hp": "5", "maxHp": "30"},
+			want: []string{
+				`SetInputSettings {"inputName":"Thorin HP","inputSettings":{"text":"HP 5/30"}}`,
+				`GetSceneItemId {"sceneName":"Main","sourceName":"Missing"}`,
+			},
+		},
+		{
+			// the skull's scene item ID is remembered
+			name:       "visibility changed",
+			attributes: map[string]string{"hp": "0", "maxHp": "30"},
+			want: []string{
+				`SetInputSettings {"inputName":"Thorin HP","inputSettings":{"text":"HP 0/30"}}`,
+				`SetSceneItemEnabled {"sceneItemEnabled":true,"sceneItemId":7,"sceneName":"Main"}`,
+				`GetSceneItemId {"sceneName":"Main","sourceName":"Missing"}`,
+			},
+		},
+	}
+
+	obs := &fakeObs{sceneItemIds: map[string]int{"Skull": 7}}
+	scene := newObsScene()
+	for _, step := range steps {
+		obs.requests = []string{}
+		if err := scene.Sync(obs, config, "thorin", step.attributes); err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+		if !reflect.DeepEqual(obs.requests, step.want) {
+			t.Errorf("%s: requests = %v, want %v", step.name, obs.requests, step.want)
+		}
+	}
+
+	// a new session starts over
+	obs.requests = []string{}
+	scene = newObsScene()
+	scene.Sync(obs, config, "gimli", map[string]string{"hp": "30"})
+	if want := []string{`SetInputSettings {"inputName":"Gimli HP","inputSettings":{"text":"HP 30"}}`}; !reflect.DeepEqual(obs.requests, want) {
+		t.Errorf("gimli: requests = %v, want %v", obs.requests, want)
+	}
+}
+
+func TestObsSceneSyncError(t *testing.T) {
+	config := ObsConfig{Texts: []ObsText{{Character: "thorin", Source: "Thorin HP", Text: "HP {hp}"}}}
+	obs := &fakeObs{err: errors.New("connection closed")}
+	scene := newObsScene()
+
+	if err := scene.Sync(obs, config, "thorin", map[string]string{"hp": "12"}); err == nil {
+		t.Fatal("error = nil, want the connection's")
+	}
+	// what failed to send is sent again once OBS is back
+	obs.err = nil
+	scene.Sync(obs, config, "thorin", map[string]string{"hp": "12"})
+	if len(obs.requests) != 1 {
+		t.Errorf("requests = %v, want the text sent again", obs.requests)
+	}
+}
+
+func TestFillObsText(t *testing.T) {
+	charAttributes := map[string]string{"hp": "12", "maxHp": "30", "name": "Thorin"}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"HP {hp}/{maxHp}", "HP 12/30"},
+		{"{name}", "Thorin"},
+		{"{mana} mana", "{mana} mana"},
+		{"no attributes", "no attributes"},
+		{"unclosed {hp", "unclosed {hp"},
+		{"{{hp}}", "{{hp}}"},
+	}
+
+	for _, test := range tests {
+		if got := FillObsText(test.text, charAttributes); got != test.want {
+			t.Errorf("FillObsText(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestObsConfigCharacters(t *testing.T) {
+	config := ObsConfig{
+		Texts:      []ObsText{{Character: "thorin"}, {Character: "gimli"}, {Character: "thorin"}},
+		Visibility: []ObsVisibility{{Character: "balin"}, {Character: "gimli"}},
+	}
+	if got, want := config.Characters(), []string{"thorin", "gimli", "balin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Characters() = %v, want %v", got, want)
+	}
+}
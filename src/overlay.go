@@ -0,0 +1,62 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// The built-in browser-source overlay: a page at /overlay/{characterKey} that renders the
+// character's attributes as stat blocks, kept up to date over /events/{characterKey}.
+//
+//go:embed overlay
+var overlayFiles embed.FS
+
+// HandleOverlay serves the overlay page for a configured character, and the scripts and
+// styles it loads from alongside it.
+func (app *CharacterSheetServiceApp) HandleOverlay(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+	name := strings.Trim(strings.TrimPrefix(requestPath, "/overlay/"), "/")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// Not GET - 405 Method Not Allowed error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	if _, configured := app.Characters()[name]; !configured {
+		// anything that isn't a character may be one of the bundled files, which a campaign
+		// character's page asks for from under /overlay/<campaign>/
+		file := path.Base(name)
+		if fileBytes, err := overlayFiles.ReadFile("overlay/" + file); err == nil && path.Ext(file) != "" {
+			w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(file)))
+			w.Write(fileBytes)
+			return
+		}
+
+		// Result not found - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			CharacterUrls: app.ValidUrls(),
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				fmt.Sprintf("No character '%s' found; see list of valid character paths in the payload.", name)),
+		})
+		return
+	}
+
+	page, err := overlayFiles.ReadFile("overlay/index.html")
+	if err != nil {
+		log.Printf("Unable to read embedded overlay page: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+
+	log.Printf("--- request: %s -> overlay for '%s'", requestPath, name)
+}
@@ -0,0 +1,161 @@
+// Renders a character's attributes as stat blocks, served at /overlay/{characterKey}. The
+// page's query string (?token=, ?attrs=) is passed on to the service. Updates arrive over
+// /events/{characterKey}; with ?poll=<seconds> the JSON endpoint is polled instead.
+(function () {
+  "use strict";
+
+  // attributes shown in the header rather than as stat blocks
+  var headerAttributes = {
+    name: "name",
+    characterName: "name",
+    race: "subtitle",
+    class: "subtitle",
+    portraitUrl: "portrait",
+  };
+
+  // the key is everything after /overlay/, which includes the campaign for characters in one
+  var path = window.location.pathname.replace(/\/+$/, "");
+  var overlayPath = "/overlay/";
+  var characterKey = decodeURIComponent(path.substring(path.lastIndexOf(overlayPath) + overlayPath.length));
+  var characterPath = characterKey.split("/").map(encodeURIComponent).join("/");
+  var params = new URLSearchParams(window.location.search);
+  var pollSeconds = parseFloat(params.get("poll") || "0");
+  params.delete("poll");
+  var query = params.toString() ? "?" + params.toString() : "";
+
+  // the service is wherever /overlay/ is mounted, which may be behind a path prefix
+  var serviceBase = new URL(path.substring(0, path.lastIndexOf(overlayPath) + 1), window.location.href);
+  var previous = {};
+
+  function label(name) {
+    // camelCase, snake_case and lowercase keys all read as words
+    return name.replace(/_/g, " ").replace(/([a-z])([A-Z])/g, "$1 $2");
+  }
+
+  function displayValue(value) {
+    if (typeof value !== "string") {
+      value = JSON.stringify(value);
+    }
+    // list and table attributes arrive as JSON arrays
+    if (value.charAt(0) === "[") {
+      try {
+        var cells = JSON.parse(value);
+        return cells.map(function (cell) {
+          return Array.isArray(cell) ? cell.join(" ") : cell;
+        }).join("\n");
+      } catch (e) {
+        return value;
+      }
+    }
+    return value;
+  }
+
+  function showError(message) {
+    var error = document.getElementById("error");
+    error.textContent = message;
+    error.hidden = !message;
+  }
+
+  function render(attributes, states, stale) {
+    var character = document.getElementById("character");
+    var stats = document.getElementById("stats");
+    var subtitle = [];
+
+    character.classList.remove("loading");
+    character.classList.toggle("stale", !!stale);
+    stats.textContent = "";
+    document.getElementById("name").textContent = characterKey;
+
+    Object.keys(attributes).forEach(function (name) {
+      var value = displayValue(attributes[name]);
+
+      switch (headerAttributes[name]) {
+        case "name":
+          document.getElementById("name").textContent = value;
+          return;
+        case "subtitle":
+          if (value) {
+            subtitle.push(value);
+          }
+          return;
+        case "portrait":
+          var portrait = document.getElementById("portrait");
+          portrait.hidden = !value;
+          if (value && portrait.getAttribute("src") !== value) {
+            portrait.setAttribute("src", value);
+          }
+          return;
+      }
+
+      var block = document.createElement("div");
+      block.className = "stat";
+      if (states && states[name]) {
+        block.classList.add("state-" + states[name]);
+      }
+      if (name in previous && previous[name] !== value) {
+        block.classList.add("changed");
+      }
+
+      var blockLabel = document.createElement("div");
+      blockLabel.className = "label";
+      blockLabel.textContent = label(name);
+      var blockValue = document.createElement("div");
+      blockValue.className = "value";
+      blockValue.textContent = value;
+
+      block.appendChild(blockLabel);
+      block.appendChild(blockValue);
+      stats.appendChild(block);
+      previous[name] = value;
+    });
+
+    document.getElementById("subtitle").textContent = subtitle.join(" · ");
+  }
+
+  function listen() {
+    var events = new EventSource(new URL("events/" + characterPath + query, serviceBase));
+    events.onmessage = function (message) {
+      var update = JSON.parse(message.data);
+      if (update.error) {
+        showError(update.error);
+        return;
+      }
+      showError("");
+      render(update.attributes || {}, update.states);
+    };
+    // EventSource reconnects by itself
+    events.onerror = function () {
+      showError("Reconnecting to the character sheet service...");
+    };
+  }
+
+  function poll() {
+    fetch(new URL(characterPath + query, serviceBase), { cache: "no-cache" })
+      .then(function (response) {
+        return response.json();
+      })
+      .then(function (body) {
+        if (body.metadata.errorMessage) {
+          showError(body.metadata.errorMessage);
+        } else {
+          showError("");
+          render(body.attributes || {}, body.states, body.metadata.stale);
+        }
+      })
+      .catch(function (error) {
+        showError("Unable to reach the character sheet service: " + error);
+      })
+      .then(function () {
+        window.setTimeout(poll, pollSeconds * 1000);
+      });
+  }
+
+  if (pollSeconds > 0 || !window.EventSource) {
+    if (!(pollSeconds > 0)) {
+      pollSeconds = 2;
+    }
+    poll();
+  } else {
+    listen();
+  }
+})();
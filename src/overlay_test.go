@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleOverlay(t *testing.T) {
+	tests := []struct {
+		name            string
+		path            string
+		wantStatus      int
+		wantContentType string
+	}{
+		{"character", "/overlay/thorin", http.StatusOK, "text/html"},
+		{"campaign character", "/overlay/dale/rowan", http.StatusOK, "text/html"},
+		{"script", "/overlay/overlay.js", http.StatusOK, "javascript"},
+		{"script beside a campaign character", "/overlay/dale/overlay.js", http.StatusOK, "javascript"},
+		{"stylesheet beside a campaign character", "/overlay/dale/overlay.css", http.StatusOK, "text/css"},
+		{"unknown character", "/overlay/smaug", http.StatusNotFound, "application/json"},
+	}
+
+	rowan := ConfigEntry{CharacterKey: "rowan", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "C2"}}}
+	rowan.JoinCampaign("dale")
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "C2": {{"9"}}})
+		app := newTestApp(t, fake,
+			ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+			rowan,
+		)
+
+		w := httptest.NewRecorder()
+		app.HandleOverlay(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		if contentType := w.Header().Get("Content-Type"); !strings.Contains(contentType, test.wantContentType) {
+			t.Errorf("%s: content type = %q, want %s", test.name, contentType, test.wantContentType)
+		}
+	}
+}
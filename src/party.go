@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// PartyMember is one character in a /party response.
+type PartyMember struct {
+	Attributes interface{}       `json:"attributes,omitempty"`
+	States     map[string]string `json:"states,omitempty"`
+	Stale      bool              `json:"stale,omitempty"`
+	FetchError string            `json:"fetchError,omitempty"`
+
+	// why the character's attributes aren't included
+	Error string `json:"error,omitempty"`
+}
+
+// HandleParty serves several characters in one response: every configured character, just
+// those named in ?keys=a,b,c, or those of ?campaign=<campaign>. ?attrs= and ?format= apply
+// to each of them.
+func (app *CharacterSheetServiceApp) HandleParty(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+	app.Stats.CountRequest()
+
+	if r.Method != http.MethodGet {
+		// Not GET - 405 Method Not Allowed error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	if app.InMaintenance() {
+		// Maintenance mode - 503 Service Unavailable, or 200 if configured
+		metadata := NewMetadata(requestPath, app.Config.Maintenance.StatusCode(), app.Config.Maintenance.MaintenanceMessage())
+		metadata.Maintenance = true
+		app.WriteApiResponse(w, r, ApiResponse{Metadata: metadata})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "map" && format != "array" {
+		// Invalid format - 400 Bad Request error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+				fmt.Sprintf("Invalid format '%s'; must be map or array.", format)),
+		})
+		return
+	}
+
+	charKeys := app.PrimingOrder()
+	if keys := r.URL.Query().Get("keys"); keys != "" {
+		charKeys = PartyKeys(keys)
+		// repeats are dropped, so more keys than characters means some are made up
+		if characterCount := len(app.Characters()); len(charKeys) > characterCount {
+			// Too many keys - 400 Bad Request error
+			app.WriteApiResponse(w, r, ApiResponse{
+				Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+					fmt.Sprintf("Too many keys; there are only %d characters.", characterCount)),
+			})
+			return
+		}
+	} else if campaign := r.URL.Query().Get("campaign"); campaign != "" {
+		charKeys = app.CampaignKeys(campaign)
+	}
+
+	// look the characters up side by side, so any that aren't cached are fetched together
+	party := make(map[string]PartyMember, len(charKeys))
+	var partyLock sync.Mutex
+	var lookups sync.WaitGroup
+	for _, charKey := range charKeys {
+		charKey := charKey
+		lookups.Add(1)
+		go func() {
+			defer lookups.Done()
+			member := app.PartyMember(r, charKey, format)
+			partyLock.Lock()
+			party[charKey] = member
+			partyLock.Unlock()
+		}()
+	}
+	lookups.Wait()
+
+	app.WriteApiResponse(w, r, ApiResponse{
+		Party:    party,
+		Metadata: NewMetadata(requestPath, http.StatusOK, ""),
+	})
+}
+
+// PartyKeys reads ?keys=, without blanks or repeats.
+func PartyKeys(keys string) []string {
+	charKeys := []string{}
+	seen := map[string]bool{}
+	for _, charKey := range strings.Split(keys, ",") {
+		charKey = strings.TrimSpace(charKey)
+		if charKey != "" && !seen[charKey] {
+			seen[charKey] = true
+			charKeys = append(charKeys, charKey)
+		}
+	}
+	return charKeys
+}
+
+// PartyMember is one character of a party, as seen by the role of the request's token for
+// that character.
+func (app *CharacterSheetServiceApp) PartyMember(r *http.Request, charKey string, format string) PartyMember {
+	charConfig, configured := app.Characters()[charKey]
+	if !configured {
+		return PartyMember{Error: fmt.Sprintf("No character '%s' found.", charKey)}
+	}
+
+	role, ok := app.CharacterRole(r, charKey)
+	if !ok {
+		return PartyMember{Error: AccessDeniedMessage(r)}
+	}
+
+	entry, found := app.LookupCharacter(r.Context(), charKey)
+	if !found || entry.Attributes == nil {
+		return PartyMember{Error: fmt.Sprintf("Character '%s' is still being loaded.", charKey)}
+	}
+
+	visible := charConfig.VisibleTo(role)
+	if attrs := r.URL.Query().Get("attrs"); attrs != "" {
+		visible = charConfig.SelectAttributes(attrs, app.Config.KeyStyle, visible)
+	}
+
+	states := ResolveAttributeStates(charConfig, *entry.Attributes)
+	return PartyMember{
+		Attributes: app.RenderAttributes(charKey, FilterAttributes(*entry.Attributes, visible), format),
+		States:     StyleAttributeKeys(app.Config.KeyStyle, FilterAttributes(states, visible)),
+		Stale:      entry.Stale,
+		FetchError: entry.FetchError,
+	}
+}
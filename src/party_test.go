@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPartyKeys(t *testing.T) {
+	tests := []struct {
+		keys string
+		want []string
+	}{
+		{"thorin", []string{"thorin"}},
+		{"thorin, gimli ,balin", []string{"thorin", "gimli", "balin"}},
+		{"thorin,thorin,gimli,thorin", []string{"thorin", "gimli"}},
+		{"thorin,,gimli,", []string{"thorin", "gimli"}},
+		{" , ", []string{}},
+	}
+
+	for _, test := range tests {
+		if got := PartyKeys(test.keys); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("PartyKeys(%q) = %v, want %v", test.keys, got, test.want)
+		}
+	}
+}
+
+func TestHandleParty(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantKeys   []string
+		wantErrors []string
+	}{
+		{"everyone", "/party", http.StatusOK, []string{"gimli", "moria/balin", "thorin"}, nil},
+		{"keys", "/party?keys=thorin,gimli", http.StatusOK, []string{"gimli", "thorin"}, nil},
+		{"repeated keys", "/party?keys=thorin,thorin,,thorin", http.StatusOK, []string{"thorin"}, nil},
+		{"unknown key", "/party?keys=thorin,smaug", http.StatusOK, []string{"smaug", "thorin"}, []string{"smaug"}},
+		{"more keys than characters", "/party?keys=thorin,a,b,c", http.StatusBadRequest, nil, nil},
+		{"repeats don't count", "/party?keys=thorin,thorin,thorin,thorin,gimli", http.StatusOK, []string{"gimli", "thorin"}, nil},
+		{"campaign", "/party?campaign=moria", http.StatusOK, []string{"moria/balin"}, nil},
+		{"bad format", "/party?format=xml", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake,
+			ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+			ConfigEntry{CharacterKey: "gimli", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+			ConfigEntry{CharacterKey: "moria/balin", Campaign: "moria", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+		)
+
+		w := httptest.NewRecorder()
+		app.HandleParty(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+			continue
+		}
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.name, err)
+		}
+
+		keys := []string{}
+		errors := []string{}
+		for charKey, member := range response.Party {
+			keys = append(keys, charKey)
+			if member.Error != "" {
+				errors = append(errors, charKey)
+			} else if hp := partyAttributes(member)["hp"]; hp != "12" {
+				t.Errorf("%s: %s hp = %q, want 12", test.name, charKey, hp)
+			}
+		}
+		sort.Strings(keys)
+		if test.wantKeys == nil {
+			test.wantKeys = []string{}
+		}
+		if !reflect.DeepEqual(keys, test.wantKeys) {
+			t.Errorf("%s: party = %v, want %v", test.name, keys, test.wantKeys)
+		}
+		if len(errors) != len(test.wantErrors) {
+			t.Errorf("%s: errors for %v, want for %v", test.name, errors, test.wantErrors)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var pathbuilderClient = &http.Client{Timeout: 10 * time.Second}
+
+// PathbuilderConfig points a character at a Pathbuilder 2e build, exported as JSON: either
+// the URL Pathbuilder gives for it (https://pathbuilder2e.com/json.php?id=<id>), or a saved
+// copy of that JSON. When none of the character's attributes are read from it, every field
+// in pathbuilderFields is served under its own name. Otherwise each attribute's range is one
+// of those fields, or the dotted path of anything else in the build, e.g. specials.
+type PathbuilderConfig struct {
+	Url  string `json:"url,omitempty"`
+	File string `json:"file,omitempty"`
+}
+
+var pathbuilderSkills = []struct{ Field, Ability string }{
+	{"acrobatics", "dex"}, {"arcana", "int"}, {"athletics", "str"}, {"crafting", "int"},
+	{"deception", "cha"}, {"diplomacy", "cha"}, {"intimidation", "cha"}, {"medicine", "wis"},
+	{"nature", "wis"}, {"occultism", "int"}, {"performance", "cha"}, {"religion", "wis"},
+	{"society", "int"}, {"stealth", "dex"}, {"survival", "wis"}, {"thievery", "dex"},
+}
+
+var pathbuilderSaves = []struct{ Field, Ability string }{
+	{"perception", "wis"}, {"fortitude", "con"}, {"reflex", "dex"}, {"will", "wis"},
+}
+
+// the fields a Pathbuilder build is mapped to, in the order they're served
+var pathbuilderFields = func() []string {
+	fields := []string{
+		"name", "class", "level", "ancestry", "heritage", "background", "alignment", "deity",
+		"maxHp", "ac", "classDC", "speed", "focusPoints",
+		"str", "dex", "con", "int", "wis", "cha",
+		"strMod", "dexMod", "conMod", "intMod", "wisMod", "chaMod",
+	}
+	for _, save := range pathbuilderSaves {
+		fields = append(fields, save.Field)
+	}
+	for _, skill := range pathbuilderSkills {
+		fields = append(fields, skill.Field)
+	}
+	return append(fields, "cp", "sp", "gp", "pp", "languages", "feats")
+}()
+
+// fields that are served as lists when they're filled in automatically
+var pathbuilderListFields = map[string]bool{"languages": true, "feats": true}
+
+func (config PathbuilderConfig) Validate() error {
+	if (config.Url == "") == (config.File == "") {
+		return fmt.Errorf("pathbuilder needs either a url or a file")
+	}
+	if config.File != "" && strings.ToLower(filepath.Ext(config.File)) != ".json" {
+		return fmt.Errorf("pathbuilder file must be a .json export")
+	}
+	return nil
+}
+
+func PathbuilderAttributes() []AttributeRow {
+	attributes := make([]AttributeRow, len(pathbuilderFields))
+	for i, field := range pathbuilderFields {
+		attributes[i] = AttributeRow{Name: field, Range: field, Source: SourcePathbuilder}
+		if pathbuilderListFields[field] {
+			attributes[i].Type = AttributeTypeList
+		}
+	}
+	return attributes
+}
+
+// PathbuilderDataSource reads characters that have a pathbuilder config.
+type PathbuilderDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+type pathbuilderBuild struct {
+	Name        string                 `json:"name"`
+	Class       string                 `json:"class"`
+	DualClass   *string                `json:"dualClass"`
+	Level       int                    `json:"level"`
+	Ancestry    string                 `json:"ancestry"`
+	Heritage    string                 `json:"heritage"`
+	Background  string                 `json:"background"`
+	Alignment   string                 `json:"alignment"`
+	Deity       string                 `json:"deity"`
+	KeyAbility  string                 `json:"keyability"`
+	Languages   []string               `json:"languages"`
+	Abilities   map[string]interface{} `json:"abilities"`
+	FocusPoints float64                `json:"focusPoints"`
+	Attributes  struct {
+		AncestryHp      float64 `json:"ancestryhp"`
+		ClassHp         float64 `json:"classhp"`
+		BonusHp         float64 `json:"bonushp"`
+		BonusHpPerLevel float64 `json:"bonushpPerLevel"`
+		Speed           float64 `json:"speed"`
+		SpeedBonus      float64 `json:"speedBonus"`
+	} `json:"attributes"`
+	Proficiencies map[string]interface{} `json:"proficiencies"`
+	AcTotal       struct {
+		AcTotal float64 `json:"acTotal"`
+	} `json:"acTotal"`
+	Money map[string]float64 `json:"money"`
+	Feats [][]interface{}    `json:"feats"`
+}
+
+// Version is the saved file's modification time; builds read from a URL are always read.
+func (source PathbuilderDataSource) Version(ctx context.Context, charConfig ConfigEntry) string {
+	if charConfig.Pathbuilder.File == "" {
+		return ""
+	}
+	return FileVersion(charConfig.Pathbuilder.File)
+}
+
+func (source PathbuilderDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	buildJson, err := source.ReadBuild(ctx, *charConfig.Pathbuilder)
+	if err != nil {
+		return FetchedAttributes{}, err
+	}
+
+	var build pathbuilderBuild
+	var document interface{}
+	if err := json.Unmarshal(buildJson, &build); err != nil {
+		return FetchedAttributes{}, fmt.Errorf("invalid Pathbuilder build: %v", err)
+	}
+	json.Unmarshal(buildJson, &document)
+
+	fields := build.Fields()
+	fetched := NewFetchedAttributes()
+	for _, attr := range charConfig.Attributes {
+		cells, found := fields[attr.Range]
+		if !found {
+			value, found := DocumentPath(document, attr.Range)
+			if !found {
+				fetched.Errors[attr.Name] = fmt.Sprintf("no '%s' in the Pathbuilder build", attr.Range)
+				continue
+			}
+			if cells, err = DocumentValueCells(value); err != nil {
+				fetched.Errors[attr.Name] = fmt.Sprintf("'%s': %v", attr.Range, err)
+				continue
+			}
+		}
+		if len(cells) > 0 {
+			fetched.SetCells(attr, cells)
+		}
+	}
+	return fetched, nil
+}
+
+// ReadBuild returns the build from the export, which wraps it as {"success": true, "build": {...}}.
+func (source PathbuilderDataSource) ReadBuild(ctx context.Context, config PathbuilderConfig) (json.RawMessage, error) {
+	var exported []byte
+	if config.File != "" {
+		var err error
+		if exported, err = os.ReadFile(config.File); err != nil {
+			return nil, err
+		}
+	} else {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Url, nil)
+		if err != nil {
+			return nil, err
+		}
+		response, err := pathbuilderClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Pathbuilder returned %s", response.Status)
+		}
+		if exported, err = io.ReadAll(response.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	var wrapper struct {
+		Success *bool           `json:"success"`
+		Build   json.RawMessage `json:"build"`
+	}
+	if err := json.Unmarshal(exported, &wrapper); err != nil {
+		return nil, fmt.Errorf("invalid Pathbuilder export: %v", err)
+	}
+	if wrapper.Success != nil && !*wrapper.Success {
+		return nil, fmt.Errorf("Pathbuilder has no build there; is the JSON export's ID right?")
+	}
+	if len(wrapper.Build) == 0 {
+		// a bare build, without the wrapper
+		return exported, nil
+	}
+	return wrapper.Build, nil
+}
+
+// Fields works out the standard fields the way Pathbuilder's sheet shows them, from ability
+// scores, proficiencies and level. Item bonuses to saves and skills aren't in the export, so
+// aren't counted.
+func (build pathbuilderBuild) Fields() map[string][]string {
+	text := func(value string) []string {
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+	number := func(value float64) []string {
+		return []string{CellString(value)}
+	}
+	modifier := func(value int) []string {
+		return []string{fmt.Sprintf("%+d", value)}
+	}
+
+	class := build.Class
+	if build.DualClass != nil && *build.DualClass != "" {
+		class += " / " + *build.DualClass
+	}
+
+	fields := map[string][]string{
+		"name":        text(build.Name),
+		"class":       text(class),
+		"level":       []string{strconv.Itoa(build.Level)},
+		"ancestry":    text(build.Ancestry),
+		"heritage":    text(build.Heritage),
+		"background":  text(build.Background),
+		"alignment":   text(build.Alignment),
+		"deity":       text(build.Deity),
+		"ac":          number(build.AcTotal.AcTotal),
+		"speed":       number(build.Attributes.Speed + build.Attributes.SpeedBonus),
+		"focusPoints": number(build.FocusPoints),
+		"languages":   build.Languages,
+	}
+
+	mods := map[string]int{}
+	for _, ability := range dndBeyondAbilities {
+		score, _ := build.Abilities[ability.Field].(float64)
+		mods[ability.Field] = abilityModifier(int(score))
+		fields[ability.Field] = number(score)
+		fields[ability.Field+"Mod"] = modifier(mods[ability.Field])
+	}
+
+	// trained and better add the character's level to the proficiency bonus
+	proficiency := func(name string) int {
+		bonus, _ := build.Proficiencies[name].(float64)
+		if bonus > 0 {
+			return int(bonus) + build.Level
+		}
+		return 0
+	}
+	for _, save := range pathbuilderSaves {
+		fields[save.Field] = modifier(mods[save.Ability] + proficiency(save.Field))
+	}
+	for _, skill := range pathbuilderSkills {
+		fields[skill.Field] = modifier(mods[skill.Ability] + proficiency(skill.Field))
+	}
+	if build.KeyAbility != "" {
+		fields["classDC"] = []string{strconv.Itoa(10 + mods[build.KeyAbility] + proficiency("classDC"))}
+	}
+
+	hitPoints := build.Attributes.AncestryHp + build.Attributes.BonusHp +
+		(build.Attributes.ClassHp+build.Attributes.BonusHpPerLevel+float64(mods["con"]))*float64(build.Level)
+	fields["maxHp"] = number(hitPoints)
+
+	for _, coin := range []string{"cp", "sp", "gp", "pp"} {
+		fields[coin] = number(build.Money[coin])
+	}
+
+	feats := []string{}
+	for _, feat := range build.Feats {
+		if len(feat) > 0 {
+			feats = append(feats, fmt.Sprintf("%v", feat[0]))
+		}
+	}
+	fields["feats"] = feats
+
+	return fields
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a level 3 build as Pathbuilder's JSON export serves it, trimmed to the fields that are read
+const pathbuilderBuildJson = `{
+	"name": "Valeros",
+	"class": "Fighter",
+	"dualClass": null,
+	"level": 3,
+	"ancestry": "Human",
+	"heritage": "Versatile Human",
+	"background": "Farmhand",
+	"alignment": "NG",
+	"deity": "",
+	"keyability": "str",
+	"languages": ["Common", "Dwarven"],
+	"abilities": {"str": 18, "dex": 14, "con": 12, "int": 10, "wis": 12, "cha": 10, "breakdown": {}},
+	"focusPoints": 0,
+	"attributes": {"ancestryhp": 8, "classhp": 10, "bonushp": 0, "bonushpPerLevel": 0, "speed": 25, "speedBonus": 5},
+	"proficiencies": {"classDC": 2, "perception": 4, "fortitude": 4, "reflex": 4, "will": 2, "athletics": 2, "acrobatics": 0},
+	"acTotal": {"acProfBonus": 5, "acAbilityBonus": 2, "acItemBonus": 4, "acTotal": 21},
+	"money": {"cp": 2, "sp": 5, "gp": 15, "pp": 0},
+	"feats": [["Shield Block", null, "General Feat", 1], ["Power Attack", null, "Class Feat", 1]],
+	"specials": ["Attack of Opportunity", "Shield Block"]
+}`
+
+// newFakePathbuilder serves the build's export, and answers for an unknown ID the way
+// Pathbuilder does.
+func newFakePathbuilder(t *testing.T) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("id") {
+		case "118213":
+			w.Write([]byte(`{"success": true, "build": ` + pathbuilderBuildJson + `}`))
+		case "0":
+			w.Write([]byte(`{"success": false}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/json.php"
+}
+
+func TestPathbuilderDataSource(t *testing.T) {
+	exportUrl := newFakePathbuilder(t)
+	dir := t.TempDir()
+	bareFile := filepath.Join(dir, "valeros.json")
+	if err := ioutil.WriteFile(bareFile, []byte(pathbuilderBuildJson), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	attributes := []AttributeRow{
+		{Name: "name", Range: "name"},
+		{Name: "level", Range: "level"},
+		{Name: "deity", Range: "deity"},
+		{Name: "Hit Points", Range: "maxHp"},
+		{Name: "ac", Range: "ac"},
+		{Name: "speed", Range: "speed"},
+		{Name: "classDC", Range: "classDC"},
+		{Name: "strMod", Range: "strMod"},
+		{Name: "perception", Range: "perception"},
+		{Name: "reflex", Range: "reflex"},
+		{Name: "will", Range: "will"},
+		{Name: "athletics", Range: "athletics"},
+		{Name: "acrobatics", Range: "acrobatics"},
+		{Name: "gp", Range: "gp"},
+		{Name: "languages", Range: "languages", Type: AttributeTypeList},
+		{Name: "feats", Range: "feats"},
+		{Name: "specials", Range: "specials", Type: AttributeTypeList},
+		{Name: "acItems", Range: "acTotal.acItemBonus"},
+		{Name: "spells", Range: "spellCasters"},
+	}
+	want := map[string]string{
+		"name":       "Valeros",
+		"level":      "3",
+		"Hit Points": "41",
+		"ac":         "21",
+		"speed":      "30",
+		"classDC":    "19",
+		"strMod":     "+4",
+		"perception": "+8",
+		"reflex":     "+9",
+		"will":       "+6",
+		"athletics":  "+9",
+		"acrobatics": "+2",
+		"gp":         "15",
+		"languages":  `["Common","Dwarven"]`,
+		"feats":      "Shield Block, Power Attack",
+		"specials":   `["Attack of Opportunity","Shield Block"]`,
+		"acItems":    "4",
+	}
+
+	tests := []struct {
+		name    string
+		config  PathbuilderConfig
+		want    map[string]string
+		wantErr string
+	}{
+		{"url", PathbuilderConfig{Url: exportUrl + "?id=118213"}, want, ""},
+		{"bare file", PathbuilderConfig{File: bareFile}, want, ""},
+		{"unknown id", PathbuilderConfig{Url: exportUrl + "?id=0"}, nil, "no build there"},
+		{"unavailable", PathbuilderConfig{Url: exportUrl + "?id=1"}, nil, "502"},
+		{"missing file", PathbuilderConfig{File: filepath.Join(dir, "missing.json")}, nil, "no such file"},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		config := test.config
+
+		fetched, err := PathbuilderDataSource{app: app}.Fetch(context.Background(), ConfigEntry{CharacterKey: "valeros", Pathbuilder: &config, Attributes: attributes})
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(fetched.Values, test.want) {
+			t.Errorf("%s: values = %v, want %v", test.name, fetched.Values, test.want)
+		}
+		if _, found := fetched.Errors["spells"]; !found || len(fetched.Errors) != 1 {
+			t.Errorf("%s: errors = %v, want one for spells", test.name, fetched.Errors)
+		}
+	}
+}
+
+func TestPathbuilderAttributes(t *testing.T) {
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake)
+	config := PathbuilderConfig{Url: newFakePathbuilder(t) + "?id=118213"}
+
+	// filled in automatically, the list fields are served as lists
+	fetched, err := PathbuilderDataSource{app: app}.Fetch(context.Background(), ConfigEntry{CharacterKey: "valeros", Pathbuilder: &config, Attributes: PathbuilderAttributes()})
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if feats := fetched.Values["feats"]; feats != `["Shield Block","Power Attack"]` {
+		t.Errorf("feats = %s, want a list", feats)
+	}
+	if len(fetched.Errors) > 0 {
+		t.Errorf("errors = %v, want none", fetched.Errors)
+	}
+}
+
+func TestPathbuilderConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PathbuilderConfig
+		wantErr bool
+	}{
+		{"url", PathbuilderConfig{Url: "https://pathbuilder2e.com/json.php?id=118213"}, false},
+		{"file", PathbuilderConfig{File: "valeros.JSON"}, false},
+		{"neither", PathbuilderConfig{}, true},
+		{"both", PathbuilderConfig{Url: "https://pathbuilder2e.com/json.php?id=118213", File: "valeros.json"}, true},
+		{"not JSON", PathbuilderConfig{File: "valeros.pdf"}, true},
+	}
+
+	for _, test := range tests {
+		if err := test.config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
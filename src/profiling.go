@@ -0,0 +1,23 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// RegisterProfilingHandlers mounts net/http/pprof under /debug/pprof/ when enableProfiling
+// is set. Profiles expose internals, so they sit behind the admin secret like /admin.
+func (app *CharacterSheetServiceApp) RegisterProfilingHandlers(mux *http.ServeMux) {
+	if !app.Config.EnableProfiling {
+		return
+	}
+
+	mux.HandleFunc("/debug/pprof/", app.RequireAdmin(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", app.RequireAdmin(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", app.RequireAdmin(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", app.RequireAdmin(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", app.RequireAdmin(pprof.Trace))
+
+	log.Println("  * profiling enabled at /debug/pprof/")
+}
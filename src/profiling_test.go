@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfilingHandlers(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		token      string
+		wantStatus int
+	}{
+		{"absent by default", false, "s3cret", http.StatusNotFound},
+		{"present when enabled", true, "s3cret", http.StatusOK},
+		{"behind the admin secret", true, "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake)
+		app.Config.AdminSecret = "s3cret"
+		app.Config.EnableProfiling = test.enabled
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", app.HandleRequest)
+		app.RegisterProfilingHandlers(mux)
+
+		r := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		if isIndex := strings.Contains(w.Body.String(), "goroutine"); isIndex != (test.wantStatus == http.StatusOK) {
+			t.Errorf("%s: pprof index served = %v", test.name, isIndex)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// FetchGroup coalesces concurrent fetches of the same character, so a burst of lookups
+// shares one trip to the Sheets API. It's singleflight keyed by character, except that
+// the fetch runs detached from its callers: one that gives up waiting doesn't cancel it
+// for the others.
+type FetchGroup struct {
+	inFlight map[string]chan struct{}
+	lock     sync.Mutex
+}
+
+// Start runs fetch on a separate goroutine unless one is already running for charKey.
+// Either way it returns a channel that's closed once the running fetch finishes.
+func (group *FetchGroup) Start(charKey string, fetch func()) (done <-chan struct{}, started bool) {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+
+	if running, found := group.inFlight[charKey]; found {
+		return running, false
+	}
+	if group.inFlight == nil {
+		group.inFlight = map[string]chan struct{}{}
+	}
+
+	finished := make(chan struct{})
+	group.inFlight[charKey] = finished
+	go func() {
+		defer func() {
+			group.lock.Lock()
+			delete(group.inFlight, charKey)
+			group.lock.Unlock()
+			close(finished)
+		}()
+		fetch()
+	}()
+
+	return finished, true
+}
+
+// RefreshInBackground fetches a character's attributes on a separate goroutine, tracked so
+// shutdown can wait for in-flight refreshes rather than cutting them off mid-write. If the
+// character is already being fetched, that fetch is shared instead of starting another.
+func (app *CharacterSheetServiceApp) RefreshInBackground(ctx context.Context, charKey string) <-chan struct{} {
+	app.Refreshes.Add(1)
+	done, started := app.Fetches.Start(charKey, func() {
+		defer app.Refreshes.Done()
+
+		// shutdown cancels fetches it can't wait for
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(app.refreshesCtx, cancel)
+		defer stop()
+
+		if err := app.FetchCharacterAttributes(ctx, charKey); err != nil {
+			if IsAuthError(err) {
+				log.Printf("!!! credentials rejected while fetching '%s': %v", charKey, err)
+			} else {
+				log.Printf("Unable to retrieve data from sheet for '%s': %v", charKey, err)
+			}
+		}
+	})
+	if !started {
+		app.Refreshes.Done()
+	}
+	return done
+}
+
+// WaitForRefreshes blocks until in-flight refreshes finish, returning false if the timeout
+// passed first.
+func (app *CharacterSheetServiceApp) WaitForRefreshes(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		app.Refreshes.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (config ServiceConfig) ShutdownTimeout() time.Duration {
+	if config.ShutdownTimeoutSeconds > 0 {
+		return time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+	}
+	return defaultShutdownTimeout
+}
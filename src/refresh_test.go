@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaitForRefreshes(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+
+	if !app.WaitForRefreshes(time.Millisecond) {
+		t.Errorf("WaitForRefreshes timed out with nothing in flight")
+	}
+
+	fake.lock.Lock()
+	fake.values = map[string][][]interface{}{"B2": {{"7"}}}
+	fake.lock.Unlock()
+	release := fake.Hold()
+	app.RefreshInBackground(context.Background(), "thorin")
+
+	if app.WaitForRefreshes(50 * time.Millisecond) {
+		t.Fatalf("WaitForRefreshes returned while a refresh was held up")
+	}
+
+	time.AfterFunc(50*time.Millisecond, release)
+	if !app.WaitForRefreshes(5 * time.Second) {
+		t.Fatalf("WaitForRefreshes timed out after the refresh was released")
+	}
+	// the refresh wrote to the cache before the wait ended
+	entry, found := app.Cache.Get("thorin")
+	if !found || (*entry.Attributes)["hp"] != "7" {
+		t.Errorf("cache not updated when WaitForRefreshes returned: %v", entry)
+	}
+}
+
+func TestRefreshIfDue(t *testing.T) {
+	now := time.Date(2021, 10, 1, 19, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		refreshAhead int
+		expiresIn    time.Duration
+		evicted      bool
+		wantRefresh  bool
+	}{
+		{"fresh", 0, 10 * time.Second, false, false},
+		{"inside the window", 30, 10 * time.Second, false, true},
+		{"outside the window", 30, time.Minute, false, false},
+		{"expired", 0, -5 * time.Second, false, true},
+		{"evicted", 0, -5 * time.Second, true, false},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"7"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.Cache.RefreshAheadSeconds = test.refreshAhead
+		app.Clock = func() time.Time { return now }
+		entry := NewCachedEntry(&map[string]string{"hp": "12"}, defaultCacheTtl)
+		entry.Expires = now.Add(test.expiresIn)
+		app.Cache.Set("thorin", entry)
+		if test.evicted {
+			app.Cache.Evict("thorin")
+		}
+
+		// requests are served from the cache, and leave refreshing to the scheduler
+		if !test.evicted {
+			served, found := app.LookupCharacter(context.Background(), "thorin")
+			if !found || (*served.Attributes)["hp"] != "12" {
+				t.Errorf("%s: served %v, want the cached values", test.name, served)
+			}
+		}
+		// only one refresh is launched however often the scheduler looks
+		app.RefreshIfDue("thorin", now)
+		app.RefreshIfDue("thorin", now)
+		app.WaitForRefreshes(5 * time.Second)
+
+		wantFetches := 0
+		if test.wantRefresh {
+			wantFetches = 1
+		}
+		if fetches := len(fake.Requests()); fetches != wantFetches {
+			t.Errorf("%s: %d fetches, want %d", test.name, fetches, wantFetches)
+		}
+		if entry, _ := app.Cache.Get("thorin"); test.wantRefresh && (*entry.Attributes)["hp"] != "7" {
+			t.Errorf("%s: hp = %q after the refresh, want 7", test.name, (*entry.Attributes)["hp"])
+		}
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    time.Duration
+	}{
+		{0, defaultShutdownTimeout},
+		{-5, defaultShutdownTimeout},
+		{30, 30 * time.Second},
+	}
+
+	for _, test := range tests {
+		config := ServiceConfig{ShutdownTimeoutSeconds: test.seconds}
+		if got := config.ShutdownTimeout(); got != test.want {
+			t.Errorf("ShutdownTimeout() with %d seconds = %v, want %v", test.seconds, got, test.want)
+		}
+	}
+}
+
+func TestStopRefreshes(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.Config.OnErrorValue = stringPointer("?")
+	app.PrimeCharacter("thorin")
+	app.Cache.Evict("thorin")
+
+	release := fake.Hold()
+	defer release()
+	done := app.RefreshInBackground(context.Background(), "thorin")
+	app.StopRefreshes()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("refresh still running after StopRefreshes")
+	}
+	// a cancelled fetch isn't recorded as a failure of the sheet
+	if entry, found := app.Cache.Get("thorin"); found && (entry.FetchFailed || entry.Stale) {
+		t.Errorf("cancelled refresh marked the entry failed or stale: %+v", entry)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+)
+
+// Characters maps each configured character key to its config.
+func (app *CharacterSheetServiceApp) Characters() map[string]ConfigEntry {
+	app.charactersLock.RLock()
+	defer app.charactersLock.RUnlock()
+	return app.characters
+}
+
+// ValidUrls lists the relative link to each character endpoint, highest priority first.
+func (app *CharacterSheetServiceApp) ValidUrls() []string {
+	app.charactersLock.RLock()
+	defer app.charactersLock.RUnlock()
+	return app.validUrls
+}
+
+func (app *CharacterSheetServiceApp) PrimingOrder() []string {
+	app.charactersLock.RLock()
+	defer app.charactersLock.RUnlock()
+	return app.primingOrder
+}
+
+// SetCharacters swaps in the characters of config. The maps and slices are replaced, never
+// modified, so callers may keep using the ones they already have.
+func (app *CharacterSheetServiceApp) SetCharacters(config ServiceConfig) {
+	characters := config.CharacterMap()
+	primingOrder := config.PrimingOrder()
+	validUrls := make([]string, 0, len(primingOrder))
+	for _, key := range primingOrder {
+		validUrls = append(validUrls, "/"+key)
+	}
+
+	app.charactersLock.Lock()
+	app.characters = characters
+	app.primingOrder = primingOrder
+	app.validUrls = validUrls
+	app.charactersLock.Unlock()
+}
+
+// HandleAdminReload re-reads the config file (or directory) and applies its characters:
+// new characters are fetched, changed ones are fetched again and removed ones are dropped
+// from the cache. The characters are validated against the running global settings, which
+// only change on restart.
+func (app *CharacterSheetServiceApp) HandleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// Not POST - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use POST for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	var config ServiceConfig
+	var err error
+	switch {
+	case app.configFile != "":
+		log.Printf("-- reloading character configuration from %s", app.configFile)
+		config, err = ReadServiceConfigFile(app.configFile)
+	case app.configDir != "":
+		log.Printf("-- reloading character configuration from %s", app.configDir)
+		config, err = ReadServiceConfigDir(app.configDir)
+	default:
+		// Config from demo, $CONFIG_JSON or stdin - 409 Conflict error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusConflict,
+				"The config wasn't read from a file, so there's nothing to reload."),
+		})
+		return
+	}
+	if err == nil {
+		// the characters are served with the running global settings, so they must be valid
+		// with those rather than with whatever the file now says
+		running := app.Config
+		running.Characters = config.Characters
+		if err = running.Validate(); err != nil {
+			err = fmt.Errorf("invalid with the running global settings: %v", err)
+		}
+
+		globals, runningGlobals := config, app.Config
+		globals.Characters, runningGlobals.Characters = nil, nil
+		if err == nil && !reflect.DeepEqual(globals, runningGlobals) {
+			log.Printf("WARNING: global settings changed; they won't take effect until a restart")
+		}
+		config = running
+	}
+	if err != nil {
+		// Keep serving the old config - 400 Bad Request error
+		log.Printf("Unable to reload config: %v", err)
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusBadRequest,
+				fmt.Sprintf("Unable to reload config; still using the previous one. %v", err)),
+		})
+		return
+	}
+
+	previous := app.Characters()
+	app.SetCharacters(config)
+
+	for charKey := range previous {
+		if _, configured := app.Characters()[charKey]; !configured {
+			log.Printf("  * removed '%s'", charKey)
+			app.Cache.Delete(charKey)
+		}
+	}
+	for _, charKey := range app.PrimingOrder() {
+		previousConfig, found := previous[charKey]
+		if found && reflect.DeepEqual(previousConfig, app.Characters()[charKey]) {
+			continue
+		}
+		if found {
+			// the ranges may have changed, so nothing cached can be carried over
+			log.Printf("  * changed '%s'", charKey)
+			app.Cache.Evict(charKey)
+		} else {
+			log.Printf("  * added '%s'", charKey)
+		}
+		app.RefreshInBackground(context.Background(), charKey)
+	}
+
+	WriteApiResponseJson(w, ApiResponse{
+		CharacterUrls: app.ValidUrls(),
+		Metadata:      NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
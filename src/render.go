@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RenderData is what a character's renderTemplate is executed with. Attribute keys are
+// styled the way they're served; list and table attributes are arrays, so templates can
+// range over them.
+type RenderData struct {
+	CharacterKey string
+	Attributes   map[string]interface{}
+	States       map[string]string
+	Metadata     ResponseMetadata
+}
+
+// HandleRender serves /render/{characterKey}: the character's cached attributes rendered
+// server-side through its renderTemplate, for widgets that don't run any JavaScript. The
+// template is read on every request, so edits show up on the next refresh of the page;
+// it can set its own <meta http-equiv="refresh"> to keep itself up to date.
+func (app *CharacterSheetServiceApp) HandleRender(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+	charKey := strings.Trim(strings.TrimPrefix(requestPath, "/render/"), "/")
+
+	if r.Method != http.MethodGet {
+		// Not GET - 405 Method Not Allowed error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	charConfig, configured := app.Characters()[charKey]
+	if !configured {
+		// Result not found - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			CharacterUrls: app.ValidUrls(),
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				fmt.Sprintf("No character '%s' found; see list of valid character paths in the payload.", charKey)),
+		})
+		return
+	}
+
+	role, ok := app.CharacterRole(r, charKey)
+	if !ok {
+		// Missing or unknown access token - 401 Unauthorized error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusUnauthorized, AccessDeniedMessage(r)),
+		})
+		return
+	}
+
+	if charConfig.RenderTemplate == "" {
+		// No template configured - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				fmt.Sprintf("Character '%s' has no renderTemplate configured.", charKey)),
+		})
+		return
+	}
+
+	if app.InMaintenance() {
+		// Maintenance mode - 503 Service Unavailable, or 200 if configured
+		metadata := NewMetadata(requestPath, app.Config.Maintenance.StatusCode(), app.Config.Maintenance.MaintenanceMessage())
+		metadata.Maintenance = true
+		app.WriteApiResponse(w, r, ApiResponse{Metadata: metadata})
+		return
+	}
+
+	entry, found := app.LookupCharacter(r.Context(), charKey)
+	if !found || entry.Attributes == nil {
+		// Configured, but not yet primed - 503 Service Unavailable error
+		w.Header().Set("Retry-After", strconv.Itoa(primingRetryAfterSeconds))
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusServiceUnavailable,
+				fmt.Sprintf("Character '%s' is still being loaded; retry in %d seconds.", charKey, primingRetryAfterSeconds)),
+		})
+		return
+	}
+
+	renderTemplate, err := template.New(filepath.Base(charConfig.RenderTemplate)).ParseFiles(charConfig.RenderTemplate)
+	if err != nil {
+		// Unreadable template - 500 Internal Server Error
+		log.Printf("Invalid renderTemplate for '%s': %v", charKey, err)
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusInternalServerError,
+				fmt.Sprintf("Invalid renderTemplate for '%s': %v", charKey, err)),
+		})
+		return
+	}
+
+	visible := charConfig.VisibleTo(role)
+	types := charConfig.ValueTypes()
+	data := RenderData{
+		CharacterKey: charKey,
+		Attributes:   map[string]interface{}{},
+		States:       StyleAttributeKeys(app.Config.KeyStyle, FilterAttributes(ResolveAttributeStates(charConfig, *entry.Attributes), visible)),
+		Metadata:     NewMetadata(requestPath, http.StatusOK, ""),
+	}
+	data.Metadata.FetchFailed = entry.FetchFailed
+	data.Metadata.Stale = entry.Stale
+	data.Metadata.FetchError = entry.FetchError
+	for name, value := range FilterAttributes(*entry.Attributes, visible) {
+		var rendered interface{} = value
+		if attrType, found := types[name]; found && (attrType == AttributeTypeList || attrType == AttributeTypeTable) {
+			// an empty one, say when the fetch failed, is still something templates can range over
+			if value == "" {
+				rendered = []interface{}{}
+			} else if err := json.Unmarshal([]byte(value), &rendered); err != nil {
+				rendered = value
+			}
+		} else if found {
+			rendered = TypedValue(attrType, value)
+		}
+		data.Attributes[ApplyKeyStyle(app.Config.KeyStyle, name)] = rendered
+	}
+
+	// render into a buffer, so a template that fails halfway doesn't send half a page
+	var page bytes.Buffer
+	if err := renderTemplate.Execute(&page, data); err != nil {
+		// Template failed - 500 Internal Server Error
+		log.Printf("Unable to render '%s': %v", charKey, err)
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusInternalServerError,
+				fmt.Sprintf("Unable to render '%s': %v", charKey, err)),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(page.Bytes())
+
+	log.Printf("--- request: %s -> rendered %s", requestPath, charConfig.RenderTemplate)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleRender(t *testing.T) {
+	dir := t.TempDir()
+	renderTemplate := filepath.Join(dir, "thorin.html")
+	if err := ioutil.WriteFile(renderTemplate, []byte(`<h1>{{.CharacterKey}}</h1>`+
+		`<p class="{{.States.hit_points}}">{{printf "%T" .Attributes.hit_points}} {{.Attributes.hit_points}}</p>`+
+		`<ul>{{range .Attributes.inventory}}<li>{{.}}</li>{{end}}</ul>`+
+		`<p>{{.Attributes.motto}}</p><p>{{.Attributes.secret}}</p>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	brokenTemplate := filepath.Join(dir, "broken.html")
+	ioutil.WriteFile(brokenTemplate, []byte(`{{.Attributes.hp`), 0644)
+	failingTemplate := filepath.Join(dir, "failing.html")
+	ioutil.WriteFile(failingTemplate, []byte(`{{template "missing" .}}`), 0644)
+
+	no := false
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		template   string
+		prime      bool
+		sheetDown  bool
+		wantStatus int
+		wantPage   string
+	}{
+		{
+			name: "rendered", method: http.MethodGet, path: "/render/thorin", template: renderTemplate, prime: true,
+			wantStatus: http.StatusOK,
+			// typed and list values reach the template, and private ones need a token
+			wantPage: `<h1>thorin</h1><p class="critical">int64 4</p><ul><li>Rope</li><li>Lantern</li></ul>` +
+				`<p>&lt;b&gt;Baruk Khazâd!&lt;/b&gt;</p><p></p>`,
+		},
+		{
+			name: "with a token", method: http.MethodGet, path: "/render/thorin?token=gm-secret", template: renderTemplate, prime: true,
+			wantStatus: http.StatusOK,
+			wantPage: `<h1>thorin</h1><p class="critical">int64 4</p><ul><li>Rope</li><li>Lantern</li></ul>` +
+				`<p>&lt;b&gt;Baruk Khazâd!&lt;/b&gt;</p><p>Arkenstone</p>`,
+		},
+		{name: "not GET", method: http.MethodPost, path: "/render/thorin", template: renderTemplate, prime: true, wantStatus: http.StatusMethodNotAllowed},
+		{name: "unknown character", method: http.MethodGet, path: "/render/smaug", template: renderTemplate, prime: true, wantStatus: http.StatusNotFound},
+		{name: "no template", method: http.MethodGet, path: "/render/thorin", prime: true, wantStatus: http.StatusNotFound},
+		{
+			name: "fetch failed", method: http.MethodGet, path: "/render/thorin", template: renderTemplate, sheetDown: true,
+			wantStatus: http.StatusOK,
+			wantPage:   `<h1>thorin</h1><p class="">&lt;nil&gt; </p><ul></ul><p></p><p></p>`,
+		},
+		{name: "invalid template", method: http.MethodGet, path: "/render/thorin", template: brokenTemplate, prime: true, wantStatus: http.StatusInternalServerError},
+		{name: "template fails", method: http.MethodGet, path: "/render/thorin", template: failingTemplate, prime: true, wantStatus: http.StatusInternalServerError},
+		{name: "missing template", method: http.MethodGet, path: "/render/thorin", template: filepath.Join(dir, "missing.html"), prime: true, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{
+			"B2": {{"4"}}, "B3:B4": {{"Rope"}, {"Lantern"}}, "B5": {{"<b>Baruk Khazâd!</b>"}}, "B6": {{"Arkenstone"}},
+		})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", RenderTemplate: test.template, RequireAccessToken: &no,
+			Attributes: []AttributeRow{
+				{Name: "Hit Points", Range: "B2", Type: AttributeTypeInt, Thresholds: []AttributeThreshold{{Max: float(5), State: "critical"}, {State: "ok"}}},
+				{Name: "inventory", Range: "B3:B4", Type: AttributeTypeList},
+				{Name: "motto", Range: "B5"},
+				{Name: "secret", Range: "B6", Private: true},
+			}})
+		app.Config.KeyStyle = KeyStyleSnake
+		app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+		if test.prime {
+			app.PrimeCharacter("thorin")
+		}
+		if test.sheetDown {
+			fake.Fail(http.StatusServiceUnavailable)
+		}
+
+		w := httptest.NewRecorder()
+		app.HandleRender(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+			continue
+		}
+		if test.wantStatus != http.StatusOK {
+			if strings.Contains(w.Body.String(), "<h1>") {
+				t.Errorf("%s: sent a partial page: %s", test.name, w.Body.String())
+			}
+			continue
+		}
+		if page := w.Body.String(); page != test.wantPage {
+			t.Errorf("%s: page = %s, want %s", test.name, page, test.wantPage)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+			t.Errorf("%s: Content-Type = %q, want HTML", test.name, contentType)
+		}
+	}
+}
+
+func TestHandleRenderAccess(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.Config.RequireAccessToken = true
+	app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+	app.PrimeCharacter("thorin")
+
+	// whether a character has a template isn't given away without a token
+	w := httptest.NewRecorder()
+	app.HandleRender(w, httptest.NewRequest(http.MethodGet, "/render/thorin", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = httptest.NewRecorder()
+	app.HandleRender(w, httptest.NewRequest(http.MethodGet, "/render/thorin?token=gm-secret", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("with a token: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
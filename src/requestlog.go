@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRequestLogSize = 100
+
+type RequestLogEntry struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	CharacterKey string    `json:"characterKey,omitempty"`
+	Status       int       `json:"status"`
+	LatencyMs    float64   `json:"latencyMs"`
+
+	// hit, stale or miss, for requests that looked a character up
+	Cache string `json:"cache,omitempty"`
+}
+
+// RequestLog keeps the most recent requests in a fixed-size ring buffer, so recent
+// activity can be checked from /admin/logs without a log aggregator.
+type RequestLog struct {
+	entries []RequestLogEntry
+	next    int
+	full    bool
+	lock    sync.Mutex
+}
+
+func NewRequestLog(size int) *RequestLog {
+	if size <= 0 {
+		size = defaultRequestLogSize
+	}
+	return &RequestLog{entries: make([]RequestLogEntry, size)}
+}
+
+func (requestLog *RequestLog) Add(entry RequestLogEntry) {
+	requestLog.lock.Lock()
+	defer requestLog.lock.Unlock()
+
+	requestLog.entries[requestLog.next] = entry
+	requestLog.next = (requestLog.next + 1) % len(requestLog.entries)
+	if requestLog.next == 0 {
+		requestLog.full = true
+	}
+}
+
+// Entries returns the logged requests, oldest first.
+func (requestLog *RequestLog) Entries() []RequestLogEntry {
+	requestLog.lock.Lock()
+	defer requestLog.lock.Unlock()
+
+	if !requestLog.full {
+		return append([]RequestLogEntry{}, requestLog.entries[:requestLog.next]...)
+	}
+	return append(append([]RequestLogEntry{}, requestLog.entries[requestLog.next:]...),
+		requestLog.entries[:requestLog.next]...)
+}
+
+func (app *CharacterSheetServiceApp) RequestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		state := &requestState{}
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestStateKey{}, state)))
+
+		entry := RequestLogEntry{
+			Timestamp: started,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    recorder.status,
+			LatencyMs: float64(time.Since(started).Microseconds()) / 1000,
+			Cache:     state.cache,
+		}
+		charKey := strings.Trim(r.URL.Path, "/")
+		if _, configured := app.Characters()[charKey]; configured {
+			entry.CharacterKey = charKey
+		}
+		app.RequestLog.Add(entry)
+		LogRequest(entry)
+		app.Stats.RecordResponse(entry.CharacterKey, entry.Status, time.Since(started))
+	})
+}
+
+func (app *CharacterSheetServiceApp) HandleAdminLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		// Not GET - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	WriteApiResponseJson(w, ApiResponse{
+		RequestLog: app.RequestLog.Entries(),
+		Metadata:   NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestRequestLog(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		added int
+		want  []string
+	}{
+		{"empty", 3, 0, []string{}},
+		{"partly full", 3, 2, []string{"/0", "/1"}},
+		{"exactly full", 3, 3, []string{"/0", "/1", "/2"}},
+		{"wrapped", 3, 5, []string{"/2", "/3", "/4"}},
+		{"wrapped twice", 3, 7, []string{"/4", "/5", "/6"}},
+		{"default size", 0, defaultRequestLogSize + 1, nil},
+	}
+
+	for _, test := range tests {
+		requestLog := NewRequestLog(test.size)
+		for i := 0; i < test.added; i++ {
+			requestLog.Add(RequestLogEntry{Path: "/" + strconv.Itoa(i)})
+		}
+
+		entries := requestLog.Entries()
+		if test.want == nil {
+			if len(entries) != defaultRequestLogSize {
+				t.Errorf("%s: %d entries, want %d", test.name, len(entries), defaultRequestLogSize)
+			}
+			continue
+		}
+		paths := []string{}
+		for _, entry := range entries {
+			paths = append(paths, entry.Path)
+		}
+		if !reflect.DeepEqual(paths, test.want) {
+			t.Errorf("%s: entries = %v, want %v", test.name, paths, test.want)
+		}
+	}
+}
+
+func TestRequestLogMiddleware(t *testing.T) {
+	app := newTestApp(t, newFakeSheets(t, nil), ConfigEntry{CharacterKey: "thorin", SheetId: "sheet"})
+	app.RequestLog = NewRequestLog(10)
+	handler := app.RequestLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/thorin" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	for _, path := range []string{"/thorin", "/smaug"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	entries := app.RequestLog.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("%d entries logged, want 2", len(entries))
+	}
+	tests := []struct {
+		entry            RequestLogEntry
+		wantPath         string
+		wantCharacterKey string
+		wantStatus       int
+	}{
+		{entries[0], "/thorin", "thorin", http.StatusOK},
+		// unknown paths aren't recorded as characters
+		{entries[1], "/smaug", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if test.entry.Path != test.wantPath || test.entry.CharacterKey != test.wantCharacterKey || test.entry.Status != test.wantStatus {
+			t.Errorf("logged %+v, want path %s, characterKey %q, status %d",
+				test.entry, test.wantPath, test.wantCharacterKey, test.wantStatus)
+		}
+		if test.entry.Method != http.MethodGet || test.entry.Timestamp.IsZero() {
+			t.Errorf("logged %+v without method or timestamp", test.entry)
+		}
+	}
+}
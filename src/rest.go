@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var restClient = &http.Client{Timeout: 10 * time.Second}
+
+// RestConfig points a character at any JSON API, such as a campaign manager or a homebrew
+// tool. Each attribute's range is a JSONPath expression into the response, e.g.
+// $.stats.hp or $.inventory[?(@.equipped)].name; one that matches several values serves
+// them all, as a list for list attributes and comma-separated otherwise.
+type RestConfig struct {
+	Url string `json:"url"`
+
+	// sent with the request, e.g. an Authorization header; values can use $ENV_VAR so
+	// tokens needn't be in the config
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (config RestConfig) Validate() error {
+	parsed, err := url.Parse(config.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("rest needs an http or https url")
+	}
+	return nil
+}
+
+// RestDataSource reads characters that have a rest config.
+type RestDataSource struct {
+	app *CharacterSheetServiceApp
+}
+
+func (source RestDataSource) Fetch(ctx context.Context, charConfig ConfigEntry) (FetchedAttributes, error) {
+	document, err := source.FetchDocument(ctx, *charConfig.Rest)
+	if err != nil {
+		return FetchedAttributes{}, err
+	}
+
+	fetched := NewFetchedAttributes()
+	for _, attr := range charConfig.Attributes {
+		// the ranges were checked by ValidateSource
+		path, err := ParseJsonPath(attr.Range)
+		if err != nil {
+			fetched.Errors[attr.Name] = err.Error()
+			continue
+		}
+
+		cells := []string{}
+		for _, value := range path.Select(document) {
+			valueCells, err := DocumentValueCells(value)
+			if err != nil {
+				fetched.Errors[attr.Name] = fmt.Sprintf("'%s': %v", attr.Range, err)
+				break
+			}
+			cells = append(cells, valueCells...)
+		}
+		if _, failed := fetched.Errors[attr.Name]; !failed && len(cells) > 0 {
+			fetched.SetCells(attr, cells)
+		}
+	}
+	return fetched, nil
+}
+
+func (source RestDataSource) FetchDocument(ctx context.Context, config RestConfig) (interface{}, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	for name, value := range config.Headers {
+		request.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	response, err := restClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	host := request.URL.Host
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%s %w: %s", host, errTokenRejected, response.Status)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", host, response.Status)
+	}
+
+	var document interface{}
+	if err := json.NewDecoder(response.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JSON from %s: %v", host, err)
+	}
+	return document, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	defaultRetryMaxAttempts = 4
+	defaultRetryBackoff     = 500 * time.Millisecond
+	defaultRetryMaxBackoff  = 8 * time.Second
+)
+
+type RetryConfig struct {
+	// how many times a Sheets API read is tried before giving up; defaults to 4, and 1
+	// turns retries off
+	MaxAttempts int `json:"maxAttempts"`
+
+	// the wait before the first retry, doubling with each attempt up to MaxBackoffMs;
+	// defaults to 500ms and 8s. Each wait is randomly shortened by up to half.
+	InitialBackoffMs int `json:"initialBackoffMs"`
+	MaxBackoffMs     int `json:"maxBackoffMs"`
+}
+
+func (config RetryConfig) Validate() error {
+	if config.MaxAttempts < 0 || config.InitialBackoffMs < 0 || config.MaxBackoffMs < 0 {
+		return fmt.Errorf("retry settings can't be negative")
+	}
+	return nil
+}
+
+func (config RetryConfig) Attempts() int {
+	if config.MaxAttempts > 0 {
+		return config.MaxAttempts
+	}
+	return defaultRetryMaxAttempts
+}
+
+// SheetsRetrier spaces out retries of failed Sheets API calls. The jitter keeps instances
+// and characters that were rate-limited together from all retrying at the same instant.
+type SheetsRetrier struct {
+	config RetryConfig
+	random *rand.Rand
+	lock   sync.Mutex
+}
+
+func NewSheetsRetrier(config RetryConfig, seed int64) *SheetsRetrier {
+	return &SheetsRetrier{
+		config: config,
+		random: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Backoff is how long to wait after the given failed attempt before trying again.
+func (retrier *SheetsRetrier) Backoff(attempt int) time.Duration {
+	backoff := defaultRetryBackoff
+	if retrier.config.InitialBackoffMs > 0 {
+		backoff = time.Duration(retrier.config.InitialBackoffMs) * time.Millisecond
+	}
+	max := defaultRetryMaxBackoff
+	if retrier.config.MaxBackoffMs > 0 {
+		max = time.Duration(retrier.config.MaxBackoffMs) * time.Millisecond
+	}
+
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+
+	retrier.lock.Lock()
+	factor := retrier.random.Float64() // [0, 1)
+	retrier.lock.Unlock()
+
+	return backoff/2 + time.Duration(factor*float64(backoff/2))
+}
+
+// IsRetryableError picks out rate limiting and server-side errors, which are worth trying
+// again shortly; anything else would only fail the same way.
+func IsRetryableError(err error) bool {
+	var apiError *googleapi.Error
+	if !errors.As(err, &apiError) {
+		return false
+	}
+	return apiError.Code == http.StatusTooManyRequests || apiError.Code >= http.StatusInternalServerError
+}
+
+// CallSheetsApi makes a Sheets API call, retrying it with backoff while it fails with a
+// retryable error. The last error is returned once the attempts run out, or as soon as
+// ctx is cancelled.
+func (app *CharacterSheetServiceApp) CallSheetsApi(ctx context.Context, description string, call func() error) error {
+	maxAttempts := app.Config.Retry.Attempts()
+
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		err := call()
+		app.Stats.RecordSheetsCall(started, err)
+		if err == nil || !IsRetryableError(err) {
+			return err
+		}
+
+		if attempt >= maxAttempts {
+			if maxAttempts > 1 {
+				log.Printf("WARNING: giving up on %s after %d attempts: %v", description, attempt, err)
+				app.Stats.CountSheetsRetriesExhausted()
+			}
+			return err
+		}
+
+		backoff := app.Retrier.Backoff(attempt)
+		log.Printf("  * %s failed on attempt %d of %d (%v); retrying in %v",
+			description, attempt, maxAttempts, err, backoff.Round(time.Millisecond))
+		app.Stats.CountSheetsRetry()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestRetrierBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  RetryConfig
+		attempt int
+		max     time.Duration
+	}{
+		{"first retry", RetryConfig{}, 1, defaultRetryBackoff},
+		{"doubles", RetryConfig{}, 3, 4 * defaultRetryBackoff},
+		{"capped", RetryConfig{}, 20, defaultRetryMaxBackoff},
+		{"custom", RetryConfig{InitialBackoffMs: 100, MaxBackoffMs: 300}, 3, 300 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		retrier := NewSheetsRetrier(test.config, 1)
+		for i := 0; i < 20; i++ {
+			// jitter takes off up to half
+			if backoff := retrier.Backoff(test.attempt); backoff < test.max/2 || backoff > test.max {
+				t.Errorf("%s: Backoff(%d) = %v, want between %v and %v", test.name, test.attempt, backoff, test.max/2, test.max)
+				break
+			}
+		}
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"server error", &googleapi.Error{Code: http.StatusInternalServerError}, true},
+		{"unavailable", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"forbidden", &googleapi.Error{Code: http.StatusForbidden}, false},
+		{"bad range", &googleapi.Error{Code: http.StatusBadRequest}, false},
+		{"network", errors.New("dial tcp: connection refused"), false},
+	}
+
+	for _, test := range tests {
+		if got := IsRetryableError(test.err); got != test.want {
+			t.Errorf("%s: IsRetryableError = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCallSheetsApiRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failStatus   int
+		maxAttempts  int
+		wantRequests int
+	}{
+		{"success", 0, 3, 1},
+		{"rate limited", http.StatusTooManyRequests, 3, 3},
+		{"server error", http.StatusInternalServerError, 2, 2},
+		{"not retryable", http.StatusForbidden, 3, 1},
+		{"retries off", http.StatusServiceUnavailable, 1, 1},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.OnErrorValue = stringPointer("?")
+		app.Config.Retry.MaxAttempts = test.maxAttempts
+		fake.Fail(test.failStatus)
+		<-app.RefreshInBackground(context.Background(), "thorin")
+
+		if requests := len(fake.Requests()); requests != test.wantRequests {
+			t.Errorf("%s: %d requests, want %d", test.name, requests, test.wantRequests)
+		}
+	}
+}
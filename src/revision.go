@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// LoadGoogleDriveService creates a Drive client from the same credentials as the Sheets
+// client. It's only used to read spreadsheets' modifiedTime.
+func LoadGoogleDriveService() (*drive.Service, error) {
+	credentials, _, err := FindCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	driveService, err := drive.NewService(context.Background(), credentials)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve Drive client: %v", err)
+	}
+	log.Println("  * created Google Drive Service")
+
+	return driveService, nil
+}
+
+func (app *CharacterSheetServiceApp) DriveService() *drive.Service {
+	app.sheetServiceLock.RLock()
+	defer app.sheetServiceLock.RUnlock()
+	return app.googleDriveService
+}
+
+func (app *CharacterSheetServiceApp) SetDriveService(driveService *drive.Service) {
+	app.sheetServiceLock.Lock()
+	app.googleDriveService = driveService
+	app.sheetServiceLock.Unlock()
+}
+
+// SheetModifiedTime asks Drive when the spreadsheet was last edited. It returns "" if that
+// can't be found out, in which case the sheet is always read in full.
+func (app *CharacterSheetServiceApp) SheetModifiedTime(ctx context.Context, sheetId string) string {
+	driveService := app.DriveService()
+	if driveService == nil {
+		return ""
+	}
+
+	file, err := driveService.Files.Get(sheetId).Fields("modifiedTime").Context(ctx).Do()
+	if err != nil {
+		log.Printf("Unable to read modifiedTime of sheet '%s'; reading values anyway: %v", sheetId, err)
+		return ""
+	}
+	return file.ModifiedTime
+}
+
+// ExtendCachedEntry serves the previous values for another TTL, for a sheet that hasn't
+// changed since they were read.
+func (app *CharacterSheetServiceApp) ExtendCachedEntry(charKey string, charConfig ConfigEntry, previous *CharacterAttributeCacheEntry) {
+	now := time.Now()
+
+	entry := *previous
+	entry.UpdatingFlag = false
+	entry.FetchError = ""
+	entry.ConsecutiveFailures = 0
+	// the values were read before a failed fetch, and the sheet hasn't changed since
+	entry.Stale = false
+	entry.Expires = now.Add(app.Config.CharacterTtl(charConfig))
+	entry.RangeExpires = make(map[string]time.Time, len(charConfig.Attributes))
+	for _, attr := range charConfig.SheetAttributes() {
+		expires := app.ExpiryJitter.Apply(now.Add(app.AttributeTtl(charConfig, attr)), app.AttributeTtl(charConfig, attr))
+		entry.RangeExpires[attr.Range] = expires
+		if expires.Before(entry.Expires) {
+			entry.Expires = expires
+		}
+	}
+
+	app.UpdateCachedEntry(charKey, &entry)
+
+	log.Printf("***** sheet for '%s' unchanged since %s; extended cache *****", charKey, previous.ModifiedTime)
+}
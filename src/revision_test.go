@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestSkipUnchangedSheets(t *testing.T) {
+	tests := []struct {
+		name         string
+		modifiedTime string
+		nextModified string
+		wantReads    int
+		wantHp       string
+		wantModified string
+	}{
+		{"unchanged", "2021-10-01T19:00:00.000Z", "2021-10-01T19:00:00.000Z", 1, "12", "2021-10-01T19:00:00.000Z"},
+		{"changed", "2021-10-01T19:00:00.000Z", "2021-10-01T19:05:00.000Z", 2, "7", "2021-10-01T19:05:00.000Z"},
+		// without a modifiedTime, the values are always read
+		{"unknown", "", "", 2, "7", ""},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.SkipUnchangedSheets = true
+		app.SetDriveService(fake.DriveService(t))
+		if test.modifiedTime != "" {
+			fake.SetModifiedTime("sheet", test.modifiedTime)
+		}
+		app.PrimeCharacter("thorin")
+
+		fake.lock.Lock()
+		fake.values = map[string][][]interface{}{"B2": {{"7"}}}
+		fake.lock.Unlock()
+		if test.nextModified != "" {
+			fake.SetModifiedTime("sheet", test.nextModified)
+		}
+		app.FetchCharacterAttributes(context.Background(), "thorin")
+
+		if reads := len(fake.Requests()); reads != test.wantReads {
+			t.Errorf("%s: %d value reads, want %d", test.name, reads, test.wantReads)
+		}
+		if fake.driveRequests != 2 {
+			t.Errorf("%s: %d Drive requests, want 2", test.name, fake.driveRequests)
+		}
+		entry, _ := app.Cache.Get("thorin")
+		if hp := (*entry.Attributes)["hp"]; hp != test.wantHp {
+			t.Errorf("%s: hp = %q, want %q", test.name, hp, test.wantHp)
+		}
+		if entry.ModifiedTime != test.wantModified {
+			t.Errorf("%s: modifiedTime = %q, want %q", test.name, entry.ModifiedTime, test.wantModified)
+		}
+		if entry.UpdatingFlag {
+			t.Errorf("%s: entry still flagged as updating", test.name)
+		}
+	}
+}
+
+func TestExtendAfterFailure(t *testing.T) {
+	captureLog(t)
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.Config.SkipUnchangedSheets = true
+	app.SetDriveService(fake.DriveService(t))
+	fake.SetModifiedTime("sheet", "2021-10-01T19:00:00.000Z")
+	app.PrimeCharacter("thorin")
+
+	// Drive can't say whether it changed, so the values are read, and that fails
+	app.SetDriveService(nil)
+	fake.Fail(http.StatusServiceUnavailable)
+	app.FetchCharacterAttributes(context.Background(), "thorin")
+	if entry, _ := app.Cache.Get("thorin"); !entry.Stale {
+		t.Fatalf("entry isn't stale after a failed fetch")
+	}
+
+	// Drive reports no change, so the values are extended rather than read
+	app.SetDriveService(fake.DriveService(t))
+	fake.Fail(0)
+	app.FetchCharacterAttributes(context.Background(), "thorin")
+	entry, _ := app.Cache.Get("thorin")
+	// the read at priming, and the one that failed
+	if reads := len(fake.Requests()); reads != 2 {
+		t.Errorf("%d value reads, want 2", reads)
+	}
+	if entry.Stale || entry.FetchError != "" {
+		t.Errorf("stale, fetchError = %v, %q after the sheet was found unchanged, want false, \"\"", entry.Stale, entry.FetchError)
+	}
+	if hp := (*entry.Attributes)["hp"]; hp != "12" {
+		t.Errorf("hp = %q, want 12", hp)
+	}
+}
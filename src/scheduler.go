@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// how often the scheduler looks for cache entries that are due a refresh
+const refreshSchedulerInterval = 1 * time.Second
+
+// ScheduleRefreshes refreshes each character as its cache entry expires (or comes within
+// the refresh-ahead window of expiring), whether or not anyone is requesting it, until ctx
+// is cancelled. Entries that were evicted, or never primed, are left for the next lookup
+// to fetch, so idle characters stay evicted.
+func (app *CharacterSheetServiceApp) ScheduleRefreshes(ctx context.Context) {
+	ticker := time.NewTicker(refreshSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, charKey := range app.PrimingOrder() {
+				app.RefreshIfDue(charKey, now)
+			}
+		}
+	}
+}
+
+// RefreshIfDue starts a refresh of the character if its entry is due one. MarkUpdating only
+// succeeds for one caller, even across instances sharing a cache, so only one fetch is
+// launched.
+func (app *CharacterSheetServiceApp) RefreshIfDue(charKey string, now time.Time) {
+	entry, found := app.Cache.Get(charKey)
+	if !found || entry.Attributes == nil || entry.UpdatingFlag {
+		return
+	}
+
+	refreshAt := entry.Expires.Add(-app.Config.Cache.RefreshAheadWindow())
+	if now.Before(refreshAt) || !app.Cache.MarkUpdating(charKey) {
+		return
+	}
+
+	if now.After(entry.Expires) {
+		log.Printf("***** cache expired for '%s'; fetching update *****", charKey)
+	} else {
+		log.Printf("***** cache for '%s' expires soon; fetching update ahead *****", charKey)
+	}
+	// stopping the scheduler doesn't cut off refreshes it already started
+	app.RefreshInBackground(context.Background(), charKey)
+}
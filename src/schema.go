@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	AttributeTypeText    = "text"
+	AttributeTypeNumber  = "number"
+	AttributeTypeList    = "list"
+	AttributeTypeTable   = "table"
+	AttributeTypeDerived = "derived"
+
+	// served as JSON values of their own type, rather than strings; string is the same as text
+	AttributeTypeString = "string"
+	AttributeTypeInt    = "int"
+	AttributeTypeFloat  = "float"
+	AttributeTypeBool   = "bool"
+)
+
+// AttributeSchema describes one configured range, or derived attribute, for tooling that
+// lays out overlays without fetching any values.
+type AttributeSchema struct {
+	Name        string           `json:"name,omitempty"`
+	Names       []string         `json:"names,omitempty"`
+	Range       string           `json:"range,omitempty"`
+	Type        string           `json:"type"`
+	Format      *AttributeFormat `json:"format,omitempty"`
+	MultiValued bool             `json:"multiValued"`
+	Static      bool             `json:"static,omitempty"`
+	Default     *string          `json:"default,omitempty"`
+	States      []string         `json:"states,omitempty"`
+}
+
+// CharacterSchema lists a character's attributes straight from config, with keys styled
+// the way they're served.
+func (app *CharacterSheetServiceApp) CharacterSchema(charConfig ConfigEntry, role string) []AttributeSchema {
+	schema := []AttributeSchema{}
+	visible := charConfig.VisibleTo(role)
+
+	for _, attr := range charConfig.Attributes {
+		if len(FilterAttributeNames(attr.AttributeNames(), visible)) == 0 {
+			continue
+		}
+
+		attrSchema := AttributeSchema{
+			Range:       attr.Range,
+			Type:        AttributeTypeText,
+			Format:      attr.Format,
+			MultiValued: len(attr.Names) > 0,
+			Static:      attr.Value != nil,
+			Default:     attr.Default,
+		}
+		if attr.Type != "" {
+			attrSchema.Type = attr.Type
+		} else if attr.Format != nil || len(attr.Thresholds) > 0 {
+			attrSchema.Type = AttributeTypeNumber
+		}
+
+		if len(attr.Names) > 0 {
+			for _, name := range FilterAttributeNames(attr.Names, visible) {
+				attrSchema.Names = append(attrSchema.Names, ApplyKeyStyle(app.Config.KeyStyle, name))
+			}
+		} else {
+			attrSchema.Name = ApplyKeyStyle(app.Config.KeyStyle, attr.Name)
+		}
+
+		for _, threshold := range attr.Thresholds {
+			attrSchema.States = append(attrSchema.States, threshold.State)
+		}
+
+		schema = append(schema, attrSchema)
+	}
+
+	for _, derived := range charConfig.Derived {
+		if visible != nil && !visible[derived.Name] {
+			continue
+		}
+		attrSchema := AttributeSchema{
+			Name: ApplyKeyStyle(app.Config.KeyStyle, derived.Name),
+			Type: AttributeTypeDerived,
+		}
+		for _, rule := range derived.Rules {
+			attrSchema.States = append(attrSchema.States, rule.Label)
+		}
+		schema = append(schema, attrSchema)
+	}
+
+	return schema
+}
+
+// HandleSchemaRequest serves /<charKey>/schema from config alone, never touching the cache
+// or the Sheets API. It returns false if the path isn't a schema request.
+func (app *CharacterSheetServiceApp) HandleSchemaRequest(w http.ResponseWriter, r *http.Request, charKey string, role string) bool {
+	if _, configured := app.Characters()[charKey]; configured || !strings.HasSuffix(charKey, "/schema") {
+		return false
+	}
+
+	charConfig, configured := app.Characters()[strings.TrimSuffix(charKey, "/schema")]
+	if !configured {
+		return false
+	}
+
+	app.WriteApiResponse(w, r, ApiResponse{
+		Schema:   app.CharacterSchema(charConfig, role),
+		Metadata: NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+	return true
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCharacterSchema(t *testing.T) {
+	decimals := 0
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet",
+		Attributes: []AttributeRow{
+			{Name: "character name", Range: "B1"},
+			{Name: "hp", Range: "B2", Thresholds: []AttributeThreshold{{Max: float(5), State: "critical"}, {State: "ok"}}},
+			{Range: "B3:C3", Names: []string{"str", "dex"}, Type: AttributeTypeNumber},
+			{Name: "gold", Range: "B4", Format: &AttributeFormat{Decimals: &decimals}, Default: stringPointer("0")},
+		},
+		Derived: []DerivedAttribute{{Name: "alert", Rules: []DerivedRule{
+			{Label: "!", All: []DerivedCondition{{Attribute: "hp", Op: "<", Value: stringPointer("5")}}},
+		}}},
+	})
+	app.Config.KeyStyle = "camel"
+
+	want := []AttributeSchema{
+		{Name: "characterName", Range: "B1", Type: AttributeTypeText},
+		{Name: "hp", Range: "B2", Type: AttributeTypeNumber, States: []string{"critical", "ok"}},
+		{Names: []string{"str", "dex"}, Range: "B3:C3", Type: AttributeTypeNumber, MultiValued: true},
+		{Name: "gold", Range: "B4", Type: AttributeTypeNumber, Format: &AttributeFormat{Decimals: &decimals}, Default: stringPointer("0")},
+		{Name: "alert", Type: AttributeTypeDerived, States: []string{"!"}},
+	}
+	if got := app.CharacterSchema(app.Characters()["thorin"], PublicRole); !reflect.DeepEqual(got, want) {
+		t.Errorf("schema = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleSchemaRequest(t *testing.T) {
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "thorin-sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+		// a character may be called schema itself
+		ConfigEntry{CharacterKey: "party/schema", SheetId: "party-sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantSchema bool
+	}{
+		{"/thorin/schema", http.StatusOK, true},
+		{"/thorin/schema/", http.StatusOK, true},
+		{"/smaug/schema", http.StatusNotFound, false},
+		{"/party/schema", http.StatusOK, false},
+	}
+
+	for _, test := range tests {
+		response := getResponse(t, app, test.path)
+		if response.Metadata.StatusCode != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.path, response.Metadata.StatusCode, test.wantStatus)
+		}
+		if (len(response.Schema) > 0) != test.wantSchema {
+			t.Errorf("%s: schema = %v, want schema %v", test.path, response.Schema, test.wantSchema)
+		}
+	}
+	// the schema comes from config alone; only the character called schema is fetched
+	if got, want := fake.SheetIds(), []string{"party-sheet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fetched %v serving schemas, want %v", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultPort             = 9090
+	defaultAutocertCacheDir = "autocert-cache"
+)
+
+type ServerConfig struct {
+	// interface to listen on, e.g. "127.0.0.1"; all of them when left out
+	Address string `json:"address"`
+
+	// defaults to 9090
+	Port int `json:"port"`
+
+	// serve HTTPS with this certificate and key...
+	TlsCertFile string `json:"tlsCertFile"`
+	TlsKeyFile  string `json:"tlsKeyFile"`
+
+	// ...or with a Let's Encrypt certificate for this domain, which must reach the service
+	// on port 443. Certificates are kept in AutocertCacheDir (default autocert-cache).
+	AutocertDomain   string `json:"autocertDomain"`
+	AutocertCacheDir string `json:"autocertCacheDir"`
+}
+
+func (config ServerConfig) Validate() error {
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("server port %d is out of range", config.Port)
+	}
+	if (config.TlsCertFile == "") != (config.TlsKeyFile == "") {
+		return fmt.Errorf("server needs both tlsCertFile and tlsKeyFile, or neither")
+	}
+	if config.TlsCertFile != "" && config.AutocertDomain != "" {
+		return fmt.Errorf("server can use tlsCertFile or autocertDomain, but not both")
+	}
+	return nil
+}
+
+func (config ServerConfig) ListenAddress() string {
+	port := config.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(config.Address, strconv.Itoa(port))
+}
+
+// ListenAndServe serves plain HTTP, or HTTPS when a certificate or autocert domain is
+// configured.
+func (config ServerConfig) ListenAndServe(server *http.Server) error {
+	switch {
+	case config.TlsCertFile != "":
+		log.Printf("  * serving HTTPS with %s", config.TlsCertFile)
+		return server.ListenAndServeTLS(config.TlsCertFile, config.TlsKeyFile)
+	case config.AutocertDomain != "":
+		cacheDir := config.AutocertCacheDir
+		if cacheDir == "" {
+			cacheDir = defaultAutocertCacheDir
+		}
+		log.Printf("  * serving HTTPS for %s with Let's Encrypt certificates", config.AutocertDomain)
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(config.AutocertDomain),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		return server.ListenAndServeTLS("", "")
+	default:
+		return server.ListenAndServe()
+	}
+}
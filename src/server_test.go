@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  ServerConfig
+		wantErr string
+	}{
+		{"defaults", ServerConfig{}, ""},
+		{"address and port", ServerConfig{Address: "127.0.0.1", Port: 8443}, ""},
+		{"highest port", ServerConfig{Port: 65535}, ""},
+		{"negative port", ServerConfig{Port: -1}, "out of range"},
+		{"port too high", ServerConfig{Port: 65536}, "out of range"},
+		{"certificate and key", ServerConfig{TlsCertFile: "cert.pem", TlsKeyFile: "key.pem"}, ""},
+		{"certificate without a key", ServerConfig{TlsCertFile: "cert.pem"}, "both tlsCertFile and tlsKeyFile"},
+		{"key without a certificate", ServerConfig{TlsKeyFile: "key.pem"}, "both tlsCertFile and tlsKeyFile"},
+		{"autocert", ServerConfig{AutocertDomain: "sheets.example.com", AutocertCacheDir: "certs"}, ""},
+		{"certificate and autocert", ServerConfig{TlsCertFile: "cert.pem", TlsKeyFile: "key.pem", AutocertDomain: "sheets.example.com"}, "not both"},
+	}
+
+	for _, test := range tests {
+		// through the service config, as it's checked at startup
+		config := ServiceConfig{Server: test.server}
+		err := config.Validate()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		server ServerConfig
+		want   string
+	}{
+		{ServerConfig{}, ":9090"},
+		{ServerConfig{Port: 8080}, ":8080"},
+		{ServerConfig{Address: "127.0.0.1"}, "127.0.0.1:9090"},
+		{ServerConfig{Address: "::1", Port: 443}, "[::1]:443"},
+	}
+
+	for _, test := range tests {
+		if got := test.server.ListenAddress(); got != test.want {
+			t.Errorf("ListenAddress() of %+v = %q, want %q", test.server, got, test.want)
+		}
+	}
+}
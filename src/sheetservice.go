@@ -3,15 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"google.golang.org/api/option"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/sheets/v4"
 )
 
@@ -19,127 +28,326 @@ type ApiConfig struct {
 	ApiKey string `json:"apiKey"`
 }
 
-type AttributeRow struct {
-	Name  string `json:"name"`
-	Range string `json:"range"`
-}
+// how long clients are asked to wait before retrying a character that isn't primed yet
+const primingRetryAfterSeconds = 5
 
-type ConfigEntry struct {
-	CharacterKey string         `json:"characterKey"`
-	SheetId      string         `json:"sheetId"`
-	Attributes   []AttributeRow `json:"attributes"`
-}
+// the longest a long-poll request may be held open with ?wait=
+const maxLongPollSeconds = 120
 
 type CharacterSheetServiceApp struct {
-	Characters         map[string]ConfigEntry
-	ValidUrls          []string
-	GoogleSheetService *sheets.Service
-	Cache              CharacterAttributeCache
+	Config          ServiceConfig
+	Cache           Cache
+	Notifier        *AttributeChangeNotifier
+	ExpiryJitter    *ExpiryJitter
+	Retrier         *SheetsRetrier
+	IdleTracker     *IdleTracker
+	Clock           func() time.Time
+	ErrorTemplate   *template.Template
+	Stats           *ServiceStats
+	RequestLog      *RequestLog
+	Refreshes       sync.WaitGroup
+	Fetches         FetchGroup
+	StopRefreshes   context.CancelFunc
+	StopScheduler   context.CancelFunc
+	ShutdownTracing func(context.Context) error
+
+	// 1 while maintenance mode is on; see InMaintenance()
+	maintenance int32
+
+	// 1 once startup priming has finished; see ReadinessChecks()
+	primed int32
+
+	// cancelled on shutdown, to stop fetches that won't finish in time
+	refreshesCtx context.Context
+
+	// swapped out when credentials are reloaded; use SheetService() and DriveService()
+	googleSheetService *sheets.Service
+	googleDriveService *drive.Service
+	sheetServiceLock   sync.RWMutex
+
+	// charKey -> *sync.Mutex held while a character is written to, or a value is read,
+	// changed and written back; see LockCharacterWrites
+	writeLocks sync.Map
+
+	// the last known named ranges and tabs of each sheet; see FetchSheetLayout
+	sheetLayouts     map[string]*SheetLayout
+	sheetLayoutsLock sync.Mutex
+
+	// swapped out when the config is reloaded; use Characters(), ValidUrls() and
+	// PrimingOrder()
+	characters     map[string]ConfigEntry
+	validUrls      []string
+	primingOrder   []string
+	charactersLock sync.RWMutex
+
+	// where the config was read from, if it can be reloaded; see HandleAdminReload
+	configFile string
+	configDir  string
+
+	// where attributes are read from: Google Sheets, or the demo attributes
+	Source DataSource
+
+	// when set, attributes are served from here instead of Google Sheets
+	DemoAttributes map[string]map[string]string
+}
+
+type CommandLineOptions struct {
+	Example    bool
+	Demo       bool
+	ConfigFile string
+	ConfigDir  string
+
+	// override the server address and port from the config
+	Address string
+	Port    int
 }
 
 type ResponseMetadata struct {
+	ApiVersion       string     `json:"apiVersion"`
 	StatusCode       int        `json:"statusCode"`
 	StatusMessage    string     `json:"statusMessage"`
 	ErrorMessage     string     `json:"errorMessage,omitempty"`
+	Truncated        bool       `json:"truncated,omitempty"`
 	RequestUri       string     `json:"request"`
 	RequestTimestamp *time.Time `json:"requestTimestamp"`
-}
 
-type ApiResponse struct {
-	Attributes    *map[string]string `json:"attributes,omitempty"`
-	CharacterUrls []string           `json:"characterUrls,omitempty"`
-	Metadata      ResponseMetadata   `json:"metadata"`
-}
+	// FetchFailed means the sheet couldn't be read and the attributes are the onErrorValue,
+	// Stale that it couldn't be read and the attributes are the last ones that were, and
+	// DefaultedAttributes lists attributes whose cells were empty.
+	FetchFailed         bool     `json:"fetchFailed,omitempty"`
+	Stale               bool     `json:"stale,omitempty"`
+	DefaultedAttributes []string `json:"defaultedAttributes,omitempty"`
+
+	// why the last refresh failed, if it did: "auth" or "transient"
+	FetchError string `json:"fetchError,omitempty"`
+
+	// the attributes are withheld because maintenance mode is on
+	Maintenance bool `json:"maintenance,omitempty"`
 
-type CharacterAttributeCache struct {
-	cacheMap map[string]*CharacterAttributeCacheEntry
-	lock     sync.RWMutex
+	// attribute name -> why it couldn't be read on the last refresh
+	AttributeErrors map[string]string `json:"attributeErrors,omitempty"`
 }
 
-type CharacterAttributeCacheEntry struct {
-	Attributes   *map[string]string
-	Expires      time.Time
-	UpdatingFlag bool
+// NamedAttribute is one entry of the attributes array served for ?format=array. Value is a
+// string, or an array for list and table attributes.
+type NamedAttribute struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
 }
 
-func LoadCharacterSheetConfig() map[string]ConfigEntry {
-	log.Println("-- loading character configuration")
+type ApiResponse struct {
+	// a *map[string]string, or a []NamedAttribute for ?format=array; characters with list
+	// or table attributes get a map[string]interface{} instead
+	Attributes    interface{}                   `json:"attributes,omitempty"`
+	States        map[string]string             `json:"states,omitempty"`
+	Suggestions   []string                      `json:"suggestions,omitempty"`
+	CharacterUrls []string                      `json:"characterUrls,omitempty"`
+	Cache         map[string]CacheSnapshotEntry `json:"cache,omitempty"`
+	Stats         *StatsSnapshot                `json:"stats,omitempty"`
+	RequestLog    []RequestLogEntry             `json:"requestLog,omitempty"`
+	Schema        []AttributeSchema             `json:"schema,omitempty"`
+	Party         map[string]PartyMember        `json:"party,omitempty"`
+	Checks        map[string]string             `json:"checks,omitempty"`
+	Metadata      ResponseMetadata              `json:"metadata"`
+}
 
-	fileBytes, err := ioutil.ReadFile("config.json")
-	if err != nil {
-		log.Fatalf("Unable to read config file: %v", err)
-	}
+// LoadGoogleSheetService finds the first available credentials and creates a Sheets client
+// from them.
+func LoadGoogleSheetService() (*sheets.Service, error) {
+	log.Println("-- connecting to Google Sheet API")
 
-	var config []ConfigEntry
+	ctx := context.Background()
 
-	err = json.Unmarshal([]byte(fileBytes), &config)
+	credentials, description, err := FindCredentials()
 	if err != nil {
-		log.Fatalf("Invalid config.json: %v", err)
+		return nil, err
 	}
+	log.Printf("  * loaded credentials from %s", description)
 
-	configMap := make(map[string]ConfigEntry, len(config))
-	for _, configEntry := range config {
-		log.Printf("  * loaded config for '%s'\n", configEntry.CharacterKey)
-		configMap[configEntry.CharacterKey] = configEntry
+	googleSheetService, err := sheets.NewService(ctx, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve Sheets client: %v", err)
 	}
+	log.Println("  * created Google Sheet Service")
 
-	return configMap
+	return googleSheetService, nil
 }
 
-func NewGoogleSheetService() *sheets.Service {
-	log.Println("-- connecting to Google Sheet API")
+func (app *CharacterSheetServiceApp) SheetService() *sheets.Service {
+	app.sheetServiceLock.RLock()
+	defer app.sheetServiceLock.RUnlock()
+	return app.googleSheetService
+}
 
-	ctx := context.Background()
+// SetSheetService swaps the Sheets client; fetches already in flight finish on the old one.
+func (app *CharacterSheetServiceApp) SetSheetService(googleSheetService *sheets.Service) {
+	app.sheetServiceLock.Lock()
+	app.googleSheetService = googleSheetService
+	app.sheetServiceLock.Unlock()
+}
 
-	fileBytes, err := ioutil.ReadFile("api-key.json")
-	if err != nil {
-		log.Fatalf("Unable to read API config file: %v", err)
+func NewCharacterSheetApp(options CommandLineOptions) *CharacterSheetServiceApp {
+	// an explicit file wins, then $CONFIG_JSON, then stdin, then ./config.json
+	var config ServiceConfig
+	configFile, configDir := "", ""
+	if options.Demo {
+		config = LoadDemoConfig()
+	} else if options.ConfigFile != "" && options.ConfigFile != "-" {
+		config = LoadServiceConfig(options.ConfigFile)
+		configFile = options.ConfigFile
+	} else if options.ConfigDir != "" {
+		config = LoadServiceConfigDir(options.ConfigDir)
+		configDir = options.ConfigDir
+	} else if os.Getenv(configJsonEnv) != "" {
+		config = LoadServiceConfigEnv()
+	} else if options.ConfigFile == "-" {
+		config = LoadServiceConfig("-")
+	} else {
+		config = LoadServiceConfig("config.json")
+		configFile = "config.json"
 	}
 
-	var apiConfig ApiConfig
+	if options.Address != "" {
+		config.Server.Address = options.Address
+	}
+	if options.Port != 0 {
+		config.Server.Port = options.Port
+	}
 
-	err = json.Unmarshal([]byte(fileBytes), &apiConfig)
-	if err != nil {
-		log.Fatalf("Invalid api-key.json: %v", err)
+	app := CharacterSheetServiceApp{
+		Config:          config,
+		Notifier:        NewAttributeChangeNotifier(),
+		ExpiryJitter:    NewExpiryJitter(config.Cache.ExpiryJitterPercent, time.Now().UnixNano()),
+		Retrier:         NewSheetsRetrier(config.Retry, time.Now().UnixNano()),
+		IdleTracker:     NewIdleTracker(),
+		ErrorTemplate:   LoadErrorTemplate(config.ErrorTemplate),
+		Stats:           NewServiceStats(),
+		RequestLog:      NewRequestLog(config.RequestLogSize),
+		ShutdownTracing: InitTracing(config.Tracing),
+		configFile:      configFile,
+		configDir:       configDir,
 	}
-	log.Println("  * loaded key from api-key.json")
 
-	googleSheetService, err := sheets.NewService(ctx, option.WithAPIKey(apiConfig.ApiKey))
-	if err != nil {
-		log.Fatalf("Unable to retrieve Sheets client: %v", err)
+	app.refreshesCtx, app.StopRefreshes = context.WithCancel(context.Background())
+
+	ConfigureLogging(config.Logging)
+	ConfigureResponseSigning(config.SigningKey)
+	ConfigureCredentialScopes(config.WriteBack)
+
+	if options.Demo {
+		app.DemoAttributes = LoadDemoAttributes()
+		app.Source = MapDataSource(app.DemoAttributes)
+	} else if !config.UsesGoogleSheets() {
+		app.Source = SheetsDataSource{app: &app}
+		log.Println("  * every character is read from a local file; not connecting to Google")
+	} else {
+		app.Source = SheetsDataSource{app: &app}
+		googleSheetService, err := LoadGoogleSheetService()
+		if err == nil && config.SkipUnchangedSheets {
+			var driveService *drive.Service
+			driveService, err = LoadGoogleDriveService()
+			app.SetDriveService(driveService)
+		}
+		if err != nil {
+			if !config.Degraded() {
+				log.Fatalf("%v", err)
+			}
+			log.Printf("!!! %v; starting degraded until credentials are reloaded", err)
+		}
+		app.SetSheetService(googleSheetService)
 	}
-	log.Println("  * created Google Sheet Service")
 
-	return googleSheetService
-}
+	app.SetCharacters(config)
 
-func NewCharacterSheetApp() *CharacterSheetServiceApp {
-	app := CharacterSheetServiceApp{
-		Characters:         LoadCharacterSheetConfig(),
-		GoogleSheetService: NewGoogleSheetService(),
+	// create the cache backend for the purpose of cacheing character attributes
+	app.Cache = NewCache(config.Cache, len(app.Characters()))
+
+	primingOrder := app.PrimingOrder()
+
+	app.PrimeCache(primingOrder)
+
+	var schedulerCtx context.Context
+	schedulerCtx, app.StopScheduler = context.WithCancel(context.Background())
+	go app.ScheduleRefreshes(schedulerCtx)
+
+	// the bot stops with the scheduler, so it doesn't answer from a cache being shut down
+	if config.Twitch.Enabled() {
+		log.Printf("  * answering chat commands in #%s", config.Twitch.Channel)
+		go app.NewTwitchBot(config.Twitch).Run(schedulerCtx)
+	}
+
+	if config.Obs.Enabled() {
+		log.Printf("  * controlling OBS at %s", config.Obs.Url)
+		go app.RunObsController(schedulerCtx, config.Obs)
 	}
 
-	// create a map for the purpose of cacheing character attributes
-	app.Cache = CharacterAttributeCache{
-		cacheMap: make(map[string]*CharacterAttributeCacheEntry, len(app.Characters)),
+	if config.Discord.Enabled() {
+		go func() {
+			if err := RegisterDiscordCommands(config.Discord); err != nil {
+				log.Printf("WARNING: unable to register discord commands: %v", err)
+				return
+			}
+			log.Printf("  * registered the /%s discord command", discordCommandName)
+		}()
 	}
 
-	// build list of character keys from map
-	for key := range app.Characters {
-		// create relative link to character endpoint
-		app.ValidUrls = append(app.ValidUrls, "/"+key)
+	if config.Snapshot.Path != "" && config.Snapshot.IntervalSeconds > 0 {
+		log.Printf("  * writing cache snapshot to %s every %ds", config.Snapshot.Path, config.Snapshot.IntervalSeconds)
+		go app.WriteCacheSnapshots(config.Snapshot.Path, time.Duration(config.Snapshot.IntervalSeconds)*time.Second)
+	}
 
-		// prime cache by fetching values for character
-		log.Printf("-- Querying attributes for '%s'... ", key)
-		app.FetchCharacterAttributesFromSheetsApi(key)
+	// primed characters count as accessed, so ones nobody asks for are evicted in turn
+	if window := config.Cache.IdleWindow(); window > 0 {
+		log.Printf("  * evicting characters idle for %v", window)
+		for _, key := range primingOrder {
+			app.IdleTracker.Touch(key, time.Now())
+		}
+		go app.EvictIdleCharacters(window)
 	}
 
 	return &app
 }
 
+// PrimeCache fetches values for each character, in the order given. Optionally only the
+// characters that have a priority are waited for, and the rest are fetched once the
+// server is running.
+func (app *CharacterSheetServiceApp) PrimeCache(primingOrder []string) {
+	deferredKeys := []string{}
+	for _, key := range primingOrder {
+		if app.Config.ReadyAfterPriorityPrimed && app.Characters()[key].Priority <= 0 {
+			deferredKeys = append(deferredKeys, key)
+			continue
+		}
+		app.PrimeCharacter(key)
+	}
+	atomic.StoreInt32(&app.primed, 1)
+	if len(deferredKeys) > 0 {
+		app.Refreshes.Add(1)
+		go func() {
+			defer app.Refreshes.Done()
+			for _, key := range deferredKeys {
+				app.PrimeCharacter(key)
+			}
+		}()
+	}
+}
+
+// PrimeCharacter fetches a character at startup. Credentials that are rejected won't fix
+// themselves, so unless startupMode is degraded, that stops the service; other failures
+// are served as stale or fetchFailed until a later refresh succeeds.
+func (app *CharacterSheetServiceApp) PrimeCharacter(charKey string) {
+	log.Printf("-- Querying attributes for '%s'... ", charKey)
+	<-app.RefreshInBackground(context.Background(), charKey)
+
+	if entry, found := app.Cache.Get(charKey); found && entry.FetchError == FetchErrorAuth && !app.Config.Degraded() {
+		log.Fatalf("Google rejected the credentials while fetching '%s'; check api-key.json", charKey)
+	}
+}
+
 func NewMetadata(requestPath string, httpStatusCode int, errorMessage string) ResponseMetadata {
 	now := time.Now()
 	return ResponseMetadata{
+		ApiVersion:       currentApiVersion,
 		StatusCode:       httpStatusCode,
 		StatusMessage:    http.StatusText(httpStatusCode),
 		ErrorMessage:     errorMessage,
@@ -148,145 +356,772 @@ func NewMetadata(requestPath string, httpStatusCode int, errorMessage string) Re
 	}
 }
 
+// WriteApiResponseJson relies on encoding/json sorting map keys, and on every slice in the
+// response being built in a fixed order, so identical data always encodes to identical bytes.
 func WriteApiResponseJson(w http.ResponseWriter, response ApiResponse) {
 	responseJson, _ := json.MarshalIndent(response, "", "  ")
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*") // CORS allow everything
+	if response.HasETag() {
+		SetETagHeader(w, AttributesETag(response))
+	}
+	SetSignatureHeader(w, responseJson)
 	w.WriteHeader(response.Metadata.StatusCode)
 	w.Write(responseJson)
 
 	message := response.Metadata.ErrorMessage
-	if message == "" {
+	if message == "" && response.Party != nil {
+		message = fmt.Sprintf("%d characters", len(response.Party))
+	} else if message == "" && response.Checks != nil {
+		bytes, _ := json.Marshal(response.Checks)
+		message = string(bytes)
+	} else if message == "" {
 		bytes, _ := json.Marshal(response.Attributes)
 		message = string(bytes)
 	}
 	log.Printf("--- request: %s -> %s", response.Metadata.RequestUri, message)
 }
 
-func NewCachedEntry(charAttributes *map[string]string) *CharacterAttributeCacheEntry {
-	return &CharacterAttributeCacheEntry{
-		Attributes:   charAttributes,
-		Expires:      time.Now().Add(30 * time.Second),
-		UpdatingFlag: false,
+// FetchCharacterAttributes refreshes a character's cache entry from the data source. If it
+// can't be read, the error is recorded on the entry, which keeps the last good values, and
+// returned. Call it through RefreshInBackground, so only one fetch per character is ever
+// in flight.
+func (app *CharacterSheetServiceApp) FetchCharacterAttributes(ctx context.Context, charKey string) error {
+	charConfig := app.Characters()[charKey]
+
+	// attributes can have their own TTLs, so only the ranges that have expired are fetched;
+	// everything else is carried over from the previous entry
+	now := time.Now()
+	previous, found := app.Cache.Get(charKey)
+	if !found || previous.Attributes == nil || previous.FetchFailed {
+		previous = nil
 	}
-}
 
-func (cache *CharacterAttributeCache) Get(charKey string) (*CharacterAttributeCacheEntry, bool) {
-	cache.lock.RLock()
-	entry, found := cache.cacheMap[charKey]
-	cache.lock.RUnlock()
+	// when the data hasn't changed since the last read, there's nothing new in it
+	source := app.SourceFor(charConfig)
+	modifiedTime := ""
+	if versioned, ok := source.(VersionedDataSource); ok {
+		modifiedTime = versioned.Version(ctx, charConfig)
+		if previous != nil && modifiedTime != "" && modifiedTime == previous.ModifiedTime {
+			app.ExtendCachedEntry(charKey, charConfig, previous)
+			return nil
+		}
+	}
 
-	if !found {
-		return nil, false
+	// static attributes are never fetched
+	fetchConfig := charConfig
+	fetchConfig.Attributes = []AttributeRow{}
+	for _, attr := range charConfig.SheetAttributes() {
+		if previous == nil || !now.Before(previous.RangeExpires[attr.Range]) {
+			fetchConfig.Attributes = append(fetchConfig.Attributes, attr)
+		}
 	}
-	return entry, true
+	if len(fetchConfig.Attributes) == 0 {
+		fetchConfig.Attributes = charConfig.SheetAttributes()
+	}
+
+	fetched, err := source.Fetch(ctx, fetchConfig)
+	if err != nil {
+		// cancelled by shutdown, not a failure of the sheet; keep the last values
+		if ctx.Err() != nil {
+			return err
+		}
+		app.UpdateCachedEntryAfterFetchError(charKey, charConfig, IsAuthError(err))
+		return err
+	}
+
+	// headers ranges are only named once they've been read; ranges that weren't read this
+	// time keep the names they had
+	headerNames := map[string][]string{}
+	if previous != nil {
+		for cellRange, names := range previous.HeaderNames {
+			headerNames[cellRange] = names
+		}
+	}
+	for cellRange, names := range fetched.HeaderNames {
+		headerNames[cellRange] = names
+	}
+	if len(headerNames) > 0 {
+		charConfig = charConfig.WithHeaderNames(headerNames)
+		fetchConfig = fetchConfig.WithHeaderNames(headerNames)
+	}
+
+	// start from the previous values, minus anything that's about to be refetched
+	charMap := make(map[string]string, len(charConfig.Attributes))
+	rawMap := make(map[string]string, len(charConfig.Attributes))
+	defaulted := []string{}
+	rangeExpires := make(map[string]time.Time, len(charConfig.Attributes))
+	if previous != nil {
+		refetched := map[string]bool{}
+		for _, name := range fetchConfig.AttributeNames() {
+			refetched[name] = true
+		}
+		for _, name := range charConfig.AttributeNames() {
+			if value, found := (*previous.Attributes)[name]; found && !refetched[name] {
+				charMap[name] = value
+			}
+			if raw, found := previous.RawAttributes[name]; found && !refetched[name] {
+				rawMap[name] = raw
+			}
+		}
+		for _, name := range previous.DefaultedAttributes {
+			if !refetched[name] {
+				defaulted = append(defaulted, name)
+			}
+		}
+		for _, attr := range charConfig.Attributes {
+			if expires, found := previous.RangeExpires[attr.Range]; found {
+				rangeExpires[attr.Range] = expires
+			}
+		}
+	}
+
+	for _, attr := range fetchConfig.Attributes {
+		rangeExpires[attr.Range] = app.ExpiryJitter.Apply(now.Add(app.AttributeTtl(charConfig, attr)), app.AttributeTtl(charConfig, attr))
+
+		// the raw values are kept alongside the transformed values for ?raw=true
+		for _, name := range attr.AttributeNames() {
+			_, failed := fetched.Errors[name]
+			if raw, found := fetched.Values[name]; found {
+				rawMap[name] = raw
+				charMap[name] = app.TransformAttributeValue(attr, raw)
+			} else if failed && previous != nil && previous.HasAttribute(name) {
+				charMap[name] = (*previous.Attributes)[name]
+				if raw, found := previous.RawAttributes[name]; found {
+					rawMap[name] = raw
+				}
+			} else if attr.Default != nil {
+				charMap[name] = *attr.Default
+				defaulted = append(defaulted, name)
+			} else if emptyValue := app.Config.EmptyValueFor(charConfig); emptyValue != nil {
+				charMap[name] = *emptyValue
+			} else if len(attr.Names) == 0 && !failed {
+				log.Println("No data found.")
+			}
+		}
+	}
+
+	app.ApplyStaticAttributes(charConfig, charMap, rawMap)
+	ApplyDerivedAttributes(charConfig, charMap)
+
+	truncated := fetched.Truncated
+	if TruncateAttributes(charConfig, charMap, app.Config.Limits.ResponseBytes()) {
+		log.Printf("WARNING: attributes for '%s' exceed %d bytes; truncating",
+			charKey, app.Config.Limits.ResponseBytes())
+		truncated = true
+	}
+	TruncateAttributes(charConfig, rawMap, app.Config.Limits.ResponseBytes())
+
+	entry := NewCachedEntry(&charMap, app.Config.CharacterTtl(charConfig))
+	entry.RawAttributes = rawMap
+	entry.Truncated = truncated
+	entry.DefaultedAttributes = charConfig.InConfigOrder(defaulted)
+	entry.RangeExpires = rangeExpires
+	entry.ModifiedTime = modifiedTime
+	if len(headerNames) > 0 {
+		entry.HeaderNames = headerNames
+	}
+	if len(fetched.Errors) > 0 {
+		entry.AttributeErrors = fetched.Errors
+	}
+
+	// the character as a whole is due for a refresh as soon as any of its ranges is
+	for _, expires := range rangeExpires {
+		if expires.Before(entry.Expires) {
+			entry.Expires = expires
+		}
+	}
+
+	app.UpdateCachedEntry(charKey, entry)
+
+	log.Printf("***** done updating cache for '%s' (%d of %d ranges fetched) *****",
+		charKey, len(fetchConfig.Attributes), len(charConfig.SheetAttributes()))
+	return nil
 }
 
-func (cache *CharacterAttributeCache) Set(charKey string, entry *CharacterAttributeCacheEntry) {
-	cache.lock.Lock()
-	cache.cacheMap[charKey] = entry
-	cache.lock.Unlock()
+// BatchGetValueRanges reads every attribute's range, returning value ranges in the same
+// order as the attributes. Ranges are batched into one call per value render option.
+func (app *CharacterSheetServiceApp) BatchGetValueRanges(ctx context.Context, charConfig ConfigEntry) ([]*sheets.ValueRange, error) {
+	renderOptions := []string{}
+	indexesByOption := map[string][]int{}
+	valueRanges := make([]*sheets.ValueRange, len(charConfig.Attributes))
+	for i, attr := range charConfig.Attributes {
+		// attributes that only want the cell's note have no values to read, and named ranges
+		// the sheet doesn't have can't be
+		if attr.Read == ReadNote || attr.Range == "" {
+			valueRanges[i] = &sheets.ValueRange{Range: attr.Range}
+			continue
+		}
+
+		renderOption := attr.ValueRenderOption
+		if renderOption == "" {
+			renderOption = app.Config.ValueRenderOption
+		}
+		if _, found := indexesByOption[renderOption]; !found {
+			renderOptions = append(renderOptions, renderOption)
+		}
+		indexesByOption[renderOption] = append(indexesByOption[renderOption], i)
+	}
+
+	for _, renderOption := range renderOptions {
+		// Construct array of ranges to call from sheet in batch
+		ranges := []string{}
+		for _, i := range indexesByOption[renderOption] {
+			ranges = append(ranges, charConfig.Attributes[i].Range)
+		}
+
+		sheetService := app.SheetService()
+		if sheetService == nil {
+			return nil, errNoCredentials
+		}
+		call := sheetService.Spreadsheets.Values.BatchGet(charConfig.SheetId).Ranges(ranges...)
+		if renderOption != "" {
+			call = call.ValueRenderOption(renderOption)
+		}
+		var batchResp *sheets.BatchGetValuesResponse
+		err := app.CallSheetsApi(ctx, fmt.Sprintf("reading sheet %s", charConfig.SheetId), func() error {
+			var err error
+			batchResp, err = call.Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for j, i := range indexesByOption[renderOption] {
+			if j < len(batchResp.ValueRanges) {
+				valueRanges[i] = batchResp.ValueRanges[j]
+			}
+		}
+	}
+
+	return valueRanges, nil
 }
 
-func (app *CharacterSheetServiceApp) FetchCharacterAttributesFromSheetsApi(charKey string) {
-	charConfig := app.Characters[charKey]
+// CellString converts a cell from the Sheets API to a string. Unformatted numbers arrive
+// as float64, which %v would print in exponent form once they're large enough.
+func CellString(cell interface{}) string {
+	if number, ok := cell.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", cell)
+}
 
-	// Construct array of ranges to call from sheet in batch
-	ranges := []string{}
+func (app *CharacterSheetServiceApp) ApplyStaticAttributes(charConfig ConfigEntry, charMap map[string]string, rawMap map[string]string) {
 	for _, attr := range charConfig.Attributes {
-		ranges = append(ranges, attr.Range)
+		if attr.Value != nil {
+			rawMap[attr.Name] = *attr.Value
+			charMap[attr.Name] = app.TransformAttributeValue(attr, *attr.Value)
+		}
 	}
+}
 
-	// Query sheet for list of ranges
-	batchResp, err := app.GoogleSheetService.Spreadsheets.Values.BatchGet(charConfig.SheetId).Ranges(ranges...).Do()
-	if err != nil {
-		log.Fatalf("Unable to retrieve data from sheet: %v", err)
+// TransformAttributeValue turns a raw cell string into the value that's served.
+func (app *CharacterSheetServiceApp) TransformAttributeValue(attr AttributeRow, raw string) string {
+	if attr.IsArray() {
+		return app.TransformCells(attr, raw)
 	}
+	if attr.IsTyped() {
+		return CanonicalTypedValue(attr, raw)
+	}
+	value := FormatAttributeValue(attr.Format, app.Config.Locale, raw)
+	return TruncateValue(value, attr.MaxLength, attr.Ellipsis)
+}
 
-	// map ranges to names from config attributes
-	charMap := make(map[string]string, len(charConfig.Attributes))
-	for i, attr := range charConfig.Attributes {
-		valueRange := batchResp.ValueRanges[i]
-		if len(valueRange.Values) == 0 {
-			log.Println("No data found.")
-		} else {
-			charMap[attr.Name] = fmt.Sprintf("%v", valueRange.Values[0][0])
+func (app *CharacterSheetServiceApp) AttributeTtl(charConfig ConfigEntry, attr AttributeRow) time.Duration {
+	if attr.TtlSeconds > 0 {
+		return time.Duration(attr.TtlSeconds) * time.Second
+	}
+	return app.Config.CharacterTtl(charConfig)
+}
+
+// UpdateCachedEntryAfterFetchError keeps serving the last good attributes if there are any,
+// and otherwise fills every attribute with the configured onErrorValue.
+func (app *CharacterSheetServiceApp) UpdateCachedEntryAfterFetchError(charKey string, charConfig ConfigEntry, authFailure bool) {
+	var entry *CharacterAttributeCacheEntry
+
+	previous, found := app.Cache.Get(charKey)
+	if found && previous.Attributes != nil && !previous.FetchFailed {
+		// try again after another TTL
+		entry = NewCachedEntry(previous.Attributes, app.Config.CharacterTtl(charConfig))
+		entry.Truncated = previous.Truncated
+		entry.DefaultedAttributes = previous.DefaultedAttributes
+		entry.RawAttributes = previous.RawAttributes
+		entry.ModifiedTime = previous.ModifiedTime
+		entry.HeaderNames = previous.HeaderNames
+		entry.Stale = true
+	} else {
+		// degraded mode may have no onErrorValue to fill in
+		errorValue := ""
+		if app.Config.OnErrorValue != nil {
+			errorValue = *app.Config.OnErrorValue
 		}
+		charMap := make(map[string]string, len(charConfig.Attributes))
+		for _, name := range charConfig.AttributeNames() {
+			charMap[name] = errorValue
+		}
+		entry = NewCachedEntry(&charMap, app.Config.CharacterTtl(charConfig))
+		entry.FetchFailed = true
+	}
+
+	entry.FetchError = FetchErrorTransient
+	if authFailure {
+		entry.FetchError = FetchErrorAuth
+	}
+	app.Stats.CountFetchError(charKey, entry.FetchError)
+
+	// back off while the failures keep coming, rather than retrying every TTL
+	entry.ConsecutiveFailures = 1
+	if found {
+		entry.ConsecutiveFailures = previous.ConsecutiveFailures + 1
 	}
+	backoff := app.Config.Cache.FailureBackoff(app.Config.CharacterTtl(charConfig), entry.ConsecutiveFailures)
+	entry.Expires = time.Now().Add(backoff)
+	log.Printf("  * %d consecutive failures for '%s'; retrying in %v", entry.ConsecutiveFailures, charKey, backoff)
+
+	app.UpdateCachedEntry(charKey, entry)
+}
 
-	entry := NewCachedEntry(&charMap)
+func (app *CharacterSheetServiceApp) UpdateCachedEntry(charKey string, entry *CharacterAttributeCacheEntry) {
+	previous, found := app.Cache.Get(charKey)
 
+	// per-range expiries are already jittered when they're set
+	if len(entry.RangeExpires) == 0 {
+		entry.Expires = app.ExpiryJitter.Apply(entry.Expires, app.Config.CharacterTtl(app.Characters()[charKey]))
+	}
 	app.Cache.Set(charKey, entry)
+	app.Stats.RecordRefresh(charKey, time.Now())
+
+	if !found || previous.Attributes == nil || !AttributesEqual(*previous.Attributes, *entry.Attributes) {
+		app.Notifier.Notify(charKey)
+	}
+
+	// the first read of a character isn't a change
+	if found && previous.Attributes != nil && entry.Attributes != nil {
+		if changes := AttributeChanges(charKey, *previous.Attributes, *entry.Attributes); len(changes) > 0 {
+			app.SendWebhooks(changes)
+			app.AnnounceToDiscord(changes)
+		}
+	}
+}
+
+// SelectSingleValue picks the value of a single-value attribute from its range, which
+// should be one cell; attr.MultiRow decides what to do when it's more than that.
+func SelectSingleValue(attr AttributeRow, values [][]interface{}) (string, bool, error) {
+	cells := []string{}
+	for _, row := range values {
+		for _, cell := range row {
+			cells = append(cells, CellString(cell))
+		}
+	}
+	if len(cells) == 0 {
+		return "", false, nil
+	}
+
+	switch attr.MultiRow {
+	case MultiRowLast:
+		return cells[len(cells)-1], true, nil
+	case MultiRowJoin:
+		separator := attr.Separator
+		if separator == "" {
+			separator = defaultJoinSeparator
+		}
+		return strings.Join(cells, separator), true, nil
+	case MultiRowError:
+		if len(cells) > 1 {
+			return "", false, fmt.Errorf("range has %d cells, but attribute '%s' expects one", len(cells), attr.Name)
+		}
+	}
+	return cells[0], true, nil
+}
 
-	log.Printf("***** done updating cache for '%s' *****", charKey)
+func MapRangeToNames(attr AttributeRow, values [][]interface{}, charMap map[string]string) error {
+	// the API omits trailing empty cells in each row, so use the width of the range
+	// when it's known to keep cells lined up with their names
+	_, cols, sized := A1RangeSize(attr.Range)
+	if !sized {
+		cols = 0
+		for _, row := range values {
+			if len(row) > cols {
+				cols = len(row)
+			}
+		}
+	}
+
+	for r, row := range values {
+		for c, cell := range row {
+			i := r*cols + c
+			if c >= cols || i >= len(attr.Names) {
+				return fmt.Errorf("range '%s' returned more cells than the %d configured names",
+					attr.Range, len(attr.Names))
+			}
+			charMap[attr.Names[i]] = CellString(cell)
+		}
+	}
+
+	return nil
 }
 
-func (app *CharacterSheetServiceApp) LookupCharacter(charKey string) (*map[string]string, bool) {
+func (app *CharacterSheetServiceApp) LookupCharacter(ctx context.Context, charKey string) (*CharacterAttributeCacheEntry, bool) {
 	entry, found := app.Cache.Get(charKey)
-	if !found {
-		return nil, false
+
+	// only configured characters are tracked, so unknown paths can't grow these maps
+	if _, configured := app.Characters()[charKey]; configured {
+		app.IdleTracker.Touch(charKey, time.Now())
+		app.Stats.CountLookup(charKey, found && entry.Attributes != nil)
+	}
+	if !found || entry.Attributes == nil {
+		SetCacheState(ctx, "miss")
+	} else if time.Now().After(entry.Expires) {
+		SetCacheState(ctx, "stale")
+	} else {
+		SetCacheState(ctx, "hit")
 	}
 
-	// Check to see if cache should expire, and fetch update in parallel if expiry is past.
-	now := time.Now()
-	if entry.UpdatingFlag == false && now.After(entry.Expires) {
-		entry.UpdatingFlag = true
-		app.Cache.Set(charKey, entry)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("character.key", charKey),
+		attribute.Bool("cache.hit", found),
+	)
+
+	// background fetches must outlive the request that triggered them
+	backgroundCtx := context.WithoutCancel(ctx)
+
+	if !found || entry.Attributes == nil {
+		// not primed yet, evicted, or dropped by a shared cache; fetch it now. Concurrent
+		// lookups share the one fetch and all wait for it.
+		if _, configured := app.Characters()[charKey]; !configured {
+			return entry, found
+		}
 
-		log.Printf("***** cache expired for '%s'; fetching update *****", charKey)
+		log.Printf("***** no cached attributes for '%s'; fetching update *****", charKey)
+		select {
+		case <-app.RefreshInBackground(backgroundCtx, charKey):
+			return app.Cache.Get(charKey)
+		case <-ctx.Done():
+			return entry, found
+		}
+	}
 
-		// Run fetch routine in a seperate thread
-		go app.FetchCharacterAttributesFromSheetsApi(charKey)
+	// expired entries are served while the scheduler refreshes them; see ScheduleRefreshes
+	if app.Now().After(entry.Expires) {
+		app.Stats.CountStale(charKey)
 	}
 
-	return entry.Attributes, true
+	return entry, true
+}
+
+// Now reads the app's Clock, which is time.Now unless it's been replaced.
+func (app *CharacterSheetServiceApp) Now() time.Time {
+	if app.Clock == nil {
+		return time.Now()
+	}
+	return app.Clock()
 }
 
 func (app *CharacterSheetServiceApp) HandleRequest(w http.ResponseWriter, r *http.Request) {
 	requestPath := r.URL.Path
+	app.Stats.CountRequest()
+
+	// writes back to the sheet are for the GM, so they need the admin secret
+	if r.Method == http.MethodPost || r.Method == http.MethodPatch {
+		if IsAdjustPath(requestPath) {
+			app.RequireAdmin(app.HandleAdjust)(w, r)
+			return
+		}
+		app.RequireAdmin(app.HandleWriteBack)(w, r)
+		return
+	}
 
 	if r.Method != http.MethodGet {
 		// Not GET - 405 Method Not Allowederror
-		WriteApiResponseJson(w, ApiResponse{
-			CharacterUrls: app.ValidUrls,
+		app.WriteApiResponse(w, r, ApiResponse{
+			CharacterUrls: app.ValidUrls(),
 			Metadata: NewMetadata(requestPath, http.StatusMethodNotAllowed,
 				fmt.Sprintf("Method '%s' not allowed; you must use GET for this web service.", r.Method)),
 		})
 		return
 	}
 
+	if version, ok := RequestedApiVersion(r); !ok {
+		// Unsupported version - 406 Not Acceptable error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusNotAcceptable,
+				fmt.Sprintf("API version '%s' is not supported; supported versions are: %s.",
+					version, strings.Join(supportedApiVersions, ", "))),
+		})
+		return
+	}
+
 	// as we're a single endpoint, we want to use all of the path as the character key,
 	// once the leading and trailing slash are stripped.
 	charKey := strings.Trim(requestPath, "/")
 
+	role, ok := app.CharacterRole(r, app.PathCharacterKey(charKey))
+	if !ok {
+		// Missing or unknown access token - 401 Unauthorized error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusUnauthorized, AccessDeniedMessage(r)),
+		})
+		return
+	}
+
+	// /<charKey>/schema describes the attributes without fetching them
+	if app.HandleSchemaRequest(w, r, charKey, role) {
+		return
+	}
+
+	// /<campaign> lists the campaign's characters
+	if app.HandleCampaignRequest(w, r, charKey) {
+		return
+	}
+
+	if app.InMaintenance() {
+		// Maintenance mode - 503 Service Unavailable, or 200 if configured
+		metadata := NewMetadata(requestPath, app.Config.Maintenance.StatusCode(), app.Config.Maintenance.MaintenanceMessage())
+		metadata.Maintenance = true
+		app.WriteApiResponse(w, r, ApiResponse{Metadata: metadata})
+		return
+	}
+
+	// /<charKey>/attr/<attributeName> serves a single attribute
+	if app.HandleAttributeRequest(w, r, charKey, role) {
+		return
+	}
+
+	// ?wait=<seconds> holds the request open until the character's attributes change
+	waitSeconds := 0
+	if wait := r.URL.Query().Get("wait"); wait != "" {
+		var err error
+		waitSeconds, err = strconv.Atoi(wait)
+		if err != nil || waitSeconds < 0 || waitSeconds > maxLongPollSeconds {
+			// Bad wait parameter - 400 Bad Request error
+			app.WriteApiResponse(w, r, ApiResponse{
+				Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+					fmt.Sprintf("Invalid wait '%s'; must be a number of seconds from 0 to %d.", wait, maxLongPollSeconds)),
+			})
+			return
+		}
+	}
+
+	// subscribe before looking up, so a change between the lookup and the wait isn't missed
+	var changed chan struct{}
+	if waitSeconds > 0 {
+		changed = app.Notifier.Subscribe(charKey)
+		defer app.Notifier.Unsubscribe(charKey, changed)
+	}
+
+	// ?format=array lists attributes in config order, for layouts that can't sort them
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "map" && format != "array" {
+		// Invalid format - 400 Bad Request error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+				fmt.Sprintf("Invalid format '%s'; must be map or array.", format)),
+		})
+		return
+	}
+
 	// looking for character
-	charAttributes, found := app.LookupCharacter(charKey)
+	entry, found := app.LookupCharacter(r.Context(), charKey)
+
+	if _, configured := app.Characters()[charKey]; configured && (!found || entry.Attributes == nil) {
+		// Configured, but not yet primed - 503 Service Unavailable error
+		w.Header().Set("Retry-After", strconv.Itoa(primingRetryAfterSeconds))
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusServiceUnavailable,
+				fmt.Sprintf("Character '%s' is still being loaded; retry in %d seconds.", charKey, primingRetryAfterSeconds)),
+		})
+		return
+	}
 
-	if !found {
+	// a removed character may linger in a shared cache
+	if _, configured := app.Characters()[charKey]; !configured || !found {
 		// Result not found - 404 Not Found error
-		WriteApiResponseJson(w, ApiResponse{
-			CharacterUrls: app.ValidUrls,
-			Metadata: NewMetadata(requestPath, http.StatusNotFound,
-				fmt.Sprintf("No character '%s' found; see list of valid character paths in the payload.", charKey)),
+		suggestions := []string{}
+		for _, suggestion := range SuggestCharacterKeys(charKey, app.PrimingOrder(), app.Config.SuggestionMaxDistance()) {
+			suggestions = append(suggestions, "/"+suggestion)
+		}
+
+		message := fmt.Sprintf("No character '%s' found; see list of valid character paths in the payload.", charKey)
+		if len(suggestions) > 0 {
+			message = fmt.Sprintf("No character '%s' found; did you mean %s?", charKey, strings.Join(suggestions, ", "))
+		}
+
+		app.WriteApiResponse(w, r, ApiResponse{
+			Suggestions:   suggestions,
+			CharacterUrls: app.ValidUrls(),
+			Metadata:      NewMetadata(requestPath, http.StatusNotFound, message),
+		})
+		return
+	}
+
+	if waitSeconds > 0 {
+		timeout := time.NewTimer(time.Duration(waitSeconds) * time.Second)
+		defer timeout.Stop()
+
+		select {
+		case <-changed:
+			entry, _ = app.LookupCharacter(r.Context(), charKey)
+		case <-timeout.C:
+			// nothing changed; respond with the current values
+		case <-r.Context().Done():
+			log.Printf("--- request: %s -> client went away during long-poll", requestPath)
+			return
+		}
+	}
+
+	// the role of the access token decides which attributes are shown, and ?attrs= can
+	// narrow them down further
+	visible := app.Characters()[charKey].VisibleTo(role)
+	if attrs := r.URL.Query().Get("attrs"); attrs != "" {
+		visible = app.Characters()[charKey].SelectAttributes(attrs, app.Config.KeyStyle, visible)
+	}
+
+	metadata := NewMetadata(requestPath, http.StatusOK, "")
+	metadata.Truncated = entry.Truncated
+	metadata.FetchFailed = entry.FetchFailed
+	metadata.Stale = entry.Stale
+	metadata.FetchError = entry.FetchError
+	metadata.DefaultedAttributes = FilterAttributeNames(entry.DefaultedAttributes, visible)
+	metadata.AttributeErrors = FilterAttributes(entry.AttributeErrors, visible)
+
+	// ?raw=true shows the cell values as read from the sheet, for debugging formatting
+	if raw, _ := strconv.ParseBool(r.URL.Query().Get("raw")); raw {
+		app.WriteApiResponse(w, r, ApiResponse{
+			Attributes: app.RenderAttributes(charKey, FilterAttributes(entry.RawAttributes, visible), format),
+			Metadata:   metadata,
 		})
 		return
 	}
 
-	WriteApiResponseJson(w, ApiResponse{
-		Attributes: charAttributes,
-		Metadata:   NewMetadata(requestPath, http.StatusOK, ""),
+	states := ResolveAttributeStates(app.Characters()[charKey], *entry.Attributes)
+	app.WriteApiResponse(w, r, ApiResponse{
+		Attributes: app.RenderAttributes(charKey, FilterAttributes(*entry.Attributes, visible), format),
+		States:     StyleAttributeKeys(app.Config.KeyStyle, FilterAttributes(states, visible)),
+		Metadata:   metadata,
 	})
 }
 
+// RenderAttributes styles the attribute keys and shapes them for the requested format.
+func (app *CharacterSheetServiceApp) RenderAttributes(charKey string, attributes map[string]string, format string) interface{} {
+	types := app.Characters()[charKey].ValueTypes()
+
+	if format != "array" {
+		if len(types) == 0 {
+			styledAttributes := StyleAttributeKeys(app.Config.KeyStyle, attributes)
+			return &styledAttributes
+		}
+
+		styledAttributes := make(map[string]interface{}, len(attributes))
+		for name, value := range attributes {
+			if attrType, found := types[name]; found {
+				styledAttributes[ApplyKeyStyle(app.Config.KeyStyle, name)] = TypedValue(attrType, value)
+			} else {
+				styledAttributes[ApplyKeyStyle(app.Config.KeyStyle, name)] = value
+			}
+		}
+		return styledAttributes
+	}
+
+	list := []NamedAttribute{}
+	for _, name := range app.Characters()[charKey].AttributeNames() {
+		if value, found := attributes[name]; found {
+			namedAttribute := NamedAttribute{Name: ApplyKeyStyle(app.Config.KeyStyle, name), Value: value}
+			if attrType, found := types[name]; found {
+				namedAttribute.Value = TypedValue(attrType, value)
+			}
+			list = append(list, namedAttribute)
+		}
+	}
+	return list
+}
+
 func main() {
+	var options CommandLineOptions
+	flag.BoolVar(&options.Example, "example", false, "write an example config.json and api-key.json, then exit")
+	flag.BoolVar(&options.Demo, "demo", false, "serve fake attributes from the embedded example config without contacting Google")
+	flag.StringVar(&options.ConfigFile, "config", "", "read config from this file instead of config.json, or from stdin with '-'")
+	flag.StringVar(&options.ConfigDir, "configDir", "", "merge every .json and .yaml config file in this directory instead of reading config.json")
+	flag.StringVar(&options.Address, "addr", "", "listen on this interface instead of the configured one (default all)")
+	flag.IntVar(&options.Port, "port", 0, "listen on this port instead of the configured one (default 9090)")
+	flag.Parse()
+
+	if options.Example {
+		if err := WriteExampleFiles("."); err != nil {
+			log.Fatalf("Unable to write example files: %v", err)
+		}
+		return
+	}
+
 	log.Println("Starting Character Sheet Service Application... ")
 
-	app := NewCharacterSheetApp()
+	app := NewCharacterSheetApp(options)
 
 	// set up route for character lookup
-	http.HandleFunc("/", app.HandleRequest)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", app.HandleRequest)
+	mux.Handle("/ws", app.WebSocketServer())
+	mux.Handle("/ws/", app.CharacterWebSocketServer())
+	mux.HandleFunc("/events/", app.HandleEvents)
+	mux.HandleFunc("/stats", app.HandleStats)
+	mux.HandleFunc("/metrics", app.HandleMetrics)
+	mux.HandleFunc("/party", app.HandleParty)
+	mux.HandleFunc("/healthz", app.HandleHealthz)
+	mux.HandleFunc("/readyz", app.HandleReadyz)
+	mux.HandleFunc("/overlay/", app.HandleOverlay)
+	mux.HandleFunc("/render/", app.HandleRender)
+	mux.HandleFunc("/discord/interactions", app.HandleDiscordInteraction)
+	mux.HandleFunc("/actions/", app.HandleAction)
+	mux.HandleFunc("/admin/cache", app.RequireAdmin(app.HandleAdminCache))
+	mux.HandleFunc("/admin/cache/", app.RequireAdmin(app.HandleAdminCacheCharacter))
+	mux.HandleFunc("/admin/refresh-all", app.RequireAdmin(app.HandleAdminRefreshAll))
+	mux.HandleFunc("/admin/maintenance", app.RequireAdmin(app.HandleAdminMaintenance))
+	mux.HandleFunc("/admin/snapshot", app.RequireAdmin(app.HandleAdminSnapshot))
+	mux.HandleFunc("/admin/logs", app.RequireAdmin(app.HandleAdminLogs))
+	mux.HandleFunc("/admin/reload", app.RequireAdmin(app.HandleAdminReload))
+	mux.HandleFunc("/admin/reload-credentials", app.RequireAdmin(app.HandleAdminReloadCredentials))
+	app.RegisterProfilingHandlers(mux)
 
-	log.Println("Character Sheet Service Application running on port 9090")
-	log.Fatal(http.ListenAndServe(":9090", nil))
+	// requests see this context cancelled on shutdown, which ends long-polls and event
+	// streams rather than holding the shutdown up
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        app.Config.Server.ListenAddress(),
+		Handler:     TracingMiddleware(app.RequestLogMiddleware(RecoverMiddleware(app.CorsMiddleware(mux)))),
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
+	}
+
+	// on SIGINT/SIGTERM, stop accepting requests, drain the ones in flight and let refreshes
+	// finish writing to the cache; refreshes still running after the timeout are cancelled
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		received := <-signals
+
+		log.Printf("Received %v; draining requests... ", received)
+		cancelRequests()
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), app.Config.ShutdownTimeout())
+		if err := server.Shutdown(drainCtx); err != nil {
+			log.Printf("  * timed out draining requests: %v", err)
+			server.Close()
+		}
+		cancelDrain()
+
+		app.StopScheduler()
+		log.Println("-- waiting for in-flight refreshes... ")
+		if !app.WaitForRefreshes(app.Config.ShutdownTimeout()) {
+			log.Println("  * timed out waiting for refreshes; cancelling them")
+			app.StopRefreshes()
+			app.WaitForRefreshes(time.Second)
+		}
+		app.ShutdownTracing(context.Background())
+		close(stopped)
+	}()
+
+	log.Printf("Character Sheet Service Application running on %s", server.Addr)
+	if err := app.Config.Server.ListenAndServe(server); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
 }
@@ -0,0 +1,1074 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// fakeSheets serves the Sheets API's values:batchGet from a map of range -> values, and
+// spreadsheets.get from a map of range -> note, recording every request it gets. It also answers Drive files.get with modifiedTimes.
+// values:batchUpdate writes into the values, and is recorded apart from the reads.
+type fakeSheets struct {
+	server *httptest.Server
+
+	lock     sync.Mutex
+	values   map[string][][]interface{}
+	notes    map[string]string
+	requests []fakeSheetsRequest
+
+	// when set, requests fail with this status
+	failStatus int
+
+	// the named ranges and tabs read before named ranges are; when nil, reading them fails
+	layout *sheets.Spreadsheet
+
+	// when set, rewrites the value ranges before they're sent
+	alterRanges func([]*sheets.ValueRange) []*sheets.ValueRange
+
+	// when set, requests wait for it to be closed before they're answered
+	hold chan struct{}
+
+	// Drive: sheet id -> modifiedTime
+	modifiedTimes map[string]string
+	driveRequests int
+
+	writes []*sheets.ValueRange
+}
+
+type fakeSheetsRequest struct {
+	SheetId string
+	Query   url.Values
+}
+
+func newFakeSheets(t *testing.T, values map[string][][]interface{}) *fakeSheets {
+	fake := &fakeSheets{values: values}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func (fake *fakeSheets) serve(w http.ResponseWriter, r *http.Request) {
+	fake.lock.Lock()
+	hold := fake.hold
+	fake.lock.Unlock()
+	if hold != nil {
+		<-hold
+	}
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if strings.HasPrefix(r.URL.Path, "/files/") {
+		fake.serveDrive(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/values:batchUpdate") {
+		fake.serveWrite(w, r)
+		return
+	}
+	sheetId := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v4/spreadsheets/"), "/", 2)[0]
+	fake.requests = append(fake.requests, fakeSheetsRequest{SheetId: sheetId, Query: r.URL.Query()})
+
+	if fake.failStatus != 0 {
+		http.Error(w, `{"error": {"message": "fake failure"}}`, fake.failStatus)
+		return
+	}
+	if !strings.Contains(strings.TrimPrefix(r.URL.Path, "/v4/spreadsheets/"), "/") && strings.HasPrefix(r.URL.Query().Get("fields"), "namedRanges") {
+		fake.serveLayout(w, r)
+		return
+	}
+	if !strings.Contains(strings.TrimPrefix(r.URL.Path, "/v4/spreadsheets/"), "/") {
+		fake.serveNotes(w, r)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/values:batchGet") {
+		http.NotFound(w, r)
+		return
+	}
+	response := sheets.BatchGetValuesResponse{}
+	for _, valueRange := range r.URL.Query()["ranges"] {
+		response.ValueRanges = append(response.ValueRanges, &sheets.ValueRange{Range: valueRange, Values: fake.values[valueRange]})
+	}
+	if fake.alterRanges != nil {
+		response.ValueRanges = fake.alterRanges(response.ValueRanges)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (fake *fakeSheets) serveWrite(w http.ResponseWriter, r *http.Request) {
+	if fake.failStatus != 0 {
+		http.Error(w, `{"error": {"message": "fake failure"}}`, fake.failStatus)
+		return
+	}
+	var request sheets.BatchUpdateValuesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, `{"error": {"message": "fake unreadable write"}}`, http.StatusBadRequest)
+		return
+	}
+	if fake.values == nil {
+		fake.values = map[string][][]interface{}{}
+	}
+	for _, valueRange := range request.Data {
+		fake.writes = append(fake.writes, valueRange)
+		fake.values[valueRange.Range] = valueRange.Values
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sheets.BatchUpdateValuesResponse{TotalUpdatedCells: int64(len(request.Data))})
+}
+
+// Writes returns the ranges written so far.
+func (fake *fakeSheets) Writes() []*sheets.ValueRange {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return append([]*sheets.ValueRange{}, fake.writes...)
+}
+
+func (fake *fakeSheets) serveNotes(w http.ResponseWriter, r *http.Request) {
+	spreadsheet := sheets.Spreadsheet{}
+	for _, noteRange := range r.URL.Query()["ranges"] {
+		cell := &sheets.CellData{Note: fake.notes[noteRange]}
+		spreadsheet.Sheets = append(spreadsheet.Sheets, &sheets.Sheet{
+			Data: []*sheets.GridData{{RowData: []*sheets.RowData{{Values: []*sheets.CellData{cell}}}}},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spreadsheet)
+}
+
+func (fake *fakeSheets) serveLayout(w http.ResponseWriter, r *http.Request) {
+	if fake.layout == nil {
+		http.Error(w, `{"error": {"message": "fake metadata unavailable"}}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fake.layout)
+}
+
+func (fake *fakeSheets) serveDrive(w http.ResponseWriter, r *http.Request) {
+	fake.driveRequests++
+	modifiedTime, found := fake.modifiedTimes[strings.TrimPrefix(r.URL.Path, "/files/")]
+	if !found {
+		http.Error(w, `{"error": {"message": "fake file not found"}}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drive.File{ModifiedTime: modifiedTime})
+}
+
+// SetModifiedTime sets the sheet's modifiedTime reported by Drive.
+func (fake *fakeSheets) SetModifiedTime(sheetId string, modifiedTime string) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if fake.modifiedTimes == nil {
+		fake.modifiedTimes = map[string]string{}
+	}
+	fake.modifiedTimes[sheetId] = modifiedTime
+}
+
+// DriveService is a Drive client talking to the fake.
+func (fake *fakeSheets) DriveService(t *testing.T) *drive.Service {
+	service, err := drive.NewService(context.Background(),
+		option.WithEndpoint(fake.server.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("unable to create drive client: %v", err)
+	}
+	return service
+}
+
+// Hold makes requests wait until the returned release function is called.
+func (fake *fakeSheets) Hold() (release func()) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	hold := make(chan struct{})
+	fake.hold = hold
+	return func() {
+		fake.lock.Lock()
+		defer fake.lock.Unlock()
+		fake.hold = nil
+		close(hold)
+	}
+}
+
+// Fail makes requests fail with status, or succeed again when it's 0.
+func (fake *fakeSheets) Fail(status int) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.failStatus = status
+}
+
+// Service is a Sheets client talking to the fake.
+func (fake *fakeSheets) Service(t *testing.T) *sheets.Service {
+	service, err := sheets.NewService(context.Background(),
+		option.WithEndpoint(fake.server.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("unable to create sheets client: %v", err)
+	}
+	return service
+}
+
+// Requests returns the requests made so far.
+func (fake *fakeSheets) Requests() []fakeSheetsRequest {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return append([]fakeSheetsRequest{}, fake.requests...)
+}
+
+// SheetIds returns the spreadsheet of each request made so far, in order.
+func (fake *fakeSheets) SheetIds() []string {
+	sheetIds := []string{}
+	for _, request := range fake.Requests() {
+		sheetIds = append(sheetIds, request.SheetId)
+	}
+	return sheetIds
+}
+
+// newTestApp is an app serving the given characters from the fake sheets.
+func newTestApp(t *testing.T, fake *fakeSheets, characters ...ConfigEntry) *CharacterSheetServiceApp {
+	captureLog(t)
+	// retries are off unless a test turns them on
+	config := ServiceConfig{Characters: characters, Retry: RetryConfig{MaxAttempts: 1}}
+	app := &CharacterSheetServiceApp{
+		Config:        config,
+		Cache:         NewCharacterAttributeCache(len(characters)),
+		Notifier:      NewAttributeChangeNotifier(),
+		Retrier:       NewSheetsRetrier(RetryConfig{InitialBackoffMs: 1, MaxBackoffMs: 1}, 1),
+		IdleTracker:   NewIdleTracker(),
+		ErrorTemplate: LoadErrorTemplate(""),
+		Stats:         NewServiceStats(),
+	}
+	app.refreshesCtx, app.StopRefreshes = context.WithCancel(context.Background())
+	t.Cleanup(app.StopRefreshes)
+	app.Source = SheetsDataSource{app: app}
+	app.SetCharacters(config)
+	app.SetSheetService(fake.Service(t))
+	return app
+}
+
+func TestMapRangeToNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		attr    AttributeRow
+		values  [][]interface{}
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "row range",
+			attr:   AttributeRow{Range: "B2:D2", Names: []string{"str", "dex", "con"}},
+			values: [][]interface{}{{"16", "12", "14"}},
+			want:   map[string]string{"str": "16", "dex": "12", "con": "14"},
+		},
+		{
+			name:   "column range",
+			attr:   AttributeRow{Range: "B2:B4", Names: []string{"str", "dex", "con"}},
+			values: [][]interface{}{{"16"}, {"12"}, {"14"}},
+			want:   map[string]string{"str": "16", "dex": "12", "con": "14"},
+		},
+		{
+			name:   "grid with trailing empty cells left out",
+			attr:   AttributeRow{Range: "A1:B2", Names: []string{"a", "b", "c", "d"}},
+			values: [][]interface{}{{"1"}, {"3", "4"}},
+			want:   map[string]string{"a": "1", "c": "3", "d": "4"},
+		},
+		{
+			name:   "named range sized by its values",
+			attr:   AttributeRow{Range: "Abilities", Names: []string{"str", "dex"}},
+			values: [][]interface{}{{16, 12}},
+			want:   map[string]string{"str": "16", "dex": "12"},
+		},
+		{
+			name:    "more cells than names",
+			attr:    AttributeRow{Range: "Abilities", Names: []string{"str"}},
+			values:  [][]interface{}{{"16", "12"}},
+			want:    map[string]string{"str": "16"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		charMap := map[string]string{}
+		err := MapRangeToNames(test.attr, test.values, charMap)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+		}
+		if !reflect.DeepEqual(charMap, test.want) {
+			t.Errorf("%s: mapped %v, want %v", test.name, charMap, test.want)
+		}
+	}
+}
+
+func TestPrimeCacheOrder(t *testing.T) {
+	attributes := []AttributeRow{{Name: "hp", Range: "B2"}}
+	characters := []ConfigEntry{
+		{CharacterKey: "npc", SheetId: "npc-sheet", Attributes: attributes},
+		{CharacterKey: "thorin", SheetId: "thorin-sheet", Priority: 10, Attributes: attributes},
+		{CharacterKey: "gimli", SheetId: "gimli-sheet", Priority: 5, Attributes: attributes},
+		{CharacterKey: "balin", SheetId: "balin-sheet", Priority: 10, Attributes: attributes},
+	}
+	tests := []struct {
+		name         string
+		readyAfter   bool
+		wantPrimed   []string
+		wantEventual []string
+	}{
+		{"whole roster", false,
+			[]string{"thorin-sheet", "balin-sheet", "gimli-sheet", "npc-sheet"}, nil},
+		{"priority characters first", true,
+			[]string{"thorin-sheet", "balin-sheet", "gimli-sheet"}, []string{"npc-sheet"}},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake, characters...)
+		app.Config.ReadyAfterPriorityPrimed = test.readyAfter
+
+		app.PrimeCache(app.Config.PrimingOrder())
+		primed := fake.SheetIds()
+		if len(primed) > len(test.wantPrimed) {
+			primed = primed[:len(test.wantPrimed)]
+		}
+		if !reflect.DeepEqual(primed, test.wantPrimed) {
+			t.Errorf("%s: primed %v, want %v", test.name, primed, test.wantPrimed)
+		}
+
+		want := append(test.wantPrimed, test.wantEventual...)
+		waitFor(t, func() bool { return len(fake.SheetIds()) == len(want) })
+		if got := fake.SheetIds(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: fetched %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+// waitFor polls until done returns true, failing the test if it takes over a few seconds.
+func waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting")
+		}
+	}
+}
+
+func TestHandleRequestBeforePriming(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "thorin-sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+		ConfigEntry{CharacterKey: "gimli", SheetId: "gimli-sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+	release := fake.Hold()
+
+	tests := []struct {
+		path           string
+		clientGone     bool
+		releaseFetch   bool
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"/thorin", false, false, http.StatusOK, ""},
+		// the client gives up while gimli's first fetch is still running
+		{"/gimli", true, false, http.StatusServiceUnavailable, "5"},
+		{"/legolas", false, false, http.StatusNotFound, ""},
+		// otherwise a cold lookup waits for the fetch
+		{"/gimli", false, true, http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.clientGone {
+			ctx, cancel := context.WithCancel(r.Context())
+			cancel()
+			r = r.WithContext(ctx)
+		}
+		if test.releaseFetch {
+			time.AfterFunc(20*time.Millisecond, release)
+		}
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, r)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.path, w.Code, test.wantStatus)
+		}
+		if retryAfter := w.Header().Get("Retry-After"); retryAfter != test.wantRetryAfter {
+			t.Errorf("%s: Retry-After = %q, want %q", test.path, retryAfter, test.wantRetryAfter)
+		}
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.path, err)
+		}
+		if response.Metadata.StatusCode != test.wantStatus {
+			t.Errorf("%s: metadata status = %d, want %d", test.path, response.Metadata.StatusCode, test.wantStatus)
+		}
+	}
+
+	// both gimli requests shared the one fetch
+	if got, want := fake.SheetIds(), []string{"thorin-sheet", "gimli-sheet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fetched %v, want %v", got, want)
+	}
+}
+
+// getResponse serves a GET of path and decodes the API response.
+func getResponse(t *testing.T, app *CharacterSheetServiceApp, path string) ApiResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	app.HandleRequest(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var response ApiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("%s: response isn't JSON: %v", path, err)
+	}
+	return response
+}
+
+// attributeMap returns a decoded response's attributes as a map of name -> value.
+func attributeMap(response ApiResponse) map[string]string {
+	decoded, _ := response.Attributes.(map[string]interface{})
+	attributes := make(map[string]string, len(decoded))
+	for name, value := range decoded {
+		attributes[name], _ = value.(string)
+	}
+	return attributes
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func TestFetchFailureAndDefaults(t *testing.T) {
+	attributes := []AttributeRow{
+		{Name: "hp", Range: "B2"},
+		{Name: "conditions", Range: "B3", Default: stringPointer("none")},
+		{Name: "notes", Range: "B4"},
+	}
+
+	tests := []struct {
+		name          string
+		failStatus    int
+		primed        bool
+		want          map[string]string
+		wantFailed    bool
+		wantStale     bool
+		wantDefaulted []string
+	}{
+		{
+			name:       "total failure on a cold start",
+			failStatus: http.StatusServiceUnavailable,
+			want:       map[string]string{"hp": "?", "conditions": "?", "notes": "?"},
+			wantFailed: true,
+		},
+		{
+			name:          "failure keeps the last good values",
+			failStatus:    http.StatusServiceUnavailable,
+			primed:        true,
+			want:          map[string]string{"hp": "12", "conditions": "none"},
+			wantStale:     true,
+			wantDefaulted: []string{"conditions"},
+		},
+		{
+			name:          "empty cells in a good fetch",
+			want:          map[string]string{"hp": "12", "conditions": "none"},
+			wantDefaulted: []string{"conditions"},
+		},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {}, "B4": {{}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: attributes})
+		app.Config.OnErrorValue = stringPointer("?")
+		if test.primed {
+			app.PrimeCharacter("thorin")
+		}
+		fake.Fail(test.failStatus)
+		app.PrimeCharacter("thorin")
+
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/thorin", nil))
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.name, err)
+		}
+
+		if !reflect.DeepEqual(attributeMap(response), test.want) {
+			t.Errorf("%s: attributes = %v, want %v", test.name, attributeMap(response), test.want)
+		}
+		if response.Metadata.FetchFailed != test.wantFailed {
+			t.Errorf("%s: fetchFailed = %v, want %v", test.name, response.Metadata.FetchFailed, test.wantFailed)
+		}
+		if response.Metadata.Stale != test.wantStale {
+			t.Errorf("%s: stale = %v, want %v", test.name, response.Metadata.Stale, test.wantStale)
+		}
+		if !reflect.DeepEqual(response.Metadata.DefaultedAttributes, test.wantDefaulted) {
+			t.Errorf("%s: defaultedAttributes = %v, want %v", test.name, response.Metadata.DefaultedAttributes, test.wantDefaulted)
+		}
+	}
+}
+
+func TestFetchOnlyExpiredRanges(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"Fireball"}}, "B4": {{"16"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Name: "hp", Range: "B2", TtlSeconds: 5},
+		{Name: "spells", Range: "B3", TtlSeconds: 3600},
+		{Name: "ac", Range: "B4"},
+	}})
+	app.PrimeCharacter("thorin")
+
+	entry, _ := app.Cache.Get("thorin")
+	if want := entry.RangeExpires["B2"]; !entry.Expires.Equal(want) {
+		t.Errorf("entry expires %v, want the earliest range expiry %v", entry.Expires, want)
+	}
+
+	tests := []struct {
+		name        string
+		expired     []string
+		wantRanges  []string
+		wantHp      string
+		wantSpells  string
+		sheetValues map[string][][]interface{}
+	}{
+		{
+			name:        "only hp expired",
+			expired:     []string{"B2"},
+			wantRanges:  []string{"B2"},
+			sheetValues: map[string][][]interface{}{"B2": {{"7"}}, "B3": {{"Shield"}}, "B4": {{"16"}}},
+			wantHp:      "7",
+			wantSpells:  "Fireball",
+		},
+		{
+			name:        "hp and ac expired",
+			expired:     []string{"B2", "B4"},
+			wantRanges:  []string{"B2", "B4"},
+			sheetValues: map[string][][]interface{}{"B2": {{"3"}}, "B3": {{"Shield"}}, "B4": {{"16"}}},
+			wantHp:      "3",
+			wantSpells:  "Fireball",
+		},
+		{
+			name:        "everything expired",
+			expired:     []string{"B2", "B3", "B4"},
+			wantRanges:  []string{"B2", "B3", "B4"},
+			sheetValues: map[string][][]interface{}{"B2": {{"3"}}, "B3": {{"Shield"}}, "B4": {{"16"}}},
+			wantHp:      "3",
+			wantSpells:  "Shield",
+		},
+	}
+
+	for _, test := range tests {
+		entry, _ := app.Cache.Get("thorin")
+		expired := *entry
+		expired.RangeExpires = map[string]time.Time{}
+		for attrRange, expires := range entry.RangeExpires {
+			expired.RangeExpires[attrRange] = expires
+		}
+		for _, attrRange := range test.expired {
+			expired.RangeExpires[attrRange] = time.Now().Add(-time.Second)
+		}
+		app.Cache.Set("thorin", &expired)
+
+		fake.lock.Lock()
+		fake.values = test.sheetValues
+		fake.lock.Unlock()
+		app.FetchCharacterAttributes(context.Background(), "thorin")
+
+		requests := fake.Requests()
+		if ranges := requests[len(requests)-1].Query["ranges"]; !reflect.DeepEqual(ranges, test.wantRanges) {
+			t.Errorf("%s: fetched %v, want %v", test.name, ranges, test.wantRanges)
+		}
+		entry, _ = app.Cache.Get("thorin")
+		attributes := *entry.Attributes
+		if attributes["hp"] != test.wantHp || attributes["spells"] != test.wantSpells || attributes["ac"] != "16" {
+			t.Errorf("%s: attributes = %v, want hp %s, spells %s, ac 16", test.name, attributes, test.wantHp, test.wantSpells)
+		}
+		if !entry.RangeExpires["B3"].After(time.Now().Add(time.Hour - time.Minute)) {
+			t.Errorf("%s: spells expire at %v, want about an hour from now", test.name, entry.RangeExpires["B3"])
+		}
+	}
+}
+
+func TestFetchPartialBatchGet(t *testing.T) {
+	attributes := []AttributeRow{
+		{Name: "hp", Range: "B2"},
+		{Range: "B3:C3", Names: []string{"str", "dex"}},
+		{Name: "ac", Range: "B4"},
+	}
+
+	tests := []struct {
+		name        string
+		alterRanges func([]*sheets.ValueRange) []*sheets.ValueRange
+		want        map[string]string
+		wantErrors  []string
+	}{
+		{
+			name:        "short response",
+			alterRanges: func(ranges []*sheets.ValueRange) []*sheets.ValueRange { return ranges[:1] },
+			want:        map[string]string{"hp": "7", "str": "16", "dex": "12", "ac": "18"},
+			wantErrors:  []string{"ac", "dex", "str"},
+		},
+		{
+			name:        "null range",
+			alterRanges: func(ranges []*sheets.ValueRange) []*sheets.ValueRange { ranges[1] = nil; return ranges },
+			want:        map[string]string{"hp": "7", "str": "16", "dex": "12", "ac": "14"},
+			wantErrors:  []string{"dex", "str"},
+		},
+		{
+			name:        "empty response",
+			alterRanges: func(ranges []*sheets.ValueRange) []*sheets.ValueRange { return nil },
+			want:        map[string]string{"hp": "12", "str": "16", "dex": "12", "ac": "18"},
+			wantErrors:  []string{"ac", "dex", "hp", "str"},
+		},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3:C3": {{"16", "12"}}, "B4": {{"18"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: attributes})
+		app.PrimeCharacter("thorin")
+
+		// everything is due again, and the sheet has changed
+		entry, _ := app.Cache.Get("thorin")
+		expired := *entry
+		expired.RangeExpires = nil
+		app.Cache.Set("thorin", &expired)
+		fake.lock.Lock()
+		fake.values = map[string][][]interface{}{"B2": {{"7"}}, "B3:C3": {{"10", "10"}}, "B4": {{"14"}}}
+		fake.alterRanges = test.alterRanges
+		fake.lock.Unlock()
+
+		app.FetchCharacterAttributes(context.Background(), "thorin")
+
+		entry, _ = app.Cache.Get("thorin")
+		if !reflect.DeepEqual(*entry.Attributes, test.want) {
+			t.Errorf("%s: attributes = %v, want %v", test.name, *entry.Attributes, test.want)
+		}
+		errorNames := []string{}
+		for name := range entry.AttributeErrors {
+			errorNames = append(errorNames, name)
+		}
+		sort.Strings(errorNames)
+		if !reflect.DeepEqual(errorNames, test.wantErrors) {
+			t.Errorf("%s: attribute errors for %v, want %v", test.name, errorNames, test.wantErrors)
+		}
+	}
+}
+
+func TestRawAttributes(t *testing.T) {
+	decimals := 1
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"1234.56"}}, "B3:C3": {{"3000", "Dwarf"}}, "B4": {}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Name: "gold", Range: "B2", Format: &AttributeFormat{Decimals: &decimals, Locale: "de-DE"}},
+		{Range: "B3:C3", Names: []string{"xp", "race"}, Format: &AttributeFormat{}},
+		{Name: "ac", Range: "B4", Default: stringPointer("10")},
+	}})
+	app.PrimeCharacter("thorin")
+
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"/thorin", map[string]string{"gold": "1.234,6", "xp": "3,000", "race": "Dwarf", "ac": "10"}},
+		{"/thorin?raw=false", map[string]string{"gold": "1.234,6", "xp": "3,000", "race": "Dwarf", "ac": "10"}},
+		// defaults aren't cell values, so they're left out of the raw view
+		{"/thorin?raw=true", map[string]string{"gold": "1234.56", "xp": "3000", "race": "Dwarf"}},
+	}
+
+	for _, test := range tests {
+		response := getResponse(t, app, test.path)
+		if !reflect.DeepEqual(attributeMap(response), test.want) {
+			t.Errorf("%s: attributes = %v, want %v", test.path, attributeMap(response), test.want)
+		}
+	}
+}
+
+func TestValueRenderOption(t *testing.T) {
+	attributes := []AttributeRow{
+		{Name: "hp", Range: "B2"},
+		{Name: "ac", Range: "B3", ValueRenderOption: "FORMULA"},
+		{Name: "str", Range: "B4"},
+	}
+
+	tests := []struct {
+		name         string
+		globalOption string
+		// render option -> ranges requested with it
+		want map[string][]string
+	}{
+		{"api default", "", map[string][]string{"": {"B2", "B4"}, "FORMULA": {"B3"}}},
+		{"global option", "UNFORMATTED_VALUE", map[string][]string{"UNFORMATTED_VALUE": {"B2", "B4"}, "FORMULA": {"B3"}}},
+		{"one batch", "FORMULA", map[string][]string{"FORMULA": {"B2", "B3", "B4"}}},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"=10+2"}}, "B4": {{"16"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: attributes})
+		app.Config.ValueRenderOption = test.globalOption
+		app.PrimeCharacter("thorin")
+
+		got := map[string][]string{}
+		for _, request := range fake.Requests() {
+			renderOption := request.Query.Get("valueRenderOption")
+			got[renderOption] = append(got[renderOption], request.Query["ranges"]...)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ranges by render option = %v, want %v", test.name, got, test.want)
+		}
+
+		// responses are put back in attribute order
+		entry, _ := app.Cache.Get("thorin")
+		if want := map[string]string{"hp": "12", "ac": "=10+2", "str": "16"}; !reflect.DeepEqual(*entry.Attributes, want) {
+			t.Errorf("%s: attributes = %v, want %v", test.name, *entry.Attributes, want)
+		}
+	}
+}
+
+func TestCellString(t *testing.T) {
+	tests := []struct {
+		cell interface{}
+		want string
+	}{
+		{"Thorin", "Thorin"},
+		{float64(12), "12"},
+		{1.5, "1.5"},
+		{float64(123456789012), "123456789012"},
+		{true, "true"},
+	}
+
+	for _, test := range tests {
+		if got := CellString(test.cell); got != test.want {
+			t.Errorf("CellString(%#v) = %q, want %q", test.cell, got, test.want)
+		}
+	}
+}
+
+func TestAttributesFormat(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3:C3": {{"16", "12"}}, "B4": {{"Thorin"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Name: "Hit Points", Range: "B2"},
+		{Range: "B3:C3", Names: []string{"str", "dex"}},
+		{Name: "name", Range: "B4"},
+	}})
+	app.Config.KeyStyle = "camel"
+	app.PrimeCharacter("thorin")
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       interface{}
+	}{
+		{"/thorin", http.StatusOK,
+			map[string]interface{}{"hitPoints": "12", "str": "16", "dex": "12", "name": "Thorin"}},
+		{"/thorin?format=map", http.StatusOK,
+			map[string]interface{}{"hitPoints": "12", "str": "16", "dex": "12", "name": "Thorin"}},
+		// in config order, rather than sorted by name
+		{"/thorin?format=array", http.StatusOK, []interface{}{
+			map[string]interface{}{"name": "hitPoints", "value": "12"},
+			map[string]interface{}{"name": "str", "value": "16"},
+			map[string]interface{}{"name": "dex", "value": "12"},
+			map[string]interface{}{"name": "name", "value": "Thorin"},
+		}},
+		{"/thorin?format=xml", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		response := getResponse(t, app, test.path)
+		if response.Metadata.StatusCode != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.path, response.Metadata.StatusCode, test.wantStatus)
+		}
+		if !reflect.DeepEqual(response.Attributes, test.want) {
+			t.Errorf("%s: attributes = %v, want %v", test.path, response.Attributes, test.want)
+		}
+	}
+}
+
+func TestWriteApiResponseJsonDeterministic(t *testing.T) {
+	captureLog(t)
+	configEntry := ConfigEntry{CharacterKey: "thorin", Attributes: []AttributeRow{
+		{Name: "hp", Range: "B2"}, {Name: "ac", Range: "B3"}, {Name: "speed", Range: "B4"},
+	}}
+	attributes := map[string]string{}
+	for i := 0; i < 50; i++ {
+		attributes[fmt.Sprintf("attr%d", i)] = strconv.Itoa(i)
+	}
+
+	requested := time.Date(2021, 10, 1, 19, 0, 0, 0, time.UTC)
+
+	// the same data, collected in different orders
+	encode := func(defaulted []string) []byte {
+		metadata := NewMetadata("/thorin", http.StatusOK, "")
+		metadata.DefaultedAttributes = configEntry.InConfigOrder(defaulted)
+		metadata.RequestTimestamp = &requested
+		w := httptest.NewRecorder()
+		WriteApiResponseJson(w, ApiResponse{Attributes: &attributes, Metadata: metadata})
+		return w.Body.Bytes()
+	}
+
+	first := encode([]string{"speed", "ac", "hp"})
+	second := encode([]string{"hp", "speed", "ac"})
+	if !bytes.Equal(first, second) {
+		t.Errorf("same response encoded differently:\n%s\n%s", first, second)
+	}
+}
+
+func TestSelectSingleValue(t *testing.T) {
+	values := [][]interface{}{{"Longsword", "Shield"}, {"Dagger"}}
+
+	tests := []struct {
+		name      string
+		attr      AttributeRow
+		values    [][]interface{}
+		want      string
+		wantFound bool
+		wantErr   bool
+	}{
+		{"one cell", AttributeRow{Name: "gear"}, [][]interface{}{{"Longsword"}}, "Longsword", true, false},
+		{"empty", AttributeRow{Name: "gear"}, [][]interface{}{{}}, "", false, false},
+		{"first by default", AttributeRow{Name: "gear"}, values, "Longsword", true, false},
+		{"first", AttributeRow{Name: "gear", MultiRow: MultiRowFirst}, values, "Longsword", true, false},
+		{"last", AttributeRow{Name: "gear", MultiRow: MultiRowLast}, values, "Dagger", true, false},
+		{"join", AttributeRow{Name: "gear", MultiRow: MultiRowJoin}, values, "Longsword, Shield, Dagger", true, false},
+		{"join with separator", AttributeRow{Name: "gear", MultiRow: MultiRowJoin, Separator: " / "}, values, "Longsword / Shield / Dagger", true, false},
+		{"error", AttributeRow{Name: "gear", MultiRow: MultiRowError}, values, "", false, true},
+		{"error with one cell", AttributeRow{Name: "gear", MultiRow: MultiRowError}, [][]interface{}{{"Longsword"}}, "Longsword", true, false},
+	}
+
+	for _, test := range tests {
+		got, found, err := SelectSingleValue(test.attr, test.values)
+		if got != test.want || found != test.wantFound || (err != nil) != test.wantErr {
+			t.Errorf("%s: SelectSingleValue = %q, %v, %v, want %q, %v, error %v",
+				test.name, got, found, err, test.want, test.wantFound, test.wantErr)
+		}
+	}
+}
+
+func TestEmptyValue(t *testing.T) {
+	attributes := []AttributeRow{
+		{Name: "hp", Range: "B2"},
+		{Name: "conditions", Range: "B3"},
+		{Range: "B4:C4", Names: []string{"str", "dex"}},
+		{Name: "ac", Range: "B5", Default: stringPointer("10")},
+	}
+
+	tests := []struct {
+		name           string
+		globalEmpty    *string
+		characterEmpty *string
+		want           map[string]string
+	}{
+		{"omitted", nil, nil, map[string]string{"hp": "12", "str": "16", "ac": "10"}},
+		{"global", stringPointer(""), nil, map[string]string{"hp": "12", "conditions": "", "str": "16", "dex": "", "ac": "10"}},
+		{"character overrides global", stringPointer(""), stringPointer("-"),
+			map[string]string{"hp": "12", "conditions": "-", "str": "16", "dex": "-", "ac": "10"}},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B4:C4": {{"16"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: attributes, EmptyValue: test.characterEmpty})
+		app.Config.EmptyValue = test.globalEmpty
+		app.PrimeCharacter("thorin")
+
+		response := getResponse(t, app, "/thorin")
+		if got := attributeMap(response); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: attributes = %v, want %v", test.name, got, test.want)
+		}
+		// defaults are still reported as such; empty values aren't
+		if want := []string{"ac"}; !reflect.DeepEqual(response.Metadata.DefaultedAttributes, want) {
+			t.Errorf("%s: defaultedAttributes = %v, want %v", test.name, response.Metadata.DefaultedAttributes, want)
+		}
+	}
+}
+
+func TestColdLookupsShareOneFetch(t *testing.T) {
+	tests := []struct {
+		name    string
+		lookups int
+		evicted bool
+	}{
+		{"single", 1, false},
+		{"burst", 20, false},
+		{"burst after eviction", 20, true},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		if test.evicted {
+			app.PrimeCharacter("thorin")
+			app.Cache.Evict("thorin")
+		}
+		fetchesBefore := len(fake.Requests())
+
+		// hold the fetch until every lookup is waiting on it
+		release := fake.Hold()
+		var lookups sync.WaitGroup
+		served := make(chan string, test.lookups)
+		for i := 0; i < test.lookups; i++ {
+			lookups.Add(1)
+			go func() {
+				defer lookups.Done()
+				entry, found := app.LookupCharacter(context.Background(), "thorin")
+				if found && entry.Attributes != nil {
+					served <- (*entry.Attributes)["hp"]
+				} else {
+					served <- ""
+				}
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		release()
+		lookups.Wait()
+		close(served)
+
+		if fetches := len(fake.Requests()) - fetchesBefore; fetches != 1 {
+			t.Errorf("%s: %d lookups made %d fetches, want 1", test.name, test.lookups, fetches)
+		}
+		for hp := range served {
+			if hp != "12" {
+				t.Errorf("%s: lookup served hp %q, want 12", test.name, hp)
+			}
+		}
+	}
+}
+
+func TestStaticAttributes(t *testing.T) {
+	decimals := 0
+	tests := []struct {
+		name       string
+		attributes []AttributeRow
+		wantRanges []string
+		want       map[string]string
+		wantRaw    map[string]string
+	}{
+		{
+			name: "mixed",
+			attributes: []AttributeRow{
+				{Name: "race", Value: stringPointer("Dwarf")},
+				{Name: "hp", Range: "B2"},
+				{Name: "gold", Value: stringPointer("1234.5"), Format: &AttributeFormat{Decimals: &decimals}},
+			},
+			wantRanges: []string{"B2"},
+			want:       map[string]string{"race": "Dwarf", "hp": "12", "gold": "1,234"},
+			wantRaw:    map[string]string{"race": "Dwarf", "hp": "12", "gold": "1234.5"},
+		},
+		{
+			name:       "static only",
+			attributes: []AttributeRow{{Name: "race", Value: stringPointer("Dwarf")}},
+			wantRanges: []string{},
+			want:       map[string]string{"race": "Dwarf"},
+			wantRaw:    map[string]string{"race": "Dwarf"},
+		},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: test.attributes})
+		app.PrimeCharacter("thorin")
+
+		ranges := []string{}
+		for _, request := range fake.Requests() {
+			ranges = append(ranges, request.Query["ranges"]...)
+		}
+		if !reflect.DeepEqual(ranges, test.wantRanges) {
+			t.Errorf("%s: fetched ranges %v, want %v", test.name, ranges, test.wantRanges)
+		}
+		if got := attributeMap(getResponse(t, app, "/thorin")); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: attributes = %v, want %v", test.name, got, test.want)
+		}
+		if got := attributeMap(getResponse(t, app, "/thorin?raw=true")); !reflect.DeepEqual(got, test.wantRaw) {
+			t.Errorf("%s: raw attributes = %v, want %v", test.name, got, test.wantRaw)
+		}
+	}
+}
+
+func TestFetchFailureBackoff(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.Config.OnErrorValue = stringPointer("?")
+
+	steps := []struct {
+		name         string
+		failStatus   int
+		wantFailures int
+		wantBackoff  time.Duration
+	}{
+		{"first failure", http.StatusInternalServerError, 1, defaultCacheTtl},
+		{"second failure", http.StatusInternalServerError, 2, 2 * defaultCacheTtl},
+		{"third failure", http.StatusInternalServerError, 3, 4 * defaultCacheTtl},
+		{"success", 0, 0, defaultCacheTtl},
+		{"failure after success", http.StatusInternalServerError, 1, defaultCacheTtl},
+	}
+
+	for _, step := range steps {
+		fake.Fail(step.failStatus)
+		before := time.Now()
+		app.PrimeCharacter("thorin")
+
+		entry, found := app.Cache.Get("thorin")
+		if !found {
+			t.Fatalf("%s: 'thorin' not cached", step.name)
+		}
+		if entry.ConsecutiveFailures != step.wantFailures {
+			t.Errorf("%s: consecutiveFailures = %d, want %d", step.name, entry.ConsecutiveFailures, step.wantFailures)
+		}
+		if backoff := entry.Expires.Sub(before); backoff < step.wantBackoff || backoff > step.wantBackoff+time.Second {
+			t.Errorf("%s: expires in %v, want %v", step.name, backoff, step.wantBackoff)
+		}
+	}
+}
+
+func TestCellNotes(t *testing.T) {
+	tests := []struct {
+		name       string
+		attr       AttributeRow
+		wantRanges []string
+		want       map[string]string
+	}{
+		{
+			name:       "value",
+			attr:       AttributeRow{Name: "sword", Range: "B2"},
+			wantRanges: []string{"B2"},
+			want:       map[string]string{"sword": "Orcrist"},
+		},
+		{
+			name:       "note in place of the value",
+			attr:       AttributeRow{Name: "sword", Range: "B2", Read: ReadNote},
+			wantRanges: []string{},
+			want:       map[string]string{"sword": "Goblin-cleaver"},
+		},
+		{
+			name:       "both",
+			attr:       AttributeRow{Name: "sword", Range: "B2", Read: ReadBoth, NoteName: "swordNote"},
+			wantRanges: []string{"B2"},
+			want:       map[string]string{"sword": "Orcrist", "swordNote": "Goblin-cleaver"},
+		},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"Orcrist"}}})
+		fake.notes = map[string]string{"B2": "Goblin-cleaver"}
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{test.attr}})
+		app.PrimeCharacter("thorin")
+
+		ranges := []string{}
+		for _, request := range fake.Requests() {
+			if request.Query.Get("fields") == "" {
+				ranges = append(ranges, request.Query["ranges"]...)
+			}
+		}
+		if !reflect.DeepEqual(ranges, test.wantRanges) {
+			t.Errorf("%s: value ranges %v, want %v", test.name, ranges, test.wantRanges)
+		}
+		if got := attributeMap(getResponse(t, app, "/thorin")); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: attributes = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
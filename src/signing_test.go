@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseSigning(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+	t.Cleanup(func() { ConfigureResponseSigning("") })
+
+	tests := []struct {
+		name       string
+		signingKey string
+		path       string
+	}{
+		{"unsigned", "", "/thorin"},
+		{"character", "s3cret", "/thorin"},
+		{"error", "s3cret", "/legolas"},
+	}
+
+	for _, test := range tests {
+		ConfigureResponseSigning(test.signingKey)
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		signature := w.Header().Get(signatureHeader)
+
+		if test.signingKey == "" {
+			if signature != "" {
+				t.Errorf("%s: signed without a signingKey: %q", test.name, signature)
+			}
+			continue
+		}
+
+		if !VerifyResponseSignature([]byte(test.signingKey), w.Body.Bytes(), signature) {
+			t.Errorf("%s: signature %q doesn't verify", test.name, signature)
+		}
+
+		// verify independently, the way a client would
+		mac := hmac.New(sha256.New, []byte(test.signingKey))
+		mac.Write(w.Body.Bytes())
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+			t.Errorf("%s: signature = %q, want %q", test.name, signature, want)
+		}
+
+		if VerifyResponseSignature([]byte("wrong"), w.Body.Bytes(), signature) {
+			t.Errorf("%s: signature verifies with the wrong key", test.name)
+		}
+		tampered := strings.Replace(w.Body.String(), `"statusCode"`, `"statuscode"`, 1)
+		if VerifyResponseSignature([]byte(test.signingKey), []byte(tampered), signature) {
+			t.Errorf("%s: signature verifies a tampered body", test.name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type SnapshotConfig struct {
+	// where the cache snapshot is written; snapshots are off when this is empty
+	Path string `json:"path"`
+
+	// how often the snapshot is rewritten; 0 only writes it on POST /admin/snapshot
+	IntervalSeconds int `json:"intervalSeconds"`
+}
+
+// SnapshotFile is the cache as written to disk, shaped so any web server can hand it out
+// while this service is down. Anyone can read it, so it has only what a request without an
+// access token would see: no private attributes, and no characters that require a token.
+type SnapshotFile struct {
+	Generated  time.Time                    `json:"generated"`
+	Characters map[string]map[string]string `json:"characters"`
+}
+
+func (app *CharacterSheetServiceApp) CacheSnapshotFile() SnapshotFile {
+	snapshot := SnapshotFile{
+		Generated:  time.Now(),
+		Characters: make(map[string]map[string]string, len(app.Characters())),
+	}
+
+	for charKey, charConfig := range app.Characters() {
+		if app.Config.TokenRequired(charConfig) {
+			continue
+		}
+		entry, found := app.Cache.Get(charKey)
+		if !found || entry.Attributes == nil {
+			continue
+		}
+		attributes := FilterAttributes(*entry.Attributes, charConfig.VisibleTo(PublicRole))
+		snapshot.Characters[charKey] = StyleAttributeKeys(app.Config.KeyStyle, attributes)
+	}
+
+	return snapshot
+}
+
+// WriteCacheSnapshot writes the snapshot to a temporary file beside path, then renames it
+// into place, so readers never see a half-written file.
+func (app *CharacterSheetServiceApp) WriteCacheSnapshot(path string) error {
+	snapshotJson, err := json.MarshalIndent(app.CacheSnapshotFile(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write(snapshotJson); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	// TempFile creates files only the owner can read
+	if err := os.Chmod(tempFile.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), path)
+}
+
+// WriteCacheSnapshots rewrites the snapshot file on an interval. It never returns.
+func (app *CharacterSheetServiceApp) WriteCacheSnapshots(path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := app.WriteCacheSnapshot(path); err != nil {
+			log.Printf("Unable to write cache snapshot to %s: %v", path, err)
+		}
+	}
+}
+
+func (app *CharacterSheetServiceApp) HandleAdminSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// Not POST - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use POST for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	path := app.Config.Snapshot.Path
+	if path == "" {
+		// Snapshots disabled - 404 Not Found error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusNotFound,
+				"Cache snapshots are disabled; set snapshot.path in config.json to enable them."),
+		})
+		return
+	}
+
+	if err := app.WriteCacheSnapshot(path); err != nil {
+		// Unable to write - 500 Internal Server Error
+		log.Printf("Unable to write cache snapshot to %s: %v", path, err)
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusInternalServerError,
+				fmt.Sprintf("Unable to write cache snapshot: %v", err)),
+		})
+		return
+	}
+	log.Printf("  * wrote cache snapshot to %s", path)
+
+	WriteApiResponseJson(w, ApiResponse{
+		Metadata: NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
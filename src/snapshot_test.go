@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHandleAdminSnapshot(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       bool
+		wantStatus int
+		want       map[string]map[string]string
+	}{
+		{
+			name:       "writes every primed character",
+			method:     http.MethodPost,
+			path:       true,
+			wantStatus: http.StatusOK,
+			want: map[string]map[string]string{
+				"thorin": {"hp": "12"},
+				"balin":  {"hp": "9"},
+			},
+		},
+		{name: "disabled", method: http.MethodPost, wantStatus: http.StatusNotFound},
+		{name: "GET", method: http.MethodGet, path: true, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "C2": {{"9"}}})
+		app := newTestApp(t, fake,
+			ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+			ConfigEntry{CharacterKey: "balin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "C2"}}},
+			ConfigEntry{CharacterKey: "dwalin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "D2"}}},
+		)
+		app.PrimeCharacter("thorin")
+		app.PrimeCharacter("balin")
+
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		if test.path {
+			app.Config.Snapshot.Path = path
+		}
+
+		w := httptest.NewRecorder()
+		app.HandleAdminSnapshot(w, httptest.NewRequest(test.method, "/admin/snapshot", nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if test.want == nil {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s: snapshot written when it shouldn't be (%v)", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: snapshot not written: %v", test.name, err)
+		}
+		var snapshot SnapshotFile
+		if err := json.Unmarshal(contents, &snapshot); err != nil {
+			t.Fatalf("%s: snapshot isn't JSON: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(snapshot.Characters, test.want) {
+			t.Errorf("%s: characters = %v, want %v", test.name, snapshot.Characters, test.want)
+		}
+		if snapshot.Generated.IsZero() {
+			t.Errorf("%s: snapshot has no generated time", test.name)
+		}
+	}
+}
+
+func TestCacheSnapshotFileIsPublic(t *testing.T) {
+	yes := true
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"Thorin"}}})
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+			{Name: "hp", Range: "B2", Private: true},
+			{Name: "name", Range: "B3"},
+		}},
+		ConfigEntry{CharacterKey: "balin", SheetId: "sheet", RequireAccessToken: &yes,
+			Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+	)
+	app.Config.AccessTokens = []AccessToken{{Token: "gm-secret", Role: "gm"}}
+	app.PrimeCharacter("thorin")
+	app.PrimeCharacter("balin")
+
+	want := map[string]map[string]string{"thorin": {"name": "Thorin"}}
+	if snapshot := app.CacheSnapshotFile(); !reflect.DeepEqual(snapshot.Characters, want) {
+		t.Errorf("characters = %v, want %v", snapshot.Characters, want)
+	}
+}
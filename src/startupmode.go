@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// refuse to start when the credentials can't be loaded, or are rejected while priming
+	StartupModeStrict = "strict"
+
+	// keep serving, with fetchFailed/fetchError in the metadata, so a supervisor doesn't
+	// crash-loop the service while the credentials are fixed
+	StartupModeDegraded = "degraded"
+)
+
+const (
+	FetchErrorAuth      = "auth"
+	FetchErrorTransient = "transient"
+)
+
+var errNoCredentials = errors.New("no usable Google credentials are loaded")
+
+func (config ServiceConfig) Degraded() bool {
+	return config.StartupMode == StartupModeDegraded
+}
+
+// IsAuthError tells credentials Google (or another source) rejected, which won't fix themselves,
+// apart from network trouble and outages, which usually will.
+func IsAuthError(err error) bool {
+	if errors.Is(err, errNoCredentials) || errors.Is(err, errTokenRejected) {
+		return true
+	}
+
+	var apiError *googleapi.Error
+	if !errors.As(err, &apiError) {
+		return false
+	}
+	switch apiError.Code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	case http.StatusBadRequest:
+		// an invalid API key is reported as a bad request
+		return strings.Contains(apiError.Message, "API key")
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsAuthError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no credentials", errNoCredentials, true},
+		{"wrapped no credentials", fmt.Errorf("fetching: %w", errNoCredentials), true},
+		{"unauthorized", &googleapi.Error{Code: http.StatusUnauthorized}, true},
+		{"forbidden", &googleapi.Error{Code: http.StatusForbidden}, true},
+		{"invalid api key", &googleapi.Error{Code: http.StatusBadRequest, Message: "API key not valid. Please pass a valid API key."}, true},
+		{"bad range", &googleapi.Error{Code: http.StatusBadRequest, Message: "Unable to parse range: Stats!ZZZ"}, false},
+		{"unavailable", &googleapi.Error{Code: http.StatusServiceUnavailable}, false},
+		{"network", errors.New("dial tcp: connection refused"), false},
+	}
+
+	for _, test := range tests {
+		if got := IsAuthError(test.err); got != test.want {
+			t.Errorf("%s: IsAuthError = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStartupModeDegraded(t *testing.T) {
+	tests := []struct {
+		name           string
+		failStatus     int
+		noCredentials  bool
+		wantFetchError string
+	}{
+		{"rejected credentials", http.StatusUnauthorized, false, FetchErrorAuth},
+		{"no credentials", 0, true, FetchErrorAuth},
+		{"outage", http.StatusServiceUnavailable, false, FetchErrorTransient},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.StartupMode = StartupModeDegraded
+		fake.Fail(test.failStatus)
+		if test.noCredentials {
+			app.SetSheetService(nil)
+		}
+		app.PrimeCharacter("thorin")
+
+		response := getResponse(t, app, "/thorin")
+		if response.Metadata.StatusCode != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", test.name, response.Metadata.StatusCode)
+		}
+		if !response.Metadata.FetchFailed || response.Metadata.FetchError != test.wantFetchError {
+			t.Errorf("%s: fetchFailed, fetchError = %v, %q, want true, %q",
+				test.name, response.Metadata.FetchFailed, response.Metadata.FetchError, test.wantFetchError)
+		}
+		if hp, found := attributeMap(response)["hp"]; !found || hp != "" {
+			t.Errorf("%s: hp = %q, %v, want it present and empty", test.name, hp, found)
+		}
+	}
+}
+
+// rejected credentials in strict mode stop the service at startup, so it's run in a child
+// process
+func TestStartupModeStrict(t *testing.T) {
+	if os.Getenv("SHEETSERVICE_STRICT_CHILD") == "1" {
+		fake := newFakeSheets(t, nil)
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+		app.Config.StartupMode = os.Getenv("STARTUP_MODE")
+		log.SetOutput(os.Stderr)
+		fake.Fail(http.StatusForbidden)
+		app.PrimeCharacter("thorin")
+		return
+	}
+
+	for _, startupMode := range []string{"", StartupModeStrict} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestStartupModeStrict$")
+		cmd.Env = append(os.Environ(), "SHEETSERVICE_STRICT_CHILD=1", "STARTUP_MODE="+startupMode)
+		output, err := cmd.CombinedOutput()
+
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) {
+			t.Fatalf("startupMode %q: service kept running after an auth failure (%v)", startupMode, err)
+		}
+		if !strings.Contains(string(output), "Google rejected the credentials") {
+			t.Errorf("startupMode %q: output doesn't mention the rejected credentials: %s", startupMode, output)
+		}
+	}
+}
+
+// a sheet that can't be read for other reasons doesn't stop the service, even in strict mode
+func TestStartupModeStrictOutage(t *testing.T) {
+	captureLog(t)
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.Config.StartupMode = StartupModeStrict
+	fake.Fail(http.StatusServiceUnavailable)
+	app.PrimeCharacter("thorin")
+
+	response := getResponse(t, app, "/thorin")
+	if !response.Metadata.FetchFailed || response.Metadata.FetchError != FetchErrorTransient {
+		t.Errorf("fetchFailed, fetchError = %v, %q, want true, %q",
+			response.Metadata.FetchFailed, response.Metadata.FetchError, FetchErrorTransient)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ServiceStats counts what the service has been doing since it started, for /stats and
+// /metrics.
+type ServiceStats struct {
+	started      time.Time
+	requests     int64
+	sheetsCalls  int64
+	sheetsErrors int64
+	sheetsNanos  int64
+
+	sheetsRetries          int64
+	sheetsRetriesExhausted int64
+
+	lock        sync.Mutex
+	hits        map[string]int64
+	misses      map[string]int64
+	stale       map[string]int64
+	lastRefresh map[string]time.Time
+
+	// keyed by character, which is "" for requests that aren't for one
+	responses    map[responseKey]int64
+	requestNanos map[string]int64
+	requestCount map[string]int64
+
+	fetchErrors map[fetchErrorKey]int64
+
+	lastSheetsError   string
+	lastSheetsErrorAt time.Time
+}
+
+type responseKey struct {
+	charKey string
+	status  int
+}
+
+type fetchErrorKey struct {
+	charKey string
+	kind    string
+}
+
+type CharacterStats struct {
+	Hits        int64      `json:"hits"`
+	Misses      int64      `json:"misses"`
+	Stale       int64      `json:"stale"`
+	LastRefresh *time.Time `json:"lastRefresh,omitempty"`
+}
+
+type StatsSnapshot struct {
+	Started       time.Time `json:"started"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+	Requests      int64     `json:"requests"`
+	SheetsCalls   int64     `json:"sheetsCalls"`
+	SheetsErrors  int64     `json:"sheetsErrors"`
+
+	// retried Sheets API calls, and calls that still failed after the last attempt
+	SheetsRetries          int64 `json:"sheetsRetries"`
+	SheetsRetriesExhausted int64 `json:"sheetsRetriesExhausted"`
+
+	LastSheetsError   string     `json:"lastSheetsError,omitempty"`
+	LastSheetsErrorAt *time.Time `json:"lastSheetsErrorAt,omitempty"`
+
+	Characters map[string]CharacterStats `json:"characters"`
+}
+
+func NewServiceStats() *ServiceStats {
+	return &ServiceStats{
+		started:      time.Now(),
+		hits:         map[string]int64{},
+		misses:       map[string]int64{},
+		stale:        map[string]int64{},
+		lastRefresh:  map[string]time.Time{},
+		responses:    map[responseKey]int64{},
+		requestNanos: map[string]int64{},
+		requestCount: map[string]int64{},
+		fetchErrors:  map[fetchErrorKey]int64{},
+	}
+}
+
+func (stats *ServiceStats) CountRequest() {
+	atomic.AddInt64(&stats.requests, 1)
+}
+
+// RecordSheetsCall counts a call to the Sheets API, given when it started and how it ended.
+func (stats *ServiceStats) RecordSheetsCall(started time.Time, err error) {
+	atomic.AddInt64(&stats.sheetsCalls, 1)
+	atomic.AddInt64(&stats.sheetsNanos, int64(time.Since(started)))
+	if err != nil {
+		atomic.AddInt64(&stats.sheetsErrors, 1)
+
+		stats.lock.Lock()
+		stats.lastSheetsError = err.Error()
+		stats.lastSheetsErrorAt = time.Now()
+		stats.lock.Unlock()
+	}
+}
+
+func (stats *ServiceStats) CountSheetsRetry() {
+	atomic.AddInt64(&stats.sheetsRetries, 1)
+}
+
+func (stats *ServiceStats) CountSheetsRetriesExhausted() {
+	atomic.AddInt64(&stats.sheetsRetriesExhausted, 1)
+}
+
+func (stats *ServiceStats) CountLookup(charKey string, hit bool) {
+	stats.lock.Lock()
+	if hit {
+		stats.hits[charKey]++
+	} else {
+		stats.misses[charKey]++
+	}
+	stats.lock.Unlock()
+}
+
+// CountStale counts a lookup served from an expired entry while it's refreshed.
+func (stats *ServiceStats) CountStale(charKey string) {
+	stats.lock.Lock()
+	stats.stale[charKey]++
+	stats.lock.Unlock()
+}
+
+func (stats *ServiceStats) RecordResponse(charKey string, status int, latency time.Duration) {
+	stats.lock.Lock()
+	stats.responses[responseKey{charKey, status}]++
+	stats.requestNanos[charKey] += int64(latency)
+	stats.requestCount[charKey]++
+	stats.lock.Unlock()
+}
+
+func (stats *ServiceStats) CountFetchError(charKey string, kind string) {
+	stats.lock.Lock()
+	stats.fetchErrors[fetchErrorKey{charKey, kind}]++
+	stats.lock.Unlock()
+}
+
+func (stats *ServiceStats) RecordRefresh(charKey string, at time.Time) {
+	stats.lock.Lock()
+	stats.lastRefresh[charKey] = at
+	stats.lock.Unlock()
+}
+
+// Snapshot reports every configured character, including ones nobody has asked for yet.
+func (stats *ServiceStats) Snapshot(charKeys []string) StatsSnapshot {
+	now := time.Now()
+	snapshot := StatsSnapshot{
+		Started:       stats.started,
+		UptimeSeconds: int64(now.Sub(stats.started).Seconds()),
+		Requests:      atomic.LoadInt64(&stats.requests),
+		SheetsCalls:   atomic.LoadInt64(&stats.sheetsCalls),
+		SheetsErrors:  atomic.LoadInt64(&stats.sheetsErrors),
+
+		SheetsRetries:          atomic.LoadInt64(&stats.sheetsRetries),
+		SheetsRetriesExhausted: atomic.LoadInt64(&stats.sheetsRetriesExhausted),
+
+		Characters: make(map[string]CharacterStats, len(charKeys)),
+	}
+
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	if stats.lastSheetsError != "" {
+		lastSheetsErrorAt := stats.lastSheetsErrorAt
+		snapshot.LastSheetsError = stats.lastSheetsError
+		snapshot.LastSheetsErrorAt = &lastSheetsErrorAt
+	}
+
+	for _, charKey := range charKeys {
+		characterStats := CharacterStats{
+			Hits:   stats.hits[charKey],
+			Misses: stats.misses[charKey],
+			Stale:  stats.stale[charKey],
+		}
+		if lastRefresh, found := stats.lastRefresh[charKey]; found {
+			characterStats.LastRefresh = &lastRefresh
+		}
+		snapshot.Characters[charKey] = characterStats
+	}
+
+	return snapshot
+}
+
+func (app *CharacterSheetServiceApp) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		// Not GET - 405 Method Not Allowed error
+		WriteApiResponseJson(w, ApiResponse{
+			Metadata: NewMetadata(r.URL.Path, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method '%s' not allowed; you must use GET for this endpoint.", r.Method)),
+		})
+		return
+	}
+
+	snapshot := app.Stats.Snapshot(app.PrimingOrder())
+	WriteApiResponseJson(w, ApiResponse{
+		Stats:    &snapshot,
+		Metadata: NewMetadata(r.URL.Path, http.StatusOK, ""),
+	})
+}
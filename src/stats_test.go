@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleStats(t *testing.T) {
+	attributes := []AttributeRow{{Name: "hp", Range: "B2"}}
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "thorin-sheet", Attributes: attributes},
+		ConfigEntry{CharacterKey: "balin", SheetId: "balin-sheet", Attributes: attributes},
+		ConfigEntry{CharacterKey: "gimli", SheetId: "gimli-sheet", Attributes: attributes})
+	app.PrimeCharacter("thorin")
+	app.PrimeCharacter("balin")
+	app.Cache.Set("gimli", &CharacterAttributeCacheEntry{})
+
+	for _, path := range []string{"/thorin", "/thorin", "/balin", "/gimli", "/smaug"} {
+		getResponse(t, app, path)
+	}
+	app.WaitForRefreshes(5 * time.Second)
+
+	w := httptest.NewRecorder()
+	app.HandleStats(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var response ApiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+	stats := response.Stats
+
+	if stats.Requests != 5 {
+		t.Errorf("requests = %d, want 5", stats.Requests)
+	}
+	// two primes, plus the refresh the unprimed gimli triggered
+	if stats.SheetsCalls != 3 {
+		t.Errorf("sheetsCalls = %d, want 3", stats.SheetsCalls)
+	}
+
+	tests := []struct {
+		charKey     string
+		wantHits    int64
+		wantMisses  int64
+		wantRefresh bool
+	}{
+		{"thorin", 2, 0, true},
+		{"balin", 1, 0, true},
+		{"gimli", 0, 1, true},
+	}
+	for _, test := range tests {
+		characterStats, found := stats.Characters[test.charKey]
+		if !found {
+			t.Errorf("%s: not in stats", test.charKey)
+			continue
+		}
+		if characterStats.Hits != test.wantHits || characterStats.Misses != test.wantMisses {
+			t.Errorf("%s: hits, misses = %d, %d, want %d, %d",
+				test.charKey, characterStats.Hits, characterStats.Misses, test.wantHits, test.wantMisses)
+		}
+		if (characterStats.LastRefresh != nil) != test.wantRefresh {
+			t.Errorf("%s: lastRefresh = %v, want refreshed %v", test.charKey, characterStats.LastRefresh, test.wantRefresh)
+		}
+	}
+	// unknown paths aren't tracked
+	if _, found := stats.Characters["smaug"]; found {
+		t.Errorf("unconfigured character in stats")
+	}
+}
+
+func TestHandleStatsMethod(t *testing.T) {
+	app := newTestApp(t, newFakeSheets(t, nil))
+	w := httptest.NewRecorder()
+	app.HandleStats(w, httptest.NewRequest(http.MethodPost, "/stats", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 405", w.Code)
+	}
+}
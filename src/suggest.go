@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	defaultSuggestionDistance = 3
+	maxSuggestions            = 3
+)
+
+// SuggestCharacterKeys returns up to maxSuggestions configured keys within maxDistance
+// edits of the requested key, closest first.
+func SuggestCharacterKeys(requested string, characterKeys []string, maxDistance int) []string {
+	if maxDistance <= 0 || requested == "" {
+		return nil
+	}
+
+	distances := map[string]int{}
+	suggestions := []string{}
+	for _, charKey := range characterKeys {
+		distance := LevenshteinDistance(strings.ToLower(requested), strings.ToLower(charKey))
+		if distance <= maxDistance {
+			distances[charKey] = distance
+			suggestions = append(suggestions, charKey)
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+
+	return suggestions
+}
+
+func LevenshteinDistance(a string, b string) int {
+	aRunes, bRunes := []rune(a), []rune(b)
+
+	previous := make([]int, len(bRunes)+1)
+	current := make([]int, len(bRunes)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(aRunes); i++ {
+		current[0] = i
+		for j := 1; j <= len(bRunes); j++ {
+			cost := 1
+			if aRunes[i-1] == bRunes[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(bRunes)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSuggestCharacterKeys(t *testing.T) {
+	characterKeys := []string{"thorin", "balin", "dwalin", "gandalf"}
+
+	tests := []struct {
+		name        string
+		requested   string
+		maxDistance int
+		want        []string
+	}{
+		{"near miss", "thorn", 3, []string{"thorin"}},
+		{"case insensitive", "THORIN", 3, []string{"thorin"}},
+		{"closest first", "balim", 3, []string{"balin", "dwalin"}},
+		{"unrelated", "smaug", 3, []string{}},
+		{"suggestions off", "thorn", -1, nil},
+		{"empty key", "", 3, nil},
+	}
+
+	for _, test := range tests {
+		got := SuggestCharacterKeys(test.requested, characterKeys, test.maxDistance)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: SuggestCharacterKeys(%q) = %v, want %v", test.name, test.requested, got, test.want)
+		}
+	}
+}
+
+func TestLevenshteinDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"thorin", "thorin", 0},
+		{"thorin", "thorn", 1},
+		{"kitten", "sitting", 3},
+		{"", "balin", 5},
+		{"éowyn", "eowyn", 1},
+	}
+
+	for _, test := range tests {
+		if got := LevenshteinDistance(test.a, test.b); got != test.want {
+			t.Errorf("LevenshteinDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestHandleRequestSuggestions(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/thorn", []string{"/thorin"}},
+		{"/smaug", nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.path, err)
+		}
+		if response.Metadata.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", test.path, response.Metadata.StatusCode)
+		}
+		if !reflect.DeepEqual(response.Suggestions, test.want) {
+			t.Errorf("%s: suggestions = %v, want %v", test.path, response.Suggestions, test.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AttributeThreshold labels a band of numeric values; Min is inclusive, Max is exclusive,
+// and either may be left out to leave that end of the band open.
+type AttributeThreshold struct {
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	State string   `json:"state"`
+}
+
+func (threshold AttributeThreshold) Contains(value float64) bool {
+	if threshold.Min != nil && value < *threshold.Min {
+		return false
+	}
+	if threshold.Max != nil && value >= *threshold.Max {
+		return false
+	}
+	return true
+}
+
+func ParseNumericValue(value string) (float64, bool) {
+	number, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", ""), 64)
+	return number, err == nil
+}
+
+// ResolveAttributeStates returns the state label of the first matching threshold for each
+// attribute that has thresholds configured. Non-numeric values have no state.
+func ResolveAttributeStates(charConfig ConfigEntry, charAttributes map[string]string) map[string]string {
+	states := map[string]string{}
+
+	for _, attr := range charConfig.Attributes {
+		if len(attr.Thresholds) == 0 {
+			continue
+		}
+
+		value, ok := ParseNumericValue(attr.Format.TrimAffixes(charAttributes[attr.Name]))
+		if !ok {
+			continue
+		}
+
+		// thresholds may be expressed as a percentage of another attribute, e.g. hp of hpMax
+		if attr.ThresholdPercentOf != "" {
+			total, ok := ParseNumericValue(charAttributes[attr.ThresholdPercentOf])
+			if !ok || total == 0 {
+				continue
+			}
+			value = value / total * 100
+		}
+
+		for _, threshold := range attr.Thresholds {
+			if threshold.Contains(value) {
+				states[attr.Name] = threshold.State
+				break
+			}
+		}
+	}
+
+	return states
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func TestResolveAttributeStates(t *testing.T) {
+	hpBands := []AttributeThreshold{
+		{Max: float(25), State: "critical"},
+		{Min: float(25), Max: float(50), State: "bloodied"},
+		{Min: float(50), State: "healthy"},
+	}
+	charConfig := ConfigEntry{
+		CharacterKey: "thorin",
+		Attributes: []AttributeRow{
+			{Name: "hp", Range: "B2", Thresholds: hpBands, ThresholdPercentOf: "hpMax"},
+			{Name: "hpMax", Range: "B3"},
+			{Name: "gold", Range: "B4", Thresholds: []AttributeThreshold{{Min: float(1000), State: "rich"}}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		attributes map[string]string
+		want       map[string]string
+	}{
+		{"critical band", map[string]string{"hp": "9", "hpMax": "40", "gold": "10"}, map[string]string{"hp": "critical"}},
+		{"band minimum is inclusive", map[string]string{"hp": "10", "hpMax": "40"}, map[string]string{"hp": "bloodied"}},
+		{"upper band", map[string]string{"hp": "40", "hpMax": "40"}, map[string]string{"hp": "healthy"}},
+		{"thousands separator", map[string]string{"gold": "1,250"}, map[string]string{"gold": "rich"}},
+		{"no band matches", map[string]string{"gold": "999"}, map[string]string{}},
+		{"non-numeric value", map[string]string{"hp": "dead", "hpMax": "40"}, map[string]string{}},
+		{"non-numeric total", map[string]string{"hp": "10", "hpMax": "?"}, map[string]string{}},
+		{"zero total", map[string]string{"hp": "10", "hpMax": "0"}, map[string]string{}},
+	}
+
+	for _, test := range tests {
+		if got := ResolveAttributeStates(charConfig, test.attributes); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: states = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	spanExporter     = tracetest.NewInMemoryExporter()
+	spanExporterOnce sync.Once
+)
+
+// recordSpans installs a provider exporting to spanExporter. The global tracer only ever
+// delegates to the first provider installed, so it's shared by every test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	spanExporterOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+	})
+	spanExporter.Reset()
+	return spanExporter
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracingSpans(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.FetchCharacterAttributes(context.Background(), "thorin")
+	exporter := recordSpans(t)
+
+	tests := []struct {
+		path       string
+		wantStatus int64
+		wantHit    bool
+	}{
+		{"/thorin", http.StatusOK, true},
+		{"/gimli", http.StatusNotFound, false},
+	}
+
+	for _, test := range tests {
+		exporter.Reset()
+		handler := TracingMiddleware(http.HandlerFunc(app.HandleRequest))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 || spans[0].Name != "HTTP GET" {
+			t.Fatalf("%s: spans = %v, want one HTTP GET span", test.path, spans)
+		}
+		if status, _ := spanAttribute(spans[0], "http.status_code"); status.AsInt64() != test.wantStatus {
+			t.Errorf("%s: http.status_code = %v, want %d", test.path, status.AsInt64(), test.wantStatus)
+		}
+		if hit, _ := spanAttribute(spans[0], "cache.hit"); hit.AsBool() != test.wantHit {
+			t.Errorf("%s: cache.hit = %v, want %v", test.path, hit.AsBool(), test.wantHit)
+		}
+	}
+
+	// a fetch made for a request is a child of the request's span
+	exporter.Reset()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	app.FetchCharacterAttributes(ctx, "thorin")
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "Sheets BatchGet" {
+		t.Fatalf("spans = %v, want Sheets BatchGet then request", spans)
+	}
+	if spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Sheets BatchGet isn't a child of the request span")
+	}
+	if key, _ := spanAttribute(spans[0], "character.key"); key.AsString() != "thorin" {
+		t.Errorf("character.key = %q, want thorin", key.AsString())
+	}
+	if count, _ := spanAttribute(spans[0], "sheets.range_count"); count.AsInt64() != 1 {
+		t.Errorf("sheets.range_count = %d, want 1", count.AsInt64())
+	}
+}
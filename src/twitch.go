@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Twitch bot sits in a channel's chat and answers commands from the cache, the same
+// way the HTTP endpoints do:
+//
+//	!sheet thorin   every public attribute of thorin
+//	!hp thorin      thorin's hp
+//
+// The character can be left out when only one is configured. Only what the public role may
+// see is ever posted, and unknown commands are ignored, since other bots share the prefix.
+
+const (
+	defaultTwitchServer          = "ircs://irc.chat.twitch.tv:6697"
+	defaultTwitchCommandPrefix   = "!"
+	defaultTwitchCooldownSeconds = 5
+
+	twitchSheetCommand = "sheet"
+
+	// Twitch drops chat messages longer than this
+	twitchMessageLimit = 500
+
+	twitchMaxReconnectDelay = 5 * time.Minute
+)
+
+type TwitchConfig struct {
+	// the channel to join, without the #; the bot is off when this is empty
+	Channel string `json:"channel"`
+
+	// the bot's account, and a chat OAuth token for it ("oauth:..." with chat:read and
+	// chat:edit scopes)
+	Username   string `json:"username"`
+	OAuthToken string `json:"oauthToken"`
+
+	// defaults to "!"
+	CommandPrefix string `json:"commandPrefix"`
+
+	// how long the same command for the same character is ignored after being answered;
+	// defaults to 5
+	CooldownSeconds int `json:"cooldownSeconds"`
+
+	// defaults to ircs://irc.chat.twitch.tv:6697; irc:// connects without TLS
+	Server string `json:"server"`
+}
+
+func (config TwitchConfig) Enabled() bool {
+	return config.Channel != ""
+}
+
+func (config TwitchConfig) Validate() error {
+	if !config.Enabled() {
+		return nil
+	}
+	if config.Username == "" || config.OAuthToken == "" {
+		return fmt.Errorf("twitch needs a username and oauthToken to join #%s", config.Channel)
+	}
+	if config.CooldownSeconds < 0 {
+		return fmt.Errorf("twitch cooldownSeconds can't be negative")
+	}
+	if _, _, err := config.ServerAddress(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ServerAddress splits Server into a host:port and whether to connect with TLS.
+func (config TwitchConfig) ServerAddress() (address string, useTls bool, err error) {
+	server := config.Server
+	if server == "" {
+		server = defaultTwitchServer
+	}
+	parsed, err := url.Parse(server)
+	if err != nil || (parsed.Scheme != "irc" && parsed.Scheme != "ircs") || parsed.Port() == "" {
+		return "", false, fmt.Errorf("twitch server '%s' must be irc://host:port or ircs://host:port", server)
+	}
+	return parsed.Host, parsed.Scheme == "ircs", nil
+}
+
+// TwitchMessage is a chat message the bot has read.
+type TwitchMessage struct {
+	User string
+	Text string
+}
+
+// ParseTwitchLine reads an IRC line into its command, and for PRIVMSG the message. Tags
+// (@...) are skipped.
+func ParseTwitchLine(line string) (command string, params string, message TwitchMessage) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") {
+		i := strings.Index(line, " ")
+		if i < 0 {
+			return "", "", message
+		}
+		line = line[i+1:]
+	}
+
+	prefix := ""
+	if strings.HasPrefix(line, ":") {
+		parts := strings.SplitN(line[1:], " ", 2)
+		prefix = parts[0]
+		if len(parts) < 2 {
+			return "", "", message
+		}
+		line = parts[1]
+	}
+
+	parts := strings.SplitN(line, " ", 2)
+	command = parts[0]
+	if len(parts) > 1 {
+		params = parts[1]
+	}
+
+	if command == "PRIVMSG" {
+		message.User = strings.SplitN(prefix, "!", 2)[0]
+		if i := strings.Index(params, " :"); i >= 0 {
+			message.Text = params[i+2:]
+		}
+	}
+	return command, params, message
+}
+
+// TwitchBot answers chat commands for the characters of app.
+type TwitchBot struct {
+	app    *CharacterSheetServiceApp
+	config TwitchConfig
+
+	// command + character -> when it was last answered
+	answered     map[string]time.Time
+	answeredLock sync.Mutex
+}
+
+func (app *CharacterSheetServiceApp) NewTwitchBot(config TwitchConfig) *TwitchBot {
+	return &TwitchBot{app: app, config: config, answered: map[string]time.Time{}}
+}
+
+// Run keeps the bot connected until ctx is cancelled, reconnecting with a growing delay
+// when the connection drops.
+func (bot *TwitchBot) Run(ctx context.Context) {
+	delay := time.Second
+	for {
+		joined, err := bot.serve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if joined {
+			delay = time.Second
+		}
+		log.Printf("WARNING: twitch chat disconnected: %v; reconnecting in %v", err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > twitchMaxReconnectDelay {
+			delay = twitchMaxReconnectDelay
+		}
+	}
+}
+
+// serve runs one connection to chat, until it fails or ctx is cancelled. joined tells
+// whether it got as far as logging in.
+func (bot *TwitchBot) serve(ctx context.Context) (joined bool, err error) {
+	address, useTls, _ := bot.config.ServerAddress()
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if useTls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// closing the connection is the only way to interrupt the blocking read below
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var writeLock sync.Mutex
+	send := func(line string) error {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		_, err := fmt.Fprintf(conn, "%s\r\n", line)
+		return err
+	}
+
+	token := bot.config.OAuthToken
+	if !strings.HasPrefix(token, "oauth:") {
+		token = "oauth:" + token
+	}
+	channel := "#" + strings.ToLower(strings.TrimPrefix(bot.config.Channel, "#"))
+	for _, line := range []string{"PASS " + token, "NICK " + strings.ToLower(bot.config.Username), "JOIN " + channel} {
+		if err := send(line); err != nil {
+			return false, err
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return joined, err
+		}
+
+		command, params, message := ParseTwitchLine(line)
+		switch command {
+		case "PING":
+			send("PONG " + params)
+		case "001":
+			joined = true
+		case "NOTICE":
+			// a bad token is reported as a notice before the server hangs up
+			log.Printf("  * twitch chat: %s", params)
+		case "JOIN":
+			log.Printf("-- twitch chat: joined %s", channel)
+		case "PRIVMSG":
+			if reply := bot.Answer(ctx, message.Text); reply != "" {
+				log.Printf("--- twitch: %s asked '%s'", message.User, message.Text)
+				send(fmt.Sprintf("PRIVMSG %s :@%s %s", channel, message.User, reply))
+			}
+		}
+	}
+}
+
+// Answer returns the reply to a chat message, or "" when it isn't a command the bot knows
+// or was answered too recently.
+func (bot *TwitchBot) Answer(ctx context.Context, text string) string {
+	prefix := bot.config.CommandPrefix
+	if prefix == "" {
+		prefix = defaultTwitchCommandPrefix
+	}
+	if !strings.HasPrefix(text, prefix) {
+		return ""
+	}
+	fields := strings.Fields(strings.TrimPrefix(text, prefix))
+	if len(fields) == 0 {
+		return ""
+	}
+	command := strings.ToLower(fields[0])
+	characterName := ""
+	if len(fields) > 1 {
+		characterName = fields[1]
+	}
+
+	charKey, known := bot.app.FindChatCharacter(characterName)
+	if command != twitchSheetCommand && !bot.app.IsPublicAttribute(command, charKey) {
+		return ""
+	}
+	if !bot.takeCooldown(command + " " + charKey) {
+		return ""
+	}
+	if !known {
+		return bot.app.UnknownCharacterReply(characterName)
+	}
+
+	if command == twitchSheetCommand {
+		command = ""
+	}
+	return bot.app.ChatReply(ctx, charKey, command, twitchMessageLimit)
+}
+
+func (bot *TwitchBot) takeCooldown(key string) bool {
+	cooldown := bot.config.CooldownSeconds
+	if cooldown == 0 {
+		cooldown = defaultTwitchCooldownSeconds
+	}
+
+	bot.answeredLock.Lock()
+	defer bot.answeredLock.Unlock()
+	if last, found := bot.answered[key]; found && time.Since(last) < time.Duration(cooldown)*time.Second {
+		return false
+	}
+	bot.answered[key] = time.Now()
+	return true
+}
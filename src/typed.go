@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// IsTyped tells int, float and bool attributes, which are served as JSON numbers and
+// booleans rather than strings.
+func (attr AttributeRow) IsTyped() bool {
+	return attr.Type == AttributeTypeInt || attr.Type == AttributeTypeFloat || attr.Type == AttributeTypeBool
+}
+
+// ValueTypes maps the character's attributes that aren't served as plain strings (lists,
+// tables, ints, floats and bools) to their types.
+func (configEntry ConfigEntry) ValueTypes() map[string]string {
+	types := map[string]string{}
+	for _, attr := range configEntry.Attributes {
+		if attr.IsArray() || attr.IsTyped() {
+			for _, name := range attr.AttributeNames() {
+				types[name] = attr.Type
+			}
+		}
+	}
+	return types
+}
+
+// TypedValue is what's served for an attribute of the given type. Typed values that can't
+// be read as their type, such as empty cells, are served as null; ?raw=true shows what
+// was in the cell.
+func TypedValue(attrType string, value string) interface{} {
+	switch attrType {
+	case AttributeTypeList, AttributeTypeTable:
+		return DecodeArrayValue(value)
+	case AttributeTypeInt:
+		if number, ok := ParseTypedNumber(value); ok {
+			return int64(math.Round(number))
+		}
+		return nil
+	case AttributeTypeFloat:
+		if number, ok := ParseTypedNumber(value); ok {
+			return number
+		}
+		return nil
+	case AttributeTypeBool:
+		if boolean, ok := ParseTypedBool(value); ok {
+			return boolean
+		}
+		return nil
+	}
+	return value
+}
+
+// CanonicalTypedValue rewrites a typed attribute's cell the way its JSON value will be
+// written, e.g. "1,234" as 1234 and "TRUE" as true, so every format serves the same thing.
+// Cells that can't be read as the type are left as they are.
+func CanonicalTypedValue(attr AttributeRow, raw string) string {
+	switch attr.Type {
+	case AttributeTypeInt:
+		if number, ok := ParseTypedNumber(raw); ok {
+			return strconv.FormatInt(int64(math.Round(number)), 10)
+		}
+	case AttributeTypeFloat:
+		if number, ok := ParseTypedNumber(raw); ok {
+			if attr.Format != nil && attr.Format.Decimals != nil {
+				scale := math.Pow(10, float64(*attr.Format.Decimals))
+				number = math.Round(number*scale) / scale
+			}
+			return strconv.FormatFloat(number, 'f', -1, 64)
+		}
+	case AttributeTypeBool:
+		if boolean, ok := ParseTypedBool(raw); ok {
+			return strconv.FormatBool(boolean)
+		}
+	}
+	return raw
+}
+
+// ParseTypedNumber reads a number as Google Sheets formats it: with thousands separators
+// (commas, periods, spaces or apostrophes, depending on the sheet's locale), a leading + or
+// a trailing %. A single comma followed by anything but three digits is a decimal comma.
+func ParseTypedNumber(value string) (float64, bool) {
+	text := strings.TrimSpace(value)
+	text = strings.TrimSuffix(text, "%")
+	text = strings.ReplaceAll(text, "\u2212", "-") // minus sign
+	text = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "", "\u2019", "").Replace(text)
+
+	lastComma, lastPeriod := strings.LastIndex(text, ","), strings.LastIndex(text, ".")
+	switch {
+	case lastComma >= 0 && lastPeriod >= 0:
+		// whichever comes last is the decimal mark
+		if lastComma > lastPeriod {
+			text = strings.ReplaceAll(text, ".", "")
+			text = strings.Replace(text, ",", ".", 1)
+		} else {
+			text = strings.ReplaceAll(text, ",", "")
+		}
+	case lastComma >= 0:
+		if strings.Count(text, ",") == 1 && len(text)-lastComma-1 != 3 {
+			text = strings.Replace(text, ",", ".", 1)
+		} else {
+			text = strings.ReplaceAll(text, ",", "")
+		}
+	}
+
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
+
+// ParseTypedBool reads checkboxes (TRUE/FALSE) and the usual spellings of yes and no.
+func ParseTypedBool(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "t", "yes", "y", "on", "1", "x", "\u2713", "\u2714":
+		return true, true
+	case "false", "f", "no", "n", "off", "0":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTypedNumber(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   float64
+		wantOk bool
+	}{
+		{"12", 12, true},
+		{" -3.5 ", -3.5, true},
+		{"+7", 7, true},
+		{"−4", -4, true},
+		{"50%", 50, true},
+		{"1,234", 1234, true},
+		{"1,234,567", 1234567, true},
+		{"1,234.56", 1234.56, true},
+		{"1.234,56", 1234.56, true},
+		{"1 234,5", 1234.5, true},
+		{"1 234", 1234, true},
+		{"1'234.5", 1234.5, true},
+		// a lone comma not followed by three digits is a decimal comma
+		{"3,5", 3.5, true},
+		{"", 0, false},
+		{"twelve", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := ParseTypedNumber(test.value)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("ParseTypedNumber(%q) = %v, %v, want %v, %v", test.value, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestParseTypedBool(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   bool
+		wantOk bool
+	}{
+		{"TRUE", true, true},
+		{"FALSE", false, true},
+		{" Yes ", true, true},
+		{"n", false, true},
+		{"1", true, true},
+		{"0", false, true},
+		{"✓", true, true},
+		{"", false, false},
+		{"maybe", false, false},
+	}
+
+	for _, test := range tests {
+		got, ok := ParseTypedBool(test.value)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("ParseTypedBool(%q) = %v, %v, want %v, %v", test.value, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestTypedValue(t *testing.T) {
+	tests := []struct {
+		attrType string
+		value    string
+		want     interface{}
+	}{
+		{AttributeTypeInt, "12", int64(12)},
+		{AttributeTypeInt, "2.5", int64(3)},
+		{AttributeTypeFloat, "2.5", 2.5},
+		{AttributeTypeBool, "true", true},
+		{AttributeTypeBool, "false", false},
+		// what can't be read as the type is null
+		{AttributeTypeInt, "", nil},
+		{AttributeTypeFloat, "n/a", nil},
+		{AttributeTypeBool, "maybe", nil},
+		{"", "12", "12"},
+	}
+
+	for _, test := range tests {
+		if got := TypedValue(test.attrType, test.value); got != test.want {
+			t.Errorf("TypedValue(%q, %q) = %#v, want %#v", test.attrType, test.value, got, test.want)
+		}
+	}
+}
+
+func TestCanonicalTypedValue(t *testing.T) {
+	decimals := 1
+	tests := []struct {
+		attr AttributeRow
+		raw  string
+		want string
+	}{
+		{AttributeRow{Type: AttributeTypeInt}, "1,234", "1234"},
+		{AttributeRow{Type: AttributeTypeInt}, "2.5", "3"},
+		{AttributeRow{Type: AttributeTypeFloat}, "1.234,50", "1234.5"},
+		{AttributeRow{Type: AttributeTypeFloat, Format: &AttributeFormat{Decimals: &decimals}}, "3.14159", "3.1"},
+		{AttributeRow{Type: AttributeTypeBool}, "TRUE", "true"},
+		{AttributeRow{Type: AttributeTypeBool}, "no", "false"},
+		// left as they are
+		{AttributeRow{Type: AttributeTypeInt}, "n/a", "n/a"},
+		{AttributeRow{Type: AttributeTypeBool}, "", ""},
+		{AttributeRow{}, "1,234", "1,234"},
+	}
+
+	for _, test := range tests {
+		if got := CanonicalTypedValue(test.attr, test.raw); got != test.want {
+			t.Errorf("CanonicalTypedValue(%q, %q) = %q, want %q", test.attr.Type, test.raw, got, test.want)
+		}
+	}
+}
+
+func TestTypedAttributes(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{
+		"B2": {{"1,234"}},
+		"B3": {{"12.5%"}},
+		"B4": {{"TRUE"}},
+		"B5": {{"n/a"}},
+		"B6": {{"12"}},
+	})
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+		{Name: "xp", Range: "B2", Type: AttributeTypeInt},
+		{Name: "crit", Range: "B3", Type: AttributeTypeFloat},
+		{Name: "inspired", Range: "B4", Type: AttributeTypeBool},
+		{Name: "ac", Range: "B5", Type: AttributeTypeInt},
+		{Name: "hp", Range: "B6"},
+	}})
+	app.PrimeCharacter("thorin")
+
+	// every format serves the same JSON values
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/thorin", `{"ac":null,"crit":12.5,"hp":"12","inspired":true,"xp":1234}`},
+		{"/thorin?format=array", `[{"name":"xp","value":1234},{"name":"crit","value":12.5},` +
+			`{"name":"inspired","value":true},{"name":"ac","value":null},{"name":"hp","value":"12"}]`},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		app.HandleRequest(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		var response struct {
+			Attributes json.RawMessage `json:"attributes"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.path, err)
+		}
+		var compact bytes.Buffer
+		json.Compact(&compact, response.Attributes)
+		if compact.String() != test.want {
+			t.Errorf("%s: attributes = %s, want %s", test.path, compact.String(), test.want)
+		}
+	}
+
+	// the text served is the same as the JSON value
+	w := httptest.NewRecorder()
+	app.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/thorin/attr/xp?format=text", nil))
+	if body := w.Body.String(); body != "1234" {
+		t.Errorf("xp as text = %q, want 1234", body)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookConfig is a URL that's POSTed an AttributeChange whenever a refresh finds that
+// an attribute's value changed. Requests are signed like responses when a signingKey is
+// configured.
+type WebhookConfig struct {
+	Url string `json:"url"`
+
+	// only changes to these characters and attributes are sent; all of them when left out.
+	// Attributes are named as they're served, in the keyStyle.
+	Characters []string `json:"characters,omitempty"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+type AttributeChange struct {
+	CharacterKey string `json:"characterKey"`
+	Attribute    string `json:"attribute"`
+	OldValue     string `json:"oldValue"`
+	NewValue     string `json:"newValue"`
+}
+
+func (webhook WebhookConfig) Validate() error {
+	parsed, err := url.Parse(webhook.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook url '%s' must be an http or https URL", webhook.Url)
+	}
+	return nil
+}
+
+func (webhook WebhookConfig) Wants(change AttributeChange) bool {
+	return matchesAny(webhook.Characters, change.CharacterKey) && matchesAny(webhook.Attributes, change.Attribute)
+}
+
+func matchesAny(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, candidate := range allowed {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// AttributeChanges lists what differs between two sets of attributes, by name. Attributes
+// that appeared or went away have an empty old or new value.
+func AttributeChanges(charKey string, previous map[string]string, current map[string]string) []AttributeChange {
+	names := []string{}
+	for name, value := range current {
+		if oldValue, found := previous[name]; !found || oldValue != value {
+			names = append(names, name)
+		}
+	}
+	for name := range previous {
+		if _, found := current[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := make([]AttributeChange, len(names))
+	for i, name := range names {
+		changes[i] = AttributeChange{
+			CharacterKey: charKey,
+			Attribute:    name,
+			OldValue:     previous[name],
+			NewValue:     current[name],
+		}
+	}
+	return changes
+}
+
+// PublicChanges keeps the changes anyone could see without an access token: none for
+// characters that require one, and otherwise those to attributes the public role may see.
+// Attribute names are put in the key style.
+func (app *CharacterSheetServiceApp) PublicChanges(changes []AttributeChange) []AttributeChange {
+	characters := app.Characters()
+	public := []AttributeChange{}
+	for _, change := range changes {
+		charConfig, configured := characters[change.CharacterKey]
+		if !configured || app.Config.TokenRequired(charConfig) {
+			continue
+		}
+		if visible := charConfig.VisibleTo(PublicRole); visible != nil && !visible[change.Attribute] {
+			continue
+		}
+		change.Attribute = ApplyKeyStyle(app.Config.KeyStyle, change.Attribute)
+		public = append(public, change)
+	}
+	return public
+}
+
+// SendWebhooks posts the public changes to every webhook that wants them, in the background
+// so a slow receiver doesn't hold up the refresh.
+func (app *CharacterSheetServiceApp) SendWebhooks(changes []AttributeChange) {
+	public := app.PublicChanges(changes)
+	for _, webhook := range app.Config.Webhooks {
+		wanted := []AttributeChange{}
+		for _, change := range public {
+			if webhook.Wants(change) {
+				wanted = append(wanted, change)
+			}
+		}
+		if len(wanted) == 0 {
+			continue
+		}
+
+		go func(webhook WebhookConfig) {
+			for _, change := range wanted {
+				if err := PostWebhook(webhook.Url, change); err != nil {
+					log.Printf("WARNING: webhook for '%s' %s failed: %v", change.CharacterKey, change.Attribute, err)
+				}
+			}
+		}(webhook)
+	}
+}
+
+func PostWebhook(webhookUrl string, change AttributeChange) error {
+	body, _ := json.Marshal(change)
+	req, err := http.NewRequest(http.MethodPost, webhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if responseSigningKey != nil {
+		req.Header.Set(signatureHeader, SignResponseBody(responseSigningKey, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", webhookUrl, resp.Status)
+	}
+	return nil
+}
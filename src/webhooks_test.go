@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublicChanges(t *testing.T) {
+	yes := true
+	changes := []AttributeChange{
+		{CharacterKey: "thorin", Attribute: "Hit Points", OldValue: "12", NewValue: "7"},
+		{CharacterKey: "thorin", Attribute: "secret", OldValue: "", NewValue: "cursed"},
+		{CharacterKey: "thorin", Attribute: "notes", OldValue: "", NewValue: "hiding"},
+		{CharacterKey: "balin", Attribute: "Hit Points", OldValue: "9", NewValue: "4"},
+		{CharacterKey: "smaug", Attribute: "Hit Points", OldValue: "900", NewValue: "0"},
+	}
+
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake,
+		ConfigEntry{
+			CharacterKey: "thorin",
+			Attributes: []AttributeRow{
+				{Name: "Hit Points", Range: "B2"},
+				{Name: "secret", Range: "B3", Private: true},
+				{Name: "notes", Range: "B4"},
+			},
+			Visibility: map[string][]string{"player": {"notes"}},
+		},
+		ConfigEntry{CharacterKey: "balin", Attributes: []AttributeRow{{Name: "Hit Points", Range: "C2"}},
+			RequireAccessToken: &yes, AccessTokens: []AccessToken{{Token: "gm-secret", Role: "gm"}}},
+	)
+	app.Config.KeyStyle = KeyStyleCamel
+
+	want := []AttributeChange{
+		{CharacterKey: "thorin", Attribute: "hitPoints", OldValue: "12", NewValue: "7"},
+		{CharacterKey: "thorin", Attribute: "notes", OldValue: "", NewValue: "hiding"},
+	}
+	if got := app.PublicChanges(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("PublicChanges = %v, want %v", got, want)
+	}
+}
+
+func TestSendWebhooksMatchesStyledNames(t *testing.T) {
+	var lock sync.Mutex
+	received := []string{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var change AttributeChange
+		json.NewDecoder(r.Body).Decode(&change)
+		lock.Lock()
+		received = append(received, r.URL.Path+" "+change.Attribute)
+		lock.Unlock()
+	}))
+	defer receiver.Close()
+
+	fake := newFakeSheets(t, nil)
+	app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", Attributes: []AttributeRow{
+		{Name: "Hit Points", Range: "B2"}, {Name: "Gold", Range: "B3"},
+	}})
+	app.Config.KeyStyle = KeyStyleSnake
+	app.Config.Webhooks = []WebhookConfig{
+		{Url: receiver.URL + "/styled", Attributes: []string{"hit_points"}},
+		{Url: receiver.URL + "/configured", Attributes: []string{"Hit Points"}},
+		{Url: receiver.URL + "/all"},
+	}
+
+	app.SendWebhooks([]AttributeChange{
+		{CharacterKey: "thorin", Attribute: "Hit Points", OldValue: "12", NewValue: "7"},
+		{CharacterKey: "thorin", Attribute: "Gold", OldValue: "30", NewValue: "40"},
+	})
+
+	want := []string{"/all gold", "/all hit_points", "/styled hit_points"}
+	waitFor(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(received) >= len(want)
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	sort.Strings(received)
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("received %v, want %v", received, want)
+	}
+}
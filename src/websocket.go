@@ -0,0 +1,244 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+type WebSocketRequest struct {
+	Action     string   `json:"action"`
+	Characters []string `json:"characters"`
+}
+
+type WebSocketUpdate struct {
+	CharacterKey string `json:"characterKey"`
+	// rendered as the JSON endpoint renders them: typed values, and ?format=array
+	Attributes interface{}       `json:"attributes,omitempty"`
+	States     map[string]string `json:"states,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	// set on /ws/{characterKey} updates after the first, which only carry the attributes
+	// and states that changed, plus the names of attributes that are gone
+	Delta   bool     `json:"delta,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+
+	// the visible attributes before rendering, and how they were rendered, for deltas
+	attributes map[string]string
+	format     string
+}
+
+// WebSocketServer skips the Origin check done by websocket.Handler, matching the CORS
+// policy of the JSON endpoint.
+func (app *CharacterSheetServiceApp) WebSocketServer() websocket.Server {
+	return websocket.Server{Handler: app.HandleWebSocket, Handshake: app.CheckWebSocketOrigin}
+}
+
+// HandleWebSocket lets a client subscribe to several characters over one connection, by
+// sending {"action": "subscribe", "characters": [...]} (or "unsubscribe"). The current
+// attributes are pushed on subscribe, and again whenever they change.
+func (app *CharacterSheetServiceApp) HandleWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	remote := ws.Request().RemoteAddr
+	log.Printf("--- websocket: %s connected", remote)
+
+	updates := make(chan string, 16)
+	done := make(chan struct{})
+
+	go app.readWebSocketRequests(ws, updates, done)
+
+	for {
+		select {
+		case charKey := <-updates:
+			if err := websocket.JSON.Send(ws, app.NewWebSocketUpdate(ws.Request(), charKey)); err != nil {
+				log.Printf("--- websocket: %s write failed: %v", remote, err)
+				return
+			}
+		case <-done:
+			log.Printf("--- websocket: %s disconnected", remote)
+			return
+		}
+	}
+}
+
+func (app *CharacterSheetServiceApp) CharacterWebSocketServer() websocket.Server {
+	return websocket.Server{Handler: app.HandleCharacterWebSocket, Handshake: app.CheckWebSocketOrigin}
+}
+
+// HandleCharacterWebSocket streams a single character, named by the path of
+// /ws/{characterKey}. The first message has all of its attributes; after that, a delta
+// is pushed whenever a refresh changes any of them.
+func (app *CharacterSheetServiceApp) HandleCharacterWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	remote := ws.Request().RemoteAddr
+	charKey := strings.TrimPrefix(ws.Request().URL.Path, "/ws/")
+	if _, configured := app.Characters()[charKey]; !configured {
+		websocket.JSON.Send(ws, WebSocketUpdate{CharacterKey: charKey, Error: "unknown character"})
+		return
+	}
+	log.Printf("--- websocket: %s connected to '%s'", remote, charKey)
+
+	changed := app.Notifier.Subscribe(charKey)
+	defer app.Notifier.Unsubscribe(charKey, changed)
+
+	// nothing is expected from the client, but reading is how a disconnect is noticed
+	done := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, ws)
+		close(done)
+	}()
+
+	var last *WebSocketUpdate
+	for {
+		update := app.NewWebSocketUpdate(ws.Request(), charKey)
+		send := update
+		if last != nil && last.Error == "" && update.Error == "" {
+			send = app.WebSocketDelta(*last, update)
+		}
+		last = &update
+
+		if !send.Delta || send.Attributes != nil || send.States != nil || len(send.Removed) > 0 {
+			if err := websocket.JSON.Send(ws, send); err != nil {
+				log.Printf("--- websocket: %s write failed: %v", remote, err)
+				return
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-done:
+			log.Printf("--- websocket: %s disconnected from '%s'", remote, charKey)
+			return
+		}
+	}
+}
+
+// WebSocketDelta trims an update down to what differs from the one sent before it.
+func (app *CharacterSheetServiceApp) WebSocketDelta(previous WebSocketUpdate, update WebSocketUpdate) WebSocketUpdate {
+	delta := WebSocketUpdate{CharacterKey: update.CharacterKey, Delta: true}
+
+	changedAttributes := map[string]string{}
+	for name, value := range update.attributes {
+		if previousValue, found := previous.attributes[name]; !found || previousValue != value {
+			changedAttributes[name] = value
+		}
+	}
+	for name := range previous.attributes {
+		if _, found := update.attributes[name]; !found {
+			delta.Removed = append(delta.Removed, ApplyKeyStyle(app.Config.KeyStyle, name))
+		}
+	}
+	if len(changedAttributes) > 0 {
+		delta.Attributes = app.RenderAttributes(update.CharacterKey, changedAttributes, update.format)
+	}
+
+	if !AttributesEqual(previous.States, update.States) {
+		delta.States = update.States
+	}
+	return delta
+}
+
+// NewWebSocketUpdate builds the update pushed for a character, as seen by the role of the
+// token on the connecting request, in the ?format= it asked for.
+func (app *CharacterSheetServiceApp) NewWebSocketUpdate(r *http.Request, charKey string) WebSocketUpdate {
+	update := WebSocketUpdate{CharacterKey: charKey, format: r.URL.Query().Get("format")}
+
+	if app.InMaintenance() {
+		update.Error = app.Config.Maintenance.MaintenanceMessage()
+		return update
+	}
+
+	role, ok := app.CharacterRole(r, charKey)
+	if !ok {
+		update.Error = strings.ToLower(strings.TrimSuffix(AccessDeniedMessage(r), "."))
+		return update
+	}
+
+	entry, found := app.LookupCharacter(r.Context(), charKey)
+	if !found || entry.Attributes == nil {
+		update.Error = "character is still being loaded"
+		return update
+	}
+
+	visible := app.Characters()[charKey].VisibleTo(role)
+
+	update.attributes = FilterAttributes(*entry.Attributes, visible)
+	update.Attributes = app.RenderAttributes(charKey, update.attributes, update.format)
+	states := ResolveAttributeStates(app.Characters()[charKey], *entry.Attributes)
+	update.States = StyleAttributeKeys(app.Config.KeyStyle, FilterAttributes(states, visible))
+	return update
+}
+
+// readWebSocketRequests owns the connection's subscriptions, and cleans them up once the
+// client goes away.
+func (app *CharacterSheetServiceApp) readWebSocketRequests(ws *websocket.Conn, updates chan string, done chan struct{}) {
+	subscriptions := map[string]chan struct{}{}
+	stops := map[string]chan struct{}{}
+
+	unsubscribe := func(charKey string) {
+		if changed, subscribed := subscriptions[charKey]; subscribed {
+			app.Notifier.Unsubscribe(charKey, changed)
+			close(stops[charKey])
+			delete(subscriptions, charKey)
+			delete(stops, charKey)
+		}
+	}
+
+	defer func() {
+		for charKey := range subscriptions {
+			unsubscribe(charKey)
+		}
+		close(done)
+	}()
+
+	for {
+		var request WebSocketRequest
+		if err := websocket.JSON.Receive(ws, &request); err != nil {
+			return
+		}
+
+		for _, charKey := range request.Characters {
+			switch request.Action {
+			case "subscribe":
+				if _, configured := app.Characters()[charKey]; !configured {
+					continue
+				}
+				if _, subscribed := subscriptions[charKey]; !subscribed {
+					changed := app.Notifier.Subscribe(charKey)
+					stop := make(chan struct{})
+					subscriptions[charKey] = changed
+					stops[charKey] = stop
+					go forwardChanges(charKey, changed, stop, updates)
+				}
+				// send the current attributes straight away, including on resubscribe
+				select {
+				case updates <- charKey:
+				case <-stops[charKey]:
+				}
+			case "unsubscribe":
+				unsubscribe(charKey)
+			}
+		}
+	}
+}
+
+func forwardChanges(charKey string, changed chan struct{}, stop chan struct{}, updates chan string) {
+	for {
+		select {
+		case <-changed:
+			select {
+			case updates <- charKey:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
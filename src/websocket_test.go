@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// dialTestWebSocket connects to the app's websocket endpoint on a test server.
+func dialTestWebSocket(t *testing.T, app *CharacterSheetServiceApp) *websocket.Conn {
+	server := httptest.NewServer(app.WebSocketServer())
+	t.Cleanup(server.Close)
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", "", server.URL)
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func receiveUpdate(t *testing.T, ws *websocket.Conn) WebSocketUpdate {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var update WebSocketUpdate
+	if err := websocket.JSON.Receive(ws, &update); err != nil {
+		t.Fatalf("no update received: %v", err)
+	}
+	return update
+}
+
+// updateValue is an attribute of an update received as JSON.
+func updateValue(update WebSocketUpdate, name string) interface{} {
+	attributes, _ := update.Attributes.(map[string]interface{})
+	return attributes[name]
+}
+
+func TestWebSocketSubscription(t *testing.T) {
+	fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}})
+	app := newTestApp(t, fake,
+		ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}},
+		ConfigEntry{CharacterKey: "gimli", SheetId: "sheet", Attributes: []AttributeRow{{Name: "hp", Range: "B2"}}})
+	app.PrimeCharacter("thorin")
+	app.PrimeCharacter("gimli")
+	ws := dialTestWebSocket(t, app)
+
+	// unknown characters are ignored
+	websocket.JSON.Send(ws, WebSocketRequest{Action: "subscribe", Characters: []string{"legolas", "thorin"}})
+	update := receiveUpdate(t, ws)
+	if update.CharacterKey != "thorin" || updateValue(update, "hp") != "12" {
+		t.Fatalf("first update = %+v, want thorin's current hp 12", update)
+	}
+
+	waitFor(t, func() bool { return app.Notifier.subscriberCount("thorin") == 1 })
+	app.UpdateCachedEntry("gimli", NewCachedEntry(&map[string]string{"hp": "30"}, defaultCacheTtl))
+	app.UpdateCachedEntry("thorin", NewCachedEntry(&map[string]string{"hp": "7"}, defaultCacheTtl))
+	update = receiveUpdate(t, ws)
+	if update.CharacterKey != "thorin" || updateValue(update, "hp") != "7" {
+		t.Errorf("update after the cache changed = %+v, want thorin's hp 7", update)
+	}
+
+	websocket.JSON.Send(ws, WebSocketRequest{Action: "unsubscribe", Characters: []string{"thorin"}})
+	waitFor(t, func() bool { return app.Notifier.subscriberCount("thorin") == 0 })
+
+	// subscriptions end with the connection
+	websocket.JSON.Send(ws, WebSocketRequest{Action: "subscribe", Characters: []string{"gimli"}})
+	if update := receiveUpdate(t, ws); update.CharacterKey != "gimli" {
+		t.Fatalf("update = %+v, want gimli's", update)
+	}
+	ws.Close()
+	waitFor(t, func() bool { return app.Notifier.subscriberCount("gimli") == 0 })
+}
+
+func TestWebSocketUpdateRendering(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyStyle  string
+		format    string
+		want      string
+		wantDelta string
+	}{
+		{"typed", "", "", `{"characterKey":"thorin","attributes":{"Hit Points":12,"Name":"Thorin"}}`,
+			`{"characterKey":"thorin","attributes":{"Hit Points":7},"delta":true,"removed":["Name"]}`},
+		{"array", "", "array", `{"characterKey":"thorin","attributes":[{"name":"Hit Points","value":12},{"name":"Name","value":"Thorin"}]}`,
+			`{"characterKey":"thorin","attributes":[{"name":"Hit Points","value":7}],"delta":true,"removed":["Name"]}`},
+		{"key style", "snake", "", `{"characterKey":"thorin","attributes":{"hit_points":12,"name":"Thorin"}}`,
+			`{"characterKey":"thorin","attributes":{"hit_points":7},"delta":true,"removed":["name"]}`},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"Thorin"}}})
+		app := newTestApp(t, fake, ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+			{Name: "Hit Points", Range: "B2", Type: AttributeTypeInt},
+			{Name: "Name", Range: "B3"},
+		}})
+		app.Config.KeyStyle = test.keyStyle
+		app.PrimeCharacter("thorin")
+
+		r := httptest.NewRequest(http.MethodGet, "/ws/thorin?format="+test.format, nil)
+		update := app.NewWebSocketUpdate(r, "thorin")
+		if encoded, _ := json.Marshal(update); string(encoded) != test.want {
+			t.Errorf("%s: update = %s, want %s", test.name, encoded, test.want)
+		}
+
+		app.UpdateCachedEntry("thorin", NewCachedEntry(&map[string]string{"Hit Points": "7"}, defaultCacheTtl))
+		delta := app.WebSocketDelta(update, app.NewWebSocketUpdate(r, "thorin"))
+		if encoded, _ := json.Marshal(delta); string(encoded) != test.wantDelta {
+			t.Errorf("%s: delta = %s, want %s", test.name, encoded, test.wantDelta)
+		}
+	}
+}
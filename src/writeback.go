@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// how long a write waits for the character to be fetched again before responding
+const writeBackRefreshTimeout = 10 * time.Second
+
+// WritableAttribute finds the attribute an update names, as configured or in the key
+// style. Only single-value attributes read from the sheet can be written; the value goes
+// in the top-left cell of the range.
+func (configEntry ConfigEntry) WritableAttribute(name string, keyStyle string) (AttributeRow, bool) {
+	for _, attr := range configEntry.SheetAttributes() {
+		if configEntry.AttributeSource(attr) != SourceSheet || len(attr.Names) > 0 || attr.IsArray() || (attr.Read != "" && attr.Read != ReadValue) {
+			continue
+		}
+		if attr.Name == name || ApplyKeyStyle(keyStyle, attr.Name) == name {
+			return attr, true
+		}
+	}
+	return AttributeRow{}, false
+}
+
+// HandleWriteBack takes a JSON object of attribute name -> value, POSTed or PATCHed to
+// /<charKey>, and writes the values to the sheet as if typed in. The character is then
+// fetched again, and its new attributes are returned.
+func (app *CharacterSheetServiceApp) HandleWriteBack(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+	charKey := strings.Trim(requestPath, "/")
+
+	charConfig, ok := app.WritableCharacter(w, r, charKey)
+	if !ok {
+		return
+	}
+
+	var updates map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil || len(updates) == 0 {
+		// Unreadable body - 400 Bad Request error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+				"The body must be a JSON object of attribute names to string values."),
+		})
+		return
+	}
+
+	data := []*sheets.ValueRange{}
+	for name, value := range updates {
+		attr, writable := charConfig.WritableAttribute(name, app.Config.KeyStyle)
+		if !writable {
+			// Unknown or read-only attribute - 400 Bad Request error
+			app.WriteApiResponse(w, r, ApiResponse{
+				Metadata: NewMetadata(requestPath, http.StatusBadRequest,
+					fmt.Sprintf("Attribute '%s' doesn't exist, or can't be written.", name)),
+			})
+			return
+		}
+		data = append(data, &sheets.ValueRange{Range: attr.Range, Values: [][]interface{}{{value}}})
+	}
+
+	// don't land in the middle of an adjustment's read and write
+	unlock := app.LockCharacterWrites(charKey)
+	defer unlock()
+
+	app.WriteAndRespond(w, r, charKey, charConfig, data)
+}
+
+// WritableCharacter finds the character a write is for, responding with an error when
+// writes are off or the character can't be written to.
+func (app *CharacterSheetServiceApp) WritableCharacter(w http.ResponseWriter, r *http.Request, charKey string) (ConfigEntry, bool) {
+	requestPath := r.URL.Path
+
+	if !app.Config.WriteBack || app.DemoAttributes != nil {
+		// Write-back off - 405 Method Not Allowed error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusMethodNotAllowed,
+				"Writing to sheets is disabled; set writeBack in config.json to enable it."),
+		})
+		return ConfigEntry{}, false
+	}
+
+	charConfig, configured := app.Characters()[charKey]
+	if !configured {
+		// Result not found - 404 Not Found error
+		app.WriteApiResponse(w, r, ApiResponse{
+			CharacterUrls: app.ValidUrls(),
+			Metadata: NewMetadata(requestPath, http.StatusNotFound,
+				fmt.Sprintf("No character '%s' found; see list of valid character paths in the payload.", charKey)),
+		})
+		return ConfigEntry{}, false
+	}
+
+	if !charConfig.HasSource(SourceSheet) {
+		// Not a Google Sheet - 409 Conflict error
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusConflict,
+				fmt.Sprintf("Character '%s' isn't read from a Google Sheet, so can't be written to.", charKey)),
+		})
+		return ConfigEntry{}, false
+	}
+	return charConfig, true
+}
+
+// WriteAndRespond writes the ranges to the character's sheet, then fetches the character
+// again and responds with its new attributes.
+func (app *CharacterSheetServiceApp) WriteAndRespond(w http.ResponseWriter, r *http.Request, charKey string, charConfig ConfigEntry, data []*sheets.ValueRange) {
+	requestPath := r.URL.Path
+
+	if err := app.WriteValueRanges(r.Context(), charConfig.SheetId, data); err != nil {
+		// Sheets rejected the write - 502 Bad Gateway error
+		log.Printf("Unable to write to sheet for '%s': %v", charKey, err)
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusBadGateway,
+				fmt.Sprintf("Unable to write to the sheet: %v", err)),
+		})
+		return
+	}
+	log.Printf("***** wrote %d attributes for '%s'; fetching update *****", len(data), charKey)
+
+	// the cached values are out of date now; read them back, rather than trusting what
+	// was written, so formulas that depend on the written cells are picked up too
+	app.Cache.Evict(charKey)
+	ctx, cancel := context.WithTimeout(r.Context(), writeBackRefreshTimeout)
+	defer cancel()
+	entry, found := app.LookupCharacter(ctx, charKey)
+	if !found || entry.Attributes == nil {
+		// Written, but not read back yet - 202 Accepted
+		app.WriteApiResponse(w, r, ApiResponse{
+			Metadata: NewMetadata(requestPath, http.StatusAccepted, ""),
+		})
+		return
+	}
+
+	// writes need the admin secret, so every attribute is shown
+	app.WriteApiResponse(w, r, ApiResponse{
+		Attributes: app.RenderAttributes(charKey, *entry.Attributes, ""),
+		Metadata:   NewMetadata(requestPath, http.StatusOK, ""),
+	})
+}
+
+func (app *CharacterSheetServiceApp) WriteValueRanges(ctx context.Context, sheetId string, data []*sheets.ValueRange) error {
+	sheetService := app.SheetService()
+	if sheetService == nil {
+		return errNoCredentials
+	}
+
+	started := time.Now()
+	_, err := sheetService.Spreadsheets.Values.BatchUpdate(sheetId, &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "USER_ENTERED",
+		Data:             data,
+	}).Context(ctx).Do()
+	app.Stats.RecordSheetsCall(started, err)
+	return err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWritableAttribute(t *testing.T) {
+	charConfig := ConfigEntry{
+		CharacterKey: "thorin",
+		SheetId:      "sheet",
+		File:         "thorin.json",
+		Sources:      []string{SourceSheet, SourceFile},
+		Attributes: []AttributeRow{
+			{Name: "Hit Points", Range: "B2"},
+			{Name: "inventory", Range: "B3:B9", Type: AttributeTypeList},
+			{Name: "spells", Range: "C3:D9", Type: AttributeTypeTable},
+			{Name: "race", Value: stringPointer("Dwarf")},
+			{Name: "sword", Range: "B10", Read: ReadNote},
+			{Names: []string{"str", "dex"}, Range: "E2:E3"},
+			{Name: "gold", Source: SourceFile},
+		},
+		Derived: []DerivedAttribute{{Name: "percent", Expression: "{Hit Points} * 2"}},
+	}
+
+	tests := []struct {
+		name      string
+		attribute string
+		keyStyle  string
+		wantRange string
+	}{
+		{"as configured", "Hit Points", "", "B2"},
+		{"in the key style", "hit_points", KeyStyleSnake, "B2"},
+		{"in another key style", "hitPoints", KeyStyleSnake, ""},
+		{"list", "inventory", "", ""},
+		{"table", "spells", "", ""},
+		{"static", "race", "", ""},
+		{"note", "sword", "", ""},
+		{"one of several names", "str", "", ""},
+		{"derived", "percent", "", ""},
+		{"from another source", "gold", "", ""},
+		{"unknown", "mana", "", ""},
+	}
+
+	for _, test := range tests {
+		attr, writable := charConfig.WritableAttribute(test.attribute, test.keyStyle)
+		if writable != (test.wantRange != "") || attr.Range != test.wantRange {
+			t.Errorf("%s: WritableAttribute(%q) = %q, %v, want %q", test.name, test.attribute, attr.Range, writable, test.wantRange)
+		}
+	}
+}
+
+func TestHandleWriteBack(t *testing.T) {
+	tests := []struct {
+		name       string
+		writeBack  bool
+		path       string
+		body       string
+		wantStatus int
+		wantWrites map[string]string
+		wantHp     string
+	}{
+		{"written", true, "/thorin", `{"hp": "7"}`, http.StatusOK, map[string]string{"B2": "7"}, "7"},
+		{"in the key style", true, "/thorin", `{"max_hp": "40"}`, http.StatusOK, map[string]string{"B3": "40"}, "12"},
+		{"write-back off", false, "/thorin", `{"hp": "7"}`, http.StatusMethodNotAllowed, nil, ""},
+		{"unknown character", true, "/smaug", `{"hp": "7"}`, http.StatusNotFound, nil, ""},
+		{"not a sheet", true, "/gimli", `{"hp": "7"}`, http.StatusConflict, nil, ""},
+		{"read-only attribute", true, "/thorin", `{"hp": "7", "race": "Elf"}`, http.StatusBadRequest, nil, ""},
+		{"unknown attribute", true, "/thorin", `{"mana": "7"}`, http.StatusBadRequest, nil, ""},
+		{"not an object", true, "/thorin", `["7"]`, http.StatusBadRequest, nil, ""},
+		{"empty", true, "/thorin", `{}`, http.StatusBadRequest, nil, ""},
+	}
+
+	for _, test := range tests {
+		fake := newFakeSheets(t, map[string][][]interface{}{"B2": {{"12"}}, "B3": {{"30"}}})
+		app := newTestApp(t, fake,
+			ConfigEntry{CharacterKey: "thorin", SheetId: "sheet", Attributes: []AttributeRow{
+				{Name: "hp", Range: "B2"},
+				{Name: "Max HP", Range: "B3"},
+				{Name: "race", Value: stringPointer("Dwarf")},
+			}},
+			ConfigEntry{CharacterKey: "gimli", File: "gimli.json", Attributes: []AttributeRow{{Name: "hp"}}},
+		)
+		app.Config.KeyStyle = KeyStyleSnake
+		app.Config.WriteBack = test.writeBack
+		app.PrimeCharacter("thorin")
+
+		w := httptest.NewRecorder()
+		app.HandleWriteBack(w, httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body)))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+
+		writes := map[string]string{}
+		for _, valueRange := range fake.Writes() {
+			writes[valueRange.Range] = valueRange.Values[0][0].(string)
+		}
+		if len(writes) == 0 {
+			writes = nil
+		}
+		if !reflect.DeepEqual(writes, test.wantWrites) {
+			t.Errorf("%s: writes = %v, want %v", test.name, writes, test.wantWrites)
+		}
+
+		if test.wantHp == "" {
+			continue
+		}
+		var response ApiResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", test.name, err)
+		}
+		// the response is read back from the sheet
+		if hp := attributeMap(response)["hp"]; hp != test.wantHp {
+			t.Errorf("%s: hp = %q, want %q", test.name, hp, test.wantHp)
+		}
+	}
+}